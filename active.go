@@ -0,0 +1,56 @@
+package ops
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	trackingActive int32
+	activeOps      = make(map[string]*op)
+	activeMutex    sync.RWMutex
+)
+
+// TrackActive makes the Op that's active on the current goroutine available
+// through Active. This lets code that has no reference to an Op, like a
+// logging library's error hook, attach information to it. Ops begun before the
+// first call to TrackActive are not tracked.
+func TrackActive() {
+	atomic.StoreInt32(&trackingActive, 1)
+}
+
+// Active returns the innermost Op that's active on the current goroutine
+// (including goroutines started with Go), or false if there is none or
+// TrackActive hasn't been called.
+func Active() (Op, bool) {
+	if atomic.LoadInt32(&trackingActive) == 0 {
+		return nil, false
+	}
+	id, _ := cm.AsMap(nil, false)["op_id"].(string)
+	if id == "" {
+		return nil, false
+	}
+	activeMutex.RLock()
+	o := activeOps[id]
+	activeMutex.RUnlock()
+	if o == nil {
+		return nil, false
+	}
+	return o, true
+}
+
+func (o *op) trackActive() {
+	if atomic.LoadInt32(&trackingActive) == 1 {
+		activeMutex.Lock()
+		activeOps[o.id] = o
+		activeMutex.Unlock()
+	}
+}
+
+func (o *op) untrackActive() {
+	if atomic.LoadInt32(&trackingActive) == 1 {
+		activeMutex.Lock()
+		delete(activeOps, o.id)
+		activeMutex.Unlock()
+	}
+}
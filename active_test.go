@@ -0,0 +1,37 @@
+package ops_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActive(t *testing.T) {
+	ops.TrackActive()
+	_, ok := ops.Active()
+	assert.False(t, ok, "no op should be active")
+
+	outer := ops.Begin("active_outer")
+	inner := outer.Begin("active_inner")
+	active, ok := ops.Active()
+	if assert.True(t, ok) {
+		assert.Equal(t, inner.ID(), active.ID())
+	}
+
+	done := make(chan string)
+	inner.Go(func() {
+		active, _ := ops.Active()
+		done <- active.ID()
+	})
+	assert.Equal(t, inner.ID(), <-done, "goroutines should see the op that started them")
+
+	inner.End()
+	active, ok = ops.Active()
+	if assert.True(t, ok) {
+		assert.Equal(t, outer.ID(), active.ID())
+	}
+	outer.End()
+	_, ok = ops.Active()
+	assert.False(t, ok)
+}
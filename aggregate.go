@@ -0,0 +1,269 @@
+package ops
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Rollup summarizes all reports for a single op name over an interval.
+// Success and Failure summarize the durations of successful and failed ops
+// separately, which shows whether failures tend to fail fast or time out.
+// DependencyFailures counts the failures by the dependencies of failed ops
+// that they involved (see Op.DependsOn), so a failure can count towards
+// several dependencies.
+type Rollup struct {
+	Name               string
+	Start              time.Time
+	Count              int
+	Failures           int
+	Total              time.Duration
+	Min                time.Duration
+	Max                time.Duration
+	Success            Latency
+	Failure            Latency
+	DependencyFailures map[string]int
+}
+
+// Latency summarizes the durations of some of the ops in a Rollup.
+type Latency struct {
+	Count int
+	Total time.Duration
+	Min   time.Duration
+	Max   time.Duration
+	hist  histogram
+}
+
+// Mean returns the mean duration.
+func (l *Latency) Mean() time.Duration {
+	if l.Count == 0 {
+		return 0
+	}
+	return l.Total / time.Duration(l.Count)
+}
+
+// Quantile returns the approximate duration below which the fraction q of
+// durations fall.
+func (l *Latency) Quantile(q float64) time.Duration {
+	return l.hist.quantile(q)
+}
+
+func (l *Latency) add(d time.Duration) {
+	if l.Count == 0 || d < l.Min {
+		l.Min = d
+	}
+	if d > l.Max {
+		l.Max = d
+	}
+	l.Count++
+	l.Total += d
+	l.hist.observe(d)
+}
+
+func (l *Latency) fill(ctx map[string]interface{}, prefix string) {
+	if l.Count == 0 {
+		return
+	}
+	ctx[prefix+"_duration_min"] = l.Min
+	ctx[prefix+"_duration_max"] = l.Max
+	ctx[prefix+"_duration_mean"] = l.Mean()
+	ctx[prefix+"_duration_p50"] = l.Quantile(0.5)
+	ctx[prefix+"_duration_p99"] = l.Quantile(0.99)
+}
+
+// FailureContribution returns the fraction of failures that involved a failure
+// of the given dependency.
+func (r *Rollup) FailureContribution(dependency string) float64 {
+	if r.Failures == 0 {
+		return 0
+	}
+	return float64(r.DependencyFailures[dependency]) / float64(r.Failures)
+}
+
+// copy returns a copy of the rollup that doesn't share its maps.
+func (r *Rollup) copy() Rollup {
+	result := *r
+	if r.DependencyFailures != nil {
+		result.DependencyFailures = make(map[string]int, len(r.DependencyFailures))
+		for dependency, count := range r.DependencyFailures {
+			result.DependencyFailures[dependency] = count
+		}
+	}
+	return result
+}
+
+// Mean returns the mean duration of the rolled up ops.
+func (r *Rollup) Mean() time.Duration {
+	if r.Count == 0 {
+		return 0
+	}
+	return r.Total / time.Duration(r.Count)
+}
+
+func (r *Rollup) add(report *Report) {
+	if r.Count == 0 || report.Duration < r.Min {
+		r.Min = report.Duration
+	}
+	if report.Duration > r.Max {
+		r.Max = report.Duration
+	}
+	r.Count++
+	r.Total += report.Duration
+	if report.Succeeded() {
+		r.Success.add(report.Duration)
+	} else {
+		r.Failures++
+		r.Failure.add(report.Duration)
+		r.addDependencyFailures(report.Context["failed_dependencies"])
+	}
+}
+
+// addDependencyFailures counts the given failed dependencies, which are
+// []interface{} rather than []string in reports decoded from JSON.
+func (r *Rollup) addDependencyFailures(dependencies interface{}) {
+	var names []string
+	switch d := dependencies.(type) {
+	case []string:
+		names = d
+	case []interface{}:
+		for _, name := range d {
+			if s, ok := name.(string); ok {
+				names = append(names, s)
+			}
+		}
+	}
+	for _, name := range names {
+		if r.DependencyFailures == nil {
+			r.DependencyFailures = make(map[string]int)
+		}
+		r.DependencyFailures[name]++
+	}
+}
+
+func (r *Rollup) asMap() map[string]interface{} {
+	ctx := map[string]interface{}{
+		"op":             r.Name,
+		"rollup":         true,
+		"count":          r.Count,
+		"failures":       r.Failures,
+		"duration_total": r.Total,
+		"duration_min":   r.Min,
+		"duration_max":   r.Max,
+		"duration_mean":  r.Mean(),
+	}
+	r.Success.fill(ctx, "success")
+	r.Failure.fill(ctx, "failure")
+	if len(r.DependencyFailures) > 0 {
+		ctx["dependency_failures"] = r.copy().DependencyFailures
+	}
+	return ctx
+}
+
+// Aggregator is a StructuredReporter that aggregates reports in memory and
+// periodically emits one rollup report per op name to downstream reporters.
+type Aggregator struct {
+	interval   time.Duration
+	downstream []StructuredReporter
+	rollups    map[string]*Rollup
+	start      time.Time
+	mx         sync.Mutex
+	stop       chan interface{}
+	stopOnce   sync.Once
+}
+
+// NewAggregator creates an Aggregator that emits rollups to the given
+// downstream reporters every interval. Register it with
+// RegisterStructuredReporter(aggregator.Report).
+func NewAggregator(interval time.Duration, downstream ...StructuredReporter) *Aggregator {
+	a := &Aggregator{
+		interval:   interval,
+		downstream: downstream,
+		rollups:    make(map[string]*Rollup),
+		start:      time.Now(),
+		stop:       make(chan interface{}),
+	}
+	go a.run()
+	return a
+}
+
+func (a *Aggregator) run() {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.Flush()
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// Report records the given report in the current interval. Progress reports
+// (see Report.InProgress) are ignored.
+func (a *Aggregator) Report(report *Report) {
+	if report.InProgress {
+		return
+	}
+	a.mx.Lock()
+	rollup := a.rollups[report.Name]
+	if rollup == nil {
+		rollup = &Rollup{Name: report.Name, Start: a.start}
+		a.rollups[report.Name] = rollup
+	}
+	rollup.add(report)
+	a.mx.Unlock()
+}
+
+// Snapshot returns copies of the rollups for the current interval, sorted by
+// name.
+func (a *Aggregator) Snapshot() []Rollup {
+	a.mx.Lock()
+	result := make([]Rollup, 0, len(a.rollups))
+	for _, rollup := range a.rollups {
+		result = append(result, rollup.copy())
+	}
+	a.mx.Unlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Flush immediately emits rollups for the current interval and starts a new
+// interval.
+func (a *Aggregator) Flush() {
+	now := time.Now()
+	a.mx.Lock()
+	rollups := a.rollups
+	a.rollups = make(map[string]*Rollup)
+	a.start = now
+	a.mx.Unlock()
+
+	names := make([]string, 0, len(rollups))
+	for name := range rollups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rollup := rollups[name]
+		report := &Report{
+			SchemaVersion: SchemaVersion,
+			Name:          rollup.Name,
+			Start:         rollup.Start,
+			Duration:      now.Sub(rollup.Start),
+			Context:       rollup.asMap(),
+		}
+		for _, reporter := range a.downstream {
+			reporter(report)
+		}
+	}
+}
+
+// Stop stops periodic emission, flushing any pending rollups.
+func (a *Aggregator) Stop() {
+	a.stopOnce.Do(func() {
+		close(a.stop)
+		a.Flush()
+	})
+}
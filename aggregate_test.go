@@ -0,0 +1,50 @@
+package ops_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregator(t *testing.T) {
+	var rollups []*ops.Report
+	a := ops.NewAggregator(time.Hour, func(report *ops.Report) {
+		rollups = append(rollups, report)
+	})
+	defer a.Stop()
+
+	a.Report(&ops.Report{Name: "b", Duration: 3 * time.Millisecond})
+	a.Report(&ops.Report{Name: "a", Duration: 2 * time.Millisecond})
+	a.Report(&ops.Report{Name: "a", Duration: 4 * time.Millisecond, Failure: errors.New("fail")})
+	snapshot := a.Snapshot()
+	if assert.Len(t, snapshot, 2) {
+		assert.Equal(t, "a", snapshot[0].Name)
+		assert.Equal(t, 3*time.Millisecond, snapshot[0].Mean())
+		assert.Equal(t, 1, snapshot[0].Success.Count)
+		assert.Equal(t, 2*time.Millisecond, snapshot[0].Success.Mean())
+		assert.Equal(t, 1, snapshot[0].Failure.Count)
+		assert.Equal(t, 4*time.Millisecond, snapshot[0].Failure.Max)
+		assert.InDelta(t, float64(4*time.Millisecond), float64(snapshot[0].Failure.Quantile(0.5)), float64(time.Millisecond))
+	}
+
+	a.Flush()
+	if assert.Len(t, rollups, 2) {
+		ctx := rollups[0].Context
+		assert.Equal(t, "a", rollups[0].Name)
+		assert.Equal(t, true, ctx["rollup"])
+		assert.Equal(t, 2, ctx["count"])
+		assert.Equal(t, 1, ctx["failures"])
+		assert.Equal(t, 2*time.Millisecond, ctx["duration_min"])
+		assert.Equal(t, 4*time.Millisecond, ctx["duration_max"])
+		assert.Equal(t, 3*time.Millisecond, ctx["duration_mean"])
+		assert.Equal(t, 2*time.Millisecond, ctx["success_duration_mean"])
+		assert.Equal(t, 4*time.Millisecond, ctx["failure_duration_mean"])
+		assert.NotNil(t, ctx["failure_duration_p99"])
+		assert.Nil(t, rollups[1].Context["failure_duration_mean"])
+		assert.Equal(t, "b", rollups[1].Name)
+	}
+	assert.Empty(t, a.Snapshot())
+}
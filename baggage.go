@@ -0,0 +1,112 @@
+package ops
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// baggageHeader carries baggage in the W3C Baggage format
+// (key1=value1,key2=value2).
+const baggageHeader = "baggage"
+
+const (
+	// maxBaggageEntries and maxBaggageBytes are the limits the W3C Baggage
+	// specification recommends honoring. Baggage beyond them isn't
+	// propagated to remote processes.
+	maxBaggageEntries = 64
+	maxBaggageBytes   = 8192
+)
+
+func (o *op) PutBaggage(key string, value string) Op {
+	o.ctx.Put(key, value)
+	o.baggageMx.Lock()
+	if o.baggage == nil {
+		o.baggage = make(map[string]string)
+	}
+	o.baggage[key] = value
+	o.baggageMx.Unlock()
+	return o
+}
+
+func (o *op) PutTag(key string, value interface{}) Op {
+	o.tagsMx.Lock()
+	if o.tags == nil {
+		o.tags = make(map[string]interface{})
+	}
+	o.tags[key] = value
+	o.tagsMx.Unlock()
+	return o
+}
+
+// allBaggage returns the baggage of this op, including that inherited from the
+// ops it was begun under.
+func (o *op) allBaggage() map[string]string {
+	result := make(map[string]string)
+	for ancestor := o; ancestor != nil; ancestor = ancestor.parent {
+		ancestor.baggageMx.Lock()
+		for key, value := range ancestor.baggage {
+			if _, found := result[key]; !found {
+				result[key] = value
+			}
+		}
+		ancestor.baggageMx.Unlock()
+	}
+	return result
+}
+
+// applyTags puts this op's tags into ctx, overriding inherited values.
+func (o *op) applyTags(ctx map[string]interface{}) {
+	o.tagsMx.Lock()
+	for key, value := range o.tags {
+		ctx[key] = value
+	}
+	o.tagsMx.Unlock()
+}
+
+func injectBaggage(o Op, carrier Carrier) {
+	_o, ok := o.(*op)
+	if !ok {
+		return
+	}
+	baggage := _o.allBaggage()
+	if len(baggage) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(baggage))
+	for key := range baggage {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var header strings.Builder
+	entries := 0
+	for _, key := range keys {
+		entry := url.PathEscape(key) + "=" + url.PathEscape(baggage[key])
+		if entries == maxBaggageEntries || header.Len()+len(entry)+1 > maxBaggageBytes {
+			break
+		}
+		if entries > 0 {
+			header.WriteByte(',')
+		}
+		header.WriteString(entry)
+		entries++
+	}
+	carrier.Set(baggageHeader, header.String())
+}
+
+func (o *op) extractBaggage(carrier Carrier) {
+	for _, entry := range strings.Split(carrier.Get(baggageHeader), ",") {
+		// Entries may carry properties after a semicolon, which we ignore
+		entry, _, _ = strings.Cut(entry, ";")
+		key, value, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		key, keyErr := url.PathUnescape(strings.TrimSpace(key))
+		value, valueErr := url.PathUnescape(strings.TrimSpace(value))
+		if keyErr != nil || valueErr != nil || key == "" {
+			continue
+		}
+		o.PutBaggage(key, value)
+	}
+}
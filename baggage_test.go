@@ -0,0 +1,65 @@
+package ops_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaggageAndTags(t *testing.T) {
+	reported := make(map[string]*ops.Report)
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported[report.Name] = report
+	}, "baggage_parent", "baggage_child", "baggage_remote")
+
+	parent := ops.Begin("baggage_parent").
+		PutBaggage("session", "s 1").
+		PutTag("route", "/users").
+		Set("local", "yes")
+	child := parent.Begin("baggage_child")
+	assert.Equal(t, "s 1", child.Snapshot()["session"], "baggage should be inherited")
+	assert.Equal(t, "yes", child.Snapshot()["local"], "set values should be inherited")
+	assert.Nil(t, child.Snapshot()["route"], "tags should not be inherited")
+	assert.Equal(t, "/users", parent.Snapshot()["route"])
+
+	h := make(http.Header)
+	ops.Inject(child, h)
+	assert.Equal(t, "session=s%201", h.Get("baggage"))
+	done := make(chan interface{})
+	go func() {
+		// a fresh goroutine, like the remote process would have
+		ops.BeginRemote("baggage_remote", h).End()
+		close(done)
+	}()
+	<-done
+	child.End()
+	parent.End()
+
+	assert.Equal(t, "/users", reported["baggage_parent"].Context["route"])
+	assert.Nil(t, reported["baggage_child"].Context["route"])
+	assert.Equal(t, "s 1", reported["baggage_remote"].Context["session"])
+	assert.Nil(t, reported["baggage_remote"].Context["local"], "set values should not be propagated")
+}
+
+func TestBaggageHeader(t *testing.T) {
+	h := make(http.Header)
+	h.Set("baggage", "user=alice;prop=1, bad, tenant = acme ,=empty")
+	op := ops.BeginRemote("baggage_header", h)
+	snapshot := op.Snapshot()
+	op.End()
+	assert.Equal(t, "alice", snapshot["user"])
+	assert.Equal(t, "acme", snapshot["tenant"])
+	assert.Nil(t, snapshot["bad"])
+
+	big := ops.Begin("baggage_big")
+	for i := 0; i < 100; i++ {
+		big.PutBaggage(strings.Repeat("k", i+1), "v")
+	}
+	h = make(http.Header)
+	ops.Inject(big, h)
+	big.End()
+	assert.Len(t, strings.Split(h.Get("baggage"), ","), 64, "baggage should be limited")
+}
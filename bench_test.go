@@ -0,0 +1,93 @@
+package ops_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func BenchmarkEnd(b *testing.B) {
+	for _, n := range []int{0, 1, 10} {
+		b.Run(fmt.Sprintf("%d_reporters", n), func(b *testing.B) {
+			parent := ops.Begin("bench_parent")
+			parent.Cancel()
+			defer parent.End()
+			for i := 0; i < n; i++ {
+				parent.RegisterStructuredReporter(func(report *ops.Report) {})
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				parent.Begin("bench_op").Set("a", i).End()
+			}
+		})
+	}
+}
+
+func BenchmarkDeepNesting(b *testing.B) {
+	const depth = 10
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		chain := make([]ops.Op, depth)
+		chain[0] = ops.Begin("bench_nested")
+		for j := 1; j < depth; j++ {
+			chain[j] = chain[j-1].Begin("bench_nested")
+		}
+		for j := depth - 1; j >= 0; j-- {
+			chain[j].End()
+		}
+	}
+}
+
+func BenchmarkGo(b *testing.B) {
+	op := ops.Begin("bench_go").Set("a", 1)
+	defer op.End()
+	done := make(chan bool)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		op.Go(func() {
+			ops.Begin("bench_go_child").End()
+			done <- true
+		})
+		<-done
+	}
+}
+
+func BenchmarkDynamic(b *testing.B) {
+	parent := ops.Begin("bench_parent")
+	parent.Cancel()
+	defer parent.End()
+	parent.RegisterStructuredReporter(func(report *ops.Report) {})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		op := parent.Begin("bench_dynamic")
+		op.SetDynamic("d", func() interface{} { return i })
+		op.End()
+	}
+}
+
+func BenchmarkReportHelper(b *testing.B) {
+	result := ops.BenchmarkReport(func(report *ops.Report) {}, b.N)
+	b.ReportMetric(float64(result.PerOp), "op_ns/op")
+	b.ReportMetric(result.AllocsPerOp, "op_allocs/op")
+}
+
+func TestBenchmarkReportPopsContext(t *testing.T) {
+	ops.BenchmarkReport(func(report *ops.Report) {}, 10)
+	assert.NotEqual(t, "ops_benchmark", ops.AsMap(nil, false)["root_op"], "benchmark ops shouldn't remain in the caller's context")
+}
+
+func BenchmarkEndParallel(b *testing.B) {
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {}, "bench_end_parallel")
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ops.Begin("bench_end_parallel").End()
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package ops
+
+import (
+	"runtime"
+	"time"
+)
+
+// BenchmarkResult is the result of BenchmarkReport.
+type BenchmarkResult struct {
+	Ops         int
+	PerOp       time.Duration
+	AllocsPerOp float64
+}
+
+// BenchmarkReport measures the overhead of instrumenting an operation, from
+// Begin to End, when ops are delivered to the given reporter (nil measures the
+// overhead without any reporters). It runs n ops under a canceled parent op
+// that the reporter is scoped to, so it doesn't affect global reporters.
+// Applications can use it to check that their reporters stay within budget, for
+// example in a test that fails if PerOp exceeds some threshold.
+func BenchmarkReport(reporter StructuredReporter, n int) BenchmarkResult {
+	if n <= 0 {
+		n = 1
+	}
+	parent := Begin("ops_benchmark")
+	parent.Cancel()
+	defer parent.End()
+	if reporter != nil {
+		parent.RegisterStructuredReporter(reporter)
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		parent.Begin("ops_benchmark_op").Set("i", i).End()
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return BenchmarkResult{
+		Ops:         n,
+		PerOp:       elapsed / time.Duration(n),
+		AllocsPerOp: float64(after.Mallocs-before.Mallocs) / float64(n),
+	}
+}
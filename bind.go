@@ -0,0 +1,55 @@
+package ops
+
+// Token is a snapshot of the context of the Op active on some goroutine, as
+// captured by Capture. Tokens are values that can be stored anywhere and used
+// later from any goroutine, which covers callbacks from C (use a
+// runtime/cgo.Handle to pass a Token through C code) or other runtimes.
+type Token struct {
+	values Map
+	// op is the innermost op when captured, see seedStack
+	op *op
+}
+
+// Capture captures the context of the Op active on the current goroutine. The
+// context is captured as a snapshot, so dynamic values are evaluated at the
+// time of calling Capture.
+func Capture() Token {
+	return Token{values: Map(cm.AsMap(nil, false)), op: innermost()}
+}
+
+// Restore re-establishes the captured context on the current goroutine until
+// the returned function is called, which must happen on the same goroutine:
+//
+//	defer token.Restore()()
+func (t Token) Restore() func() {
+	ctx := cm.Enter()
+	for key, value := range t.values {
+		ctx.Put(key, value)
+	}
+	if t.op == nil {
+		return ctx.Exit
+	}
+	gid := curGoroutineID()
+	previous, hadPrevious := stackTops.Load(gid)
+	stackTops.Store(gid, t.op)
+	return func() {
+		ctx.Exit()
+		if hadPrevious {
+			stackTops.Store(gid, previous)
+		} else {
+			stackTops.Delete(gid)
+		}
+	}
+}
+
+// Bind captures the context of the Op active on the current goroutine and
+// returns a function that runs fn with that context re-established, on
+// whatever goroutine calls it. This covers handing work to existing goroutines
+// (task queues, worker pools), which Go doesn't. See Capture.
+func Bind(fn func()) func() {
+	token := Capture()
+	return func() {
+		defer token.Restore()()
+		fn()
+	}
+}
@@ -0,0 +1,55 @@
+package ops_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBind(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "bound_task")
+
+	tasks := make(chan func())
+	done := make(chan bool)
+	go func() {
+		for task := range tasks {
+			task()
+		}
+		done <- true
+	}()
+
+	op := ops.Begin("submitter").Set("request", 5)
+	tasks <- ops.Bind(func() {
+		ops.Begin("bound_task").End()
+	})
+	op.End()
+	close(tasks)
+	<-done
+
+	if assert.NotNil(t, reported) {
+		assert.Equal(t, 5, reported.Context["request"])
+		assert.Equal(t, "submitter", reported.Context["root_op"])
+	}
+}
+
+func TestCaptureRestore(t *testing.T) {
+	op := ops.Begin("capturer").Set("request", 6)
+	token := ops.Capture()
+	op.End()
+	assert.Empty(t, ops.Current())
+
+	done := make(chan bool)
+	go func() {
+		restored := token.Restore()
+		assert.EqualValues(t, 6, ops.Current()["request"])
+		assert.Equal(t, "capturer", ops.Current()["op"])
+		restored()
+		assert.Empty(t, ops.Current())
+		done <- true
+	}()
+	<-done
+}
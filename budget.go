@@ -0,0 +1,210 @@
+package ops
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// Budget limits how many Ops can be begun under a single root Op, protecting
+// against runaway recursion. Zero values mean no limit.
+//
+// Budgets only apply to Ops begun with Op.Begin (and helpers built on it), as
+// Ops begun with the package level Begin are roots themselves.
+type Budget struct {
+	// MaxDepth is the maximum depth of Ops under a root, the root's children
+	// being at depth 1.
+	MaxDepth int
+
+	// MaxChildren is the maximum number of Ops begun under a root at any
+	// depth, over the lifetime of the root.
+	MaxChildren int
+}
+
+var currentBudget atomic.Value
+
+// SetBudget sets the Budget for Ops under each root Op. Ops beyond the budget
+// are no-ops: they don't affect the context and are never reported. The first
+// time a root's budget is exceeded, a diagnostic report of kind
+// "op_budget_exceeded" is emitted identifying the root and which limit was
+// exceeded.
+func SetBudget(budget Budget) {
+	currentBudget.Store(budget)
+}
+
+// withinBudget indicates whether a child may be begun under this op.
+func (o *op) withinBudget() bool {
+	budget, _ := currentBudget.Load().(Budget)
+	if budget.MaxDepth <= 0 && budget.MaxChildren <= 0 {
+		return true
+	}
+	var exceeded string
+	switch {
+	case budget.MaxDepth > 0 && o.depth+1 > budget.MaxDepth:
+		exceeded = "max_depth"
+	case budget.MaxChildren > 0 && atomic.AddInt32(&o.root.descendants, 1) > int32(budget.MaxChildren):
+		exceeded = "max_children"
+	default:
+		return true
+	}
+	if atomic.CompareAndSwapInt32(&o.root.budgetExceeded, 0, 1) {
+		reportDiagnostic("op_budget_exceeded", map[string]interface{}{
+			"exceeded":     exceeded,
+			"max_depth":    budget.MaxDepth,
+			"max_children": budget.MaxChildren,
+			"root_op":      o.root.name,
+			"root_op_id":   o.root.id,
+			"trace_id":     o.root.traceID,
+		})
+	}
+	return false
+}
+
+// noopOp is what's begun in place of Ops that exceed the Budget.
+type noopOp struct {
+	parent *op
+}
+
+func (n *noopOp) Begin(name string) Op {
+	return n
+}
+
+func (n *noopOp) BeginWith(name string, kv ...interface{}) Op {
+	return n
+}
+
+func (n *noopOp) Go(fn func()) {
+	n.parent.Go(fn)
+}
+
+func (n *noopOp) End() {
+}
+func (n *noopOp) EndWithError(err error) error {
+	return err
+}
+
+func (n *noopOp) Cancel() {
+}
+func (n *noopOp) Set(key string, value interface{}) Op {
+	return n
+}
+
+func (n *noopOp) PutBaggage(key string, value string) Op {
+	return n
+}
+
+func (n *noopOp) PutTag(key string, value interface{}) Op {
+	return n
+}
+
+func (n *noopOp) SetDynamic(key string, valueFN func() interface{}) Op {
+	return n
+}
+
+func (n *noopOp) SetDynamicOnce(key string, valueFN func() interface{}) Op {
+	return n
+}
+
+func (n *noopOp) SetDynamicOnFailure(key string, valueFN func() interface{}) Op {
+	return n
+}
+
+func (n *noopOp) SetDynamicLimits(limits DynamicLimits) Op {
+	return n
+}
+
+func (n *noopOp) FailIf(err error) error {
+	return err
+}
+
+func (n *noopOp) SetOutcome(outcome Outcome) Op {
+	return n
+}
+
+func (n *noopOp) DependsOn(dependency string) Op {
+	return n
+}
+
+func (n *noopOp) MarkEnqueued(at time.Time) Op {
+	return n
+}
+
+func (n *noopOp) MarkDequeued() Op {
+	return n
+}
+
+func (n *noopOp) SetPriority(priority Priority) Op {
+	return n
+}
+
+func (n *noopOp) SetDeadline(deadline time.Time) Op {
+	return n
+}
+
+func (n *noopOp) Deadline() (time.Time, bool) {
+	return n.parent.Deadline()
+}
+
+func (n *noopOp) RemainingBudget() (time.Duration, bool) {
+	return n.parent.RemainingBudget()
+}
+
+func (n *noopOp) SetFailurePropagation(policy FailurePropagation) Op {
+	return n
+}
+
+func (n *noopOp) SetIdempotencyKey(key string) Op {
+	return n
+}
+
+func (n *noopOp) Warn(err error) error {
+	return err
+}
+
+func (n *noopOp) FailWithCode(code string, err error) error {
+	return err
+}
+
+func (n *noopOp) Time(name string, fn func() error) error {
+	return fn()
+}
+
+func (n *noopOp) Heartbeat(interval time.Duration) Op {
+	return n
+}
+
+func (n *noopOp) RegisterReporter(reporter Reporter) Op {
+	return n
+}
+
+func (n *noopOp) RegisterStructuredReporter(reporter StructuredReporter) Op {
+	return n
+}
+
+func (n *noopOp) WithReporter(reporter StructuredReporter) Op {
+	return n
+}
+
+func (n *noopOp) Snapshot() Map {
+	return Map{}
+}
+
+func (n *noopOp) ID() string {
+	return ""
+}
+
+func (n *noopOp) TraceID() string {
+	return n.parent.traceID
+}
+
+func (n *noopOp) ParentID() string {
+	return n.parent.id
+}
+
+func (n *noopOp) TrackReader(r io.Reader) io.Reader {
+	return r
+}
+
+func (n *noopOp) TrackWriter(w io.Writer) io.Writer {
+	return w
+}
@@ -0,0 +1,53 @@
+package ops_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudget(t *testing.T) {
+	ops.SetBudget(ops.Budget{MaxDepth: 3, MaxChildren: 5})
+	defer ops.SetBudget(ops.Budget{})
+
+	var diagnostics []map[string]interface{}
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		if report.Context["diagnostic"] == "op_budget_exceeded" {
+			diagnostics = append(diagnostics, report.Context)
+		}
+	}, ops.DiagnosticOpName)
+	var reported []string
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = append(reported, report.Name)
+	}, "budget_root", "budget_child")
+
+	var recurse func(op ops.Op, depth int)
+	recurse = func(op ops.Op, depth int) {
+		if depth == 10 {
+			return
+		}
+		child := op.Begin("budget_child").Set("depth", depth)
+		defer child.End()
+		recurse(child, depth+1)
+	}
+	root := ops.Begin("budget_root")
+	recurse(root, 1)
+	assert.Equal(t, "budget_root", ops.Current()["op"])
+	for i := 0; i < 5; i++ {
+		root.Begin("budget_child").End()
+	}
+	root.End()
+
+	// 3 children within max depth, then 2 more within max children
+	assert.Equal(t, []string{"budget_child", "budget_child", "budget_child", "budget_child", "budget_child", "budget_root"}, reported)
+	if assert.Len(t, diagnostics, 1, "should have reported once per root") {
+		assert.Equal(t, "max_depth", diagnostics[0]["exceeded"])
+		assert.Equal(t, "budget_root", diagnostics[0]["root_op"])
+	}
+
+	root = ops.Begin("budget_root")
+	recurse(root, 1)
+	root.End()
+	assert.Len(t, diagnostics, 2, "new root gets its own budget")
+}
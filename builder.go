@@ -0,0 +1,132 @@
+package ops
+
+import (
+	stdcontext "context"
+	"fmt"
+	"time"
+)
+
+// Builder configures an op to run a function in, reducing the instrumentation
+// of a function to a single expression:
+//
+//	err := ops.Build("dial").
+//		WithTimeout(5*time.Second).
+//		WithKeys("addr", addr).
+//		Run(func(op ops.Op) error {
+//			conn, err = net.Dial("tcp", addr)
+//			return err
+//		})
+//
+// It's called Build rather than Op since Op is the interface type. A Builder
+// can be kept and run any number of times, each run in an op of its own.
+type Builder struct {
+	name    string
+	parent  Op
+	kv      []interface{}
+	timeout time.Duration
+}
+
+// Build starts building an op with the given name.
+func Build(name string) *Builder {
+	return &Builder{name: name}
+}
+
+// WithParent begins the op as a child of parent rather than as a top-level op.
+func (b *Builder) WithParent(parent Op) *Builder {
+	b.parent = parent
+	return b
+}
+
+// WithKeys sets the given key/value pairs on the op, like BeginWith.
+func (b *Builder) WithKeys(kv ...interface{}) *Builder {
+	b.kv = append(b.kv, kv...)
+	return b
+}
+
+// WithTimeout sets the op's deadline timeout from the start of each run (see
+// Op.SetDeadline). Run never waits for the function beyond the op's deadline,
+// whether set this way or inherited from its parent. If the function takes
+// longer, Run fails the op with an error wrapping context.DeadlineExceeded, so
+// that its outcome is TimedOut, and returns that error without waiting for the
+// function to finish. Use RunContext for functions that can stop early.
+func (b *Builder) WithTimeout(timeout time.Duration) *Builder {
+	b.timeout = timeout
+	return b
+}
+
+// Run begins the op, runs fn with it, fails the op if fn returns an error and
+// ends the op, returning fn's error. If fn panics, the op is failed with the
+// panic and ended before the panic continues on the calling goroutine.
+func (b *Builder) Run(fn func(Op) error) error {
+	return b.RunContext(stdcontext.Background(), func(_ stdcontext.Context, o Op) error {
+		return fn(o)
+	})
+}
+
+// RunContext is like Run but also passes fn a copy of ctx that carries the op
+// (see NewContext) and is done once the op's deadline passes. A deadline of ctx
+// also applies to the op, like with BeginContext.
+func (b *Builder) RunContext(ctx stdcontext.Context, fn func(stdcontext.Context, Op) error) error {
+	var o Op
+	if b.parent != nil {
+		o = b.parent.BeginWith(b.name, b.kv...)
+	} else {
+		o = BeginWith(b.name, b.kv...)
+	}
+	defer o.End()
+	if b.timeout > 0 {
+		o.SetDeadline(time.Now().Add(b.timeout))
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		o.SetDeadline(deadline)
+	}
+
+	err := o.FailIf(b.run(NewContext(ctx, o), o, fn))
+	if p, ok := err.(*builderPanic); ok {
+		panic(p.value)
+	}
+	return err
+}
+
+func (b *Builder) run(ctx stdcontext.Context, o Op, fn func(stdcontext.Context, Op) error) error {
+	deadline, ok := o.Deadline()
+	if !ok {
+		return callRecovering(ctx, o, fn)
+	}
+	start := time.Now()
+	ctx, cancel := stdcontext.WithDeadline(ctx, deadline)
+	defer cancel()
+	result := make(chan error, 1)
+	o.Go(func() {
+		result <- callRecovering(ctx, o, fn)
+	})
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		if ctx.Err() == stdcontext.DeadlineExceeded {
+			return fmt.Errorf("%v timed out after %v: %w", b.name, time.Since(start).Round(time.Millisecond), ctx.Err())
+		}
+		return fmt.Errorf("%v: %w", b.name, ctx.Err())
+	}
+}
+
+// callRecovering runs fn, turning a panic into an error so that it fails the
+// op and is raised again on the goroutine that called Run. Panics after the
+// deadline has passed are dropped.
+func callRecovering(ctx stdcontext.Context, o Op, fn func(stdcontext.Context, Op) error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = &builderPanic{p}
+		}
+	}()
+	return fn(ctx, o)
+}
+
+type builderPanic struct {
+	value interface{}
+}
+
+func (p *builderPanic) Error() string {
+	return fmt.Sprintf("panic: %v", p.value)
+}
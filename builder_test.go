@@ -0,0 +1,76 @@
+package ops_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder(t *testing.T) {
+	var mx sync.Mutex
+	reported := make(map[string]*ops.Report)
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		mx.Lock()
+		reported[report.Name] = report
+		mx.Unlock()
+	}, "builder_parent", "builder_ok", "builder_fail", "builder_timeout", "builder_panic")
+	get := func(name string) *ops.Report {
+		mx.Lock()
+		defer mx.Unlock()
+		return reported[name]
+	}
+
+	parent := ops.Begin("builder_parent")
+	err := ops.Build("builder_ok").WithParent(parent).WithKeys("a", 1, "b", 2).Run(func(op ops.Op) error {
+		op.Set("c", 3)
+		return nil
+	})
+	parent.End()
+	assert.NoError(t, err)
+	if r := get("builder_ok"); assert.NotNil(t, r) {
+		assert.True(t, r.Succeeded())
+		assert.Equal(t, 1, r.Context["a"])
+		assert.Equal(t, 2, r.Context["b"])
+		assert.Equal(t, 3, r.Context["c"])
+		assert.Equal(t, get("builder_parent").ID, r.ParentID)
+	}
+
+	err = ops.Build("builder_fail").Run(func(op ops.Op) error {
+		return errors.New("it failed")
+	})
+	assert.Equal(t, "it failed", ops.ErrorText(err))
+	if r := get("builder_fail"); assert.NotNil(t, r) {
+		assert.Equal(t, ops.Failed, r.Outcome)
+	}
+
+	// fn keeps running after RunContext returns, so it hands back what it saw
+	sawDeadline := make(chan bool, 1)
+	err = ops.Build("builder_timeout").WithTimeout(10*time.Millisecond).RunContext(context.Background(), func(ctx context.Context, op ops.Op) error {
+		carried, _ := ops.FromContext(ctx)
+		assert.Equal(t, op, carried)
+		_, hasDeadline := ctx.Deadline()
+		sawDeadline <- hasDeadline
+		<-ctx.Done()
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	assert.True(t, <-sawDeadline)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	if r := get("builder_timeout"); assert.NotNil(t, r) {
+		assert.Equal(t, ops.TimedOut, r.Outcome)
+	}
+
+	assert.PanicsWithValue(t, "boom", func() {
+		ops.Build("builder_panic").Run(func(op ops.Op) error {
+			panic("boom")
+		})
+	})
+	if r := get("builder_panic"); assert.NotNil(t, r) {
+		assert.EqualError(t, r.Failure, "panic: boom")
+	}
+}
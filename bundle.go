@@ -0,0 +1,201 @@
+package ops
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	recentReports      []*Report
+	recentReportsNext  int
+	recentReportsMutex sync.Mutex
+	recordRecentOnce   sync.Once
+
+	diagnosticsSources      = make(map[string]func() interface{})
+	diagnosticsSourcesMutex sync.Mutex
+)
+
+// RecordRecentReports keeps the n most recent reports in memory for inclusion
+// in ExportDiagnostics. Passing 0 stops recording and discards recorded
+// reports.
+func RecordRecentReports(n int) {
+	recordRecentOnce.Do(func() {
+		RegisterStructuredReporter(recordRecent)
+	})
+	recentReportsMutex.Lock()
+	recentReports = make([]*Report, 0, n)
+	recentReportsNext = 0
+	recentReportsMutex.Unlock()
+}
+
+func recordRecent(report *Report) {
+	report = report.Retain()
+	recentReportsMutex.Lock()
+	defer recentReportsMutex.Unlock()
+	switch {
+	case cap(recentReports) == 0:
+		return
+	case len(recentReports) < cap(recentReports):
+		recentReports = append(recentReports, report)
+	default:
+		recentReports[recentReportsNext] = report
+		recentReportsNext = (recentReportsNext + 1) % len(recentReports)
+	}
+}
+
+func recent() []*Report {
+	recentReportsMutex.Lock()
+	defer recentReportsMutex.Unlock()
+	result := make([]*Report, 0, len(recentReports))
+	result = append(result, recentReports[recentReportsNext:]...)
+	return append(result, recentReports[:recentReportsNext]...)
+}
+
+// RegisterDiagnosticsSource registers a function whose result is included in
+// ExportDiagnostics as sources/<name>.json, for example an Aggregator's
+// Snapshot.
+func RegisterDiagnosticsSource(name string, source func() interface{}) {
+	diagnosticsSourcesMutex.Lock()
+	diagnosticsSources[name] = source
+	diagnosticsSourcesMutex.Unlock()
+}
+
+// ExportDiagnostics writes a zip archive to w for attaching to support tickets.
+// It contains the following, with reports in their canonical JSON encoding
+// (see ReportJSONSchema):
+//
+//   - reports.json: recent reports, oldest first (see RecordRecentReports)
+//   - in_flight.json: ops that haven't ended yet, if tracked (see
+//     ReportOnPanicAndExit)
+//   - config.json: the configuration of this package, globals and runtime
+//     information
+//   - sources/<name>.json: the results of the registered diagnostics sources
+//   - goroutines.txt: the stacks of all goroutines
+//
+// Reports, in-flight ops and globals have the privacy policy applied if
+// privacy mode is enabled.
+func ExportDiagnostics(w io.Writer) error {
+	z := zip.NewWriter(w)
+	if err := writeJSON(z, "reports.json", recent()); err != nil {
+		return err
+	}
+	if err := writeJSON(z, "in_flight.json", inFlightDiagnostics()); err != nil {
+		return err
+	}
+	if err := writeJSON(z, "config.json", configDiagnostics()); err != nil {
+		return err
+	}
+
+	diagnosticsSourcesMutex.Lock()
+	names := make([]string, 0, len(diagnosticsSources))
+	for name := range diagnosticsSources {
+		names = append(names, name)
+	}
+	sources := make(map[string]func() interface{}, len(diagnosticsSources))
+	for name, source := range diagnosticsSources {
+		sources[name] = source
+	}
+	diagnosticsSourcesMutex.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		if err := writeJSON(z, "sources/"+name+".json", sources[name]()); err != nil {
+			return err
+		}
+	}
+
+	goroutines, err := z.Create("goroutines.txt")
+	if err != nil {
+		return err
+	}
+	if err := pprof.Lookup("goroutine").WriteTo(goroutines, 2); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+func writeJSON(z *zip.Writer, name string, v interface{}) error {
+	f, err := z.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("unable to encode %v: %v", name, err)
+	}
+	return nil
+}
+
+// stringifyUnencodable formats values that can't be encoded as JSON with
+// fmt.Sprint, so that one odd value doesn't spoil the whole bundle.
+func stringifyUnencodable(ctx map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(ctx))
+	for key, value := range ctx {
+		if _, err := json.Marshal(value); err != nil {
+			value = fmt.Sprint(value)
+		}
+		result[key] = value
+	}
+	return result
+}
+
+func inFlightDiagnostics() []*Report {
+	ops := inFlightOps()
+	result := make([]*Report, 0, len(ops))
+	for _, o := range ops {
+		result = append(result, o.report())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result
+}
+
+func configDiagnostics() map[string]interface{} {
+	// Read globals from a goroutine without any op context
+	globalsCh := make(chan map[string]interface{})
+	go func() {
+		globalsCh <- cm.AsMap(nil, true)
+	}()
+	globals := &Report{Context: <-globalsCh}
+	applyPrivacy(globals)
+
+	backend := "getlantern"
+	if _, native := cm.(*nativeManager); native {
+		backend = "native"
+	}
+	current, _ := reporters.Load().([]*registeredReporter)
+	currentEnrichers, _ := enrichers.Load().([]Enricher)
+	sampler, _ := currentSampler.Load().(Sampler)
+	scrubber, _ := currentScrubber.Load().(Scrubber)
+	return map[string]interface{}{
+		"schema_version":     SchemaVersion,
+		"environment":        Environment(),
+		"context_backend":    backend,
+		"propagator":         fmt.Sprintf("%T", propagator()),
+		"id_generator":       fmt.Sprintf("%T", idGenerator()),
+		"reporters":          len(current),
+		"enrichers":          len(currentEnrichers),
+		"integrations":       Integrations(),
+		"slow_reporters":     SlowReporters(),
+		"sampling":           sampler != nil,
+		"scrubbing":          scrubber != nil,
+		"privacy_mode":       atomic.LoadInt32(&privacyEnabled) == 1,
+		"tracking_in_flight": atomic.LoadInt32(&trackingInFlight) == 1,
+		"globals":            stringifyUnencodable(globals.Context),
+		"go_version":         runtime.Version(),
+		"goos":               runtime.GOOS,
+		"goarch":             runtime.GOARCH,
+		"num_cpu":            runtime.NumCPU(),
+		"num_goroutine":      runtime.NumGoroutine(),
+		"exported_at":        time.Now(),
+	}
+}
@@ -0,0 +1,59 @@
+package ops_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportDiagnostics(t *testing.T) {
+	ops.RecordRecentReports(2)
+	defer ops.RecordRecentReports(0)
+	ops.RegisterDiagnosticsSource("test_source", func() interface{} {
+		return map[string]int{"a": 1}
+	})
+
+	ops.Begin("test_bundle_1").End()
+	ops.Begin("test_bundle_2").End()
+	op := ops.Begin("test_bundle_3")
+	op.FailIf(errors.New("failed"))
+	op.End()
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, ops.ExportDiagnostics(&buf)) {
+		return
+	}
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	files := make(map[string][]byte)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if assert.NoError(t, err) {
+			files[f.Name], _ = io.ReadAll(r)
+			r.Close()
+		}
+	}
+
+	var reports []map[string]interface{}
+	if assert.NoError(t, json.Unmarshal(files["reports.json"], &reports)) && assert.Len(t, reports, 2) {
+		assert.Equal(t, "test_bundle_2", reports[0]["name"])
+		assert.Equal(t, "test_bundle_3", reports[1]["name"])
+		assert.Equal(t, "failed", reports[1]["failure"])
+	}
+	var config map[string]interface{}
+	if assert.NoError(t, json.Unmarshal(files["config.json"], &config)) {
+		assert.EqualValues(t, ops.SchemaVersion, config["schema_version"])
+		assert.Equal(t, "getlantern", config["context_backend"])
+	}
+	assert.Equal(t, "{\n  \"a\": 1\n}\n", string(files["sources/test_source.json"]))
+	assert.NotEmpty(t, files["in_flight.json"])
+	assert.Contains(t, string(files["goroutines.txt"]), "goroutine")
+}
@@ -0,0 +1,129 @@
+package ops
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// KeyCardinality describes a context key with too many distinct values.
+type KeyCardinality struct {
+	Key string
+	// Distinct is the number of distinct values seen in the current window,
+	// which stops counting somewhat beyond the threshold.
+	Distinct int
+	// Ops are the names of ops whose reports contained the key.
+	Ops []string
+}
+
+// CardinalityMonitor watches reports for context keys with more distinct
+// string values per window than a threshold, which tend to cause cardinality
+// explosions in metrics backends. When a key first exceeds the threshold in a
+// window, the monitor emits a diagnostic report (see DiagnosticOpName) with
+// diagnostic=high_cardinality, key, distinct and ops. Only string values are
+// considered, and the keys op_id and trace_id, which are unique by design, are
+// ignored.
+type CardinalityMonitor struct {
+	window      time.Duration
+	threshold   int
+	ignored     map[string]bool
+	windowStart time.Time
+	keys        map[string]*keyValues
+	mx          sync.Mutex
+}
+
+type keyValues struct {
+	values    map[string]bool
+	ops       map[string]bool
+	offending bool
+}
+
+// NewCardinalityMonitor creates a CardinalityMonitor. Register it with
+// RegisterStructuredReporter(monitor.Report).
+func NewCardinalityMonitor(window time.Duration, threshold int) *CardinalityMonitor {
+	return &CardinalityMonitor{
+		window:      window,
+		threshold:   threshold,
+		ignored:     map[string]bool{"op_id": true, "trace_id": true},
+		windowStart: time.Now(),
+		keys:        make(map[string]*keyValues),
+	}
+}
+
+// Ignore makes the monitor ignore the given keys. It must be called before the
+// monitor is registered.
+func (m *CardinalityMonitor) Ignore(keys ...string) *CardinalityMonitor {
+	for _, key := range keys {
+		m.ignored[key] = true
+	}
+	return m
+}
+
+// Report records the values in the given report.
+func (m *CardinalityMonitor) Report(report *Report) {
+	if report.Name == DiagnosticOpName {
+		return
+	}
+	var newOffenders []KeyCardinality
+	m.mx.Lock()
+	if now := time.Now(); now.Sub(m.windowStart) > m.window {
+		m.keys = make(map[string]*keyValues)
+		m.windowStart = now
+	}
+	for key, value := range report.Context {
+		s, ok := value.(string)
+		if !ok || m.ignored[key] {
+			continue
+		}
+		kv := m.keys[key]
+		if kv == nil {
+			kv = &keyValues{values: make(map[string]bool), ops: make(map[string]bool)}
+			m.keys[key] = kv
+		}
+		kv.ops[report.Name] = true
+		if len(kv.values) > m.threshold {
+			// Don't keep accumulating values for offending keys
+			continue
+		}
+		kv.values[s] = true
+		if len(kv.values) > m.threshold && !kv.offending {
+			kv.offending = true
+			newOffenders = append(newOffenders, kv.cardinality(key))
+		}
+	}
+	m.mx.Unlock()
+
+	for _, offender := range newOffenders {
+		reportDiagnostic("high_cardinality", map[string]interface{}{
+			"key":      offender.Key,
+			"distinct": offender.Distinct,
+			"ops":      offender.Ops,
+		})
+	}
+}
+
+// Offenders returns the keys that exceeded the threshold in the current window,
+// sorted by key.
+func (m *CardinalityMonitor) Offenders() []KeyCardinality {
+	var result []KeyCardinality
+	m.mx.Lock()
+	for key, kv := range m.keys {
+		if kv.offending {
+			result = append(result, kv.cardinality(key))
+		}
+	}
+	m.mx.Unlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+func (kv *keyValues) cardinality(key string) KeyCardinality {
+	ops := make([]string, 0, len(kv.ops))
+	for name := range kv.ops {
+		ops = append(ops, name)
+	}
+	sort.Strings(ops)
+	return KeyCardinality{Key: key, Distinct: len(kv.values), Ops: ops}
+}
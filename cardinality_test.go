@@ -0,0 +1,43 @@
+package ops_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCardinalityMonitor(t *testing.T) {
+	var diagnostics []*ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		diagnostics = append(diagnostics, report)
+	}, ops.DiagnosticOpName)
+
+	m := ops.NewCardinalityMonitor(time.Hour, 10).Ignore("request_id")
+	for i := 0; i < 100; i++ {
+		name := "fetch"
+		if i%2 == 0 {
+			name = "store"
+		}
+		m.Report(&ops.Report{Name: name, Context: map[string]interface{}{
+			"op":         name,
+			"op_id":      fmt.Sprint(i),
+			"request_id": fmt.Sprint(i),
+			"user_id":    fmt.Sprint(i),
+			"count":      i,
+		}})
+	}
+
+	offenders := m.Offenders()
+	if assert.Len(t, offenders, 1) {
+		assert.Equal(t, "user_id", offenders[0].Key)
+		assert.Equal(t, 11, offenders[0].Distinct)
+		assert.Equal(t, []string{"fetch", "store"}, offenders[0].Ops)
+	}
+	if assert.Len(t, diagnostics, 1, "should only report a key once per window") {
+		assert.Equal(t, "high_cardinality", diagnostics[0].Context["diagnostic"])
+		assert.Equal(t, "user_id", diagnostics[0].Context["key"])
+	}
+}
@@ -0,0 +1,74 @@
+package ops
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrInjected is the default failure injected by InjectFailure.
+var ErrInjected = errors.New("injected failure")
+
+type injectedFailure struct {
+	probability float64
+	err         error
+}
+
+var (
+	injecting       int32
+	injections      = make(map[string][]*injectedFailure)
+	injectionsMutex sync.RWMutex
+)
+
+// InjectFailure makes ops with the given name fail with err, with the given
+// probability (between 0 and 1), unless they've failed already. This is meant
+// for test and staging builds, to check that alerting and fallback logic driven
+// by op outcomes actually work. Reports of injected failures have
+// injected_failure=true. If err is nil, ErrInjected is used. Returns a function that stops injecting the failure.
+func InjectFailure(opName string, probability float64, err error) func() {
+	if err == nil {
+		err = ErrInjected
+	}
+	injection := &injectedFailure{probability, err}
+	injectionsMutex.Lock()
+	injections[opName] = append(injections[opName], injection)
+	atomic.StoreInt32(&injecting, 1)
+	injectionsMutex.Unlock()
+
+	return func() {
+		injectionsMutex.Lock()
+		defer injectionsMutex.Unlock()
+		remaining := make([]*injectedFailure, 0, len(injections[opName]))
+		for _, existing := range injections[opName] {
+			if existing != injection {
+				remaining = append(remaining, existing)
+			}
+		}
+		if len(remaining) == 0 {
+			delete(injections, opName)
+		} else {
+			injections[opName] = remaining
+		}
+		if len(injections) == 0 {
+			atomic.StoreInt32(&injecting, 0)
+		}
+	}
+}
+
+// injectFailure fails this op if a failure is being injected for it.
+func (o *op) injectFailure() {
+	if atomic.LoadInt32(&injecting) == 0 || o.failure.Load() != nil {
+		return
+	}
+	injectionsMutex.RLock()
+	candidates := injections[o.name]
+	injectionsMutex.RUnlock()
+	for _, injection := range candidates {
+		if rand.Float64() < injection.probability {
+			o.failure.Store(injection.err)
+			o.ctx.Put("injected_failure", true)
+			return
+		}
+	}
+}
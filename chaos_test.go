@@ -0,0 +1,46 @@
+package ops_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInjectFailure(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "chaos_target", "chaos_other")
+
+	stop := ops.InjectFailure("chaos_target", 1, errors.New("chaos"))
+	ops.Begin("chaos_target").End()
+	if assert.NotNil(t, reported) {
+		assert.Equal(t, "chaos", ops.ErrorText(reported.Failure))
+		assert.Equal(t, true, reported.Context["injected_failure"])
+	}
+
+	ops.Begin("chaos_other").End()
+	assert.True(t, reported.Succeeded(), "other ops should be unaffected")
+
+	op := ops.Begin("chaos_target")
+	op.FailIf(errors.New("real"))
+	op.End()
+	assert.Equal(t, "real", ops.ErrorText(reported.Failure), "real failures should be kept")
+	assert.Nil(t, reported.Context["injected_failure"])
+
+	stop()
+	ops.Begin("chaos_target").End()
+	assert.True(t, reported.Succeeded(), "should stop injecting")
+
+	stop = ops.InjectFailure("chaos_target", 0, nil)
+	ops.Begin("chaos_target").End()
+	assert.True(t, reported.Succeeded(), "probability 0 should never inject")
+	stop()
+
+	stop = ops.InjectFailure("chaos_target", 1, nil)
+	ops.Begin("chaos_target").End()
+	assert.Equal(t, ops.ErrInjected, reported.Failure)
+	stop()
+}
@@ -0,0 +1,97 @@
+package ops
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+var closingChildren int32
+
+// States of op.ended besides 0 (in flight) and 1 (ended).
+const (
+	// closedByParent means the op was closed when its parent ended, but its
+	// context is still on the stack of the goroutine that began it.
+	closedByParent = 2
+	// exitedAfterClose means the op was closed when its parent ended and its
+	// own End has since been called.
+	exitedAfterClose = 3
+)
+
+// SetCloseChildrenOnEnd chooses whether ending an op also closes its
+// descendants that are still open (default false), so that leaked children
+// of a completed request can't appear to be in flight forever. Closed
+// descendants are reported immediately, before the op itself, with
+// interrupted=true and, unless they've already failed, a failure saying that
+// the parent ended first. Their sampling doesn't apply and their failures
+// aren't propagated to the op. Calling End on them later only pops their
+// context off the stack of the goroutine that began them, if it's still on
+// top.
+//
+// Only ops begun while this is enabled are closed.
+func SetCloseChildrenOnEnd(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&closingChildren, value)
+}
+
+// addChild records that child needs closing when o ends.
+func (o *op) addChild(child *op) {
+	if atomic.LoadInt32(&closingChildren) != 1 {
+		return
+	}
+	o.childrenMx.Lock()
+	defer o.childrenMx.Unlock()
+	if atomic.LoadInt32(&o.ended) != 0 {
+		// Too late to be closed along with o
+		return
+	}
+	child.closable = true
+	if o.children == nil {
+		o.children = make(map[*op]bool)
+	}
+	o.children[child] = true
+}
+
+func (o *op) removeFromParent() {
+	if !o.closable {
+		return
+	}
+	o.parent.childrenMx.Lock()
+	delete(o.parent.children, o)
+	o.parent.childrenMx.Unlock()
+}
+
+// closeChildren closes the children of o that are still open, along with
+// their descendants.
+func (o *op) closeChildren() {
+	o.childrenMx.Lock()
+	children := o.children
+	o.children = nil
+	o.childrenMx.Unlock()
+	for child := range children {
+		if atomic.CompareAndSwapInt32(&child.ended, 0, closedByParent) {
+			child.closeChildren()
+			child.interrupt(fmt.Errorf("parent %v ended before %v", o.name, child.name))
+		}
+	}
+}
+
+// exitClosed handles End on an op that was closed by its parent.
+func (o *op) exitClosed() {
+	if !atomic.CompareAndSwapInt32(&o.ended, closedByParent, exitedAfterClose) {
+		return
+	}
+	o.endRuntimeTrace()
+	if native, ok := cm.(*nativeManager); ok {
+		if native.current(o.gid) == o.ctx {
+			o.ctx.Exit()
+		}
+	} else if missing, top := o.checkStack(); !missing && top == nil {
+		if o.stacked {
+			o.popStack()
+		}
+		o.ctx.Exit()
+	}
+}
@@ -0,0 +1,73 @@
+package ops_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloseChildrenOnEnd(t *testing.T) {
+	ops.SetCloseChildrenOnEnd(true)
+	defer ops.SetCloseChildrenOnEnd(false)
+	t.Run("getlantern", testCloseChildrenOnEnd(ops.GetlanternContextBackend))
+	t.Run("native", testCloseChildrenOnEnd(ops.NativeContextBackend))
+}
+
+func testCloseChildrenOnEnd(backend ops.ContextBackend) func(t *testing.T) {
+	return func(t *testing.T) {
+		ops.SetContextBackend(backend)
+		defer ops.SetContextBackend(ops.GetlanternContextBackend)
+		closeChildrenOnEnd(t)
+	}
+}
+
+func closeChildrenOnEnd(t *testing.T) {
+	var mx sync.Mutex
+	var order []string
+	reported := make(map[string]*ops.Report)
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		mx.Lock()
+		order = append(order, report.Name)
+		reported[report.Name] = report
+		mx.Unlock()
+	}, "children_parent", "children_child", "children_grandchild", "children_done", "children_after")
+
+	parent := ops.Begin("children_parent")
+	parent.Begin("children_done").End()
+	child := parent.Begin("children_child")
+	begun := make(chan interface{})
+	parentEnded := make(chan interface{})
+	finished := make(chan interface{})
+	child.Go(func() {
+		grandchild := child.Begin("children_grandchild").Set("in_grandchild", true)
+		close(begun)
+		<-parentEnded
+		grandchild.Set("late", true)
+		grandchild.End()
+		// The grandchild's context should be gone from this goroutine
+		ops.Begin("children_after").End()
+		close(finished)
+	})
+	<-begun
+	parent.End()
+	close(parentEnded)
+	<-finished
+	child.End()
+
+	mx.Lock()
+	defer mx.Unlock()
+	assert.Equal(t, []string{"children_done", "children_grandchild", "children_child", "children_parent", "children_after"}, order)
+	assert.True(t, reported["children_parent"].Succeeded())
+	assert.Nil(t, reported["children_done"].Context["interrupted"])
+	for _, name := range []string{"children_child", "children_grandchild"} {
+		r := reported[name]
+		assert.Equal(t, true, r.Context["interrupted"], name)
+		assert.Error(t, r.Failure, name)
+	}
+	assert.EqualError(t, reported["children_child"].Failure, "parent children_parent ended before children_child")
+	assert.Equal(t, true, reported["children_grandchild"].Context["in_grandchild"])
+	assert.Nil(t, reported["children_grandchild"].Context["late"])
+	assert.Nil(t, reported["children_after"].Context["in_grandchild"])
+}
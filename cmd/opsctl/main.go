@@ -0,0 +1,284 @@
+// Command opsctl tails and queries the reports of a running process that
+// serves ops.StreamHandler, over HTTP or a unix socket.
+//
+// Usage:
+//
+//	opsctl [-addr URL | -socket PATH [-path PATH]] COMMAND [ARGS]
+//
+// Commands:
+//
+//	tail [-json] [-failures] [-name NAME]...  print reports as they arrive
+//	top [-interval 2s] [-name NAME]...        show per-op rates and latencies
+//	grep [-json] KEY[=VALUE]...               print reports matching all of
+//	                                          the given context keys (and
+//	                                          values)
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+// maxLine is the longest report line accepted from the stream.
+const maxLine = 1024 * 1024
+
+type namesFlag []string
+
+func (n *namesFlag) String() string {
+	return strings.Join(*n, ",")
+}
+
+func (n *namesFlag) Set(value string) error {
+	*n = append(*n, value)
+	return nil
+}
+
+func main() {
+	addr := flag.String("addr", "", "URL of the stream handler, e.g. http://127.0.0.1:6060/debug/ops/stream")
+	socket := flag.String("socket", "", "unix socket on which the stream handler is served")
+	path := flag.String("path", "/", "path of the stream handler when using -socket")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 || (*addr == "") == (*socket == "") {
+		usage()
+		os.Exit(2)
+	}
+	client, base, err := connect(*addr, *socket, *path)
+	if err == nil {
+		err = run(client, base, flag.Arg(0), flag.Args()[1:], os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "opsctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: opsctl [-addr URL | -socket PATH [-path PATH]] COMMAND [ARGS]
+
+commands:
+  tail [-json] [-failures] [-name NAME]...  print reports as they arrive
+  top [-interval 2s] [-name NAME]...        show per-op rates and latencies
+  grep [-json] KEY[=VALUE]...               print reports matching the given
+                                            context keys (and values)
+
+flags:
+`)
+	flag.PrintDefaults()
+}
+
+// connect returns a client and the URL of the stream handler.
+func connect(addr, socket, path string) (*http.Client, *url.URL, error) {
+	if socket == "" {
+		base, err := url.Parse(addr)
+		return http.DefaultClient, base, err
+	}
+	var dialer net.Dialer
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		},
+	}}
+	return client, &url.URL{Scheme: "http", Host: "unix", Path: path}, nil
+}
+
+func run(client *http.Client, base *url.URL, command string, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	var names namesFlag
+	asJSON := fs.Bool("json", false, "print reports as JSON")
+	switch command {
+	case "tail":
+		fs.Var(&names, "name", "only show ops with this name (repeatable)")
+		failures := fs.Bool("failures", false, "only show failed ops")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		return stream(client, streamURL(base, names, *failures), func(report *ops.Report) {
+			printReport(out, report, *asJSON)
+		})
+	case "grep":
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		matchers, err := parseMatchers(fs.Args())
+		if err != nil {
+			return err
+		}
+		return stream(client, streamURL(base, nil, false), func(report *ops.Report) {
+			if matchers.match(report) {
+				printReport(out, report, *asJSON)
+			}
+		})
+	case "top":
+		fs.Var(&names, "name", "only show ops with this name (repeatable)")
+		interval := fs.Duration("interval", 2*time.Second, "how often to refresh")
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		return top(client, streamURL(base, names, false), *interval, out)
+	}
+	return fmt.Errorf("unknown command %q", command)
+}
+
+func streamURL(base *url.URL, names []string, failures bool) string {
+	u := *base
+	q := u.Query()
+	for _, name := range names {
+		q.Add("name", name)
+	}
+	if failures {
+		q.Set("failures", "true")
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// stream calls onReport with each report from the stream until it ends.
+func stream(client *http.Client, streamURL string, onReport func(*ops.Report)) error {
+	resp, err := client.Get(streamURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+	for scanner.Scan() {
+		report := &ops.Report{}
+		if err := json.Unmarshal(scanner.Bytes(), report); err != nil {
+			// Skip reports we don't understand
+			continue
+		}
+		onReport(report)
+	}
+	return scanner.Err()
+}
+
+func printReport(out io.Writer, report *ops.Report, asJSON bool) {
+	if asJSON {
+		b, err := json.Marshal(report)
+		if err == nil {
+			fmt.Fprintln(out, string(b))
+		}
+		return
+	}
+	fmt.Fprintln(out, formatReport(report))
+}
+
+// formatReport formats a report as a single line with the time, name,
+// outcome, duration, failure and context keys in sorted order.
+func formatReport(report *ops.Report) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v %v %v %v", report.Start.Local().Format("15:04:05.000"), report.Name, report.Outcome, report.Duration)
+	if report.Failure != nil {
+		fmt.Fprintf(&b, " error=%q", report.Failure.Error())
+	}
+	for _, key := range ops.Map(report.Context).Keys() {
+		switch key {
+		case "op", "error", "outcome", "schema_version":
+			// already shown
+			continue
+		}
+		fmt.Fprintf(&b, " %v=%v", key, report.Context[key])
+	}
+	return b.String()
+}
+
+type matcher struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+type matchers []matcher
+
+// parseMatchers parses arguments of the form key or key=value.
+func parseMatchers(args []string) (matchers, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("grep needs at least one KEY[=VALUE]")
+	}
+	result := make(matchers, 0, len(args))
+	for _, arg := range args {
+		key, value, hasValue := strings.Cut(arg, "=")
+		if key == "" {
+			return nil, fmt.Errorf("invalid matcher %q", arg)
+		}
+		result = append(result, matcher{key, value, hasValue})
+	}
+	return result, nil
+}
+
+// match checks whether the report's context matches all matchers. The name
+// of the op can be matched with the key op.
+func (ms matchers) match(report *ops.Report) bool {
+	for _, m := range ms {
+		value, found := report.Context[m.key]
+		if m.key == "op" {
+			value, found = report.Name, true
+		}
+		if !found || (m.hasValue && fmt.Sprint(value) != m.value) {
+			return false
+		}
+	}
+	return true
+}
+
+func top(client *http.Client, streamURL string, interval time.Duration, out io.Writer) error {
+	aggregator := ops.NewAggregator(time.Hour)
+	defer aggregator.Stop()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- stream(client, streamURL, aggregator.Report)
+	}()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-errCh:
+			return err
+		case <-ticker.C:
+			rollups := aggregator.Snapshot()
+			aggregator.Flush()
+			// Clear the screen and move to the top left
+			fmt.Fprint(out, "\033[H\033[2J")
+			renderTop(out, rollups, interval)
+		}
+	}
+}
+
+// renderTop prints a table of rollups, busiest ops first. Quantiles are of
+// successful ops, since failures often fail fast or time out and would skew
+// them.
+func renderTop(out io.Writer, rollups []ops.Rollup, interval time.Duration) {
+	sort.SliceStable(rollups, func(i, j int) bool {
+		return rollups[i].Count > rollups[j].Count
+	})
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "OP\tRATE/S\tFAILED\tMEAN\tP50\tP99")
+	for _, r := range rollups {
+		fmt.Fprintf(w, "%v\t%.1f\t%.1f%%\t%v\t%v\t%v\n",
+			r.Name,
+			float64(r.Count)/interval.Seconds(),
+			100*float64(r.Failures)/float64(r.Count),
+			r.Mean().Round(time.Microsecond),
+			r.Success.Quantile(0.5).Round(time.Microsecond),
+			r.Success.Quantile(0.99).Round(time.Microsecond))
+	}
+	w.Flush()
+}
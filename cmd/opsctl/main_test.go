@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func testReports() []*ops.Report {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []*ops.Report{
+		{
+			SchemaVersion: ops.SchemaVersion,
+			Name:          "dial",
+			Start:         start,
+			Duration:      time.Millisecond,
+			Context:       map[string]interface{}{"op": "dial", "host": "a.com"},
+		},
+		{
+			SchemaVersion: ops.SchemaVersion,
+			Name:          "dial",
+			Start:         start,
+			Duration:      2 * time.Millisecond,
+			Failure:       errors.New("refused"),
+			Context:       map[string]interface{}{"op": "dial", "host": "b.com"},
+		},
+		{
+			SchemaVersion: ops.SchemaVersion,
+			Name:          "resolve",
+			Start:         start,
+			Duration:      time.Millisecond,
+			Context:       map[string]interface{}{"op": "resolve", "host": "a.com"},
+		},
+	}
+}
+
+// serveReports serves the test reports as a stream that ends after the last
+// one, recording the query of each request.
+func serveReports(t *testing.T, queries chan<- url.Values) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if queries != nil {
+			queries <- req.URL.Query()
+		}
+		for _, report := range testReports() {
+			b, err := json.Marshal(report)
+			if !assert.NoError(t, err) {
+				return
+			}
+			resp.Write(append(b, '\n'))
+		}
+	})
+}
+
+func TestTail(t *testing.T) {
+	queries := make(chan url.Values, 1)
+	server := httptest.NewServer(serveReports(t, queries))
+	defer server.Close()
+
+	client, base, err := connect(server.URL, "", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var out bytes.Buffer
+	assert.NoError(t, run(client, base, "tail", []string{"-failures", "-name", "dial", "-name", "resolve"}, &out))
+	query := <-queries
+	assert.Equal(t, []string{"dial", "resolve"}, query["name"])
+	assert.Equal(t, "true", query.Get("failures"))
+	assert.Len(t, strings.Split(strings.TrimSpace(out.String()), "\n"), 3)
+}
+
+func TestGrep(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "ops.sock")
+	l, err := net.Listen("unix", socket)
+	if !assert.NoError(t, err) {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/debug/ops/stream", serveReports(t, nil))
+	go http.Serve(l, mux)
+	defer l.Close()
+
+	client, base, err := connect("", socket, "/debug/ops/stream")
+	if !assert.NoError(t, err) {
+		return
+	}
+	var out bytes.Buffer
+	assert.NoError(t, run(client, base, "grep", []string{"-json", "op=dial", "host=b.com"}, &out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if assert.Len(t, lines, 1) {
+		report := &ops.Report{}
+		if assert.NoError(t, json.Unmarshal([]byte(lines[0]), report)) {
+			assert.Equal(t, "dial", report.Name)
+			assert.EqualError(t, report.Failure, "refused")
+		}
+	}
+
+	assert.Error(t, run(client, base, "grep", nil, &out), "grep without matchers")
+	assert.Error(t, run(client, base, "bogus", nil, &out), "unknown command")
+}
+
+func TestMatchers(t *testing.T) {
+	report := testReports()[1]
+	for _, tc := range []struct {
+		args  []string
+		match bool
+	}{
+		{[]string{"host"}, true},
+		{[]string{"host=b.com"}, true},
+		{[]string{"op=dial", "host=b.com"}, true},
+		{[]string{"host=a.com"}, false},
+		{[]string{"op=resolve"}, false},
+		{[]string{"port"}, false},
+	} {
+		ms, err := parseMatchers(tc.args)
+		if assert.NoError(t, err) {
+			assert.Equal(t, tc.match, ms.match(report), "%v", tc.args)
+		}
+	}
+	_, err := parseMatchers([]string{"=b.com"})
+	assert.Error(t, err)
+}
+
+func TestFormatReport(t *testing.T) {
+	report := testReports()[1]
+	report.Outcome = ops.Failed
+	formatted := formatReport(report)
+	assert.Contains(t, formatted, `dial failed 2ms error="refused" host=b.com`)
+	assert.NotContains(t, formatted, "op=")
+}
+
+func TestRenderTop(t *testing.T) {
+	aggregator := ops.NewAggregator(time.Hour)
+	defer aggregator.Stop()
+	for _, report := range testReports() {
+		aggregator.Report(report)
+	}
+	var out bytes.Buffer
+	renderTop(&out, aggregator.Snapshot(), time.Second)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if assert.Len(t, lines, 3) {
+		assert.Equal(t, []string{"OP", "RATE/S", "FAILED", "MEAN", "P50", "P99"}, strings.Fields(lines[0]))
+		assert.Equal(t, []string{"dial", "2.0", "50.0%"}, strings.Fields(lines[1])[:3])
+		assert.Equal(t, []string{"resolve", "1.0", "0.0%"}, strings.Fields(lines[2])[:3])
+	}
+}
@@ -0,0 +1,267 @@
+// Package collector implements a local aggregation daemon for ops. Processes
+// send their reports to a Collector over a unix socket or UDP using a Sender,
+// and the Collector rolls them up (see ops.Aggregator) and forwards the rollups
+// to its own reporters, so that many processes on a host can share a single
+// connection to the metrics backend. Reports are sent in their canonical JSON
+// encoding (see ops.ReportJSONSchema).
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+const (
+	// maxDatagramSize is the largest report that can be sent over a datagram
+	// network.
+	maxDatagramSize = 65507
+
+	// sendTimeout bounds how long a Sender blocks the op reporting to it while
+	// dialing or writing.
+	sendTimeout = 250 * time.Millisecond
+
+	// minRedialBackoff and maxRedialBackoff bound how long a Sender waits after
+	// a failed dial before dialing again.
+	minRedialBackoff = 100 * time.Millisecond
+	maxRedialBackoff = 30 * time.Second
+)
+
+func isDatagram(network string) bool {
+	return strings.HasPrefix(network, "udp") || network == "unixgram"
+}
+
+// Collector receives reports from Senders and aggregates them.
+type Collector struct {
+	aggregator *ops.Aggregator
+	closers    []func() error
+	conns      map[net.Conn]bool
+	closed     bool
+	mx         sync.Mutex
+	wg         sync.WaitGroup
+}
+
+// New creates a Collector that emits rollups of the reports it receives to the
+// given reporters every interval.
+func New(interval time.Duration, downstream ...ops.StructuredReporter) *Collector {
+	return &Collector{
+		aggregator: ops.NewAggregator(interval, downstream...),
+		conns:      make(map[net.Conn]bool),
+	}
+}
+
+// Listen starts receiving reports on the given network ("udp", "unixgram",
+// "unix" or "tcp") and address, returning the address actually listened on.
+func (c *Collector) Listen(network, addr string) (net.Addr, error) {
+	if isDatagram(network) {
+		conn, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return nil, err
+		}
+		c.addCloser(conn.Close)
+		c.wg.Add(1)
+		go c.readPackets(conn)
+		return conn.LocalAddr(), nil
+	}
+
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	c.addCloser(l.Close)
+	c.wg.Add(1)
+	go c.accept(l)
+	return l.Addr(), nil
+}
+
+func (c *Collector) addCloser(closer func() error) {
+	c.mx.Lock()
+	c.closers = append(c.closers, closer)
+	c.mx.Unlock()
+}
+
+// addConn tracks an accepted connection until it ends, returning false if the
+// Collector is already closed.
+func (c *Collector) addConn(conn net.Conn) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if c.closed {
+		return false
+	}
+	c.conns[conn] = true
+	return true
+}
+
+func (c *Collector) removeConn(conn net.Conn) {
+	c.mx.Lock()
+	delete(c.conns, conn)
+	c.mx.Unlock()
+}
+
+func (c *Collector) readPackets(conn net.PacketConn) {
+	defer c.wg.Done()
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		c.receive(buf[:n])
+	}
+}
+
+func (c *Collector) accept(l net.Listener) {
+	defer c.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		if !c.addConn(conn) {
+			conn.Close()
+			return
+		}
+		c.wg.Add(1)
+		go c.readStream(conn)
+	}
+}
+
+func (c *Collector) readStream(conn net.Conn) {
+	defer c.wg.Done()
+	defer conn.Close()
+	defer c.removeConn(conn)
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), maxDatagramSize)
+	for scanner.Scan() {
+		c.receive(scanner.Bytes())
+	}
+}
+
+func (c *Collector) receive(b []byte) {
+	report := &ops.Report{}
+	if err := json.Unmarshal(b, report); err != nil {
+		// Ignore malformed reports
+		return
+	}
+	c.aggregator.Report(report)
+}
+
+// Snapshot returns the rollups for the current interval.
+func (c *Collector) Snapshot() []ops.Rollup {
+	return c.aggregator.Snapshot()
+}
+
+// Flush immediately emits rollups for the current interval.
+func (c *Collector) Flush() {
+	c.aggregator.Flush()
+}
+
+// Close stops listening and emits any pending rollups.
+func (c *Collector) Close() error {
+	c.mx.Lock()
+	closers := c.closers
+	c.closers = nil
+	for conn := range c.conns {
+		closers = append(closers, conn.Close)
+	}
+	c.conns = make(map[net.Conn]bool)
+	c.closed = true
+	c.mx.Unlock()
+	var firstErr error
+	for _, closer := range closers {
+		if err := closer(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	c.wg.Wait()
+	c.aggregator.Stop()
+	return firstErr
+}
+
+// Sender sends reports to a Collector.
+type Sender struct {
+	network  string
+	addr     string
+	datagram bool
+	mx       sync.Mutex
+	// conn is nil while disconnected
+	conn     net.Conn
+	backoff  time.Duration
+	nextDial time.Time
+	closed   bool
+}
+
+// NewSender connects to the Collector listening on the given network and
+// address. Register it with ops.RegisterStructuredReporter(sender.Report).
+func NewSender(network, addr string) (*Sender, error) {
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Sender{network: network, addr: addr, conn: conn, datagram: isDatagram(network)}, nil
+}
+
+// Report sends the given report to the Collector. Reports that can't be
+// serialized or sent are dropped. If sending fails, the Sender reconnects,
+// waiting longer after each failed attempt, and drops reports until it's
+// reconnected.
+func (s *Sender) Report(report *ops.Report) {
+	b, err := json.Marshal(report)
+	if err != nil || len(b) > maxDatagramSize {
+		return
+	}
+	if !s.datagram {
+		b = append(b, '\n')
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.closed || s.conn == nil && !s.redial() {
+		return
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(sendTimeout))
+	if _, err := s.conn.Write(b); err != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// redial reconnects unless it's too soon after the last failed attempt,
+// returning whether it's connected.
+func (s *Sender) redial() bool {
+	now := time.Now()
+	if now.Before(s.nextDial) {
+		return false
+	}
+	conn, err := net.DialTimeout(s.network, s.addr, sendTimeout)
+	if err != nil {
+		s.backoff *= 2
+		if s.backoff < minRedialBackoff {
+			s.backoff = minRedialBackoff
+		} else if s.backoff > maxRedialBackoff {
+			s.backoff = maxRedialBackoff
+		}
+		s.nextDial = now.Add(s.backoff)
+		return false
+	}
+	s.conn = conn
+	s.backoff = 0
+	return true
+}
+
+// Close closes the connection to the Collector.
+func (s *Sender) Close() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.closed = true
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
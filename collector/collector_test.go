@@ -0,0 +1,92 @@
+package collector_test
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/collector"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollector(t *testing.T) {
+	for _, network := range []string{"udp", "unix"} {
+		t.Run(network, func(t *testing.T) {
+			var mx sync.Mutex
+			var rollups []*ops.Report
+			c := collector.New(time.Hour, func(report *ops.Report) {
+				mx.Lock()
+				rollups = append(rollups, report)
+				mx.Unlock()
+			})
+			addr := "127.0.0.1:0"
+			if network == "unix" {
+				addr = filepath.Join(t.TempDir(), "collector.sock")
+			}
+			listenAddr, err := c.Listen(network, addr)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			// Two processes sending reports
+			for i := 0; i < 2; i++ {
+				sender, err := collector.NewSender(network, listenAddr.String())
+				if !assert.NoError(t, err) {
+					return
+				}
+				sender.Report(&ops.Report{SchemaVersion: ops.SchemaVersion, Name: "request", Duration: time.Duration(i+1) * time.Millisecond})
+				sender.Report(&ops.Report{SchemaVersion: ops.SchemaVersion, Name: "request", Duration: time.Millisecond, Failure: errors.New("failed")})
+				defer sender.Close()
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				snapshot := c.Snapshot()
+				if len(snapshot) == 1 && snapshot[0].Count == 4 || time.Now().After(deadline) {
+					break
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+			assert.NoError(t, c.Close())
+
+			mx.Lock()
+			defer mx.Unlock()
+			if assert.Len(t, rollups, 1) {
+				assert.Equal(t, "request", rollups[0].Name)
+				assert.Equal(t, 4, rollups[0].Context["count"])
+				assert.Equal(t, 2, rollups[0].Context["failures"])
+				assert.Equal(t, 2*time.Millisecond, rollups[0].Context["duration_max"])
+			}
+		})
+	}
+}
+
+func TestSenderReconnects(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "collector.sock")
+	first := collector.New(time.Hour)
+	if _, err := first.Listen("unix", addr); !assert.NoError(t, err) {
+		return
+	}
+	sender, err := collector.NewSender("unix", addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer sender.Close()
+	assert.NoError(t, first.Close())
+
+	// The collector restarts while the sender keeps reporting
+	second := collector.New(time.Hour)
+	if _, err := second.Listen("unix", addr); !assert.NoError(t, err) {
+		return
+	}
+	defer second.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(second.Snapshot()) == 0 && time.Now().Before(deadline) {
+		sender.Report(&ops.Report{SchemaVersion: ops.SchemaVersion, Name: "request"})
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Len(t, second.Snapshot(), 1, "sender should have reconnected to the restarted collector")
+}
@@ -0,0 +1,140 @@
+package ops
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// ConcurrencyOptions configures a ConcurrencyController. Zero values use the
+// defaults noted on each field.
+type ConcurrencyOptions struct {
+	// Initial is the initial concurrency limit for each op name (default 10).
+	Initial int
+
+	// Min is the lowest the limit goes (default 1).
+	Min int
+
+	// Max is the highest the limit goes (default 1000).
+	Max int
+
+	// LatencyTarget, if set, treats successful ops that take longer than this
+	// as congestion, just like failures.
+	LatencyTarget time.Duration
+
+	// Backoff is the factor the limit is multiplied by on congestion
+	// (default 0.9).
+	Backoff float64
+
+	// Cooldown is the minimum time between decreases of the limit, so that a
+	// burst of failures from requests that were all in flight at once only
+	// counts once (default 1 second).
+	Cooldown time.Duration
+}
+
+// ConcurrencyController limits the number of concurrent ops per name, adapting
+// the limits to the outcomes of the ops using AIMD (additive increase,
+// multiplicative decrease): each success below the latency target grows the
+// limit by 1/limit, so the limit grows by about 1 per limit successes, while
+// congestion (failures and slow ops) multiplies it by Backoff.
+//
+// Callers check Allow before beginning work and call Done when finished. The
+// controller learns the outcomes from reports, so it must be registered with
+// RegisterStructuredReporter(controller.Report).
+type ConcurrencyController struct {
+	opts  ConcurrencyOptions
+	gates map[string]*gate
+	mx    sync.Mutex
+}
+
+type gate struct {
+	limit        float64
+	inFlight     int
+	lastDecrease time.Time
+}
+
+// NewConcurrencyController creates a ConcurrencyController with the given
+// options.
+func NewConcurrencyController(opts ConcurrencyOptions) *ConcurrencyController {
+	if opts.Initial <= 0 {
+		opts.Initial = 10
+	}
+	if opts.Min <= 0 {
+		opts.Min = 1
+	}
+	if opts.Max <= 0 {
+		opts.Max = 1000
+	}
+	if opts.Backoff <= 0 || opts.Backoff >= 1 {
+		opts.Backoff = 0.9
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = time.Second
+	}
+	return &ConcurrencyController{opts: opts, gates: make(map[string]*gate)}
+}
+
+func (c *ConcurrencyController) gate(name string) *gate {
+	g := c.gates[name]
+	if g == nil {
+		g = &gate{limit: float64(c.opts.Initial)}
+		c.gates[name] = g
+	}
+	return g
+}
+
+// Allow indicates whether another op with the given name may start. If it
+// returns true, the caller must call Done once the op is finished.
+func (c *ConcurrencyController) Allow(name string) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	g := c.gate(name)
+	if g.inFlight >= int(g.limit) {
+		return false
+	}
+	g.inFlight++
+	return true
+}
+
+// Done records that an op allowed by Allow has finished.
+func (c *ConcurrencyController) Done(name string) {
+	c.mx.Lock()
+	g := c.gate(name)
+	if g.inFlight > 0 {
+		g.inFlight--
+	}
+	c.mx.Unlock()
+}
+
+// Limit returns the current concurrency limit for the given op name.
+func (c *ConcurrencyController) Limit(name string) int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return int(c.gate(name).limit)
+}
+
+// Report adjusts the limit for the reported op's name. Reports for names that
+// have never been passed to Allow and progress reports are ignored.
+func (c *ConcurrencyController) Report(report *Report) {
+	if report.InProgress {
+		return
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	g := c.gates[report.Name]
+	if g == nil {
+		return
+	}
+	congested := !report.Succeeded() ||
+		(c.opts.LatencyTarget > 0 && report.Duration > c.opts.LatencyTarget)
+	if !congested {
+		g.limit = math.Min(g.limit+1/g.limit, float64(c.opts.Max))
+		return
+	}
+	now := time.Now()
+	if now.Sub(g.lastDecrease) < c.opts.Cooldown {
+		return
+	}
+	g.lastDecrease = now
+	g.limit = math.Max(g.limit*c.opts.Backoff, float64(c.opts.Min))
+}
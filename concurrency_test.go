@@ -0,0 +1,54 @@
+package ops_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrencyController(t *testing.T) {
+	c := ops.NewConcurrencyController(ops.ConcurrencyOptions{
+		Initial:       2,
+		Max:           3,
+		LatencyTarget: time.Second,
+		Backoff:       0.5,
+		Cooldown:      time.Nanosecond,
+	})
+
+	assert.True(t, c.Allow("dial"))
+	assert.True(t, c.Allow("dial"))
+	assert.False(t, c.Allow("dial"), "should have hit limit")
+	c.Done("dial")
+	assert.True(t, c.Allow("dial"))
+	c.Done("dial")
+	c.Done("dial")
+
+	// Additive increase, capped at Max
+	for i := 0; i < 10; i++ {
+		c.Report(&ops.Report{Name: "dial", Duration: time.Millisecond})
+	}
+	assert.Equal(t, 3, c.Limit("dial"))
+
+	// Multiplicative decrease on failures and slow ops, floored at Min
+	c.Report(&ops.Report{Name: "dial", Failure: errors.New("failed")})
+	assert.Equal(t, 1, c.Limit("dial"))
+	time.Sleep(time.Millisecond)
+	c.Report(&ops.Report{Name: "dial", Duration: 2 * time.Second})
+	assert.Equal(t, 1, c.Limit("dial"))
+
+	// Unknown names are ignored
+	c.Report(&ops.Report{Name: "other", Failure: errors.New("failed")})
+	assert.Equal(t, 2, c.Limit("other"))
+}
+
+func TestConcurrencyControllerCooldown(t *testing.T) {
+	c := ops.NewConcurrencyController(ops.ConcurrencyOptions{Initial: 100, Backoff: 0.5})
+	c.Allow("dial")
+	for i := 0; i < 10; i++ {
+		c.Report(&ops.Report{Name: "dial", Failure: errors.New("failed")})
+	}
+	assert.Equal(t, 50, c.Limit("dial"))
+}
@@ -0,0 +1,111 @@
+package ops
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+var (
+	trackingInFlight int32
+	inFlight         = make(map[*op]bool)
+	inFlightMutex    sync.Mutex
+	crashOnce        sync.Once
+)
+
+// ReportOnPanicAndExit makes sure that ops which are still in flight when the
+// process dies get reported. Once called, receiving SIGINT or SIGTERM reports
+// all in-flight ops as interrupted, flushes reporters and then lets the signal
+// terminate the process. The returned function does the same for panics and
+// should be deferred at the top of main (and of any long-lived goroutine):
+//
+//	defer ops.ReportOnPanicAndExit()()
+//
+// Ops begun before the first call to ReportOnPanicAndExit are not tracked.
+func ReportOnPanicAndExit() func() {
+	crashOnce.Do(func() {
+		atomic.StoreInt32(&trackingInFlight, 1)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			sig := <-signals
+			reportInterrupted(fmt.Errorf("interrupted by signal: %v", sig))
+			Flush()
+			signal.Stop(signals)
+			p, err := os.FindProcess(os.Getpid())
+			if err == nil {
+				err = p.Signal(sig)
+			}
+			if err != nil {
+				os.Exit(1)
+			}
+		}()
+	})
+
+	return func() {
+		if p := recover(); p != nil {
+			reportInterrupted(fmt.Errorf("interrupted by panic: %v", p))
+			Flush()
+			panic(p)
+		}
+	}
+}
+
+// reportInterrupted reports all in-flight ops with the given failure (unless
+// they already have one) and interrupted=true.
+func reportInterrupted(failure error) {
+	for _, o := range inFlightOps() {
+		if atomic.CompareAndSwapInt32(&o.ended, 0, 1) {
+			o.interrupt(failure)
+		}
+	}
+}
+
+// interrupt reports an op that has been marked as ended without being ended
+// normally with the given failure (unless it already has one) and
+// interrupted=true.
+func (o *op) interrupt(failure error) {
+	o.untrack()
+	o.stopHeartbeat()
+	if o.failure.Load() == nil {
+		o.failure.Store(failure)
+	}
+	reportersCopy := o.reporters()
+	if len(reportersCopy) > 0 {
+		report := o.report()
+		report.Context["interrupted"] = true
+		dispatch(reportersCopy, report)
+	}
+	o.endReporterScopes()
+}
+
+func (o *op) track() {
+	o.trackActive()
+	if atomic.LoadInt32(&trackingInFlight) == 1 {
+		inFlightMutex.Lock()
+		inFlight[o] = true
+		inFlightMutex.Unlock()
+	}
+}
+
+func (o *op) untrack() {
+	o.untrackActive()
+	if atomic.LoadInt32(&trackingInFlight) == 1 {
+		inFlightMutex.Lock()
+		delete(inFlight, o)
+		inFlightMutex.Unlock()
+	}
+}
+
+func inFlightOps() []*op {
+	inFlightMutex.Lock()
+	result := make([]*op, 0, len(inFlight))
+	for o := range inFlight {
+		result = append(result, o)
+	}
+	inFlightMutex.Unlock()
+	return result
+}
@@ -0,0 +1,82 @@
+package ops_test
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+// crashEnv selects the crash that the test binary simulates when it's run as a
+// subprocess by runCrash, since ReportOnPanicAndExit installs process-wide
+// signal handling that would outlive the test.
+const crashEnv = "OPS_TEST_CRASH"
+
+func TestMain(m *testing.M) {
+	if crash := os.Getenv(crashEnv); crash != "" {
+		simulateCrash(crash)
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// simulateCrash prints a line for every report and flush, then crashes with a
+// panic or SIGTERM while an op is in flight.
+func simulateCrash(crash string) {
+	handlePanic := ops.ReportOnPanicAndExit()
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		fmt.Printf("report %v interrupted=%v failure=%v\n", report.Name, report.Context["interrupted"], report.Failure)
+	}, "crash_completed", "crash_in_flight")
+	ops.RegisterFlusher(func() {
+		fmt.Println("flushed")
+	})
+
+	defer handlePanic()
+	ops.Begin("crash_completed").End()
+	ops.Begin("crash_in_flight")
+	switch crash {
+	case "panic":
+		panic("boom")
+	case "signal":
+		p, _ := os.FindProcess(os.Getpid())
+		p.Signal(syscall.SIGTERM)
+		select {}
+	}
+}
+
+func runCrash(crash string) (string, error) {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), crashEnv+"="+crash)
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+func TestReportOnPanic(t *testing.T) {
+	out, err := runCrash("panic")
+	assert.Error(t, err, "panic should still crash the process")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Equal(t, []string{
+		"report crash_completed interrupted=<nil> failure=<nil>",
+		"report crash_in_flight interrupted=true failure=interrupted by panic: boom",
+		"flushed",
+	}, lines)
+}
+
+func TestReportOnSignal(t *testing.T) {
+	out, err := runCrash("signal")
+	if exitErr, ok := err.(*exec.ExitError); assert.True(t, ok, "signal should still terminate the process") {
+		status, _ := exitErr.Sys().(syscall.WaitStatus)
+		assert.Equal(t, syscall.SIGTERM, status.Signal())
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	assert.Equal(t, []string{
+		"report crash_completed interrupted=<nil> failure=<nil>",
+		"report crash_in_flight interrupted=true failure=interrupted by signal: terminated",
+		"flushed",
+	}, lines)
+}
@@ -0,0 +1,31 @@
+package ops
+
+import (
+	"time"
+)
+
+// DeadlineKey is the context key under which an op's deadline is recorded (see
+// Op.SetDeadline). Since it's part of the context, it's inherited by the ops
+// begun under the op, including on goroutines started with Go.
+const DeadlineKey = "deadline"
+
+func (o *op) SetDeadline(deadline time.Time) Op {
+	if current, ok := o.Deadline(); ok && !deadline.Before(current) {
+		return o
+	}
+	o.putLookup(DeadlineKey, deadline)
+	return o
+}
+
+func (o *op) Deadline() (time.Time, bool) {
+	deadline, ok := o.lookup(DeadlineKey).(time.Time)
+	return deadline, ok
+}
+
+func (o *op) RemainingBudget() (time.Duration, bool) {
+	deadline, ok := o.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return time.Until(deadline), true
+}
@@ -0,0 +1,130 @@
+package ops_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadline(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "deadline_parent")
+
+	_, ok := ops.Begin("deadline_none").RemainingBudget()
+	assert.False(t, ok)
+
+	deadline := time.Now().Add(time.Hour)
+	parent := ops.Begin("deadline_parent").SetDeadline(deadline)
+	remaining, ok := parent.RemainingBudget()
+	assert.True(t, ok)
+	assert.InDelta(t, float64(time.Hour), float64(remaining), float64(time.Minute))
+
+	child := parent.Begin("deadline_child")
+	inherited, ok := child.Deadline()
+	assert.True(t, ok)
+	assert.True(t, deadline.Equal(inherited))
+	child.SetDeadline(deadline.Add(time.Hour))
+	inherited, _ = child.Deadline()
+	assert.True(t, deadline.Equal(inherited), "deadline should not be extended")
+	earlier := deadline.Add(-30 * time.Minute)
+	child.SetDeadline(earlier)
+	own, _ := child.Deadline()
+	assert.True(t, earlier.Equal(own))
+	inherited, _ = parent.Deadline()
+	assert.True(t, deadline.Equal(inherited), "parent's deadline should not change")
+	child.End()
+
+	done := make(chan time.Time)
+	parent.Go(func() {
+		d, _ := ops.Begin("deadline_goroutine").Deadline()
+		done <- d
+	})
+	assert.True(t, deadline.Equal(<-done), "ops on goroutines started with Go should inherit the deadline")
+
+	parent.End()
+	assert.Equal(t, deadline, reported.Context[ops.DeadlineKey])
+}
+
+func TestDeadlineFromContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	expected, _ := ctx.Deadline()
+	op, _ := ops.BeginContext(ctx, "deadline_context")
+	defer op.End()
+	deadline, ok := op.Deadline()
+	assert.True(t, ok)
+	assert.True(t, expected.Equal(deadline))
+}
+
+func TestBuilderInheritsDeadline(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "deadline_builder")
+
+	parent := ops.Begin("deadline_builder_parent").SetDeadline(time.Now().Add(10 * time.Millisecond))
+	defer parent.End()
+	err := ops.Build("deadline_builder").WithParent(parent).Run(func(op ops.Op) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, ops.TimedOut, reported.Outcome)
+}
+
+func TestDeadlineLookup(t *testing.T) {
+	t.Run("getlantern", testDeadlineLookup(ops.GetlanternContextBackend))
+	t.Run("native", testDeadlineLookup(ops.NativeContextBackend))
+}
+
+func testDeadlineLookup(backend ops.ContextBackend) func(t *testing.T) {
+	return func(t *testing.T) {
+		ops.SetContextBackend(backend)
+		defer ops.SetContextBackend(ops.GetlanternContextBackend)
+
+		var evaluations int32
+		deadline := time.Now().Add(time.Hour)
+		parent := ops.Begin("deadline_lookup").SetDeadline(deadline).SetDynamic("dynamic", func() interface{} {
+			atomic.AddInt32(&evaluations, 1)
+			return 1
+		})
+		defer parent.End()
+		// lookup returns the deadline of a new op, checking that finding it
+		// doesn't evaluate dynamic values
+		lookup := func(name string) time.Time {
+			op := ops.Begin(name)
+			before := atomic.LoadInt32(&evaluations)
+			d, _ := op.Deadline()
+			assert.Equal(t, before, atomic.LoadInt32(&evaluations), "looking up the deadline shouldn't evaluate dynamic values")
+			op.End()
+			return d
+		}
+
+		assert.True(t, deadline.Equal(lookup("deadline_lookup_nested")), "ops begun inside the parent should inherit its deadline")
+
+		var inherited time.Time
+		done := make(chan bool)
+		ops.Go(func() {
+			inherited = lookup("deadline_lookup_go")
+			done <- true
+		})
+		<-done
+		assert.True(t, deadline.Equal(inherited), "ops on goroutines started with ops.Go should inherit the deadline")
+
+		bound := ops.Bind(func() {
+			inherited = lookup("deadline_lookup_bound")
+		})
+		go func() {
+			bound()
+			done <- true
+		}()
+		<-done
+		assert.True(t, deadline.Equal(inherited), "ops in bound functions should inherit the deadline")
+	}
+}
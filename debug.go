@@ -0,0 +1,35 @@
+package ops
+
+import (
+	"sync/atomic"
+)
+
+// DebugKey is the context key that turns on verbose debug capture. Setting it
+// to true on an Op (typically a root op) makes reports for that Op and all Ops
+// begun under it bypass sampling and, for Ops begun with Op.Begin, makes
+// failures capture the stack at the point of FailIf under the key "stack".
+const DebugKey = "debug"
+
+func (o *op) setDebug(value interface{}) {
+	var debug int32
+	if enabled, _ := value.(bool); enabled {
+		debug = 1
+	}
+	atomic.StoreInt32(&o.debug, debug)
+}
+
+func (o *op) isDebug() bool {
+	for current := o; current != nil; current = current.parent {
+		if atomic.LoadInt32(&current.debug) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// isDebugReport checks whether the report has debug capture turned on. This
+// also covers ops that inherit the debug key through the context.
+func isDebugReport(report *Report) bool {
+	debug, _ := report.Context[DebugKey].(bool)
+	return debug
+}
@@ -0,0 +1,38 @@
+package ops_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugCapture(t *testing.T) {
+	defer ops.SetSampler(nil)
+	ops.SetSampler(func(report *ops.Report) bool { return false })
+
+	var reported []*ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = append(reported, report)
+	}, "not_debugged", "debugged", "debugged_child", "debugged_ambient")
+
+	ops.Begin("not_debugged").End()
+	assert.Empty(t, reported, "sampler should drop ordinary reports")
+
+	root := ops.Begin("debugged").Set(ops.DebugKey, true)
+	child := root.Begin("debugged_child")
+	child.FailIf(errors.New("child failed"))
+	child.End()
+	ambient := ops.Begin("debugged_ambient")
+	ambient.End()
+	root.End()
+
+	if assert.Len(t, reported, 3) {
+		assert.Equal(t, "debugged_child", reported[0].Name)
+		assert.Contains(t, reported[0].Context["stack"], "TestDebugCapture")
+		assert.Equal(t, "debugged_ambient", reported[1].Name)
+		assert.Equal(t, "debugged", reported[2].Name)
+		assert.NotContains(t, reported[2].Context, "stack")
+	}
+}
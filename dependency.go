@@ -0,0 +1,92 @@
+package ops
+
+import (
+	"sort"
+)
+
+// dependencies are the external dependencies recorded with DependsOn.
+type dependencies struct {
+	// direct are the dependencies the op itself touched
+	direct map[string]bool
+	// all include the dependencies touched by the op's descendants
+	all map[string]bool
+	// failed are the dependencies of failed ops among the op and its
+	// descendants
+	failed map[string]bool
+}
+
+func (o *op) DependsOn(dependency string) Op {
+	o.depsMx.Lock()
+	if o.deps.direct == nil {
+		o.deps.direct = make(map[string]bool)
+	}
+	o.deps.direct[dependency] = true
+	o.depsMx.Unlock()
+	for ancestor := o; ancestor != nil; ancestor = ancestor.parent {
+		ancestor.depsMx.Lock()
+		if ancestor.deps.all == nil {
+			ancestor.deps.all = make(map[string]bool)
+		}
+		ancestor.deps.all[dependency] = true
+		ancestor.depsMx.Unlock()
+	}
+	return o
+}
+
+// recordFailedDependencies blames the direct dependencies of an op that has
+// ended with a failure on it and its ancestors.
+func (o *op) recordFailedDependencies() {
+	if o.failure.Load() == nil {
+		return
+	}
+	o.depsMx.Lock()
+	direct := make([]string, 0, len(o.deps.direct))
+	for dependency := range o.deps.direct {
+		direct = append(direct, dependency)
+	}
+	o.depsMx.Unlock()
+	if len(direct) == 0 {
+		return
+	}
+	for ancestor := o; ancestor != nil; ancestor = ancestor.parent {
+		ancestor.depsMx.Lock()
+		if ancestor.deps.failed == nil {
+			ancestor.deps.failed = make(map[string]bool)
+		}
+		for _, dependency := range direct {
+			ancestor.deps.failed[dependency] = true
+		}
+		ancestor.depsMx.Unlock()
+	}
+}
+
+// recordDependencies puts the sorted dependencies of the op and its
+// descendants under "dependencies" and, if the op failed, those of failed ops
+// under "failed_dependencies".
+func (o *op) recordDependencies(ctx map[string]interface{}, failed bool) {
+	o.depsMx.Lock()
+	all := sortedKeys(o.deps.all)
+	var failedDependencies []string
+	if failed {
+		failedDependencies = sortedKeys(o.deps.failed)
+	}
+	o.depsMx.Unlock()
+	if len(all) > 0 {
+		ctx["dependencies"] = all
+	}
+	if len(failedDependencies) > 0 {
+		ctx["failed_dependencies"] = failedDependencies
+	}
+}
+
+func sortedKeys(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
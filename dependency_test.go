@@ -0,0 +1,50 @@
+package ops_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDependsOn(t *testing.T) {
+	reported := make(map[string]*ops.Report)
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported[report.Name] = report
+	}, "dependency_checkout", "dependency_cache", "dependency_payment")
+
+	checkout := ops.Begin("dependency_checkout")
+	cache := checkout.Begin("dependency_cache").DependsOn("redis")
+	cache.FailIf(errors.New("connection refused"))
+	cache.End()
+	payment := checkout.Begin("dependency_payment").DependsOn("stripe").DependsOn("postgres")
+	payment.End()
+	checkout.FailIf(errors.New("checkout failed"))
+	checkout.End()
+
+	assert.Equal(t, []string{"redis"}, reported["dependency_cache"].Context["dependencies"])
+	assert.Equal(t, []string{"redis"}, reported["dependency_cache"].Context["failed_dependencies"])
+	assert.Equal(t, []string{"postgres", "stripe"}, reported["dependency_payment"].Context["dependencies"])
+	assert.NotContains(t, reported["dependency_payment"].Context, "failed_dependencies")
+	assert.Equal(t, []string{"postgres", "redis", "stripe"}, reported["dependency_checkout"].Context["dependencies"])
+	assert.Equal(t, []string{"redis"}, reported["dependency_checkout"].Context["failed_dependencies"])
+
+	a := ops.NewAggregator(time.Hour)
+	defer a.Stop()
+	a.Report(reported["dependency_checkout"])
+	a.Report(&ops.Report{Name: "dependency_checkout", Failure: errors.New("other"), Context: map[string]interface{}{
+		// As decoded from JSON
+		"failed_dependencies": []interface{}{"stripe"},
+	}})
+	a.Report(&ops.Report{Name: "dependency_checkout"})
+	snapshot := a.Snapshot()
+	if assert.Len(t, snapshot, 1) {
+		assert.Equal(t, map[string]int{"redis": 1, "stripe": 1}, snapshot[0].DependencyFailures)
+		assert.Equal(t, 0.5, snapshot[0].FailureContribution("redis"))
+		assert.Equal(t, 0.0, snapshot[0].FailureContribution("postgres"))
+		snapshot[0].DependencyFailures["redis"] = 10
+		assert.Equal(t, 1, a.Snapshot()[0].DependencyFailures["redis"], "snapshot shouldn't share state")
+	}
+}
@@ -0,0 +1,29 @@
+package ops
+
+import (
+	"time"
+)
+
+// DiagnosticOpName is the name of reports that this package emits about its
+// own operation, like high cardinality keys. Their Context contains the key
+// "diagnostic" identifying the kind of diagnostic.
+const DiagnosticOpName = "ops_diagnostic"
+
+// reportDiagnostic delivers a diagnostic report to interested reporters,
+// bypassing sampling.
+func reportDiagnostic(diagnostic string, ctx map[string]interface{}) {
+	reportersCopy := currentReporters(DiagnosticOpName)
+	if len(reportersCopy) == 0 {
+		return
+	}
+	ctx["op"] = DiagnosticOpName
+	ctx["diagnostic"] = diagnostic
+	ctx["schema_version"] = SchemaVersion
+	dispatch(reportersCopy, &Report{
+		SchemaVersion: SchemaVersion,
+		Name:          DiagnosticOpName,
+		Environment:   Environment(),
+		Start:         time.Now(),
+		Context:       ctx,
+	})
+}
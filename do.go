@@ -0,0 +1,10 @@
+package ops
+
+// Do begins an Op with the given name, runs fn with it, fails the Op if fn
+// returns an error, ends the Op and returns fn's results.
+func Do[T any](name string, fn func(Op) (T, error)) (T, error) {
+	o := Begin(name)
+	defer o.End()
+	result, err := fn(o)
+	return result, o.FailIf(err)
+}
@@ -0,0 +1,55 @@
+package ops_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDo(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_do", "test_do_failure")
+
+	result, err := ops.Do("test_do", func(op ops.Op) (int, error) {
+		op.Set("a", 1)
+		return 5, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 5, result)
+	assert.Equal(t, "test_do", reported.Name)
+	assert.True(t, reported.Succeeded())
+	assert.Equal(t, 1, reported.Context["a"])
+
+	_, err = ops.Do("test_do_failure", func(op ops.Op) (string, error) {
+		return "", errors.New("it failed")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, "test_do_failure", reported.Name)
+	assert.Equal(t, "it failed", ops.ErrorText(reported.Failure))
+}
+
+func TestTime(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_time")
+
+	op := ops.Begin("test_time")
+	assert.NoError(t, op.Time("connect", func() error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}))
+	assert.Error(t, op.Time("send", func() error {
+		return errors.New("send failed")
+	}))
+	op.End()
+
+	assert.True(t, reported.Context["connect_duration"].(time.Duration) >= 5*time.Millisecond)
+	assert.NotNil(t, reported.Context["send_duration"])
+	assert.Equal(t, "send failed", ops.ErrorText(reported.Failure))
+}
@@ -0,0 +1,181 @@
+package ops
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+// DynamicLimits limits the evaluation of dynamic values so that a misbehaving
+// value function can't stall or crash End. Regardless of limits, a value
+// function that panics yields a value describing the panic. Limits only apply
+// to dynamic values set after limits were first set, globally or on any Op, so
+// that programs that don't use limits don't pay for them.
+type DynamicLimits struct {
+	// Timeout limits how long a value function may run, 0 meaning no limit. A
+	// function that times out keeps running in the background, and reads of
+	// the value until it returns wait for that same evaluation rather than
+	// starting another.
+	Timeout time.Duration
+
+	// MaxSize caps the length in bytes of string and []byte values, 0 meaning
+	// no limit. Strings are cut at a rune boundary.
+	MaxSize int
+}
+
+var (
+	globalLimits atomic.Value
+
+	// limitsSet is 1 once any non-zero DynamicLimits have been set, globally or
+	// on an op.
+	limitsSet int32
+)
+
+func init() {
+	SetDynamicLimits(DynamicLimits{})
+}
+
+// SetDynamicLimits sets the DynamicLimits for all dynamic values, unless
+// overridden on a particular Op.
+func SetDynamicLimits(limits DynamicLimits) {
+	noteLimits(limits)
+	globalLimits.Store(limits)
+}
+
+func noteLimits(limits DynamicLimits) {
+	if limits != (DynamicLimits{}) {
+		atomic.StoreInt32(&limitsSet, 1)
+	}
+}
+
+func globalDynamicLimits() DynamicLimits {
+	return globalLimits.Load().(DynamicLimits)
+}
+
+func (o *op) SetDynamicLimits(limits DynamicLimits) Op {
+	noteLimits(limits)
+	o.limits.Store(limits)
+	return o
+}
+
+type failureValue struct {
+	key     string
+	valueFN func() interface{}
+}
+
+func (o *op) SetDynamicOnFailure(key string, valueFN func() interface{}) Op {
+	o.onFailureMx.Lock()
+	o.onFailure = append(o.onFailure, failureValue{key, guardDynamic(o.dynamicLimits, valueFN)})
+	o.onFailureMx.Unlock()
+	return o
+}
+
+// applyOnFailure evaluates the values set with SetDynamicOnFailure into ctx.
+func (o *op) applyOnFailure(ctx map[string]interface{}) {
+	o.onFailureMx.Lock()
+	values := o.onFailure
+	o.onFailureMx.Unlock()
+	// Evaluate outside of the lock, since value functions may take a while
+	for _, value := range values {
+		ctx[value.key] = value.valueFN()
+	}
+}
+
+func (o *op) dynamicLimits() DynamicLimits {
+	limits, ok := o.limits.Load().(DynamicLimits)
+	if !ok {
+		return globalDynamicLimits()
+	}
+	return limits
+}
+
+// guardDynamic wraps valueFN to enforce the limits in effect at evaluation
+// time. Until limits are first set, it only recovers panics, which saves
+// allocating the state for timeouts.
+func guardDynamic(limits func() DynamicLimits, valueFN func() interface{}) func() interface{} {
+	if atomic.LoadInt32(&limitsSet) == 0 {
+		return func() interface{} {
+			return safeEval(valueFN, 0)
+		}
+	}
+	var mx sync.Mutex
+	var pending *evaluation
+	return func() interface{} {
+		l := limits()
+		if l.Timeout <= 0 {
+			return safeEval(valueFN, l.MaxSize)
+		}
+		mx.Lock()
+		e := pending
+		if e == nil {
+			e = &evaluation{done: make(chan interface{})}
+			pending = e
+			go func() {
+				e.value = safeEval(valueFN, l.MaxSize)
+				mx.Lock()
+				pending = nil
+				mx.Unlock()
+				close(e.done)
+			}()
+		}
+		mx.Unlock()
+		timer := time.NewTimer(l.Timeout)
+		defer timer.Stop()
+		select {
+		case <-e.done:
+			return e.value
+		case <-timer.C:
+			return fmt.Sprintf("!dynamic value timed out after %v", l.Timeout)
+		}
+	}
+}
+
+// evaluation is an evaluation of a guarded value function that's in progress,
+// shared by all reads of the value until it completes.
+type evaluation struct {
+	done  chan interface{}
+	value interface{}
+}
+
+func safeEval(valueFN func() interface{}, maxSize int) (value interface{}) {
+	defer func() {
+		if p := recover(); p != nil {
+			value = fmt.Sprintf("!dynamic value panicked: %v", p)
+		}
+	}()
+	return truncate(valueFN(), maxSize)
+}
+
+func truncate(value interface{}, maxSize int) interface{} {
+	if maxSize <= 0 {
+		return value
+	}
+	switch v := value.(type) {
+	case string:
+		if len(v) > maxSize {
+			for maxSize > 0 && !utf8.RuneStart(v[maxSize]) {
+				maxSize--
+			}
+			return v[:maxSize]
+		}
+	case []byte:
+		if len(v) > maxSize {
+			return v[:maxSize]
+		}
+	}
+	return value
+}
+
+// once wraps valueFN so that it's only evaluated the first time it's called.
+func once(valueFN func() interface{}) func() interface{} {
+	var o sync.Once
+	var value interface{}
+	return func() interface{} {
+		o.Do(func() {
+			value = valueFN()
+		})
+		return value
+	}
+}
@@ -0,0 +1,112 @@
+package ops_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDynamicLimits(t *testing.T) {
+	defer ops.SetDynamicLimits(ops.DynamicLimits{})
+
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_dynamic_limits", "test_dynamic_op_limits")
+
+	ops.SetDynamicLimits(ops.DynamicLimits{Timeout: 10 * time.Millisecond, MaxSize: 5})
+	ops.Begin("test_dynamic_limits").
+		SetDynamic("panics", func() interface{} { panic("boom") }).
+		SetDynamic("slow", func() interface{} { time.Sleep(time.Second); return 1 }).
+		SetDynamic("large", func() interface{} { return "0123456789" }).
+		SetDynamic("fine", func() interface{} { return 5 }).
+		End()
+	assert.Equal(t, "!dynamic value panicked: boom", reported.Context["panics"])
+	assert.Contains(t, reported.Context["slow"], "timed out")
+	assert.Equal(t, "01234", reported.Context["large"])
+	assert.Equal(t, 5, reported.Context["fine"])
+
+	ops.Begin("test_dynamic_op_limits").
+		SetDynamicLimits(ops.DynamicLimits{}).
+		SetDynamic("large", func() interface{} { return "0123456789" }).
+		End()
+	assert.Equal(t, "0123456789", reported.Context["large"])
+
+	ops.Begin("test_dynamic_op_limits").
+		SetDynamicLimits(ops.DynamicLimits{MaxSize: 5}).
+		SetDynamic("large", func() interface{} { return "abcdé" }).
+		End()
+	assert.Equal(t, "abcd", reported.Context["large"], "runes shouldn't be split")
+}
+
+func TestDynamicTimeoutSharesEvaluation(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_dynamic_shared")
+
+	var evaluations int32
+	release := make(chan interface{})
+	op := ops.Begin("test_dynamic_shared").
+		SetDynamicLimits(ops.DynamicLimits{Timeout: 10 * time.Millisecond}).
+		SetDynamic("slow", func() interface{} {
+			atomic.AddInt32(&evaluations, 1)
+			<-release
+			return 1
+		})
+	for i := 0; i < 5; i++ {
+		assert.Contains(t, op.Snapshot()["slow"], "timed out")
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&evaluations), "reads should wait for the outstanding evaluation")
+
+	close(release)
+	time.Sleep(50 * time.Millisecond)
+	op.End()
+	assert.Equal(t, 1, reported.Context["slow"])
+	assert.EqualValues(t, 2, atomic.LoadInt32(&evaluations))
+}
+
+func TestDynamicOnce(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_dynamic_once")
+
+	evaluations := 0
+	op := ops.Begin("test_dynamic_once").SetDynamicOnce("cached", func() interface{} {
+		evaluations++
+		return evaluations
+	})
+	assert.Equal(t, 1, ops.AsMap(nil, false)["cached"])
+	assert.Equal(t, 1, ops.AsMap(nil, false)["cached"])
+	op.End()
+	assert.Equal(t, 1, reported.Context["cached"])
+	assert.Equal(t, 1, evaluations)
+}
+
+func TestDynamicOnFailure(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_dynamic_on_success", "test_dynamic_on_failure")
+
+	evaluations := 0
+	dump := func() interface{} {
+		evaluations++
+		return "state"
+	}
+	ops.Begin("test_dynamic_on_success").SetDynamicOnFailure("dump", dump).End()
+	assert.Nil(t, reported.Context["dump"])
+	assert.Equal(t, 0, evaluations, "should not evaluate for successful ops")
+
+	op := ops.Begin("test_dynamic_on_failure").SetDynamicOnFailure("dump", dump)
+	assert.Nil(t, ops.AsMap(nil, false)["dump"])
+	op.FailIf(errors.New("failed"))
+	op.End()
+	assert.Equal(t, "state", reported.Context["dump"])
+	assert.Equal(t, 1, evaluations)
+}
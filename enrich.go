@@ -0,0 +1,46 @@
+package ops
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Enricher adds derived values to the context of finished Ops before they're
+// reported, for example looking up the country of a client_ip. Enrichers run
+// before scrubbing, sampling and privacy policies are applied, in the order they
+// were registered.
+type Enricher interface {
+	// Enrich adds values to ctx. failure is the Op's failure, or nil if it
+	// succeeded.
+	Enrich(ctx map[string]interface{}, failure error)
+}
+
+// EnricherFunc adapts a function to the Enricher interface.
+type EnricherFunc func(ctx map[string]interface{}, failure error)
+
+// Enrich implements Enricher.
+func (fn EnricherFunc) Enrich(ctx map[string]interface{}, failure error) {
+	fn(ctx, failure)
+}
+
+var (
+	enrichers      atomic.Value // []Enricher
+	enrichersMutex sync.Mutex
+)
+
+// RegisterEnricher registers the given Enricher.
+func RegisterEnricher(enricher Enricher) {
+	enrichersMutex.Lock()
+	existing, _ := enrichers.Load().([]Enricher)
+	updated := make([]Enricher, 0, len(existing)+1)
+	updated = append(updated, existing...)
+	enrichers.Store(append(updated, enricher))
+	enrichersMutex.Unlock()
+}
+
+func enrich(report *Report) {
+	current, _ := enrichers.Load().([]Enricher)
+	for _, enricher := range current {
+		enricher.Enrich(report.Context, report.Failure)
+	}
+}
@@ -0,0 +1,38 @@
+package ops_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnricher(t *testing.T) {
+	ops.RegisterEnricher(ops.EnricherFunc(func(ctx map[string]interface{}, failure error) {
+		if ctx["op"] != "test_enrich" {
+			return
+		}
+		ctx["enriched"] = ctx["a"].(int) * 2
+		if failure != nil {
+			ctx["enriched_failure"] = ops.ErrorText(failure)
+		}
+	}))
+
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_enrich")
+
+	ops.Begin("test_enrich").Set("a", 2).End()
+	if assert.NotNil(t, reported) {
+		assert.Equal(t, 4, reported.Context["enriched"])
+		assert.Nil(t, reported.Context["enriched_failure"])
+	}
+
+	op := ops.Begin("test_enrich").Set("a", 3)
+	op.FailIf(errors.New("broken"))
+	op.End()
+	assert.Equal(t, 6, reported.Context["enriched"])
+	assert.Equal(t, "broken", reported.Context["enriched_failure"])
+}
@@ -0,0 +1,51 @@
+package ops
+
+import (
+	"sync/atomic"
+)
+
+var environment atomic.Value
+
+func init() {
+	environment.Store("")
+}
+
+// SetEnvironment sets the environment in which this process runs, like "dev",
+// "staging" or "prod". Every report is tagged with it, both in
+// Report.Environment and under the key "environment".
+func SetEnvironment(env string) {
+	environment.Store(env)
+}
+
+// Environment returns the environment set with SetEnvironment.
+func Environment() string {
+	return environment.Load().(string)
+}
+
+// EnvironmentReporter returns a StructuredReporter that delivers each report to
+// the reporter configured for its environment, or to fallback (if not nil) if
+// there's none.
+func EnvironmentReporter(reporters map[string]StructuredReporter, fallback StructuredReporter) StructuredReporter {
+	return func(report *Report) {
+		reporter := reporters[report.Environment]
+		if reporter == nil {
+			reporter = fallback
+		}
+		if reporter != nil {
+			reporter(report)
+		}
+	}
+}
+
+// EnvironmentSampler returns a Sampler that samples using the Sampler
+// configured for the current environment, or fallback if there's none. A nil
+// Sampler keeps all reports.
+func EnvironmentSampler(samplers map[string]Sampler, fallback Sampler) Sampler {
+	return func(report *Report) bool {
+		sampler, found := samplers[report.Environment]
+		if !found {
+			sampler = fallback
+		}
+		return sampler == nil || sampler(report)
+	}
+}
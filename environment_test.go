@@ -0,0 +1,40 @@
+package ops_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvironment(t *testing.T) {
+	defer ops.SetEnvironment("")
+	defer ops.SetSampler(nil)
+
+	var prod, other []*ops.Report
+	ops.RegisterStructuredReporter(ops.EnvironmentReporter(map[string]ops.StructuredReporter{
+		"prod": func(report *ops.Report) { prod = append(prod, report) },
+	}, func(report *ops.Report) {
+		if report.Name == "test_environment" {
+			other = append(other, report)
+		}
+	}))
+	ops.SetSampler(ops.EnvironmentSampler(map[string]ops.Sampler{
+		"dev": func(report *ops.Report) bool { return false },
+	}, nil))
+
+	ops.Begin("test_environment").End()
+	ops.SetEnvironment("dev")
+	ops.Begin("test_environment").End()
+	ops.SetEnvironment("prod")
+	ops.Begin("test_environment").End()
+
+	if assert.Len(t, prod, 1) {
+		assert.Equal(t, "prod", prod[0].Environment)
+		assert.Equal(t, "prod", prod[0].Context["environment"])
+	}
+	if assert.Len(t, other, 1) {
+		assert.Empty(t, other[0].Environment)
+		assert.NotContains(t, other[0].Context, "environment")
+	}
+}
@@ -0,0 +1,58 @@
+package ops
+
+import (
+	"errors"
+	"sync"
+)
+
+type errorCode struct {
+	code  string
+	match func(error) bool
+}
+
+var (
+	errorCodes      []errorCode
+	errorCodesMutex sync.RWMutex
+)
+
+// RegisterErrorCode maps errors matching target (as determined by errors.Is)
+// to the given stable code. Failed ops whose error matches a registered code
+// and that don't have an explicit code (see FailWithCode) are reported with
+// that code under the key "error_code". Codes are matched in the order in
+// which they were registered.
+func RegisterErrorCode(code string, target error) {
+	RegisterErrorCodeFunc(code, func(err error) bool {
+		return errors.Is(err, target)
+	})
+}
+
+// RegisterErrorCodeFunc is like RegisterErrorCode but uses the given function
+// to match errors.
+func RegisterErrorCodeFunc(code string, match func(err error) bool) {
+	errorCodesMutex.Lock()
+	errorCodes = append(errorCodes, errorCode{code, match})
+	errorCodesMutex.Unlock()
+}
+
+// ErrorCode returns the registered code for the given error, or "" if there is
+// none.
+func ErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+	errorCodesMutex.RLock()
+	defer errorCodesMutex.RUnlock()
+	for _, ec := range errorCodes {
+		if ec.match(err) {
+			return ec.code
+		}
+	}
+	return ""
+}
+
+func (o *op) FailWithCode(code string, err error) error {
+	if err != nil {
+		o.Set("error_code", code)
+	}
+	return o.FailIf(err)
+}
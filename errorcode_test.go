@@ -0,0 +1,43 @@
+package ops_test
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorCodes(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_error_code")
+	ops.RegisterErrorCode("E_UNEXPECTED_EOF", io.ErrUnexpectedEOF)
+	ops.RegisterErrorCodeFunc("E_QUOTA", func(err error) bool {
+		return strings.Contains(err.Error(), "quota")
+	})
+
+	assert.Equal(t, "E_UNEXPECTED_EOF", ops.ErrorCode(fmt.Errorf("reading: %w", io.ErrUnexpectedEOF)))
+	assert.Equal(t, "", ops.ErrorCode(errors.New("unknown")))
+	assert.Equal(t, "", ops.ErrorCode(nil))
+
+	op := ops.Begin("test_error_code")
+	op.FailIf(fmt.Errorf("reading: %w", io.ErrUnexpectedEOF))
+	op.End()
+	assert.Equal(t, "E_UNEXPECTED_EOF", reported.Context["error_code"])
+
+	op = ops.Begin("test_error_code")
+	op.FailWithCode("E_EXPLICIT", errors.New("quota exceeded"))
+	op.End()
+	assert.Equal(t, "E_EXPLICIT", reported.Context["error_code"])
+
+	op = ops.Begin("test_error_code")
+	assert.NoError(t, op.FailWithCode("E_EXPLICIT", nil))
+	op.End()
+	assert.True(t, reported.Succeeded())
+	assert.NotContains(t, reported.Context, "error_code")
+}
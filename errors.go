@@ -0,0 +1,144 @@
+package ops
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"sort"
+
+	"github.com/getlantern/context"
+)
+
+// ContextualError is an error carrying Op context, like the errors returned by
+// ErrorWithContext.
+type ContextualError interface {
+	error
+	OpContext() map[string]interface{}
+}
+
+// ErrorWithContext returns an error that wraps err and carries a snapshot of
+// the given Op's context (see Op.Snapshot), so that the Op's metadata travels
+// with the error wherever it ends up. The error formats its context with %+v
+// and logs it as a group with slog. Returns nil if err is nil.
+func ErrorWithContext(o Op, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &contextError{err: err, ctx: o.Snapshot()}
+}
+
+type contextError struct {
+	err error
+	ctx map[string]interface{}
+}
+
+func (e *contextError) Error() string {
+	return e.err.Error()
+}
+
+func (e *contextError) Unwrap() error {
+	return e.err
+}
+
+// OpContext returns the Op context captured with the error.
+func (e *contextError) OpContext() map[string]interface{} {
+	return e.ctx
+}
+
+func (e *contextError) sortedKeys() []string {
+	keys := make([]string, 0, len(e.ctx))
+	for key := range e.ctx {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Format implements fmt.Formatter. %+v includes the Op context.
+func (e *contextError) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		io.WriteString(s, e.err.Error())
+		if s.Flag('+') {
+			for _, key := range e.sortedKeys() {
+				fmt.Fprintf(s, " %v=%v", key, e.ctx[key])
+			}
+		}
+	case 's':
+		io.WriteString(s, e.err.Error())
+	case 'q':
+		fmt.Fprintf(s, "%q", e.err.Error())
+	default:
+		fmt.Fprintf(s, "%%!%c(%s)", verb, e.err.Error())
+	}
+}
+
+// LogValue implements slog.LogValuer.
+func (e *contextError) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, len(e.ctx)+1)
+	attrs = append(attrs, slog.String("msg", e.err.Error()))
+	for _, key := range e.sortedKeys() {
+		attrs = append(attrs, slog.Any(key, e.ctx[key]))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// mergeErrorContext merges the context of any ContextualError in err's chain
+// into this op. Keys identifying the originating op are recorded as error_op
+// and error_op_id, since this op has its own.
+func (o *op) mergeErrorContext(err error) {
+	var ce ContextualError
+	if !errors.As(err, &ce) {
+		return
+	}
+	for key, value := range ce.OpContext() {
+		switch key {
+		case "op":
+			o.ctx.PutIfAbsent("error_op", value)
+		case "op_id":
+			if value != o.id {
+				o.ctx.PutIfAbsent("error_op_id", value)
+			}
+		case "error", "schema_version":
+			// these get set when reporting
+		default:
+			o.ctx.PutIfAbsent(key, value)
+		}
+	}
+}
+
+// mergeErrorFields merges the fields of any context.Contextual error in err's
+// chain (like the errors from github.com/getlantern/errors) into ctx, so that
+// the error's context and the op's context make up a single report. Keys the op
+// set itself are never overwritten. A conflicting value from the error is
+// recorded under "error_" + key instead, so for example the op that created the
+// error shows up as error_op. Fields with the same value in both are only
+// included once.
+//
+// Such errors also capture the context that was current when they were
+// created. If that was this op's own context, it's just an earlier copy of ctx
+// (with stale dynamic values), so only the fields that ctx lacks are merged.
+func (o *op) mergeErrorFields(ctx map[string]interface{}, err error) {
+	var contextual context.Contextual
+	if !errors.As(err, &contextual) {
+		return
+	}
+	fields := make(context.Map)
+	contextual.Fill(fields)
+	ownContext := fields["op_id"] == o.id
+	for key, value := range fields {
+		existing, found := ctx[key]
+		if !found {
+			ctx[key] = value
+			continue
+		}
+		if ownContext || reflect.DeepEqual(existing, value) {
+			continue
+		}
+		if _, found := ctx["error_"+key]; !found {
+			ctx["error_"+key] = value
+		}
+	}
+}
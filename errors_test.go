@@ -0,0 +1,108 @@
+package ops_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+
+	gerrors "github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorWithContext(t *testing.T) {
+	op := ops.Begin("test_error_context_nil")
+	assert.Nil(t, ops.ErrorWithContext(op, nil))
+	op.End()
+
+	op = ops.Begin("test_error_context").Set("upstream", "example.com")
+	err := ops.ErrorWithContext(op, fmt.Errorf("dialing: %w", io.EOF))
+	op.End()
+
+	assert.True(t, errors.Is(err, io.EOF))
+	assert.Equal(t, "dialing: EOF", err.Error())
+	assert.Equal(t, "dialing: EOF", fmt.Sprintf("%v", err))
+	assert.Contains(t, fmt.Sprintf("%+v", err), " upstream=example.com")
+	ctxErr := err.(interface{ OpContext() map[string]interface{} })
+	assert.Equal(t, "test_error_context", ctxErr.OpContext()["op"])
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Error("failed", "err", err)
+	record := make(map[string]interface{})
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &record)) {
+		logged := record["err"].(map[string]interface{})
+		assert.Equal(t, "dialing: EOF", logged["msg"])
+		assert.Equal(t, "example.com", logged["upstream"])
+	}
+}
+
+func TestFailIfMergesErrorContext(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "inner", "outer")
+
+	inner := ops.Begin("inner").Set("upstream", "example.com").Set("shared", "inner")
+	err := ops.ErrorWithContext(inner, errors.New("inner failed"))
+	inner.End()
+
+	outer := ops.Begin("outer").Set("shared", "outer")
+	outer.FailIf(fmt.Errorf("wrapped: %w", err))
+	outer.End()
+
+	assert.Equal(t, "outer", reported.Context["op"])
+	assert.Equal(t, "example.com", reported.Context["upstream"])
+	assert.Equal(t, "outer", reported.Context["shared"], "should not overwrite existing keys")
+	assert.Equal(t, "inner", reported.Context["error_op"])
+	assert.Equal(t, inner.ID(), reported.Context["error_op_id"])
+	assert.Equal(t, "wrapped: inner failed", reported.Context["error"])
+}
+
+func TestReportMergesStructuredErrorFields(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "fetch")
+
+	err := gerrors.New("dial failed").
+		With("op", "dial").
+		With("host", "example.com").
+		With("shared", "same").
+		With("conflicting", "from error")
+	op := ops.Begin("fetch").Set("shared", "same").Set("conflicting", "from op")
+	op.FailIf(err)
+	op.End()
+
+	assert.Equal(t, "fetch", reported.Context["op"])
+	assert.Equal(t, "dial", reported.Context["error_op"])
+	assert.Equal(t, "example.com", reported.Context["host"])
+	assert.Equal(t, "same", reported.Context["shared"])
+	assert.Nil(t, reported.Context["error_shared"], "identical values should not be duplicated")
+	assert.Equal(t, "from op", reported.Context["conflicting"])
+	assert.Equal(t, "from error", reported.Context["error_conflicting"])
+	assert.Equal(t, "dial failed", reported.Context["error"])
+	assert.Equal(t, "errors.Error", reported.Context["error_type"])
+}
+
+func TestReportKeepsOpFieldsOverErrorFields(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "upload")
+
+	op := ops.Begin("upload").Set("error_code", "quota").Set("bytes", 1)
+	err := gerrors.New("upload failed").With("error_code", "io").With("attempt", 2)
+	op.Set("bytes", 2)
+	op.FailIf(err)
+	op.End()
+
+	assert.Equal(t, "quota", reported.Context["error_code"], "error fields shouldn't overwrite the op's")
+	assert.Equal(t, 2, reported.Context["bytes"])
+	assert.Nil(t, reported.Context["error_bytes"], "the op's own context captured by the error shouldn't be duplicated")
+	assert.Equal(t, 2, reported.Context["attempt"])
+	assert.Equal(t, "upload failed", reported.Context["error"])
+}
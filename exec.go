@@ -0,0 +1,53 @@
+package ops
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// InjectEnv adds environment variables carrying the identity of the given Op
+// to cmd, so that a child process can continue the trace with FromEnv. If
+// cmd.Env is nil, it is initialized from the current environment first.
+func InjectEnv(o Op, cmd *exec.Cmd) {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	carrier := make(envCarrier)
+	Inject(o, carrier)
+	for key, value := range carrier {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+}
+
+// FromEnv is like BeginRemote, but continues the trace found in the
+// environment of the current process, as set up by InjectEnv.
+func FromEnv(name string) Op {
+	return BeginRemote(name, osEnvCarrier{})
+}
+
+// envKey converts a header style key like X-B3-TraceId into an environment
+// variable name like X_B3_TRACEID.
+func envKey(key string) string {
+	return strings.ToUpper(strings.Replace(key, "-", "_", -1))
+}
+
+type envCarrier map[string]string
+
+func (c envCarrier) Get(key string) string {
+	return c[envKey(key)]
+}
+
+func (c envCarrier) Set(key, value string) {
+	c[envKey(key)] = value
+}
+
+type osEnvCarrier struct{}
+
+func (osEnvCarrier) Get(key string) string {
+	return os.Getenv(envKey(key))
+}
+
+func (osEnvCarrier) Set(key, value string) {
+	os.Setenv(envKey(key), value)
+}
@@ -0,0 +1,31 @@
+package ops_test
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvPropagation(t *testing.T) {
+	op := ops.Begin("parent")
+	defer op.End()
+
+	cmd := exec.Command("child")
+	ops.InjectEnv(op, cmd)
+	for _, kv := range cmd.Env {
+		if strings.HasPrefix(kv, "X_B3_") {
+			parts := strings.SplitN(kv, "=", 2)
+			os.Setenv(parts[0], parts[1])
+			defer os.Unsetenv(parts[0])
+		}
+	}
+
+	child := ops.FromEnv("child")
+	defer child.End()
+	assert.Equal(t, op.TraceID(), child.TraceID())
+	assert.Equal(t, op.ID(), child.ParentID())
+}
@@ -0,0 +1,54 @@
+package ops
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var (
+	ipv4Pattern = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}(?::\d+)?\b`)
+	ipv6Pattern = regexp.MustCompile(`\[[0-9a-fA-F:.]+\](?::\d+)?|\b[0-9a-fA-F]{1,4}(?::[0-9a-fA-F]{0,4}){2,7}\b`)
+)
+
+var fingerprintNormalizers = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`"[^"]*"|'[^']*'`), "<str>"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{ipv4Pattern, "<ip>"},
+	{ipv6Pattern, "<ip>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b|\b[0-9a-f]*\d[0-9a-f]*[a-f][0-9a-f]*\b|\b[0-9a-f]*[a-f][0-9a-f]*\d[0-9a-f]*\b`), "<hex>"},
+	{regexp.MustCompile(`\d+(?:\.\d+)?`), "<n>"},
+}
+
+// Fingerprint computes a stable fingerprint for a failure of the op with the
+// given name, so that identical failures can be grouped. It hashes the op name,
+// the type of the innermost wrapped error and the error message with variable
+// parts like quoted strings, ids, IP addresses and numbers replaced by
+// placeholders. Failed ops are reported with their fingerprint under the key
+// "error_fingerprint".
+func Fingerprint(name string, err error) string {
+	root := err
+	for {
+		unwrapped := errors.Unwrap(root)
+		if unwrapped == nil {
+			break
+		}
+		root = unwrapped
+	}
+	sum := sha256.Sum256([]byte(name + "|" + fmt.Sprintf("%T", root) + "|" + NormalizeErrorMessage(ErrorText(err))))
+	return hex.EncodeToString(sum[:8])
+}
+
+// NormalizeErrorMessage replaces the variable parts of an error message with
+// placeholders, as used by Fingerprint.
+func NormalizeErrorMessage(msg string) string {
+	for _, n := range fingerprintNormalizers {
+		msg = n.pattern.ReplaceAllString(msg, n.replacement)
+	}
+	return msg
+}
@@ -0,0 +1,37 @@
+package ops_test
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeErrorMessage(t *testing.T) {
+	assert.Equal(t, "dial tcp <ip>: i/o timeout after <n>s", ops.NormalizeErrorMessage("dial tcp 10.0.0.1:443: i/o timeout after 5.2s"))
+	assert.Equal(t, "dial tcp <ip>: refused", ops.NormalizeErrorMessage("dial tcp [2001:db8::1]:443: refused"))
+	assert.Equal(t, "user <str> not found (id <uuid>)", ops.NormalizeErrorMessage(`user "bob" not found (id 123e4567-e89b-12d3-a456-426614174000)`))
+	assert.Equal(t, "bad checksum <hex>", ops.NormalizeErrorMessage("bad checksum 9f86d081884c"))
+}
+
+func TestFingerprint(t *testing.T) {
+	a := ops.Fingerprint("dial", fmt.Errorf("dial 10.0.0.1:443: %w", io.EOF))
+	b := ops.Fingerprint("dial", fmt.Errorf("dial 10.0.0.2:8080: %w", io.EOF))
+	assert.Equal(t, a, b)
+	assert.Len(t, a, 16)
+	assert.NotEqual(t, a, ops.Fingerprint("fetch", fmt.Errorf("dial 10.0.0.1:443: %w", io.EOF)))
+	assert.NotEqual(t, a, ops.Fingerprint("dial", errors.New("dial 10.0.0.1:443: EOF")), "error type should matter")
+	assert.Equal(t, ops.Fingerprint("dial", errors.New("refused")), ops.Fingerprint("dial", errors.New("refused")), "hidden error ids should be ignored")
+
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "dial")
+	op := ops.Begin("dial")
+	op.FailIf(fmt.Errorf("dial 10.0.0.3:80: %w", io.EOF))
+	op.End()
+	assert.Equal(t, a, reported.Context["error_fingerprint"])
+}
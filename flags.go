@@ -0,0 +1,105 @@
+package ops
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+// Names of the flags looked up in the Flags set with SetFlags. Each flag is
+// evaluated with the context of an op, which includes "op" and "root_op", so
+// that providers can target particular ops as well as cohorts like countries
+// or user tiers.
+const (
+	// FlagEnabled (bool, default true) decides whether reports are delivered.
+	FlagEnabled = "ops.enabled"
+
+	// FlagSampleRate (float, default 1) is the fraction of reports kept, on
+	// top of the Sampler. Kept reports with a rate below 1 get the key
+	// "sample_rate", multiplied by any rate the Sampler recorded.
+	FlagSampleRate = "ops.sample_rate"
+
+	// FlagDebug (bool, default false) turns on debug capture for ops that
+	// don't have DebugKey set. It is evaluated when root ops begin, as if
+	// DebugKey had been set on them, and when ops end, delivering their reports
+	// regardless of sampling.
+	FlagDebug = "ops.debug"
+)
+
+// Flags provides the values of feature flags, like the client of a
+// feature-flag service, letting operators adjust telemetry without deploys.
+// Implementations must be fast and safe for concurrent use, as flags are
+// evaluated for every report.
+type Flags interface {
+	// Bool returns the value of the boolean flag for the given context, or
+	// fallback if the flag isn't set.
+	Bool(flag string, ctx map[string]interface{}, fallback bool) bool
+
+	// Float returns the value of the numeric flag for the given context, or
+	// fallback if the flag isn't set.
+	Float(flag string, ctx map[string]interface{}, fallback float64) float64
+}
+
+var currentFlags atomic.Value
+
+type flagsHolder struct {
+	flags Flags
+}
+
+// SetFlags sets the Flags that drive telemetry. Nil (the default) leaves all
+// flags at their defaults.
+func SetFlags(flags Flags) {
+	currentFlags.Store(flagsHolder{flags})
+}
+
+func loadFlags() Flags {
+	holder, _ := currentFlags.Load().(flagsHolder)
+	return holder.flags
+}
+
+// applyDebugFlag turns on debug capture for a root op if FlagDebug says so,
+// unless DebugKey is already set.
+func (o *op) applyDebugFlag() {
+	flags := loadFlags()
+	if flags == nil {
+		return
+	}
+	ctx := o.ctx.AsMap(nil, true)
+	if _, set := ctx[DebugKey]; set || !flags.Bool(FlagDebug, ctx, false) {
+		return
+	}
+	o.ctx.Put(DebugKey, true)
+	o.setDebug(true)
+}
+
+// flagsDecision applies the flags to the report, returning whether it is
+// disabled, whether it is to be debugged and the sample rate to apply.
+func flagsDecision(report *Report) (disabled bool, debug bool, rate float64) {
+	flags := loadFlags()
+	if flags == nil {
+		return false, false, 1
+	}
+	if !flags.Bool(FlagEnabled, report.Context, true) {
+		return true, false, 0
+	}
+	if _, set := report.Context[DebugKey]; !set && flags.Bool(FlagDebug, report.Context, false) {
+		report.Context[DebugKey] = true
+		return false, true, 1
+	}
+	return false, false, flags.Float(FlagSampleRate, report.Context, 1)
+}
+
+// sampleFlagRate keeps the given fraction of reports, recording the rate on
+// those kept.
+func sampleFlagRate(report *Report, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 || rand.Float64() >= rate {
+		return false
+	}
+	if existing, ok := report.Context["sample_rate"].(float64); ok {
+		rate *= existing
+	}
+	report.Context["sample_rate"] = rate
+	return true
+}
@@ -0,0 +1,101 @@
+package ops_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+// cohortFlags sets flags for ops in the given country.
+type cohortFlags struct {
+	country string
+	bools   map[string]bool
+	floats  map[string]float64
+}
+
+func (f *cohortFlags) Bool(flag string, ctx map[string]interface{}, fallback bool) bool {
+	if value, ok := f.bools[flag]; ok && ctx["country"] == f.country {
+		return value
+	}
+	return fallback
+}
+
+func (f *cohortFlags) Float(flag string, ctx map[string]interface{}, fallback float64) float64 {
+	if value, ok := f.floats[flag]; ok && ctx["country"] == f.country {
+		return value
+	}
+	return fallback
+}
+
+func TestFlags(t *testing.T) {
+	defer ops.SetFlags(nil)
+	var reported []*ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = append(reported, report)
+	}, "flagged")
+
+	ops.SetFlags(&cohortFlags{country: "US", bools: map[string]bool{ops.FlagEnabled: false}})
+	ops.Begin("flagged").Set("country", "US").End()
+	ops.Begin("flagged").Set("country", "DE").End()
+	if assert.Len(t, reported, 1, "ops in the cohort should be disabled") {
+		assert.Equal(t, "DE", reported[0].Context["country"])
+	}
+
+	reported = nil
+	ops.SetFlags(&cohortFlags{country: "US", floats: map[string]float64{ops.FlagSampleRate: 0.5}})
+	for i := 0; i < 1000; i++ {
+		ops.Begin("flagged").Set("country", "US").End()
+	}
+	assert.InDelta(t, 500, len(reported), 100)
+	if assert.NotEmpty(t, reported) {
+		assert.Equal(t, 0.5, reported[0].Context["sample_rate"])
+	}
+
+	reported = nil
+	ops.SetFlags(&cohortFlags{country: "US", floats: map[string]float64{ops.FlagSampleRate: 0}})
+	ops.Begin("flagged").Set("country", "US").SetPriority(ops.PriorityHigh).End()
+	assert.Len(t, reported, 1, "high priority reports should bypass the sample rate")
+
+	ops.SetFlags(nil)
+	reported = nil
+	ops.Begin("flagged").Set("country", "US").End()
+	assert.Len(t, reported, 1)
+}
+
+func TestDebugFlag(t *testing.T) {
+	defer ops.SetFlags(nil)
+	defer ops.SetSampler(nil)
+	ops.SetSampler(func(report *ops.Report) bool { return false })
+	var reported []*ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = append(reported, report)
+	}, "debug_flagged", "debug_flagged_child")
+
+	ops.SetFlags(&cohortFlags{country: "US", bools: map[string]bool{ops.FlagDebug: true}})
+	ops.Begin("debug_flagged").Set("country", "DE").End()
+	assert.Empty(t, reported)
+
+	ops.Begin("debug_flagged").Set("country", "US").End()
+	if assert.Len(t, reported, 1, "flag should bypass sampling when ending") {
+		assert.Equal(t, true, reported[0].Context[ops.DebugKey])
+	}
+
+	// The cohort is known when the root begins, so children capture stacks
+	reported = nil
+	ambient := ops.Begin("ambient").Set("country", "US")
+	root := ops.Begin("debug_flagged")
+	child := root.Begin("debug_flagged_child")
+	child.FailIf(errors.New("failed"))
+	child.End()
+	root.End()
+	ambient.End()
+	if assert.Len(t, reported, 2) {
+		assert.Contains(t, reported[0].Context["stack"], "TestDebugFlag")
+	}
+
+	reported = nil
+	ops.BeginWith("debug_flagged", "country", "US", ops.DebugKey, false).End()
+	assert.Empty(t, reported, "explicit debug key should win over the flag")
+}
@@ -0,0 +1,75 @@
+package ops
+
+import (
+	"net"
+	"strings"
+)
+
+// GeoInfo is what a GeoIPProvider knows about an IP address. Empty or zero
+// fields are unknown.
+type GeoInfo struct {
+	Country string // ISO 3166-1 alpha-2 code, like "IR"
+	Region  string // ISO 3166-2 subdivision code, like "THR"
+	ASN     uint
+	ASOrg   string
+}
+
+// GeoIPProvider looks up geolocation data for IP addresses. Implementations
+// typically wrap a MaxMind GeoIP2/GeoLite2 database.
+type GeoIPProvider interface {
+	Lookup(ip net.IP) (GeoInfo, error)
+}
+
+// DefaultGeoIPKeys are the keys enriched by GeoIPEnricher if none are given.
+var DefaultGeoIPKeys = []string{"client_ip", "proxy_ip"}
+
+// GeoIPEnricher returns an Enricher that looks up the IP addresses found under
+// the given keys (DefaultGeoIPKeys if none are given) and adds the results
+// under the key's prefix. For example, client_ip is enriched with
+// client_country, client_region, client_asn and client_as_org. Values may be
+// net.IPs or strings containing an IP or host:port. Failed lookups and
+// unknown fields add nothing.
+//
+// Since enrichers run before privacy policies, the IP keys can still be
+// dropped or truncated by PrivacyPolicy while keeping the derived geography.
+func GeoIPEnricher(provider GeoIPProvider, keys ...string) Enricher {
+	if len(keys) == 0 {
+		keys = DefaultGeoIPKeys
+	}
+	return &geoIPEnricher{provider: provider, keys: keys}
+}
+
+type geoIPEnricher struct {
+	provider GeoIPProvider
+	keys     []string
+}
+
+func (e *geoIPEnricher) Enrich(ctx map[string]interface{}, failure error) {
+	for _, key := range e.keys {
+		value, found := ctx[key]
+		if !found {
+			continue
+		}
+		ip := parseIP(value)
+		if ip == nil {
+			continue
+		}
+		info, err := e.provider.Lookup(ip)
+		if err != nil {
+			continue
+		}
+		prefix := strings.TrimSuffix(key, "_ip") + "_"
+		if info.Country != "" {
+			ctx[prefix+"country"] = info.Country
+		}
+		if info.Region != "" {
+			ctx[prefix+"region"] = info.Region
+		}
+		if info.ASN != 0 {
+			ctx[prefix+"asn"] = info.ASN
+		}
+		if info.ASOrg != "" {
+			ctx[prefix+"as_org"] = info.ASOrg
+		}
+	}
+}
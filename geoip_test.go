@@ -0,0 +1,49 @@
+package ops_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+type testGeoIP map[string]ops.GeoInfo
+
+func (db testGeoIP) Lookup(ip net.IP) (ops.GeoInfo, error) {
+	info, found := db[ip.String()]
+	if !found {
+		return info, errors.New("not found")
+	}
+	return info, nil
+}
+
+func TestGeoIPEnricher(t *testing.T) {
+	enricher := ops.GeoIPEnricher(testGeoIP{
+		"5.160.0.1": {Country: "IR", Region: "THR", ASN: 58224, ASOrg: "TCI"},
+		"1.1.1.1":   {Country: "AU", ASN: 13335},
+	})
+
+	ctx := map[string]interface{}{
+		"client_ip": "5.160.0.1:51234",
+		"proxy_ip":  net.ParseIP("1.1.1.1"),
+	}
+	enricher.Enrich(ctx, nil)
+	assert.Equal(t, "IR", ctx["client_country"])
+	assert.Equal(t, "THR", ctx["client_region"])
+	assert.EqualValues(t, 58224, ctx["client_asn"])
+	assert.Equal(t, "TCI", ctx["client_as_org"])
+	assert.Equal(t, "AU", ctx["proxy_country"])
+	assert.EqualValues(t, 13335, ctx["proxy_asn"])
+	assert.Nil(t, ctx["proxy_region"])
+	assert.Nil(t, ctx["proxy_as_org"])
+
+	ctx = map[string]interface{}{"client_ip": "8.8.8.8", "proxy_ip": "not an ip"}
+	enricher.Enrich(ctx, nil)
+	assert.Len(t, ctx, 2)
+
+	ctx = map[string]interface{}{"upstream_ip": "1.1.1.1"}
+	ops.GeoIPEnricher(testGeoIP{"1.1.1.1": {Country: "AU"}}, "upstream_ip").Enrich(ctx, nil)
+	assert.Equal(t, "AU", ctx["upstream_country"])
+}
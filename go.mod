@@ -0,0 +1,18 @@
+module github.com/getlantern/ops
+
+go 1.21
+
+require (
+	github.com/getlantern/context v0.0.0-20190109183933-c447772a6520
+	github.com/getlantern/errors v1.0.1
+	github.com/getlantern/hidden v0.0.0-20190325191715-f02dbb02be55
+	github.com/stretchr/testify v1.8.4
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/getlantern/hex v0.0.0-20190417191902-c6586a6fe0b7 // indirect
+	github.com/go-stack/stack v1.8.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,136 @@
+package ops
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GraphRecorder is a debugging aid that records the graph of ops in recent
+// traces (names, durations and outcomes) so it can be exported as a Graphviz
+// DOT or Mermaid diagram.
+type GraphRecorder struct {
+	maxTraces int
+	traces    map[string][]graphNode
+	order     []string
+	mx        sync.Mutex
+}
+
+type graphNode struct {
+	id        string
+	parentID  string
+	name      string
+	duration  time.Duration
+	succeeded bool
+}
+
+// NewGraphRecorder creates a GraphRecorder that remembers up to maxTraces
+// traces, forgetting the oldest ones first. Register it with
+// RegisterStructuredReporter(recorder.Report).
+func NewGraphRecorder(maxTraces int) *GraphRecorder {
+	return &GraphRecorder{maxTraces: maxTraces, traces: make(map[string][]graphNode)}
+}
+
+// Report records the given report.
+func (g *GraphRecorder) Report(report *Report) {
+	if report.TraceID == "" {
+		return
+	}
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	if _, found := g.traces[report.TraceID]; !found {
+		if len(g.order) >= g.maxTraces {
+			delete(g.traces, g.order[0])
+			g.order = g.order[1:]
+		}
+		g.order = append(g.order, report.TraceID)
+	}
+	g.traces[report.TraceID] = append(g.traces[report.TraceID], graphNode{
+		id:        report.ID,
+		parentID:  report.ParentID,
+		name:      report.Name,
+		duration:  report.Duration,
+		succeeded: report.Succeeded(),
+	})
+}
+
+// Traces returns the ids of the recorded traces, oldest first.
+func (g *GraphRecorder) Traces() []string {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+	return append([]string{}, g.order...)
+}
+
+func (g *GraphRecorder) nodes(traceID string) ([]graphNode, map[string]bool) {
+	g.mx.Lock()
+	nodes := append([]graphNode{}, g.traces[traceID]...)
+	g.mx.Unlock()
+	ids := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		ids[node.id] = true
+	}
+	return nodes, ids
+}
+
+func (n graphNode) label() string {
+	outcome := "ok"
+	if !n.succeeded {
+		outcome = "failed"
+	}
+	return fmt.Sprintf("%s (%v, %s)", n.name, n.duration.Round(time.Microsecond), outcome)
+}
+
+// WriteDOT writes the graph of the given trace in Graphviz DOT format. Parents
+// that weren't recorded (for example remote ones) are shown as dashed nodes.
+func (g *GraphRecorder) WriteDOT(w io.Writer, traceID string) error {
+	nodes, ids := g.nodes(traceID)
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n", traceID)
+	for _, node := range nodes {
+		color := "black"
+		if !node.succeeded {
+			color = "red"
+		}
+		fmt.Fprintf(&b, "  %q [label=%q, color=%s];\n", node.id, node.label(), color)
+	}
+	for _, node := range nodes {
+		if node.parentID == "" {
+			continue
+		}
+		if !ids[node.parentID] {
+			ids[node.parentID] = true
+			fmt.Fprintf(&b, "  %q [label=%q, style=dashed];\n", node.parentID, "remote "+node.parentID)
+		}
+		fmt.Fprintf(&b, "  %q -> %q;\n", node.parentID, node.id)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteMermaid writes the graph of the given trace as a Mermaid flowchart.
+func (g *GraphRecorder) WriteMermaid(w io.Writer, traceID string) error {
+	nodes, ids := g.nodes(traceID)
+	var b strings.Builder
+	b.WriteString("flowchart TD\n")
+	for _, node := range nodes {
+		fmt.Fprintf(&b, "  op_%s[\"%s\"]\n", node.id, strings.Replace(node.label(), `"`, "#quot;", -1))
+		if !node.succeeded {
+			fmt.Fprintf(&b, "  style op_%s stroke:#f00\n", node.id)
+		}
+	}
+	for _, node := range nodes {
+		if node.parentID == "" {
+			continue
+		}
+		if !ids[node.parentID] {
+			ids[node.parentID] = true
+			fmt.Fprintf(&b, "  op_%s([\"remote %s\"])\n", node.parentID, node.parentID)
+		}
+		fmt.Fprintf(&b, "  op_%s --> op_%s\n", node.parentID, node.id)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,38 @@
+package ops_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGraphRecorder(t *testing.T) {
+	g := ops.NewGraphRecorder(2)
+	ops.RegisterStructuredReporter(g.Report)
+
+	root := ops.Begin("graph_root")
+	child := root.Begin("graph_child")
+	child.FailIf(errors.New("failed"))
+	child.End()
+	root.End()
+
+	var dot bytes.Buffer
+	assert.NoError(t, g.WriteDOT(&dot, root.TraceID()))
+	assert.Contains(t, dot.String(), fmt.Sprintf("digraph %q {", root.TraceID()))
+	assert.Contains(t, dot.String(), fmt.Sprintf("%q -> %q;", root.ID(), child.ID()))
+	assert.Contains(t, dot.String(), "color=red")
+
+	var mermaid bytes.Buffer
+	assert.NoError(t, g.WriteMermaid(&mermaid, root.TraceID()))
+	assert.Contains(t, mermaid.String(), "flowchart TD")
+	assert.Contains(t, mermaid.String(), fmt.Sprintf("op_%s --> op_%s", root.ID(), child.ID()))
+
+	ops.Begin("second").End()
+	ops.Begin("third").End()
+	assert.Len(t, g.Traces(), 2)
+	assert.NotContains(t, g.Traces(), root.TraceID(), "oldest trace should be forgotten")
+}
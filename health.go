@@ -0,0 +1,137 @@
+package ops
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthBuckets is the number of buckets a HealthCheck's window is divided
+// into.
+const healthBuckets = 10
+
+// Health tracks the recent success rate of ops with a given name. See
+// HealthCheck.
+type Health struct {
+	name      string
+	window    time.Duration
+	threshold float64
+	buckets   [healthBuckets]healthBucket
+	mx        sync.Mutex
+}
+
+type healthBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+var (
+	healthChecks      []*Health
+	healthChecksMutex sync.Mutex
+)
+
+// HealthCheck starts tracking the success rate of ops with the given name over
+// a sliding window (with a granularity of a tenth of the window). The check is
+// healthy while the success rate is at least threshold (between 0 and 1), or
+// while there have been no ops in the window. Windows shorter than a
+// nanosecond per bucket are lengthened to that.
+func HealthCheck(name string, window time.Duration, threshold float64) *Health {
+	if window < healthBuckets {
+		window = healthBuckets
+	}
+	h := &Health{name: name, window: window, threshold: threshold}
+	RegisterStructuredReporterFor(h.report, name)
+	healthChecksMutex.Lock()
+	healthChecks = append(healthChecks, h)
+	healthChecksMutex.Unlock()
+	return h
+}
+
+func (h *Health) report(report *Report) {
+	if report.InProgress {
+		return
+	}
+	now := time.Now()
+	width := h.window / healthBuckets
+	start := now.Truncate(width)
+	h.mx.Lock()
+	b := &h.buckets[(start.UnixNano()/int64(width))%healthBuckets]
+	if !b.start.Equal(start) {
+		*b = healthBucket{start: start}
+	}
+	if report.Succeeded() {
+		b.successes++
+	} else {
+		b.failures++
+	}
+	h.mx.Unlock()
+}
+
+// Name returns the name of the ops tracked by this check.
+func (h *Health) Name() string {
+	return h.name
+}
+
+// SuccessRate returns the success rate over the window and the number of ops
+// it's based on. With no ops, the rate is 1.
+func (h *Health) SuccessRate() (rate float64, count int) {
+	cutoff := time.Now().Add(-h.window)
+	var successes int
+	h.mx.Lock()
+	for _, b := range h.buckets {
+		if b.start.After(cutoff) {
+			successes += b.successes
+			count += b.successes + b.failures
+		}
+	}
+	h.mx.Unlock()
+	if count == 0 {
+		return 1, 0
+	}
+	return float64(successes) / float64(count), count
+}
+
+// Healthy indicates whether the success rate is at least the threshold.
+func (h *Health) Healthy() bool {
+	rate, _ := h.SuccessRate()
+	return rate >= h.threshold
+}
+
+// HealthHandler returns an http.Handler that serves the aggregate health of
+// the given checks (all checks created with HealthCheck if none are given),
+// responding with 200 if all of them are healthy and 503 otherwise. The body is
+// a JSON object describing each check, suitable for readiness and liveness
+// probes.
+func HealthHandler(checks ...*Health) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		current := checks
+		if len(current) == 0 {
+			healthChecksMutex.Lock()
+			current = append(current, healthChecks...)
+			healthChecksMutex.Unlock()
+		}
+		healthy := true
+		details := make(map[string]interface{}, len(current))
+		for _, h := range current {
+			rate, count := h.SuccessRate()
+			checkHealthy := rate >= h.threshold
+			healthy = healthy && checkHealthy
+			details[h.name] = map[string]interface{}{
+				"healthy":      checkHealthy,
+				"success_rate": rate,
+				"count":        count,
+				"threshold":    h.threshold,
+			}
+		}
+		resp.Header().Set("Content-Type", "application/json")
+		if !healthy {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(resp).Encode(map[string]interface{}{
+			"healthy": healthy,
+			"checks":  details,
+		})
+	})
+}
@@ -0,0 +1,71 @@
+package ops_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthCheck(t *testing.T) {
+	h := ops.HealthCheck("test_health", time.Minute, 0.75)
+	assert.True(t, h.Healthy(), "no ops should be healthy")
+
+	for i := 0; i < 3; i++ {
+		ops.Begin("test_health").End()
+	}
+	op := ops.Begin("test_health")
+	op.FailIf(errors.New("failed"))
+	op.End()
+	rate, count := h.SuccessRate()
+	assert.Equal(t, 0.75, rate)
+	assert.Equal(t, 4, count)
+	assert.True(t, h.Healthy())
+
+	serve := func() (int, map[string]interface{}) {
+		rec := httptest.NewRecorder()
+		ops.HealthHandler(h).ServeHTTP(rec, httptest.NewRequest("GET", "/health", nil))
+		body := make(map[string]interface{})
+		json.Unmarshal(rec.Body.Bytes(), &body)
+		return rec.Code, body
+	}
+	code, body := serve()
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, true, body["healthy"])
+
+	op = ops.Begin("test_health")
+	op.FailIf(errors.New("failed"))
+	op.End()
+	assert.False(t, h.Healthy())
+	code, body = serve()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, false, body["healthy"])
+	check := body["checks"].(map[string]interface{})["test_health"].(map[string]interface{})
+	assert.EqualValues(t, 5, check["count"])
+	assert.Equal(t, "test_health", h.Name())
+}
+
+func TestHealthCheckWindow(t *testing.T) {
+	h := ops.HealthCheck("test_health_window", 50*time.Millisecond, 1)
+	op := ops.Begin("test_health_window")
+	op.FailIf(errors.New("failed"))
+	op.End()
+	assert.False(t, h.Healthy())
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, h.Healthy(), "failure should have left the window")
+}
+
+func TestHealthCheckTinyWindow(t *testing.T) {
+	for i, window := range []time.Duration{0, 5} {
+		name := fmt.Sprintf("test_health_tiny_window_%d", i)
+		h := ops.HealthCheck(name, window, 1)
+		assert.NotPanics(t, func() { ops.Begin(name).End() })
+		assert.True(t, h.Healthy())
+	}
+}
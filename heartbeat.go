@@ -0,0 +1,70 @@
+package ops
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	progressReporters      atomic.Value // []StructuredReporter, copied on write
+	progressReportersMutex sync.Mutex
+)
+
+// RegisterProgressReporter registers a reporter for the progress reports
+// emitted by Op.Heartbeat, which have InProgress set. Progress reports aren't
+// delivered to any other reporters, so that reporters counting ops don't count
+// the same op again for every beat.
+func RegisterProgressReporter(reporter StructuredReporter) {
+	progressReportersMutex.Lock()
+	existing, _ := progressReporters.Load().([]StructuredReporter)
+	updated := make([]StructuredReporter, 0, len(existing)+1)
+	updated = append(updated, existing...)
+	progressReporters.Store(append(updated, reporter))
+	progressReportersMutex.Unlock()
+}
+
+func (o *op) Heartbeat(interval time.Duration) Op {
+	o.beatMx.Lock()
+	defer o.beatMx.Unlock()
+	if o.stopBeat != nil {
+		close(o.stopBeat)
+	}
+	stop := make(chan interface{})
+	o.stopBeat = stop
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				o.beat()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return o
+}
+
+// beat emits a progress report. Progress reports bypass sampling.
+func (o *op) beat() {
+	reportersCopy, _ := progressReporters.Load().([]StructuredReporter)
+	if len(reportersCopy) == 0 {
+		return
+	}
+	report := o.report()
+	report.InProgress = true
+	report.Context["in_progress"] = true
+	report.Context["elapsed"] = report.Duration
+	dispatch(reportersCopy, report)
+}
+
+func (o *op) stopHeartbeat() {
+	o.beatMx.Lock()
+	if o.stopBeat != nil {
+		close(o.stopBeat)
+		o.stopBeat = nil
+	}
+	o.beatMx.Unlock()
+}
@@ -0,0 +1,78 @@
+package ops_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeartbeat(t *testing.T) {
+	var mx sync.Mutex
+	var beats []*ops.Report
+	var final *ops.Report
+	ops.RegisterProgressReporter(func(report *ops.Report) {
+		if report.Name != "test_heartbeat" {
+			return
+		}
+		mx.Lock()
+		beats = append(beats, report)
+		mx.Unlock()
+	})
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		mx.Lock()
+		assert.False(t, report.InProgress, "ordinary reporters shouldn't get progress reports")
+		final = report
+		mx.Unlock()
+	}, "test_heartbeat")
+
+	op := ops.Begin("test_heartbeat").Set("progress", 0.5).Heartbeat(10 * time.Millisecond)
+	time.Sleep(55 * time.Millisecond)
+	op.End()
+	time.Sleep(30 * time.Millisecond)
+
+	mx.Lock()
+	defer mx.Unlock()
+	assert.True(t, len(beats) >= 3, "should have gotten several heartbeats, got %d", len(beats))
+	assert.True(t, len(beats) <= 6, "should have stopped heartbeats on End, got %d", len(beats))
+	if len(beats) > 0 {
+		assert.True(t, beats[0].InProgress)
+		assert.Equal(t, true, beats[0].Context["in_progress"])
+		assert.Equal(t, 0.5, beats[0].Context["progress"])
+		assert.True(t, beats[0].Context["elapsed"].(time.Duration) >= 10*time.Millisecond)
+	}
+	if assert.NotNil(t, final) {
+		assert.Nil(t, final.Context["in_progress"])
+	}
+}
+
+func TestHeartbeatNotCounted(t *testing.T) {
+	a := ops.NewAggregator(time.Hour)
+	defer a.Stop()
+	h := ops.HealthCheck("test_heartbeat_counted", time.Minute, 0.5)
+	ops.RegisterProgressReporter(a.Report)
+	ops.RegisterStructuredReporterFor(a.Report, "test_heartbeat_counted")
+
+	op := ops.Begin("test_heartbeat_counted").Heartbeat(time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	op.FailIf(errors.New("broken"))
+	op.End()
+
+	var counted *ops.Rollup
+	for _, rollup := range a.Snapshot() {
+		if rollup.Name == "test_heartbeat_counted" {
+			found := rollup
+			counted = &found
+		}
+	}
+	if assert.NotNil(t, counted) {
+		assert.Equal(t, 1, counted.Count, "beats shouldn't be counted")
+		assert.Equal(t, 1, counted.Failures)
+	}
+	rate, count := h.SuccessRate()
+	assert.Equal(t, 0.0, rate)
+	assert.Equal(t, 1, count, "beats shouldn't count towards health")
+}
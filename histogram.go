@@ -0,0 +1,75 @@
+package ops
+
+import (
+	"math"
+	"time"
+)
+
+const (
+	histogramBuckets = 100
+	histogramBase    = float64(time.Microsecond)
+	histogramGrowth  = 1.25
+)
+
+var logHistogramGrowth = math.Log(histogramGrowth)
+
+// histogram is a rolling histogram of durations using exponentially sized
+// buckets, starting at 1µs and growing by 25% per bucket (up to about 80
+// minutes). Once it holds window observations, all counts are halved so that
+// older observations gradually lose weight. It is not safe for concurrent use.
+type histogram struct {
+	counts [histogramBuckets]float64
+	total  float64
+	window float64
+}
+
+func newHistogram(window int) *histogram {
+	return &histogram{window: float64(window)}
+}
+
+func bucketFor(d time.Duration) int {
+	if float64(d) < histogramBase {
+		return 0
+	}
+	i := int(math.Log(float64(d)/histogramBase) / logHistogramGrowth)
+	if i >= histogramBuckets {
+		i = histogramBuckets - 1
+	}
+	return i
+}
+
+func bucketLowerBound(i int) time.Duration {
+	if i == 0 {
+		return 0
+	}
+	return time.Duration(histogramBase * math.Pow(histogramGrowth, float64(i)))
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if h.window > 0 && h.total >= h.window {
+		h.total = 0
+		for i := range h.counts {
+			h.counts[i] /= 2
+			h.total += h.counts[i]
+		}
+	}
+	h.counts[bucketFor(d)]++
+	h.total++
+}
+
+// quantile returns the approximate duration below which the fraction q of
+// observations fall, expressed as the lower bound of the containing bucket.
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.total == 0 {
+		return 0
+	}
+	target := q * h.total
+	var seen float64
+	for i, count := range h.counts {
+		seen += count
+		if seen > target {
+			return bucketLowerBound(i)
+		}
+	}
+	return bucketLowerBound(histogramBuckets - 1)
+}
@@ -0,0 +1,24 @@
+package ops
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram(1000)
+	for i := 1; i <= 100; i++ {
+		h.observe(time.Duration(i) * time.Millisecond)
+	}
+	assert.InDelta(t, 50*time.Millisecond, h.quantile(0.5), float64(15*time.Millisecond))
+	assert.InDelta(t, 95*time.Millisecond, h.quantile(0.95), float64(20*time.Millisecond))
+	assert.Equal(t, time.Duration(0), newHistogram(10).quantile(0.5))
+
+	for i := 0; i < 2000; i++ {
+		h.observe(time.Second)
+	}
+	assert.True(t, h.total <= 1001, "old observations should decay")
+	assert.True(t, h.quantile(0.1) > 500*time.Millisecond, "histogram should reflect recent observations")
+}
@@ -0,0 +1,258 @@
+package ops
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// historyVersion is the version of the file format written by History.
+const historyVersion = 1
+
+// History is a StructuredReporter that accumulates one Rollup per op name
+// for as long as it's kept, rather than per interval like Aggregator. It
+// periodically persists its state to a file and restores it when opened
+// again, so that statistics like success rates survive restarts of the
+// process and reflect longer horizons than a single run. Each Rollup's Start
+// is the time that its first op was recorded.
+type History struct {
+	path     string
+	rollups  map[string]*Rollup
+	mx       sync.Mutex
+	saveMx   sync.Mutex
+	stop     chan interface{}
+	stopped  chan interface{}
+	stopOnce sync.Once
+}
+
+// OpenHistory opens the History persisted at path, or starts an empty one if
+// there's no file there yet, and persists it to path every interval. Register
+// it with RegisterStructuredReporter(history.Report) and Close it before the
+// process exits to persist the latest state.
+func OpenHistory(path string, interval time.Duration) (*History, error) {
+	h := &History{
+		path:    path,
+		rollups: make(map[string]*Rollup),
+		stop:    make(chan interface{}),
+		stopped: make(chan interface{}),
+	}
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	go h.run(interval)
+	return h, nil
+}
+
+func (h *History) run(interval time.Duration) {
+	defer close(h.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.Save()
+		case <-h.stop:
+			return
+		}
+	}
+}
+
+// Report records the given report.
+func (h *History) Report(report *Report) {
+	h.mx.Lock()
+	rollup := h.rollups[report.Name]
+	if rollup == nil {
+		rollup = &Rollup{Name: report.Name, Start: report.Start}
+		h.rollups[report.Name] = rollup
+	}
+	rollup.add(report)
+	h.mx.Unlock()
+}
+
+// Snapshot returns copies of the rollups, sorted by name.
+func (h *History) Snapshot() []Rollup {
+	h.mx.Lock()
+	result := make([]Rollup, 0, len(h.rollups))
+	for _, rollup := range h.rollups {
+		result = append(result, rollup.copy())
+	}
+	h.mx.Unlock()
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Reset forgets all recorded ops. The file is updated on the next Save.
+func (h *History) Reset() {
+	h.mx.Lock()
+	h.rollups = make(map[string]*Rollup)
+	h.mx.Unlock()
+}
+
+// Save immediately persists the current state. The file is replaced
+// atomically, so a crash while saving leaves the previous state in place.
+func (h *History) Save() error {
+	h.saveMx.Lock()
+	defer h.saveMx.Unlock()
+	encoded, err := json.Marshal(persistedHistory{
+		Version: historyVersion,
+		Rollups: h.persisted(),
+	})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), filepath.Base(h.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(encoded)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), h.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Close stops persisting periodically and saves the final state.
+func (h *History) Close() error {
+	var err error
+	h.stopOnce.Do(func() {
+		close(h.stop)
+		<-h.stopped
+		err = h.Save()
+	})
+	return err
+}
+
+func (h *History) load() error {
+	encoded, err := os.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var persisted persistedHistory
+	if err := json.Unmarshal(encoded, &persisted); err != nil {
+		return fmt.Errorf("unable to decode history at %v: %v", h.path, err)
+	}
+	if persisted.Version != historyVersion {
+		return fmt.Errorf("unsupported history version %d at %v", persisted.Version, h.path)
+	}
+	for _, p := range persisted.Rollups {
+		rollup := &Rollup{
+			Name:     p.Name,
+			Start:    p.Start,
+			Count:    p.Count,
+			Failures: p.Failures,
+			Total:    p.Total,
+			Min:      p.Min,
+			Max:      p.Max,
+
+			DependencyFailures: p.DependencyFailures,
+		}
+		p.Success.restore(&rollup.Success)
+		p.Failure.restore(&rollup.Failure)
+		h.rollups[p.Name] = rollup
+	}
+	return nil
+}
+
+func (h *History) persisted() []persistedRollup {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	result := make([]persistedRollup, 0, len(h.rollups))
+	for _, rollup := range h.rollups {
+		result = append(result, persistedRollup{
+			Name:     rollup.Name,
+			Start:    rollup.Start,
+			Count:    rollup.Count,
+			Failures: rollup.Failures,
+			Total:    rollup.Total,
+			Min:      rollup.Min,
+			Max:      rollup.Max,
+			Success:  persistLatency(&rollup.Success),
+			Failure:  persistLatency(&rollup.Failure),
+			// Copied, since it's encoded after unlocking
+			DependencyFailures: rollup.copy().DependencyFailures,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+type persistedHistory struct {
+	Version int               `json:"version"`
+	Rollups []persistedRollup `json:"rollups"`
+}
+
+type persistedRollup struct {
+	Name     string           `json:"name"`
+	Start    time.Time        `json:"start"`
+	Count    int              `json:"count"`
+	Failures int              `json:"failures"`
+	Total    time.Duration    `json:"total_ns"`
+	Min      time.Duration    `json:"min_ns"`
+	Max      time.Duration    `json:"max_ns"`
+	Success  persistedLatency `json:"success"`
+	Failure  persistedLatency `json:"failure"`
+	// DependencyFailures was added without changing historyVersion, since
+	// older files simply have none
+	DependencyFailures map[string]int `json:"dependency_failures,omitempty"`
+}
+
+// persistedLatency is a Latency with its histogram. Buckets are stored
+// sparsely, keyed by index, since most of them are usually empty.
+type persistedLatency struct {
+	Count   int             `json:"count"`
+	Total   time.Duration   `json:"total_ns"`
+	Min     time.Duration   `json:"min_ns"`
+	Max     time.Duration   `json:"max_ns"`
+	Buckets map[int]float64 `json:"buckets,omitempty"`
+}
+
+func persistLatency(l *Latency) persistedLatency {
+	p := persistedLatency{
+		Count: l.Count,
+		Total: l.Total,
+		Min:   l.Min,
+		Max:   l.Max,
+	}
+	for i, count := range l.hist.counts {
+		if count > 0 {
+			if p.Buckets == nil {
+				p.Buckets = make(map[int]float64)
+			}
+			p.Buckets[i] = count
+		}
+	}
+	return p
+}
+
+func (p *persistedLatency) restore(l *Latency) {
+	l.Count = p.Count
+	l.Total = p.Total
+	l.Min = p.Min
+	l.Max = p.Max
+	for i, count := range p.Buckets {
+		if i >= 0 && i < histogramBuckets && count > 0 {
+			l.hist.counts[i] = count
+			l.hist.total += count
+		}
+	}
+}
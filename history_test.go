@@ -0,0 +1,91 @@
+package ops_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	start := time.Now().Add(-time.Hour).Round(0)
+
+	h, err := ops.OpenHistory(path, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h.Report(&ops.Report{Name: "a", Start: start, Duration: 2 * time.Millisecond})
+	h.Report(&ops.Report{Name: "a", Start: start.Add(time.Minute), Duration: 4 * time.Millisecond, Failure: errors.New("fail")})
+	h.Report(&ops.Report{Name: "b", Start: start, Duration: 3 * time.Millisecond})
+	assert.NoError(t, h.Close())
+
+	// Restore and keep accumulating
+	h, err = ops.OpenHistory(path, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h.Report(&ops.Report{Name: "a", Start: time.Now(), Duration: 6 * time.Millisecond})
+	snapshot := h.Snapshot()
+	if assert.Len(t, snapshot, 2) {
+		a := snapshot[0]
+		assert.Equal(t, "a", a.Name)
+		assert.True(t, start.Equal(a.Start), "start should be that of the first op")
+		assert.Equal(t, 3, a.Count)
+		assert.Equal(t, 1, a.Failures)
+		assert.Equal(t, 2*time.Millisecond, a.Min)
+		assert.Equal(t, 6*time.Millisecond, a.Max)
+		assert.Equal(t, 4*time.Millisecond, a.Mean())
+		assert.Equal(t, 2, a.Success.Count)
+		assert.Equal(t, 4*time.Millisecond, a.Success.Mean())
+		assert.InDelta(t, float64(6*time.Millisecond), float64(a.Success.Quantile(0.99)), float64(2*time.Millisecond))
+		assert.InDelta(t, float64(4*time.Millisecond), float64(a.Failure.Quantile(0.5)), float64(time.Millisecond))
+		assert.Equal(t, "b", snapshot[1].Name)
+		assert.Equal(t, 1, snapshot[1].Count)
+	}
+
+	h.Reset()
+	assert.Empty(t, h.Snapshot())
+	assert.NoError(t, h.Close())
+	h, err = ops.OpenHistory(path, time.Hour)
+	if assert.NoError(t, err) {
+		assert.Empty(t, h.Snapshot())
+		h.Close()
+	}
+}
+
+func TestHistoryCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	assert.NoError(t, os.WriteFile(path, []byte("{"), 0644))
+	_, err := ops.OpenHistory(path, time.Hour)
+	assert.Error(t, err)
+
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version":99}`), 0644))
+	_, err = ops.OpenHistory(path, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestHistoryDependencyFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	h, err := ops.OpenHistory(path, time.Hour)
+	if !assert.NoError(t, err) {
+		return
+	}
+	h.Report(&ops.Report{Name: "a", Failure: errors.New("fail"), Context: map[string]interface{}{
+		"failed_dependencies": []string{"redis"},
+	}})
+	assert.NoError(t, h.Close())
+
+	h, err = ops.OpenHistory(path, time.Hour)
+	if assert.NoError(t, err) {
+		defer h.Close()
+		snapshot := h.Snapshot()
+		if assert.Len(t, snapshot, 1) {
+			assert.Equal(t, map[string]int{"redis": 1}, snapshot[0].DependencyFailures)
+		}
+	}
+}
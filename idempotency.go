@@ -0,0 +1,67 @@
+package ops
+
+import (
+	"sync"
+	"time"
+)
+
+// IdempotencyKey is the context key under which idempotency keys are recorded.
+const IdempotencyKey = "idempotency_key"
+
+var (
+	duplicateWindow   time.Duration
+	recentSuccesses   = make(map[duplicateKey]time.Time)
+	lastPrune         time.Time
+	recentSuccessesMx sync.Mutex
+)
+
+type duplicateKey struct {
+	name string
+	key  interface{}
+}
+
+func (o *op) SetIdempotencyKey(key string) Op {
+	return o.Set(IdempotencyKey, key)
+}
+
+// SuppressDuplicateSuccesses makes successful reports get dropped if a
+// successful report for an op with the same name and idempotency key was
+// delivered within the given window. A window of 0 (the default) disables
+// suppression.
+func SuppressDuplicateSuccesses(window time.Duration) {
+	recentSuccessesMx.Lock()
+	duplicateWindow = window
+	recentSuccesses = make(map[duplicateKey]time.Time)
+	recentSuccessesMx.Unlock()
+}
+
+func isDuplicateSuccess(report *Report) bool {
+	if !report.Succeeded() {
+		return false
+	}
+	key, found := report.Context[IdempotencyKey]
+	if !found {
+		return false
+	}
+
+	now := time.Now()
+	recentSuccessesMx.Lock()
+	defer recentSuccessesMx.Unlock()
+	if duplicateWindow <= 0 {
+		return false
+	}
+	if now.Sub(lastPrune) > duplicateWindow {
+		for k, seen := range recentSuccesses {
+			if now.Sub(seen) > duplicateWindow {
+				delete(recentSuccesses, k)
+			}
+		}
+		lastPrune = now
+	}
+	dk := duplicateKey{report.Name, key}
+	if seen, found := recentSuccesses[dk]; found && now.Sub(seen) <= duplicateWindow {
+		return true
+	}
+	recentSuccesses[dk] = now
+	return false
+}
@@ -0,0 +1,44 @@
+package ops_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuppressDuplicateSuccesses(t *testing.T) {
+	defer ops.SuppressDuplicateSuccesses(0)
+
+	var reported []*ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = append(reported, report)
+	}, "charge")
+
+	charge := func(key string, failure error) {
+		op := ops.Begin("charge").SetIdempotencyKey(key)
+		op.FailIf(failure)
+		op.End()
+	}
+
+	charge("a", nil)
+	charge("a", nil)
+	assert.Len(t, reported, 2, "should not suppress by default")
+	assert.Equal(t, "a", reported[0].Context[ops.IdempotencyKey])
+
+	reported = nil
+	ops.SuppressDuplicateSuccesses(time.Minute)
+	charge("a", errors.New("declined"))
+	charge("a", nil)
+	charge("a", errors.New("declined"))
+	charge("a", nil)
+	charge("b", nil)
+	if assert.Len(t, reported, 4) {
+		assert.False(t, reported[0].Succeeded())
+		assert.True(t, reported[1].Succeeded())
+		assert.False(t, reported[2].Succeeded())
+		assert.Equal(t, "b", reported[3].Context[ops.IdempotencyKey])
+	}
+}
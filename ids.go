@@ -0,0 +1,123 @@
+package ops
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IDGenerator generates ids for ops and traces. To be compatible with B3
+// propagation, trace ids should be 32 and op ids 16 lowercase hex characters.
+type IDGenerator interface {
+	// NewTraceID generates a new trace id.
+	NewTraceID() string
+
+	// NewID generates a new op id.
+	NewID() string
+}
+
+var (
+	// RandomIDs generates random ids. This is the default IDGenerator.
+	RandomIDs IDGenerator = randomIDs{}
+
+	// TimeOrderedIDs generates ids that sort by the time at which they were
+	// generated, including ids generated within the same millisecond by the
+	// same process. Trace ids are UUIDv7s (without dashes) with a 12 bit
+	// counter after the 48 bit millisecond timestamp, followed by 62 random
+	// bits, and op ids are a 48 bit millisecond timestamp followed by a 16 bit
+	// counter. Counters start at a random value each millisecond.
+	TimeOrderedIDs IDGenerator = timeOrderedIDs{}
+
+	currentIDGenerator atomic.Value
+
+	traceIDClock, opIDClock monotonicClock
+)
+
+func init() {
+	SetIDGenerator(RandomIDs)
+}
+
+// SetIDGenerator sets the IDGenerator used for new ops.
+func SetIDGenerator(generator IDGenerator) {
+	currentIDGenerator.Store(&generator)
+}
+
+func idGenerator() IDGenerator {
+	return *currentIDGenerator.Load().(*IDGenerator)
+}
+
+func newTraceID() string {
+	return idGenerator().NewTraceID()
+}
+
+func newSpanID() string {
+	return idGenerator().NewID()
+}
+
+type randomIDs struct{}
+
+func (randomIDs) NewTraceID() string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], rand.Uint64())
+	binary.BigEndian.PutUint64(b[8:], rand.Uint64())
+	return hex.EncodeToString(b[:])
+}
+
+func (randomIDs) NewID() string {
+	return hexID(rand.Uint64())
+}
+
+type timeOrderedIDs struct{}
+
+func (timeOrderedIDs) NewTraceID() string {
+	ms, seq := traceIDClock.next(12)
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], ms<<16|seq)
+	binary.BigEndian.PutUint64(b[8:], rand.Uint64())
+	b[6] = 0x70 | b[6]&0x0f // version 7
+	b[8] = 0x80 | b[8]&0x3f // RFC 4122 variant
+	return hex.EncodeToString(b[:])
+}
+
+func (timeOrderedIDs) NewID() string {
+	ms, seq := opIDClock.next(16)
+	return hexID(ms<<16 | seq)
+}
+
+// monotonicClock generates 48 bit millisecond timestamps paired with counters
+// that together increase with every call, even if the wall clock stalls or
+// steps back.
+type monotonicClock struct {
+	mx  sync.Mutex
+	ms  uint64
+	seq uint64
+}
+
+// next returns the timestamp and a counter of the given number of bits. The
+// counter starts at a random value in the lower half of its range each new
+// millisecond, leaving room to count, and once it's exhausted the timestamp
+// moves on to the next millisecond.
+func (c *monotonicClock) next(bits uint) (ms, seq uint64) {
+	now := uint64(time.Now().UnixMilli()) & (1<<48 - 1)
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if now > c.ms {
+		c.ms = now
+		c.seq = uint64(rand.Int63n(1 << (bits - 1)))
+	} else if c.seq++; c.seq >= 1<<bits {
+		c.ms++
+		c.seq = 0
+	}
+	return c.ms, c.seq
+}
+
+// hexID formats id as 16 hex digits. It's considerably cheaper than
+// fmt.Sprintf("%016x").
+func hexID(id uint64) string {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], id)
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,64 @@
+package ops_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+type sequentialIDs struct {
+	next int
+}
+
+func (s *sequentialIDs) NewTraceID() string {
+	s.next++
+	return "trace" + strconv.Itoa(s.next)
+}
+
+func (s *sequentialIDs) NewID() string {
+	s.next++
+	return "op" + strconv.Itoa(s.next)
+}
+
+func TestIDGenerator(t *testing.T) {
+	defer ops.SetIDGenerator(ops.RandomIDs)
+
+	ops.SetIDGenerator(&sequentialIDs{})
+	op := ops.Begin("test_ids")
+	child := op.Begin("child")
+	assert.Equal(t, "op1", op.ID())
+	assert.Equal(t, "trace2", op.TraceID())
+	assert.Equal(t, "op3", child.ID())
+	assert.Equal(t, "trace2", child.TraceID())
+	child.End()
+	op.End()
+}
+
+func TestTimeOrderedIDs(t *testing.T) {
+	gen := ops.TimeOrderedIDs
+	firstTrace, firstID := gen.NewTraceID(), gen.NewID()
+	time.Sleep(2 * time.Millisecond)
+	secondTrace, secondID := gen.NewTraceID(), gen.NewID()
+
+	assert.Len(t, firstTrace, 32)
+	assert.Len(t, firstID, 16)
+	assert.Equal(t, byte('7'), firstTrace[12], "trace id should be a UUIDv7")
+	assert.True(t, firstTrace < secondTrace)
+	assert.True(t, firstID < secondID)
+}
+
+func TestTimeOrderedIDsWithinMillisecond(t *testing.T) {
+	gen := ops.TimeOrderedIDs
+	previousTrace, previousID := gen.NewTraceID(), gen.NewID()
+	for i := 0; i < 10000; i++ {
+		trace, id := gen.NewTraceID(), gen.NewID()
+		if !assert.True(t, previousTrace < trace, "trace ids should increase") ||
+			!assert.True(t, previousID < id, "op ids should increase") {
+			return
+		}
+		previousTrace, previousID = trace, id
+	}
+}
@@ -0,0 +1,35 @@
+package ops
+
+import (
+	"sort"
+	"sync"
+)
+
+var (
+	integrations      = make(map[string]bool)
+	integrationsMutex sync.Mutex
+)
+
+// RegisterIntegration records that the named integration is linked into this
+// binary. Integrations with heavy dependencies (like opsgolog and opssqlite)
+// live in their own Go modules so that programs that don't use them, such as
+// mobile clients, don't pay for their dependencies. They call
+// RegisterIntegration from an init function, which lets this package list them
+// (see Integrations) without depending on them.
+func RegisterIntegration(name string) {
+	integrationsMutex.Lock()
+	integrations[name] = true
+	integrationsMutex.Unlock()
+}
+
+// Integrations returns the names of the registered integrations, sorted.
+func Integrations() []string {
+	integrationsMutex.Lock()
+	result := make([]string, 0, len(integrations))
+	for name := range integrations {
+		result = append(result, name)
+	}
+	integrationsMutex.Unlock()
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,15 @@
+package ops_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIntegrations(t *testing.T) {
+	ops.RegisterIntegration("test_b")
+	ops.RegisterIntegration("test_a")
+	ops.RegisterIntegration("test_b")
+	assert.Equal(t, []string{"test_a", "test_b"}, ops.Integrations())
+}
@@ -0,0 +1,199 @@
+package ops
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+type ioStats struct {
+	bytesRead    int64
+	readNanos    int64
+	bytesWritten int64
+	writeNanos   int64
+}
+
+// stats lazily sets up the counters shared by all readers and writers tracked
+// by this op.
+func (o *op) stats() *ioStats {
+	o.ioOnce.Do(func() {
+		s := &ioStats{}
+		o.ioStats = s
+		o.SetDynamic("bytes_read", func() interface{} { return atomic.LoadInt64(&s.bytesRead) })
+		o.SetDynamic("read_duration", func() interface{} { return time.Duration(atomic.LoadInt64(&s.readNanos)) })
+		o.SetDynamic("bytes_written", func() interface{} { return atomic.LoadInt64(&s.bytesWritten) })
+		o.SetDynamic("write_duration", func() interface{} { return time.Duration(atomic.LoadInt64(&s.writeNanos)) })
+	})
+	return o.ioStats
+}
+
+func (o *op) TrackReader(r io.Reader) io.Reader {
+	return &trackingReader{r, o, o.stats()}
+}
+
+func (o *op) TrackWriter(w io.Writer) io.Writer {
+	return &trackingWriter{w, o, o.stats()}
+}
+
+type trackingReader struct {
+	io.Reader
+	op    *op
+	stats *ioStats
+}
+
+func (r *trackingReader) Read(b []byte) (int, error) {
+	start := time.Now()
+	n, err := r.Reader.Read(b)
+	atomic.AddInt64(&r.stats.readNanos, int64(time.Since(start)))
+	atomic.AddInt64(&r.stats.bytesRead, int64(n))
+	if err != nil && err != io.EOF {
+		r.op.Set("read_error", ErrorText(err))
+		r.op.FailIf(err)
+	}
+	return n, err
+}
+
+type trackingWriter struct {
+	io.Writer
+	op    *op
+	stats *ioStats
+}
+
+func (w *trackingWriter) Write(b []byte) (int, error) {
+	start := time.Now()
+	n, err := w.Writer.Write(b)
+	atomic.AddInt64(&w.stats.writeNanos, int64(time.Since(start)))
+	atomic.AddInt64(&w.stats.bytesWritten, int64(n))
+	if err != nil {
+		w.op.Set("write_error", ErrorText(err))
+		w.op.FailIf(err)
+	}
+	return n, err
+}
+
+// Copy copies from src to dst like io.Copy, recording copy_bytes,
+// copy_duration, copy_bytes_per_second and copy_terminated_by ("eof",
+// "read_error" or "write_error") in the given Op. Errors other than io.EOF
+// fail the Op. Like io.Copy, it uses src's io.WriterTo or else dst's
+// io.ReaderFrom if they have one, watching the other side for errors to tell
+// which side failed. The watched side still offers its own io.ReaderFrom or
+// io.WriterTo, so copies between TCP connections can splice. Failures of such
+// a copy are attributed to the watched side, since either side may have
+// caused them.
+func Copy(o Op, dst io.Writer, src io.Reader) (written int64, err error) {
+	terminatedBy := "eof"
+	start := time.Now()
+	if wt, ok := src.(io.WriterTo); ok {
+		w := &errorWatchingWriter{Writer: dst}
+		written, err = wt.WriteTo(w)
+		if err != nil {
+			terminatedBy = sideOf(err, w.err, "write_error", "read_error")
+			if err == io.ErrShortWrite {
+				terminatedBy = "write_error"
+			}
+		}
+	} else if rf, ok := dst.(io.ReaderFrom); ok {
+		r := &errorWatchingReader{Reader: src}
+		written, err = rf.ReadFrom(r)
+		if err != nil {
+			terminatedBy = sideOf(err, r.err, "read_error", "write_error")
+		}
+	} else {
+		written, terminatedBy, err = copyBuffer(dst, src)
+	}
+
+	elapsed := time.Since(start)
+	o.Set("copy_bytes", written)
+	o.Set("copy_duration", elapsed)
+	if elapsed > 0 {
+		o.Set("copy_bytes_per_second", float64(written)/elapsed.Seconds())
+	}
+	o.Set("copy_terminated_by", terminatedBy)
+	return written, o.FailIf(err)
+}
+
+// sideOf returns watchedSide if err is the error seen by the watched side of a
+// copy, or otherwise otherSide.
+func sideOf(err, watched error, watchedSide, otherSide string) string {
+	if watched != nil && errors.Is(err, watched) {
+		return watchedSide
+	}
+	return otherSide
+}
+
+func copyBuffer(dst io.Writer, src io.Reader) (written int64, terminatedBy string, err error) {
+	buf := make([]byte, 32*1024)
+	for {
+		nr, readErr := src.Read(buf)
+		if nr > 0 {
+			nw, writeErr := dst.Write(buf[:nr])
+			written += int64(nw)
+			if writeErr == nil && nw != nr {
+				writeErr = io.ErrShortWrite
+			}
+			if writeErr != nil {
+				return written, "write_error", writeErr
+			}
+		}
+		if readErr != nil {
+			if readErr != io.EOF {
+				return written, "read_error", readErr
+			}
+			return written, "eof", nil
+		}
+	}
+}
+
+// errorWatchingReader and errorWatchingWriter remember the last error (other
+// than io.EOF) of the reader or writer they wrap. They forward WriteTo and
+// ReadFrom, so that wrapping doesn't hide the fast paths of what they wrap.
+type errorWatchingReader struct {
+	io.Reader
+	err error
+}
+
+func (r *errorWatchingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *errorWatchingReader) WriteTo(dst io.Writer) (int64, error) {
+	wt, ok := r.Reader.(io.WriterTo)
+	if !ok {
+		return io.Copy(dst, struct{ io.Reader }{r})
+	}
+	n, err := wt.WriteTo(dst)
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+type errorWatchingWriter struct {
+	io.Writer
+	err error
+}
+
+func (w *errorWatchingWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
+
+func (w *errorWatchingWriter) ReadFrom(src io.Reader) (int64, error) {
+	rf, ok := w.Writer.(io.ReaderFrom)
+	if !ok {
+		return io.Copy(struct{ io.Writer }{w}, src)
+	}
+	n, err := rf.ReadFrom(src)
+	if err != nil {
+		w.err = err
+	}
+	return n, err
+}
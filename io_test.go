@@ -0,0 +1,141 @@
+package ops_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestTrackReaderWriter(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_io", "test_io_failure")
+
+	op := ops.Begin("test_io")
+	var buf bytes.Buffer
+	n, err := io.Copy(op.TrackWriter(&buf), op.TrackReader(strings.NewReader("hello world")))
+	assert.NoError(t, err)
+	assert.EqualValues(t, 11, n)
+	op.TrackReader(strings.NewReader("again")).Read(make([]byte, 10))
+	op.End()
+
+	assert.True(t, reported.Succeeded())
+	assert.EqualValues(t, 16, reported.Context["bytes_read"])
+	assert.EqualValues(t, 11, reported.Context["bytes_written"])
+	assert.Nil(t, reported.Context["read_error"])
+
+	op = ops.Begin("test_io_failure")
+	op.TrackWriter(failingWriter{}).Write([]byte("data"))
+	op.End()
+	assert.False(t, reported.Succeeded())
+	assert.Equal(t, "write failed", reported.Context["write_error"])
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(b []byte) (int, error) {
+	return 0, errors.New("read failed")
+}
+
+func TestCopy(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_copy", "test_copy_read_error", "test_copy_write_error", "test_copy_reader_from", "test_copy_writer_to", "test_copy_writer_to_reader_from")
+
+	op := ops.Begin("test_copy")
+	var buf bytes.Buffer
+	n, err := ops.Copy(op, &buf, strings.NewReader("hello world"))
+	op.End()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 11, n)
+	assert.Equal(t, "hello world", buf.String())
+	assert.True(t, reported.Succeeded())
+	assert.EqualValues(t, 11, reported.Context["copy_bytes"])
+	assert.Equal(t, "eof", reported.Context["copy_terminated_by"])
+	assert.NotNil(t, reported.Context["copy_duration"])
+
+	op = ops.Begin("test_copy_read_error")
+	_, err = ops.Copy(op, &buf, failingReader{})
+	op.End()
+	assert.Error(t, err)
+	assert.False(t, reported.Succeeded())
+	assert.Equal(t, "read_error", reported.Context["copy_terminated_by"])
+
+	op = ops.Begin("test_copy_write_error")
+	_, err = ops.Copy(op, failingWriter{}, strings.NewReader("hello world"))
+	op.End()
+	assert.Error(t, err)
+	assert.Equal(t, "write_error", reported.Context["copy_terminated_by"])
+
+	op = ops.Begin("test_copy_reader_from")
+	dst := &readerFrom{}
+	_, err = ops.Copy(op, dst, failingReader{})
+	op.End()
+	assert.Error(t, err)
+	assert.True(t, dst.used, "should delegate to dst's ReadFrom")
+	assert.Equal(t, "read_error", reported.Context["copy_terminated_by"])
+
+	op = ops.Begin("test_copy_writer_to")
+	src := &writerTo{}
+	_, err = ops.Copy(op, failingWriter{}, src)
+	op.End()
+	assert.Error(t, err)
+	assert.True(t, src.used, "should delegate to src's WriteTo")
+	assert.Equal(t, "write_error", reported.Context["copy_terminated_by"])
+
+	// like a TCP connection, whose WriteTo falls back to dst's ReadFrom
+	op = ops.Begin("test_copy_writer_to_reader_from")
+	dst = &readerFrom{}
+	n, err = ops.Copy(op, dst, &genericWriterTo{Reader: strings.NewReader("hello world")})
+	op.End()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 11, n)
+	assert.True(t, dst.used, "watching dst for errors shouldn't hide its ReadFrom")
+	assert.Equal(t, "hello world", dst.String())
+	assert.Equal(t, "eof", reported.Context["copy_terminated_by"])
+}
+
+type readerFrom struct {
+	bytes.Buffer
+	used bool
+}
+
+func (r *readerFrom) ReadFrom(src io.Reader) (int64, error) {
+	r.used = true
+	return r.Buffer.ReadFrom(src)
+}
+
+type genericWriterTo struct {
+	io.Reader
+}
+
+func (w *genericWriterTo) WriteTo(dst io.Writer) (int64, error) {
+	return io.Copy(dst, struct{ io.Reader }{w.Reader})
+}
+
+type writerTo struct {
+	used bool
+}
+
+func (*writerTo) Read(b []byte) (int, error) {
+	return 0, io.EOF
+}
+
+func (w *writerTo) WriteTo(dst io.Writer) (int64, error) {
+	w.used = true
+	n, err := dst.Write([]byte("hello"))
+	return int64(n), err
+}
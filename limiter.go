@@ -0,0 +1,96 @@
+package ops
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+)
+
+// limiterMaxKeys is the number of keys a Limiter tracks before it forgets the
+// least recently seen ones.
+const limiterMaxKeys = 10000
+
+// Limiter rate limits ops by a key derived from their context, like a client
+// IP or user ID, using a token bucket per key. Ops that are rejected get the
+// outcome Throttled and record the name of the limiter under "rate_limiter",
+// so that abuse protection and its telemetry live in one place.
+type Limiter struct {
+	name    string
+	rate    float64
+	burst   float64
+	keyFn   func(ctx Map) string
+	buckets map[string]*list.Element
+	// recent orders the buckets from most to least recently seen
+	recent *list.List
+	mx     sync.Mutex
+}
+
+type tokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter creates a Limiter that allows rate ops per second for each key,
+// with bursts of up to rate ops (or 1 if rate is lower). keyFn derives the key
+// from the context of the op (see Op.Snapshot). Ops for which it returns ""
+// aren't limited.
+func NewLimiter(name string, rate float64, keyFn func(ctx Map) string) *Limiter {
+	return &Limiter{
+		name:    name,
+		rate:    rate,
+		burst:   math.Max(rate, 1),
+		keyFn:   keyFn,
+		buckets: make(map[string]*list.Element),
+		recent:  list.New(),
+	}
+}
+
+// Allow indicates whether the given op may proceed. If not, the op is marked
+// as Throttled and the caller should end it without doing its work, for
+// example:
+//
+//	op := ops.Begin("request").Set("client_ip", ip)
+//	defer op.End()
+//	if !limiter.Allow(op) {
+//		resp.WriteHeader(http.StatusTooManyRequests)
+//		return
+//	}
+func (l *Limiter) Allow(op Op) bool {
+	key := l.keyFn(op.Snapshot())
+	if key == "" {
+		return true
+	}
+	if l.take(key, time.Now()) {
+		return true
+	}
+	op.SetOutcome(Throttled)
+	op.Set("rate_limiter", l.name)
+	return false
+}
+
+func (l *Limiter) take(key string, now time.Time) bool {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	var b *tokenBucket
+	if e := l.buckets[key]; e != nil {
+		l.recent.MoveToFront(e)
+		b = e.Value.(*tokenBucket)
+	} else {
+		if len(l.buckets) >= limiterMaxKeys {
+			oldest := l.recent.Back()
+			l.recent.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*tokenBucket).key)
+		}
+		b = &tokenBucket{key: key, tokens: l.burst, last: now}
+		l.buckets[key] = l.recent.PushFront(b)
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
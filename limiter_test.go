@@ -0,0 +1,66 @@
+package ops_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	var reported []*ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = append(reported, report)
+	}, "test_limited")
+
+	limiter := ops.NewLimiter("per_client", 10, func(ctx ops.Map) string {
+		return ctx.String("client_ip")
+	})
+	allow := func(ip string) bool {
+		op := ops.Begin("test_limited").Set("client_ip", ip)
+		defer op.End()
+		return limiter.Allow(op)
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.True(t, allow("10.0.0.1"), "burst %d", i)
+	}
+	assert.False(t, allow("10.0.0.1"))
+	assert.True(t, allow("10.0.0.2"), "other keys should be limited separately")
+	assert.True(t, allow(""), "ops without a key shouldn't be limited")
+
+	if assert.Len(t, reported, 13) {
+		throttled := reported[10]
+		assert.Equal(t, ops.Throttled, throttled.Outcome)
+		assert.True(t, throttled.Succeeded())
+		assert.Equal(t, "throttled", throttled.Context["outcome"])
+		assert.Equal(t, "per_client", throttled.Context["rate_limiter"])
+		assert.Equal(t, ops.Succeeded, reported[11].Outcome)
+		assert.NotContains(t, reported[11].Context, "rate_limiter")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	assert.True(t, allow("10.0.0.1"), "tokens should refill over time")
+}
+
+func TestLimiterForgetsLeastRecentKeys(t *testing.T) {
+	limiter := ops.NewLimiter("per_client", 0.001, func(ctx ops.Map) string {
+		return ctx.String("client_ip")
+	})
+	allow := func(ip string) bool {
+		op := ops.Begin("test_limited_keys").Set("client_ip", ip)
+		defer op.End()
+		return limiter.Allow(op)
+	}
+
+	assert.True(t, allow("old"))
+	assert.True(t, allow("recent"))
+	for i := 0; i < 9998; i++ {
+		allow(fmt.Sprintf("flood%d", i))
+	}
+	assert.False(t, allow("recent"), "recently seen keys should still be limited")
+	allow("flood_last")
+	assert.True(t, allow("old"), "least recently seen key should have been forgotten")
+}
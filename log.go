@@ -0,0 +1,53 @@
+package ops
+
+import (
+	stdcontext "context"
+	"log/slog"
+)
+
+// LogContext returns the context of the Op active on the current goroutine as
+// alternating key/value pairs sorted by key, suitable for passing to loggers
+// like slog.Info(msg, ops.LogContext()...).
+func LogContext() []interface{} {
+	return logContext(Current())
+}
+
+func logContext(ctx Map) []interface{} {
+	keys := ctx.Keys()
+	result := make([]interface{}, 0, len(keys)*2)
+	for _, key := range keys {
+		result = append(result, key, ctx[key])
+	}
+	return result
+}
+
+// NewLogHandler wraps the given slog.Handler so that every record it handles
+// includes the context of the Op carried by the record's context (see
+// NewContext), for example when logging with slog.InfoContext, or otherwise of
+// the Op active on the logging goroutine.
+func NewLogHandler(handler slog.Handler) slog.Handler {
+	return &logHandler{handler}
+}
+
+type logHandler struct {
+	slog.Handler
+}
+
+func (h *logHandler) Handle(ctx stdcontext.Context, record slog.Record) error {
+	if ctx != nil {
+		if o, ok := FromContext(ctx); ok {
+			record.Add(logContext(o.Snapshot())...)
+			return h.Handler.Handle(ctx, record)
+		}
+	}
+	record.Add(LogContext()...)
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{h.Handler.WithGroup(name)}
+}
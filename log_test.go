@@ -0,0 +1,48 @@
+package ops_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(ops.NewLogHandler(slog.NewJSONHandler(&buf, nil)))
+
+	op := ops.Begin("test_log").Set("a", 1)
+	log.Info("inside")
+	op.End()
+
+	record := make(map[string]interface{})
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &record)) {
+		assert.Equal(t, "inside", record["msg"])
+		assert.Equal(t, "test_log", record["op"])
+		assert.Equal(t, op.ID(), record["op_id"])
+		assert.Equal(t, op.TraceID(), record["trace_id"])
+		assert.EqualValues(t, 1, record["a"])
+	}
+}
+
+func TestLogHandlerPrefersContext(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(ops.NewLogHandler(slog.NewJSONHandler(&buf, nil)))
+
+	carried := ops.Begin("test_log_carried")
+	ctx := ops.NewContext(context.Background(), carried)
+	carried.End()
+	active := ops.Begin("test_log_active")
+	log.InfoContext(ctx, "elsewhere")
+	active.End()
+
+	record := make(map[string]interface{})
+	if assert.NoError(t, json.Unmarshal(buf.Bytes(), &record)) {
+		assert.Equal(t, "test_log_carried", record["op"])
+		assert.Equal(t, carried.ID(), record["op_id"])
+	}
+}
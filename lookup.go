@@ -0,0 +1,47 @@
+package ops
+
+// putLookup puts the value in this op's context, also remembering it on the op
+// so that lookup can find it without building the context's map, which would
+// evaluate all of its dynamic values.
+func (o *op) putLookup(key string, value interface{}) {
+	o.ctx.Put(key, value)
+	if _, native := o.ctx.(*nativeContext); native {
+		return
+	}
+	o.lookupsMx.Lock()
+	if o.lookups == nil {
+		o.lookups = make(map[string]interface{})
+	}
+	o.lookups[key] = value
+	o.lookupsMx.Unlock()
+}
+
+// lookup returns the value put with putLookup on this op or the nearest op
+// whose context it inherits, or nil if there is none. The native backend looks
+// the key up on the context stack directly. The getlantern backend has no way
+// to look up a single key, so the ops are followed instead: an op inherits from
+// its parent or, without one, from the op that was innermost on its goroutine
+// when it began, which covers goroutines started with Go and contexts restored
+// from a Token.
+func (o *op) lookup(key string) interface{} {
+	if native, ok := o.ctx.(*nativeContext); ok {
+		value, _ := native.get(key)
+		return value
+	}
+	for current := o; current != nil; current = current.inheritsFrom() {
+		current.lookupsMx.RLock()
+		value, found := current.lookups[key]
+		current.lookupsMx.RUnlock()
+		if found {
+			return value
+		}
+	}
+	return nil
+}
+
+func (o *op) inheritsFrom() *op {
+	if o.parent != nil {
+		return o.parent
+	}
+	return o.below
+}
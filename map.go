@@ -0,0 +1,38 @@
+package ops
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Map is a snapshot of an Op's context, mapping keys to values.
+type Map map[string]interface{}
+
+// Current returns the context of the Op active on the current goroutine,
+// excluding globals. If there is no active Op, the Map is empty.
+func Current() Map {
+	return Map(cm.AsMap(nil, false))
+}
+
+// Keys returns the keys of the Map in sorted order.
+func (m Map) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String returns the value for the given key formatted as a string, or "" if
+// the key isn't present.
+func (m Map) String(key string) string {
+	value, found := m[key]
+	if !found {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
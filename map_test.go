@@ -0,0 +1,23 @@
+package ops_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMap(t *testing.T) {
+	assert.Empty(t, ops.Current())
+
+	op := ops.Begin("test_map").Set("b", 2).Set("a", "one")
+	current := ops.Current()
+	assert.Equal(t, []string{"a", "b", "op", "op_id", "root_op", "trace_id"}, current.Keys())
+	assert.Equal(t, "one", current.String("a"))
+	assert.Equal(t, "2", current.String("b"))
+	assert.Equal(t, "", current.String("missing"))
+	assert.Equal(t, "test_map", op.Snapshot().String("op"))
+	op.End()
+
+	assert.Empty(t, ops.Current())
+}
@@ -0,0 +1,100 @@
+package ops
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// EmptyNamePolicy determines what happens when an Op is begun with an empty
+// name.
+type EmptyNamePolicy int32
+
+const (
+	// KeepEmptyNames leaves empty names alone. This is the default.
+	KeepEmptyNames EmptyNamePolicy = iota
+
+	// NameEmptyFromCaller names Ops begun with an empty name after the
+	// function that began them, like CallerName.
+	NameEmptyFromCaller
+
+	// ReportEmptyNames is like NameEmptyFromCaller but also emits a diagnostic
+	// report of kind "empty_op_name" identifying the caller, to help find and
+	// fix unnamed ops.
+	ReportEmptyNames
+)
+
+var emptyNamePolicy int32
+
+// SetEmptyNamePolicy sets the policy for Ops begun with an empty name.
+func SetEmptyNamePolicy(policy EmptyNamePolicy) {
+	atomic.StoreInt32(&emptyNamePolicy, int32(policy))
+}
+
+func applyEmptyNamePolicy(name string) string {
+	if name != "" {
+		return name
+	}
+	policy := EmptyNamePolicy(atomic.LoadInt32(&emptyNamePolicy))
+	if policy == KeepEmptyNames {
+		return name
+	}
+	name, file, line := caller()
+	if policy == ReportEmptyNames {
+		reportDiagnostic("empty_op_name", map[string]interface{}{
+			"caller":      file + ":" + strconv.Itoa(line),
+			"caller_name": name,
+		})
+	}
+	return name
+}
+
+const packagePrefix = "github.com/getlantern/ops."
+
+// caller finds the first function on the stack outside of this package,
+// returning its name (see CallerName), file and line.
+func caller() (name string, file string, line int) {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, packagePrefix) {
+			return funcName(frame.Function), frame.File, frame.Line
+		}
+		if !more {
+			return "", "", 0
+		}
+	}
+}
+
+// CallerName returns the name of the function calling it, formatted as
+// package.Func or package.Type.Method (so net/http.(*Client).Do becomes
+// http.Client.Do). Functions in this package are skipped, so helpers in this
+// package name their callers.
+func CallerName() string {
+	name, _, _ := caller()
+	return name
+}
+
+// BeginFunc is like Begin, naming the Op after the calling function (see
+// CallerName), so that instrumenting a function takes a single line with no
+// name to keep in sync:
+//
+//	func (c *Client) Fetch(url string) error {
+//		op := ops.BeginFunc() // named "mypkg.Client.Fetch"
+//		defer op.End()
+//		...
+func BeginFunc() Op {
+	return Begin(CallerName())
+}
+
+// funcName shortens a fully qualified function name like
+// github.com/getlantern/foo.(*Bar).Baz to foo.Bar.Baz.
+func funcName(full string) string {
+	if i := strings.LastIndex(full, "/"); i >= 0 {
+		full = full[i+1:]
+	}
+	return strings.NewReplacer("(*", "", "(", "", ")", "").Replace(full)
+}
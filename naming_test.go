@@ -0,0 +1,67 @@
+package ops_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+type namer struct{}
+
+func (n *namer) name() string {
+	return ops.CallerName()
+}
+
+func TestCallerName(t *testing.T) {
+	assert.Equal(t, "ops_test.TestCallerName", ops.CallerName())
+	assert.Equal(t, "ops_test.namer.name", (&namer{}).name())
+}
+
+func TestEmptyNamePolicy(t *testing.T) {
+	defer ops.SetEmptyNamePolicy(ops.KeepEmptyNames)
+
+	var diagnostics []map[string]interface{}
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		if report.Context["diagnostic"] == "empty_op_name" {
+			diagnostics = append(diagnostics, report.Context)
+		}
+	}, ops.DiagnosticOpName)
+
+	op := ops.Begin("")
+	assert.Equal(t, "", ops.Current()["op"])
+	op.End()
+
+	ops.SetEmptyNamePolicy(ops.NameEmptyFromCaller)
+	op = ops.Begin("")
+	assert.Equal(t, "ops_test.TestEmptyNamePolicy", ops.Current()["op"])
+	child := op.Begin("")
+	assert.Equal(t, "ops_test.TestEmptyNamePolicy", ops.Current()["op"])
+	child.End()
+	op.End()
+	assert.Empty(t, diagnostics)
+
+	ops.SetEmptyNamePolicy(ops.ReportEmptyNames)
+	ops.Do("", func(op ops.Op) (int, error) {
+		assert.Equal(t, "ops_test.TestEmptyNamePolicy", ops.Current()["op"])
+		return 0, nil
+	})
+	if assert.Len(t, diagnostics, 1) {
+		assert.Equal(t, "ops_test.TestEmptyNamePolicy", diagnostics[0]["caller_name"])
+		assert.True(t, strings.Contains(diagnostics[0]["caller"].(string), "naming_test.go:"))
+	}
+}
+
+func (n *namer) begin() ops.Op {
+	return ops.BeginFunc()
+}
+
+func TestBeginFunc(t *testing.T) {
+	op := ops.BeginFunc()
+	assert.Equal(t, "ops_test.TestBeginFunc", ops.Current()["op"])
+	child := (&namer{}).begin()
+	assert.Equal(t, "ops_test.namer.begin", ops.Current()["op"])
+	child.End()
+	op.End()
+}
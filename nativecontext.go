@@ -0,0 +1,283 @@
+package ops
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/getlantern/context"
+)
+
+// ContextBackend is an implementation of the per-goroutine context stacks that
+// Ops keep their state in.
+type ContextBackend int
+
+const (
+	// GetlanternContextBackend uses github.com/getlantern/context. This is the
+	// default.
+	GetlanternContextBackend ContextBackend = iota
+
+	// NativeContextBackend uses an implementation internal to this package
+	// which stores values in small slices rather than maps, shards the
+	// goroutine registry to reduce lock contention and reads globals without
+	// locking.
+	NativeContextBackend
+)
+
+// SetContextBackend selects the context backend. It must be called before any
+// Ops are begun and before any globals are set, typically from an init
+// function, since contexts and globals held by the previous backend are not
+// carried over.
+func SetContextBackend(backend ContextBackend) {
+	switch backend {
+	case NativeContextBackend:
+		cm = newNativeManager()
+	default:
+		cm = context.NewManager()
+	}
+}
+
+const nativeShards = 64
+
+type nativeShard struct {
+	mx       sync.Mutex
+	contexts map[uint64]*nativeContext
+}
+
+type nativeManager struct {
+	shards    [nativeShards]nativeShard
+	globals   atomic.Value // map[string]interface{}, copied on write
+	globalsMx sync.Mutex
+}
+
+func newNativeManager() *nativeManager {
+	m := &nativeManager{}
+	for i := range m.shards {
+		m.shards[i].contexts = make(map[uint64]*nativeContext)
+	}
+	m.globals.Store(map[string]interface{}{})
+	return m
+}
+
+func (m *nativeManager) shard(gid uint64) *nativeShard {
+	return &m.shards[gid%nativeShards]
+}
+
+func (m *nativeManager) current(gid uint64) *nativeContext {
+	s := m.shard(gid)
+	s.mx.Lock()
+	c := s.contexts[gid]
+	s.mx.Unlock()
+	return c
+}
+
+func (m *nativeManager) setCurrent(gid uint64, c *nativeContext) {
+	s := m.shard(gid)
+	s.mx.Lock()
+	if c == nil {
+		delete(s.contexts, gid)
+	} else {
+		s.contexts[gid] = c
+	}
+	s.mx.Unlock()
+}
+
+func (m *nativeManager) enter(gid uint64, parent *nativeContext) *nativeContext {
+	c := &nativeContext{m: m, gid: gid, parent: parent}
+	m.setCurrent(gid, c)
+	return c
+}
+
+func (m *nativeManager) Enter() context.Context {
+	gid := curGoroutineID()
+	return m.enter(gid, m.current(gid))
+}
+
+func (m *nativeManager) Go(fn func()) {
+	m.goFrom(m.current(curGoroutineID()), fn)
+}
+
+func (m *nativeManager) goFrom(branch *nativeContext, fn func()) {
+	go func() {
+		gid := curGoroutineID()
+		if branch != nil {
+			m.setCurrent(gid, &nativeContext{m: m, gid: gid, branch: branch})
+		}
+		defer m.setCurrent(gid, nil)
+		fn()
+	}()
+}
+
+func (m *nativeManager) PutGlobal(key string, value interface{}) {
+	m.globalsMx.Lock()
+	old := m.globals.Load().(map[string]interface{})
+	updated := make(map[string]interface{}, len(old)+1)
+	for k, v := range old {
+		updated[k] = v
+	}
+	updated[key] = value
+	m.globals.Store(updated)
+	m.globalsMx.Unlock()
+}
+
+func (m *nativeManager) PutGlobalDynamic(key string, valueFN func() interface{}) {
+	m.PutGlobal(key, dynamicValue(valueFN))
+}
+
+func (m *nativeManager) AsMap(obj interface{}, includeGlobals bool) context.Map {
+	if c := m.current(curGoroutineID()); c != nil {
+		return c.AsMap(obj, includeGlobals)
+	}
+	return m.asMap(nil, obj, includeGlobals)
+}
+
+func (m *nativeManager) asMap(c *nativeContext, obj interface{}, includeGlobals bool) context.Map {
+	result := make(context.Map)
+	m.fill(c, result, obj, includeGlobals)
+	return result
+}
+
+// fill adds the values visible from c to result.
+func (m *nativeManager) fill(c *nativeContext, result context.Map, obj interface{}, includeGlobals bool) {
+	if contextual, ok := obj.(context.Contextual); ok {
+		contextual.Fill(result)
+	}
+	for ; c != nil; c = c.next() {
+		c.mx.Lock()
+		for _, kv := range c.values {
+			if _, found := result[kv.key]; !found {
+				result[kv.key] = kv.value
+			}
+		}
+		c.mx.Unlock()
+	}
+	if includeGlobals {
+		for key, value := range m.globals.Load().(map[string]interface{}) {
+			if _, found := result[key]; !found {
+				result[key] = value
+			}
+		}
+	}
+	// Resolve dynamic values outside of locks, since they may take a while
+	for key, value := range result {
+		if fn, ok := value.(dynamicValue); ok {
+			result[key] = fn()
+		}
+	}
+}
+
+// dynamicValue marks values that are computed at the time they're read.
+type dynamicValue func() interface{}
+
+type nativeKV struct {
+	key   string
+	value interface{}
+}
+
+// nativeContext is a frame on a goroutine's context stack. Contexts typically
+// hold only a handful of values, so they're kept in a slice rather than a map.
+type nativeContext struct {
+	m      *nativeManager
+	gid    uint64
+	parent *nativeContext
+	branch *nativeContext
+	mx     sync.Mutex
+	values []nativeKV
+}
+
+func (c *nativeContext) next() *nativeContext {
+	if c.branch != nil {
+		return c.branch
+	}
+	return c.parent
+}
+
+func (c *nativeContext) Enter() context.Context {
+	return c.m.enter(curGoroutineID(), c)
+}
+
+func (c *nativeContext) Go(fn func()) {
+	c.m.goFrom(c, fn)
+}
+
+func (c *nativeContext) Exit() {
+	c.m.setCurrent(c.gid, c.parent)
+}
+
+func (c *nativeContext) Put(key string, value interface{}) context.Context {
+	c.mx.Lock()
+	c.put(key, value)
+	c.mx.Unlock()
+	return c
+}
+
+func (c *nativeContext) put(key string, value interface{}) {
+	for i := range c.values {
+		if c.values[i].key == key {
+			c.values[i].value = value
+			return
+		}
+	}
+	if c.values == nil {
+		c.values = make([]nativeKV, 0, 8)
+	}
+	c.values = append(c.values, nativeKV{key, value})
+}
+
+func (c *nativeContext) has(key string) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	for _, kv := range c.values {
+		if kv.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the value of key visible from c, without building the map of all
+// of them.
+func (c *nativeContext) get(key string) (interface{}, bool) {
+	for ctx := c; ctx != nil; ctx = ctx.next() {
+		ctx.mx.Lock()
+		for _, kv := range ctx.values {
+			if kv.key == key {
+				ctx.mx.Unlock()
+				if fn, ok := kv.value.(dynamicValue); ok {
+					return fn(), true
+				}
+				return kv.value, true
+			}
+		}
+		ctx.mx.Unlock()
+	}
+	return nil, false
+}
+
+func (c *nativeContext) PutIfAbsent(key string, value interface{}) context.Context {
+	for ctx := c; ctx != nil; ctx = ctx.next() {
+		if ctx.has(key) {
+			return c
+		}
+	}
+	return c.Put(key, value)
+}
+
+func (c *nativeContext) PutDynamic(key string, valueFN func() interface{}) context.Context {
+	return c.Put(key, dynamicValue(valueFN))
+}
+
+// Fill implements the method from the Contextual interface, adding the values
+// visible from c (but not globals) to m.
+func (c *nativeContext) Fill(m context.Map) {
+	c.m.fill(c, m, nil, false)
+}
+
+func (c *nativeContext) AsMap(obj interface{}, includeGlobals bool) context.Map {
+	return c.m.asMap(c, obj, includeGlobals)
+}
+
+// fillMap is like AsMap but adds the values to the given map, which lets
+// reports reuse maps (see SetReuseContextMaps).
+func (c *nativeContext) fillMap(result context.Map, includeGlobals bool) {
+	c.m.fill(c, result, nil, includeGlobals)
+}
@@ -0,0 +1,100 @@
+package ops_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNativeContextBackend(t *testing.T) {
+	ops.SetContextBackend(ops.NativeContextBackend)
+	defer ops.SetContextBackend(ops.GetlanternContextBackend)
+
+	var reported []*ops.Report
+	var mx sync.Mutex
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		mx.Lock()
+		reported = append(reported, report)
+		mx.Unlock()
+	}, "native_outer", "native_inner")
+
+	ops.SetGlobal("g", "global")
+	ops.SetGlobalDynamic("gd", func() interface{} { return 7 })
+	outer := ops.Begin("native_outer").Set("a", 1)
+	assert.Equal(t, "native_outer", ops.Current().String("op"))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	outer.Go(func() {
+		inner := ops.Begin("native_inner").Set("a", 2)
+		inner.SetDynamic("d", func() interface{} { return "dynamic" })
+		inner.FailIf(errors.New("inner failed"))
+		inner.End()
+		wg.Done()
+	})
+	wg.Wait()
+	outer.End()
+	assert.Empty(t, ops.Current())
+
+	mx.Lock()
+	defer mx.Unlock()
+	if assert.Len(t, reported, 2) {
+		inner, outer := reported[0].Context, reported[1].Context
+		assert.Equal(t, "native_inner", inner["op"])
+		assert.Equal(t, "native_outer", inner["root_op"])
+		assert.Equal(t, 2, inner["a"])
+		assert.Equal(t, "dynamic", inner["d"])
+		assert.Equal(t, "inner failed", inner["error"])
+		assert.Equal(t, "global", inner["g"])
+		assert.Equal(t, 7, inner["gd"])
+		assert.Equal(t, "native_outer", outer["op"])
+		assert.Equal(t, 1, outer["a"])
+		assert.Nil(t, outer["error"])
+	}
+}
+
+func BenchmarkBeginEnd(b *testing.B) {
+	b.Run("getlantern", benchmarkBeginEnd(ops.GetlanternContextBackend))
+	b.Run("native", benchmarkBeginEnd(ops.NativeContextBackend))
+}
+
+func benchmarkBeginEnd(backend ops.ContextBackend) func(b *testing.B) {
+	return func(b *testing.B) {
+		ops.SetContextBackend(backend)
+		defer ops.SetContextBackend(ops.GetlanternContextBackend)
+		ops.SetGlobal("bench_global", 1)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			outer := ops.Begin("bench_outer").Set("a", 1)
+			inner := outer.Begin("bench_inner").Set("b", 2)
+			inner.Snapshot()
+			inner.End()
+			outer.End()
+		}
+	}
+}
+
+func BenchmarkBeginEndParallel(b *testing.B) {
+	b.Run("getlantern", benchmarkBeginEndParallel(ops.GetlanternContextBackend))
+	b.Run("native", benchmarkBeginEndParallel(ops.NativeContextBackend))
+}
+
+func benchmarkBeginEndParallel(backend ops.ContextBackend) func(b *testing.B) {
+	return func(b *testing.B) {
+		ops.SetContextBackend(backend)
+		defer ops.SetContextBackend(ops.GetlanternContextBackend)
+		b.ReportAllocs()
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				op := ops.Begin("bench_parallel").Set("a", 1)
+				op.Snapshot()
+				op.End()
+			}
+		})
+	}
+}
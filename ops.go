@@ -6,28 +6,43 @@
 package ops
 
 import (
+	"fmt"
+	"io"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/getlantern/context"
 )
 
 var (
 	cm             = context.NewManager()
-	reporters      []Reporter
-	reportersMutex sync.RWMutex
+	reporters      atomic.Value // []*registeredReporter, copied on write
+	reportersMutex sync.Mutex
+	flushers       []func()
+	flushersMutex  sync.Mutex
 )
 
 // Reporter is a function that reports the success or failure of an Op. If
 // failure is nil, the Op can be considered successful.
 type Reporter func(failure error, ctx map[string]interface{})
 
+// StructuredReporter is like Reporter but receives a typed Report. If
+// SetReuseContextMaps is enabled, reporters must not keep the report's Context
+// after they return, see Report.Retain.
+type StructuredReporter func(report *Report)
+
 // Op represents an operation that's being performed. It mimics the API of
 // context.Context.
 type Op interface {
 	// Begin marks the beginning of an Op under this Op.
 	Begin(name string) Op
 
+	// BeginWith is like Begin but also puts the given alternating key/value
+	// pairs into the new Op's context before anything else can see the Op.
+	BeginWith(name string, kv ...interface{}) Op
+
 	// Go starts the given function on a new goroutine.
 	Go(fn func())
 
@@ -35,91 +50,499 @@ type Op interface {
 	// or failure to all registered Reporters.
 	End()
 
-	// Cancel cancels this op so that even if End() is called later, it will not
-	// report its success or failure.
+	// EndWithError is shorthand for FailIf(err) followed by End. It returns err
+	// for convenient chaining, as in return op.EndWithError(err).
+	EndWithError(err error) error
+
+	// Cancel cancels this op so that when End() is called later, it will not
+	// report its success or failure. End must still be called to pop the op's
+	// context.
 	Cancel()
 
-	// Set puts a key->value pair into the current Op's context.
+	// Set puts a key->value pair into the current Op's context. The value is
+	// inherited by Ops begun under this one, but isn't propagated to remote
+	// processes (see PutBaggage and PutTag).
 	Set(key string, value interface{}) Op
 
+	// PutBaggage is like Set, but the value is also propagated to remote
+	// processes with Inject and picked up by BeginRemote, using the W3C
+	// baggage header. Since baggage is copied into every downstream request,
+	// keep it for the few values the whole call chain needs, like a session
+	// id.
+	PutBaggage(key string, value string) Op
+
+	// PutTag records a key->value pair that describes only this Op. Unlike
+	// values put with Set, tags aren't inherited by Ops begun under this one,
+	// so they don't accumulate in deep call chains. Tags are included in this
+	// Op's reports and Snapshot, taking precedence over inherited values, but
+	// not in AsMap.
+	PutTag(key string, value interface{}) Op
+
 	// SetDynamic puts a key->value pair into the current Op's context, where the
 	// value is generated by a function that gets evaluated at every Read.
 	SetDynamic(key string, valueFN func() interface{}) Op
 
+	// SetDynamicOnce is like SetDynamic, but valueFN is evaluated only at the
+	// first Read and the result is reused from then on. This is useful for
+	// values that are expensive to compute but don't change.
+	SetDynamicOnce(key string, valueFN func() interface{}) Op
+
+	// SetDynamicOnFailure is like SetDynamic, but valueFN is only evaluated
+	// when this Op is reported as failed, and never for successful ones. This
+	// suits values that are expensive to compute and only help diagnose
+	// failures, like stack dumps or state snapshots. The value is only
+	// included in this Op's reports, not in those of Ops begun under it.
+	SetDynamicOnFailure(key string, valueFN func() interface{}) Op
+
+	// SetDynamicLimits overrides the global DynamicLimits for dynamic values set
+	// on this Op.
+	SetDynamicLimits(limits DynamicLimits) Op
+
 	// FailIf marks this Op as failed if the given err is not nil. If FailIf is
 	// called multiple times, the latest error will be reported as the failure.
+	// If err (or an error it wraps) is a ContextualError, its context is merged
+	// into this Op's context without overwriting existing keys. Likewise, the
+	// fields of a github.com/getlantern/errors error are merged into the report,
+	// with conflicting values recorded under "error_" + key.
 	// Returns the original error for convenient chaining.
 	FailIf(err error) error
+
+	// SetOutcome records how this Op ended in Report.Outcome and, unless it
+	// Succeeded, under the key "outcome". If no outcome is set, it's derived
+	// from the failure: Canceled for errors wrapping context.Canceled, TimedOut
+	// for errors wrapping context.DeadlineExceeded, Failed for other errors and
+	// Succeeded without one. Setting an outcome doesn't change the recorded
+	// failure.
+	SetOutcome(outcome Outcome) Op
+
+	// SetPriority sets the Priority of this Op and of the Ops begun under it
+	// that don't set their own, recorded in Report.Priority and, unless it's
+	// PriorityNormal, under the key "priority".
+	SetPriority(priority Priority) Op
+
+	// SetDeadline sets the time by which this Op and the Ops begun under it,
+	// including on goroutines started with Go, should be done, recorded under
+	// DeadlineKey. It never extends an inherited deadline, so a later deadline
+	// than the current one is ignored.
+	SetDeadline(deadline time.Time) Op
+
+	// Deadline returns the deadline of this Op, if it has one, whether set on
+	// this Op or inherited.
+	Deadline() (time.Time, bool)
+
+	// RemainingBudget returns how much time is left until the deadline of this
+	// Op, if it has one, so that calls made by the Op can size their own
+	// timeouts. It's zero or negative once the deadline has passed.
+	RemainingBudget() (time.Duration, bool)
+
+	// SetFailurePropagation overrides the global FailurePropagation for
+	// failures of this Op.
+	SetFailurePropagation(policy FailurePropagation) Op
+
+	// SetIdempotencyKey records key under "idempotency_key" so that consumers
+	// can deduplicate retried operations. See SuppressDuplicateSuccesses.
+	SetIdempotencyKey(key string) Op
+
+	// DependsOn records that this Op touched the given external dependency,
+	// like "redis". Reports list the dependencies touched by an Op and the Ops
+	// under it under "dependencies" and, for failed Ops, the dependencies of
+	// the failed Ops among them under "failed_dependencies", which is what
+	// Rollup.DependencyFailures counts.
+	DependsOn(dependency string) Op
+
+	// MarkEnqueued records that the work this Op represents was queued at the
+	// given time, before the Op began, for example when a worker begins the Op
+	// after taking the work off a queue. The report then includes the time
+	// spent waiting in the queue under "queue_wait_duration" and the time spent
+	// processing under "service_duration". Report.Duration still starts when
+	// the Op began.
+	MarkEnqueued(at time.Time) Op
+
+	// MarkDequeued records that the work this Op represents, which was queued
+	// when the Op began (or at the time given to MarkEnqueued), starts being
+	// processed now. See MarkEnqueued for the durations this adds to the
+	// report.
+	MarkDequeued() Op
+
+	// Warn records a problem that doesn't fail this Op under the key "warning",
+	// raising the Op's severity to SeverityWarning (unless it fails). Returns
+	// the original error for convenient chaining.
+	Warn(err error) error
+
+	// FailWithCode is like FailIf, but also records the given stable error code
+	// under the key "error_code".
+	FailWithCode(code string, err error) error
+
+	// Time runs fn, records how long it took under the key <name>_duration
+	// and fails this Op if fn returns an error, which is returned.
+	Time(name string, fn func() error) error
+
+	// Heartbeat makes this Op emit a progress report every interval until it
+	// ends, delivered only to reporters registered with
+	// RegisterProgressReporter. Progress reports have InProgress set,
+	// in_progress=true and elapsed set to the time since the Op began, and
+	// include any other keys (for example a progress counter) currently in the
+	// Op's context.
+	Heartbeat(interval time.Duration) Op
+
+	// RegisterReporter registers a reporter that receives reports only for
+	// this Op and Ops begun under it (via Op.Begin).
+	RegisterReporter(reporter Reporter) Op
+
+	// RegisterStructuredReporter is like RegisterReporter for structured
+	// reporters.
+	RegisterStructuredReporter(reporter StructuredReporter) Op
+
+	// WithReporter adds a reporter that receives reports for this Op and all
+	// Ops that inherit its context, including those begun with the package
+	// level Begin on the same goroutine or on goroutines started with Go, until
+	// this Op ends, at which point the reporter is removed. This is useful for
+	// capturing all of the telemetry of one request, for example to explain it
+	// to an admin.
+	WithReporter(reporter StructuredReporter) Op
+
+	// Snapshot returns the current merged context of this Op, including globals
+	// and dynamic values, as it would be reported if the Op ended now.
+	Snapshot() Map
+
+	// ID returns the unique id of this Op.
+	ID() string
+
+	// TraceID returns the id of the trace to which this Op belongs. Ops begun
+	// from another Op share its trace id.
+	TraceID() string
+
+	// ParentID returns the id of the Op under which this Op was begun, or "" if
+	// it has no known parent.
+	ParentID() string
+
+	// TrackReader wraps the given Reader to record bytes_read, read_duration and
+	// read_error in this Op's context. Read errors other than io.EOF fail the
+	// Op.
+	TrackReader(r io.Reader) io.Reader
+
+	// TrackWriter wraps the given Writer to record bytes_written,
+	// write_duration and write_error in this Op's context. Write errors fail
+	// the Op.
+	TrackWriter(w io.Writer) io.Writer
 }
 
 type op struct {
 	ctx      context.Context
+	name     string
+	start    time.Time
+	id       string
+	traceID  string
+	parentID string
+	parent   *op
+	root     *op
+	depth    int
+	gid      uint64
+	// below is the op that was innermost on the goroutine when this one began
+	// with the getlantern backend, see pushStack
+	below    *op
+	stacked  bool
 	canceled bool
+	ended    int32
 	failure  atomic.Value
+	rtrace   *runtimeTrace
+	ioStats  *ioStats
+	ioOnce   sync.Once
+	limits   atomic.Value
+	stopBeat chan interface{}
+	beatMx   sync.Mutex
+	scoped   []StructuredReporter
+	scopedMx sync.RWMutex
+	// lookups mirror the values put with putLookup, see lookup
+	lookups   map[string]interface{}
+	lookupsMx sync.RWMutex
+	// ownScopes are the reporters added with WithReporter
+	ownScopes []*reporterScope
+	debug     int32
+	warned    int32
+	// baggage and tags are set with PutBaggage and PutTag
+	baggage   map[string]string
+	baggageMx sync.Mutex
+	tags      map[string]interface{}
+	tagsMx    sync.Mutex
+	// onFailure holds values set with SetDynamicOnFailure
+	onFailure   []failureValue
+	onFailureMx sync.Mutex
+	// descendants and budgetExceeded are only used on roots, see Budget
+	descendants    int32
+	budgetExceeded int32
+	// sequence is only used on roots, see Report.Sequence
+	sequence uint64
+	// propagation is the FailurePropagation plus one, or 0 if not set
+	propagation int32
+	// outcome is the Outcome plus one, or 0 if not set
+	outcome int32
+	// priority is the Priority minus PriorityLow plus one, or 0 if not set
+	priority int32
+	// enqueued and dequeued are Unix nanoseconds, or 0 if not marked
+	enqueued int64
+	dequeued int64
+	deps     dependencies
+	depsMx   sync.Mutex
+	// children are the open children to close when this op ends, and closable
+	// indicates whether this op is among its parent's, see
+	// SetCloseChildrenOnEnd
+	children   map[*op]bool
+	childrenMx sync.Mutex
+	closable   bool
 }
 
 // RegisterReporter registers the given reporter.
 func RegisterReporter(reporter Reporter) {
+	RegisterReporterFor(reporter)
+}
+
+// RegisterStructuredReporter registers the given structured reporter.
+func RegisterStructuredReporter(reporter StructuredReporter) {
+	RegisterStructuredReporterFor(reporter)
+}
+
+// RegisterReporterFor is like RegisterReporter, but the reporter only receives
+// reports for ops with one of the given names. If no names are given, it
+// receives all reports. Ops in which no reporter is interested skip building
+// their report altogether.
+func RegisterReporterFor(reporter Reporter, names ...string) {
+	RegisterStructuredReporterFor(func(report *Report) {
+		reporter(report.Failure, report.Context)
+	}, names...)
+}
+
+// RegisterStructuredReporterFor is like RegisterReporterFor for structured
+// reporters.
+func RegisterStructuredReporterFor(reporter StructuredReporter, names ...string) {
+	r := &registeredReporter{reporter: reporter}
+	if len(names) > 0 {
+		r.names = make(map[string]bool, len(names))
+		for _, name := range names {
+			r.names[name] = true
+		}
+	}
 	reportersMutex.Lock()
-	reporters = append(reporters, reporter)
+	existing, _ := reporters.Load().([]*registeredReporter)
+	updated := make([]*registeredReporter, 0, len(existing)+1)
+	updated = append(updated, existing...)
+	reporters.Store(append(updated, r))
 	reportersMutex.Unlock()
 }
 
+type registeredReporter struct {
+	reporter StructuredReporter
+	// names are the op names of interest to the reporter, nil meaning all
+	names map[string]bool
+}
+
+// RegisterFlusher registers a function that flushes buffered reports, for
+// example Aggregator.Flush. Flushers are called by Flush.
+func RegisterFlusher(flusher func()) {
+	flushersMutex.Lock()
+	flushers = append(flushers, flusher)
+	flushersMutex.Unlock()
+}
+
+// Flush calls all registered flushers.
+func Flush() {
+	flushersMutex.Lock()
+	flushersCopy := make([]func(), len(flushers))
+	copy(flushersCopy, flushers)
+	flushersMutex.Unlock()
+	for _, flusher := range flushersCopy {
+		flusher()
+	}
+}
+
 // Begin marks the beginning of a new Op.
 func Begin(name string) Op {
-	return &op{ctx: cm.Enter().Put("op", name).PutIfAbsent("root_op", name)}
+	return newOp(cm.Enter(), name, nil)
 }
 
 func (o *op) Begin(name string) Op {
-	return &op{ctx: o.ctx.Enter().Put("op", name).PutIfAbsent("root_op", name)}
+	if !o.withinBudget() {
+		return &noopOp{o}
+	}
+	return newOp(o.ctx.Enter(), name, o)
+}
+
+// BeginWith is like Begin but also puts the given alternating key/value pairs
+// into the new Op's context before anything else can see the Op, for example
+// BeginWith("dial", "addr", addr, "proto", "tcp"). Keys that aren't strings are
+// formatted with fmt.Sprint and a trailing key without a value gets nil.
+func BeginWith(name string, kv ...interface{}) Op {
+	return newOpWith(cm.Enter(), name, nil, kv)
+}
+
+func (o *op) BeginWith(name string, kv ...interface{}) Op {
+	if !o.withinBudget() {
+		return &noopOp{o}
+	}
+	return newOpWith(o.ctx.Enter(), name, o, kv)
+}
+
+func newOpWith(ctx context.Context, name string, parent *op, kv []interface{}) *op {
+	debug, hasDebug := interface{}(nil), false
+	for i := 0; i < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		var value interface{}
+		if i+1 < len(kv) {
+			value = kv[i+1]
+		}
+		if key == DebugKey {
+			debug, hasDebug = value, true
+		}
+		ctx.Put(key, value)
+	}
+	o := newOp(ctx, name, parent)
+	if hasDebug {
+		o.setDebug(debug)
+	}
+	return o
+}
+
+func newOp(ctx context.Context, name string, parent *op) *op {
+	name = applyEmptyNamePolicy(name)
+	o := &op{
+		ctx:   ctx,
+		name:  name,
+		start: time.Now(),
+		id:    newSpanID(),
+	}
+	switch native, isNative := ctx.(*nativeContext); {
+	case isNative:
+		o.gid = native.gid
+	case parent != nil:
+		// The getlantern backend enters the context on the stack of the
+		// goroutine that began the parent, so there's no need to look up the
+		// current goroutine.
+		o.gid = parent.gid
+		o.pushStack()
+	default:
+		o.gid = curGoroutineID()
+		o.pushStack()
+	}
+	if parent != nil {
+		o.traceID = parent.traceID
+		o.parentID = parent.id
+		o.parent = parent
+		o.root = parent.root
+		o.depth = parent.depth + 1
+		parent.addChild(o)
+	} else {
+		o.traceID = newTraceID()
+		o.root = o
+	}
+	ctx.Put("op", name).PutIfAbsent("root_op", name).Put("op_id", o.id).Put("trace_id", o.traceID)
+	if parent == nil {
+		o.applyDebugFlag()
+	}
+	o.startRuntimeTrace(parent)
+	o.track()
+	return o
 }
 
 func (o *op) Go(fn func()) {
-	o.ctx.Go(fn)
+	o.ctx.Go(o.seedStack(fn))
 }
 
 // Go mimics the method from context.Manager.
 func Go(fn func()) {
-	cm.Go(fn)
+	cm.Go(innermost().seedStack(fn))
 }
 
 func (o *op) Cancel() {
 	o.canceled = true
+	o.untrack()
 }
 
 func (o *op) End() {
 	if o.canceled {
+		// Canceled ops aren't reported, but their context still needs popping
+		if atomic.CompareAndSwapInt32(&o.ended, 0, 1) {
+			o.removeFromParent()
+			o.closeChildren()
+			o.stopHeartbeat()
+			o.endRuntimeTrace()
+			o.endReporterScopes()
+			o.exit()
+		}
 		return
 	}
-
-	var reportersCopy []Reporter
-	reportersMutex.RLock()
-	if len(reporters) > 0 {
-		reportersCopy = make([]Reporter, len(reporters))
-		copy(reportersCopy, reporters)
+	if !atomic.CompareAndSwapInt32(&o.ended, 0, 1) {
+		o.exitClosed()
+		return
 	}
-	reportersMutex.RUnlock()
+	o.removeFromParent()
+	o.closeChildren()
+	o.untrack()
+	o.stopHeartbeat()
+	o.endRuntimeTrace()
+	o.injectFailure()
+	o.propagateFailure()
+	o.recordFailedDependencies()
 
+	reportersCopy := o.reporters()
 	if len(reportersCopy) > 0 {
-		var failure error
-		_failure := o.failure.Load()
-		ctx := o.ctx.AsMap(_failure, true)
-		if _failure != nil {
-			failure = _failure.(error)
-			_, errorSet := ctx["error"]
-			if !errorSet {
-				ctx["error"] = failure.Error()
-			}
+		report := o.reusableReport()
+		if shouldDeliver(report) {
+			report.Sequence = o.nextSequence()
+			dispatch(reportersCopy, report)
 		}
-		for _, reporter := range reportersCopy {
-			reporter(failure, ctx)
+		releaseReport(report)
+	}
+	o.endReporterScopes()
+
+	o.exit()
+}
+
+func (o *op) EndWithError(err error) error {
+	o.FailIf(err)
+	o.End()
+	return err
+}
+
+// shouldDeliver decides whether a finished op's report gets delivered to
+// reporters.
+func shouldDeliver(report *Report) bool {
+	disabled, debug, rate := flagsDecision(report)
+	if disabled {
+		return false
+	}
+	if debug || isDebugReport(report) {
+		return true
+	}
+	return (report.Priority == PriorityHigh || (sample(report) && sampleFlagRate(report, rate))) &&
+		!isDuplicateSuccess(report)
+}
+
+// currentReporters returns the reporters interested in ops with the given
+// name. It doesn't lock, since the list of reporters is copied on write.
+func currentReporters(name string) []StructuredReporter {
+	var reportersCopy []StructuredReporter
+	current, _ := reporters.Load().([]*registeredReporter)
+	for _, r := range current {
+		if r.names == nil || r.names[name] {
+			reportersCopy = append(reportersCopy, r.reporter)
 		}
 	}
+	return reportersCopy
+}
 
-	o.ctx.Exit()
+func dispatch(reportersCopy []StructuredReporter, report *Report) {
+	for _, reporter := range reportersCopy {
+		reporter(report)
+	}
 }
 
 func (o *op) Set(key string, value interface{}) Op {
+	if key == DebugKey {
+		o.setDebug(value)
+	}
 	o.ctx.Put(key, value)
 	return o
 }
@@ -131,24 +554,59 @@ func SetGlobal(key string, value interface{}) {
 }
 
 func (o *op) SetDynamic(key string, valueFN func() interface{}) Op {
-	o.ctx.PutDynamic(key, valueFN)
+	o.ctx.PutDynamic(key, guardDynamic(o.dynamicLimits, valueFN))
 	return o
 }
 
+func (o *op) SetDynamicOnce(key string, valueFN func() interface{}) Op {
+	return o.SetDynamic(key, once(valueFN))
+}
+
 // SetGlobalDynamic is like SetGlobal but uses a function to derive the value
 // at read time.
 func SetGlobalDynamic(key string, valueFN func() interface{}) {
-	cm.PutGlobalDynamic(key, valueFN)
+	cm.PutGlobalDynamic(key, guardDynamic(globalDynamicLimits, valueFN))
+}
+
+// SetGlobalDynamicOnce is like SetGlobalDynamic but only evaluates valueFN at
+// the first read, reusing the result from then on.
+func SetGlobalDynamicOnce(key string, valueFN func() interface{}) {
+	SetGlobalDynamic(key, once(valueFN))
 }
 
-// AsMap mimics the method from context.Manager.
+// AsMap mimics the method from context.Manager. It returns a context.Map so
+// that github.com/getlantern/errors and golog can capture it directly; use
+// Current for an ops.Map.
 func AsMap(obj interface{}, includeGlobals bool) context.Map {
 	return cm.AsMap(obj, includeGlobals)
 }
 
+func (o *op) ID() string {
+	return o.id
+}
+
+func (o *op) TraceID() string {
+	return o.traceID
+}
+
+func (o *op) ParentID() string {
+	return o.parentID
+}
+
 func (o *op) FailIf(err error) error {
 	if err != nil {
 		o.failure.Store(err)
+		o.mergeErrorContext(err)
+		if o.isDebug() {
+			o.ctx.Put("stack", string(debug.Stack()))
+		}
 	}
 	return err
 }
+
+func (o *op) Time(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	o.Set(name+"_duration", time.Since(start))
+	return o.FailIf(err)
+}
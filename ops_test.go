@@ -17,7 +17,7 @@ func TestSuccess(t *testing.T) {
 		reportedCtx = ctx
 	}
 
-	ops.RegisterReporter(report)
+	ops.RegisterReporterFor(report, "test_success", "inside")
 	ops.SetGlobal("g", "g1")
 	op := ops.Begin("test_success").Set("a", 1).SetDynamic("b", func() interface{} { return 2 })
 	defer op.End()
@@ -27,11 +27,14 @@ func TestSuccess(t *testing.T) {
 
 	assert.Nil(t, reportedFailure)
 	expectedCtx := map[string]interface{}{
-		"op":      "inside",
-		"root_op": "test_success",
-		"g":       "g1",
-		"a":       1,
-		"b":       2,
+		"op":             "inside",
+		"root_op":        "test_success",
+		"op_id":          innerOp.ID(),
+		"trace_id":       op.TraceID(),
+		"schema_version": ops.SchemaVersion,
+		"g":              "g1",
+		"a":              1,
+		"b":              2,
 	}
 	assert.Equal(t, expectedCtx, reportedCtx)
 }
@@ -52,7 +55,7 @@ func doTestFailure(t *testing.T, cancel bool) {
 		reportedCtx = ctx
 	}
 
-	ops.RegisterReporter(report)
+	ops.RegisterReporterFor(report, "test_failure")
 	op := ops.Begin("test_failure")
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -69,8 +72,47 @@ func doTestFailure(t *testing.T, cancel bool) {
 	if cancel {
 		assert.Nil(t, reportedFailure)
 		assert.Nil(t, reportedCtx)
+		assert.Nil(t, ops.AsMap(nil, false)["op"], "ending a canceled op should pop its context")
 	} else {
 		assert.Contains(t, reportedFailure.Error(), "I failed")
 		assert.Equal(t, 5, reportedCtx["errorcontext"])
 	}
 }
+
+func TestEndWithError(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_end_with_error")
+
+	assert.NoError(t, ops.Begin("test_end_with_error").EndWithError(nil))
+	assert.True(t, reported.Succeeded())
+
+	err := errors.New("I failed")
+	assert.Equal(t, err, ops.Begin("test_end_with_error").EndWithError(err))
+	assert.Equal(t, err, reported.Failure)
+}
+
+func TestBeginWith(t *testing.T) {
+	var reported []*ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = append(reported, report)
+	}, "test_begin_with", "test_begin_with_child")
+
+	op := ops.BeginWith("test_begin_with", "a", 1, "b", "two", 3, "three", "dangling")
+	op.BeginWith("test_begin_with_child", "a", 2).End()
+	op.End()
+
+	if assert.Len(t, reported, 2) {
+		child, parent := reported[0].Context, reported[1].Context
+		assert.Equal(t, 2, child["a"])
+		assert.Equal(t, "two", child["b"])
+		assert.Equal(t, reported[1].ID, reported[0].ParentID)
+		assert.Equal(t, 1, parent["a"])
+		assert.Equal(t, "three", parent["3"])
+		_, found := parent["dangling"]
+		assert.True(t, found)
+		assert.Nil(t, parent["dangling"])
+		assert.Equal(t, "test_begin_with", parent["op"])
+	}
+}
@@ -0,0 +1,352 @@
+// Package opsclickhouse provides a reporter that batches reports and inserts
+// them into ClickHouse, where wide per-op events are easy to slice and
+// aggregate with SQL. Reports are inserted into a table with the following
+// schema (see Schema), which New creates if necessary:
+//
+//	CREATE TABLE IF NOT EXISTS ops_reports (
+//		name      LowCardinality(String),
+//		op_id     String,
+//		trace_id  String,
+//		parent_id String,
+//		start     DateTime64(6, 'UTC'),
+//		duration  Int64 COMMENT 'nanoseconds',
+//		succeeded UInt8,
+//		outcome   LowCardinality(String),
+//		error     String,
+//		context   Map(String, String)
+//	) ENGINE = MergeTree
+//	PARTITION BY toYYYYMM(start)
+//	ORDER BY (name, start)
+//
+// Context values that aren't strings are stored as JSON, so they can be
+// extracted with the JSONExtract functions, for example:
+//
+//	SELECT name, quantile(0.99)(duration) FROM ops_reports
+//	WHERE context['country'] = 'US' GROUP BY name
+//
+// The HTTP interface is used by setting Options.URL. For the native interface,
+// set Options.DB to a database opened with a ClickHouse driver for
+// database/sql, like github.com/ClickHouse/clickhouse-go/v2, which
+// opsclickhouse doesn't depend on.
+package opsclickhouse
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opsclickhouse")
+}
+
+const schema = `CREATE TABLE IF NOT EXISTS %s (
+	name      LowCardinality(String),
+	op_id     String,
+	trace_id  String,
+	parent_id String,
+	start     DateTime64(6, 'UTC'),
+	duration  Int64 COMMENT 'nanoseconds',
+	succeeded UInt8,
+	outcome   LowCardinality(String),
+	error     String,
+	context   Map(String, String)
+) ENGINE = MergeTree
+PARTITION BY toYYYYMM(start)
+ORDER BY (name, start)`
+
+const columns = "name, op_id, trace_id, parent_id, start, duration, succeeded, outcome, error, context"
+
+// startFormat is how start times are formatted for the HTTP interface.
+const startFormat = "2006-01-02 15:04:05.000000"
+
+// Schema returns the statement that creates the table of the given name.
+func Schema(table string) string {
+	return fmt.Sprintf(schema, table)
+}
+
+// Options configures an Exporter. Zero values use the defaults noted on each
+// field. Either URL or DB must be set.
+type Options struct {
+	// URL is the URL of the HTTP interface, for example
+	// http://localhost:8123/?database=telemetry.
+	URL string
+
+	// Username and Password authenticate requests to the HTTP interface.
+	Username string
+	Password string
+
+	// Client is the http.Client used for the HTTP interface (default
+	// http.DefaultClient).
+	Client *http.Client
+
+	// DB is a database using the native interface, used if URL isn't set.
+	DB *sql.DB
+
+	// Table is the name of the table (default "ops_reports").
+	Table string
+
+	// BatchSize is how many reports are inserted at most per batch (default
+	// 10000).
+	BatchSize int
+
+	// FlushInterval is how long reports wait at most before being inserted
+	// (default 5 seconds). ClickHouse works best with few large inserts.
+	FlushInterval time.Duration
+}
+
+// Exporter is a reporter that inserts reports into ClickHouse in the
+// background.
+type Exporter struct {
+	opts     Options
+	queue    chan interface{}
+	dropped  int64
+	done     chan interface{}
+	closed   bool
+	closedMx sync.RWMutex
+}
+
+// row is a report as inserted, with the JSON names of the HTTP interface.
+type row struct {
+	Name      string            `json:"name"`
+	ID        string            `json:"op_id"`
+	TraceID   string            `json:"trace_id"`
+	ParentID  string            `json:"parent_id"`
+	Start     string            `json:"start"`
+	Duration  int64             `json:"duration"`
+	Succeeded uint8             `json:"succeeded"`
+	Outcome   string            `json:"outcome"`
+	Error     string            `json:"error"`
+	Context   map[string]string `json:"context"`
+
+	start time.Time
+}
+
+// New creates the table (if necessary) and returns an Exporter that inserts
+// into it. Register it with ops.RegisterStructuredReporter(exporter.Report)
+// and Close it before the process exits to insert queued reports.
+func New(opts Options) (*Exporter, error) {
+	if opts.URL == "" && opts.DB == nil {
+		return nil, fmt.Errorf("either URL or DB is required")
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Table == "" {
+		opts.Table = "ops_reports"
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 10000
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	e := &Exporter{
+		opts:  opts,
+		queue: make(chan interface{}, opts.BatchSize),
+		done:  make(chan interface{}),
+	}
+	if err := e.exec(Schema(opts.Table), nil); err != nil {
+		return nil, fmt.Errorf("unable to create table %v: %v", opts.Table, err)
+	}
+	go e.run()
+	return e, nil
+}
+
+// Report queues the report for inserting. Reports are dropped if the queue is
+// full or the Exporter is closed.
+func (e *Exporter) Report(report *ops.Report) {
+	r := toRow(report)
+	e.closedMx.RLock()
+	defer e.closedMx.RUnlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.queue <- r:
+	default:
+		atomic.AddInt64(&e.dropped, 1)
+	}
+}
+
+func toRow(report *ops.Report) *row {
+	r := &row{
+		Name:     report.Name,
+		ID:       report.ID,
+		TraceID:  report.TraceID,
+		ParentID: report.ParentID,
+		Start:    report.Start.UTC().Format(startFormat),
+		Duration: int64(report.Duration),
+		Outcome:  report.Outcome.String(),
+		Context:  make(map[string]string, len(report.Context)),
+		start:    report.Start,
+	}
+	if report.Succeeded() {
+		r.Succeeded = 1
+	}
+	if report.Failure != nil {
+		r.Error = ops.ErrorText(report.Failure)
+	}
+	for key, value := range report.Context {
+		if s, ok := value.(string); ok {
+			r.Context[key] = s
+		} else if encoded, err := json.Marshal(value); err == nil {
+			r.Context[key] = string(encoded)
+		} else {
+			r.Context[key] = fmt.Sprint(value)
+		}
+	}
+	return r
+}
+
+// Dropped returns the number of reports that were dropped because too many
+// were waiting or because inserting them failed.
+func (e *Exporter) Dropped() int64 {
+	return atomic.LoadInt64(&e.dropped)
+}
+
+// Flush waits until all queued reports have been inserted.
+func (e *Exporter) Flush() {
+	flushed := make(chan interface{})
+	e.closedMx.RLock()
+	if e.closed {
+		e.closedMx.RUnlock()
+		return
+	}
+	e.queue <- flushed
+	e.closedMx.RUnlock()
+	<-flushed
+}
+
+// Close inserts any queued reports and stops the Exporter. It doesn't close
+// the database.
+func (e *Exporter) Close() {
+	e.closedMx.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.closedMx.Unlock()
+	<-e.done
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]*row, 0, e.opts.BatchSize)
+	insert := func() {
+		if len(batch) > 0 {
+			if err := e.insert(batch); err != nil {
+				atomic.AddInt64(&e.dropped, int64(len(batch)))
+			}
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case item, ok := <-e.queue:
+			if !ok {
+				insert()
+				return
+			}
+			switch t := item.(type) {
+			case *row:
+				batch = append(batch, t)
+				if len(batch) >= e.opts.BatchSize {
+					insert()
+				}
+			case chan interface{}:
+				insert()
+				close(t)
+			}
+		case <-ticker.C:
+			insert()
+		}
+	}
+}
+
+func (e *Exporter) insert(batch []*row) error {
+	statement := fmt.Sprintf("INSERT INTO %s (%s)", e.opts.Table, columns)
+	if e.opts.URL == "" {
+		return e.insertNative(statement, batch)
+	}
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, r := range batch {
+		if err := encoder.Encode(r); err != nil {
+			return err
+		}
+	}
+	return e.exec(statement+" FORMAT JSONEachRow", &body)
+}
+
+func (e *Exporter) insertNative(statement string, batch []*row) error {
+	tx, err := e.opts.DB.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(statement)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range batch {
+		_, err := stmt.Exec(r.Name, r.ID, r.TraceID, r.ParentID, r.start, r.Duration,
+			r.Succeeded, r.Outcome, r.Error, r.Context)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// exec runs the given statement, with data for inserts over the HTTP
+// interface.
+func (e *Exporter) exec(statement string, data io.Reader) error {
+	if e.opts.URL == "" {
+		_, err := e.opts.DB.Exec(statement)
+		return err
+	}
+	u, err := url.Parse(e.opts.URL)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		data = bytes.NewBufferString(statement)
+	} else {
+		// With data in the body, the statement goes in the query parameter
+		q := u.Query()
+		q.Set("query", statement)
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequest(http.MethodPost, u.String(), data)
+	if err != nil {
+		return err
+	}
+	if e.opts.Username != "" {
+		req.Header.Set("X-ClickHouse-User", e.opts.Username)
+		req.Header.Set("X-ClickHouse-Key", e.opts.Password)
+	}
+	resp, err := e.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("unexpected status %v: %s", resp.Status, bytes.TrimSpace(message))
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package opsclickhouse_test
+
+import (
+	"bufio"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opsclickhouse"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTP(t *testing.T) {
+	var mx sync.Mutex
+	var statements []string
+	var rows []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		mx.Lock()
+		defer mx.Unlock()
+		assert.Equal(t, "default", req.Header.Get("X-ClickHouse-User"))
+		assert.Equal(t, "telemetry", req.URL.Query().Get("database"))
+		query := req.URL.Query().Get("query")
+		if query == "" {
+			b, _ := io.ReadAll(req.Body)
+			statements = append(statements, string(b))
+			return
+		}
+		statements = append(statements, query)
+		scanner := bufio.NewScanner(req.Body)
+		for scanner.Scan() {
+			var r map[string]interface{}
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+			rows = append(rows, r)
+		}
+	}))
+	defer server.Close()
+
+	e, err := opsclickhouse.New(opsclickhouse.Options{
+		URL:           server.URL + "/?database=telemetry",
+		Username:      "default",
+		FlushInterval: time.Hour,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	start := time.Date(2026, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	e.Report(&ops.Report{Name: "dial", ID: "a", TraceID: "t", Start: start, Duration: time.Millisecond,
+		Context: map[string]interface{}{"country": "US", "attempts": 2}})
+	e.Report(&ops.Report{Name: "dial", ID: "b", Start: start, Failure: errors.New("refused"), Outcome: ops.Failed})
+	e.Flush()
+
+	mx.Lock()
+	defer mx.Unlock()
+	if assert.Len(t, statements, 2) {
+		assert.Equal(t, opsclickhouse.Schema("ops_reports"), statements[0])
+		assert.Equal(t, "INSERT INTO ops_reports (name, op_id, trace_id, parent_id, start, duration, succeeded, outcome, error, context) FORMAT JSONEachRow", statements[1])
+	}
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, "dial", rows[0]["name"])
+		assert.Equal(t, "t", rows[0]["trace_id"])
+		assert.Equal(t, "2026-01-02 03:04:05.123456", rows[0]["start"])
+		assert.EqualValues(t, 1000000, rows[0]["duration"])
+		assert.EqualValues(t, 1, rows[0]["succeeded"])
+		assert.Equal(t, "succeeded", rows[0]["outcome"])
+		assert.Equal(t, map[string]interface{}{"country": "US", "attempts": "2"}, rows[0]["context"])
+		assert.EqualValues(t, 0, rows[1]["succeeded"])
+		assert.Equal(t, "failed", rows[1]["outcome"])
+		assert.Equal(t, "refused", rows[1]["error"])
+	}
+	e.Close()
+	assert.EqualValues(t, 0, e.Dropped())
+}
+
+func TestHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusBadRequest)
+		resp.Write([]byte("Code: 62. DB::Exception: Syntax error"))
+	}))
+	defer server.Close()
+	_, err := opsclickhouse.New(opsclickhouse.Options{URL: server.URL})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Syntax error")
+	}
+}
+
+func TestNative(t *testing.T) {
+	fake.reset()
+	db, err := sql.Open("opsclickhouse_fake", "")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer db.Close()
+	e, err := opsclickhouse.New(opsclickhouse.Options{DB: db, Table: "reports", FlushInterval: time.Hour})
+	if !assert.NoError(t, err) {
+		return
+	}
+	start := time.Now()
+	e.Report(&ops.Report{Name: "dial", ID: "a", Start: start, Duration: time.Millisecond, Context: map[string]interface{}{"country": "US"}})
+	e.Close()
+
+	fake.mx.Lock()
+	defer fake.mx.Unlock()
+	if assert.Len(t, fake.statements, 2) {
+		assert.Equal(t, opsclickhouse.Schema("reports"), fake.statements[0])
+		assert.True(t, strings.HasPrefix(fake.statements[1], "INSERT INTO reports ("))
+	}
+	if assert.Len(t, fake.args, 1) {
+		args := fake.args[0]
+		assert.Equal(t, "dial", args[0])
+		assert.Equal(t, start, args[4])
+		assert.Equal(t, int64(time.Millisecond), args[5])
+		assert.Equal(t, map[string]string{"country": "US"}, args[9])
+	}
+	assert.Equal(t, 1, fake.commits)
+}
+
+// fakeDriver records statements like a ClickHouse driver would receive them.
+type fakeDriver struct {
+	statements []string
+	args       [][]interface{}
+	commits    int
+	mx         sync.Mutex
+}
+
+var fake = &fakeDriver{}
+
+// reset forgets what earlier tests recorded, since drivers can't be
+// registered again.
+func (d *fakeDriver) reset() {
+	d.mx.Lock()
+	d.statements, d.args, d.commits = nil, nil, 0
+	d.mx.Unlock()
+}
+
+func init() {
+	sql.Register("opsclickhouse_fake", fake)
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) { return fakeConn{d}, nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.mx.Lock()
+	c.d.statements = append(c.d.statements, query)
+	c.d.mx.Unlock()
+	return fakeStmt{c.d}, nil
+}
+
+func (c fakeConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	c.d.mx.Lock()
+	c.d.statements = append(c.d.statements, query)
+	c.d.mx.Unlock()
+	return driver.RowsAffected(0), nil
+}
+
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{c.d}, nil }
+
+// CheckNamedValue accepts any value, like ClickHouse drivers accept maps.
+func (c fakeConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+type fakeStmt struct{ d *fakeDriver }
+
+func (s fakeStmt) Close() error  { return nil }
+func (s fakeStmt) NumInput() int { return -1 }
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+	}
+	s.d.mx.Lock()
+	s.d.args = append(s.d.args, values)
+	s.d.mx.Unlock()
+	return driver.RowsAffected(1), nil
+}
+func (s fakeStmt) Query(args []driver.Value) (driver.Rows, error) { return nil, driver.ErrSkip }
+
+type fakeTx struct{ d *fakeDriver }
+
+func (tx fakeTx) Commit() error {
+	tx.d.mx.Lock()
+	tx.d.commits++
+	tx.d.mx.Unlock()
+	return nil
+}
+func (tx fakeTx) Rollback() error { return nil }
@@ -0,0 +1,130 @@
+// Package opsdns provides a net.Resolver wrapper that tracks each lookup as an
+// op.
+package opsdns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opsdns")
+}
+
+// Resolver wraps a net.Resolver so that each lookup is performed as an op
+// named "dns_lookup" under the currently active op. Lookups record
+// dns_query_type, dns_host, dns_resolver and dns_answers and, on failure,
+// dns_error_class (one of nxdomain, timeout, servfail or other).
+type Resolver struct {
+	resolver *net.Resolver
+	name     string
+}
+
+// New creates a Resolver wrapping the given net.Resolver (net.DefaultResolver
+// if nil). name identifies the resolver in reports.
+func New(resolver *net.Resolver, name string) *Resolver {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	return &Resolver{resolver: resolver, name: name}
+}
+
+func (r *Resolver) begin(queryType string, host string) ops.Op {
+	return ops.Begin("dns_lookup").
+		Set("dns_query_type", queryType).
+		Set("dns_host", host).
+		Set("dns_resolver", r.name)
+}
+
+func finish(op ops.Op, answers int, err error) error {
+	if err != nil {
+		op.Set("dns_error_class", Classify(err))
+	} else {
+		op.Set("dns_answers", answers)
+	}
+	op.FailIf(err)
+	op.End()
+	return err
+}
+
+// LookupHost is like net.Resolver.LookupHost.
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	op := r.begin("host", host)
+	addrs, err := r.resolver.LookupHost(ctx, host)
+	return addrs, finish(op, len(addrs), err)
+}
+
+// LookupIPAddr is like net.Resolver.LookupIPAddr.
+func (r *Resolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	op := r.begin("ip", host)
+	addrs, err := r.resolver.LookupIPAddr(ctx, host)
+	return addrs, finish(op, len(addrs), err)
+}
+
+// LookupIP is like net.Resolver.LookupIP. The query type is recorded as A for
+// network "ip4", AAAA for "ip6" and ip otherwise.
+func (r *Resolver) LookupIP(ctx context.Context, network, host string) ([]net.IP, error) {
+	queryType := "ip"
+	switch network {
+	case "ip4":
+		queryType = "A"
+	case "ip6":
+		queryType = "AAAA"
+	}
+	op := r.begin(queryType, host)
+	ips, err := r.resolver.LookupIP(ctx, network, host)
+	return ips, finish(op, len(ips), err)
+}
+
+// LookupCNAME is like net.Resolver.LookupCNAME.
+func (r *Resolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	op := r.begin("CNAME", host)
+	cname, err := r.resolver.LookupCNAME(ctx, host)
+	return cname, finish(op, 1, err)
+}
+
+// LookupMX is like net.Resolver.LookupMX.
+func (r *Resolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	op := r.begin("MX", name)
+	mxs, err := r.resolver.LookupMX(ctx, name)
+	return mxs, finish(op, len(mxs), err)
+}
+
+// LookupTXT is like net.Resolver.LookupTXT.
+func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	op := r.begin("TXT", name)
+	txts, err := r.resolver.LookupTXT(ctx, name)
+	return txts, finish(op, len(txts), err)
+}
+
+// LookupSRV is like net.Resolver.LookupSRV.
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	op := r.begin("SRV", name)
+	cname, addrs, err := r.resolver.LookupSRV(ctx, service, proto, name)
+	return cname, addrs, finish(op, len(addrs), err)
+}
+
+// Classify classifies a lookup error as nxdomain, timeout, servfail or other.
+func Classify(err error) string {
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "timeout"
+		}
+		return "other"
+	}
+	switch {
+	case dnsErr.IsNotFound:
+		return "nxdomain"
+	case dnsErr.IsTimeout:
+		return "timeout"
+	case strings.Contains(dnsErr.Err, "server misbehaving"):
+		// This is how the Go resolver reports SERVFAIL
+		return "servfail"
+	}
+	return "other"
+}
@@ -0,0 +1,43 @@
+package opsdns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	assert.Equal(t, "nxdomain", Classify(&net.DNSError{Err: "no such host", IsNotFound: true}))
+	assert.Equal(t, "timeout", Classify(&net.DNSError{Err: "i/o timeout", IsTimeout: true}))
+	assert.Equal(t, "servfail", Classify(&net.DNSError{Err: "server misbehaving", IsTemporary: true}))
+	assert.Equal(t, "timeout", Classify(context.DeadlineExceeded))
+	assert.Equal(t, "other", Classify(errors.New("boom")))
+}
+
+func TestLookupFailure(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporter(func(report *ops.Report) {
+		reported = report
+	})
+
+	r := New(&net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("unreachable")
+		},
+	}, "test")
+	_, err := r.LookupIP(context.Background(), "ip4", "example.com")
+	assert.Error(t, err)
+	if assert.NotNil(t, reported) {
+		assert.Equal(t, "dns_lookup", reported.Name)
+		assert.False(t, reported.Succeeded())
+		assert.Equal(t, "A", reported.Context["dns_query_type"])
+		assert.Equal(t, "example.com", reported.Context["dns_host"])
+		assert.Equal(t, "test", reported.Context["dns_resolver"])
+		assert.NotNil(t, reported.Context["dns_error_class"])
+	}
+}
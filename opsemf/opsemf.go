@@ -0,0 +1,252 @@
+// Package opsemf provides a reporter that emits ops as CloudWatch Embedded
+// Metric Format (EMF) log events, from which CloudWatch extracts metrics on
+// its own, so that services on Lambda or ECS get op metrics and dimensions
+// without running an agent.
+//
+// By default, events are written to stdout, which Lambda and the awslogs log
+// driver of ECS forward to CloudWatch Logs. Elsewhere, events can be sent with
+// the CloudWatch Logs API by setting Options.PutLogEvents, for example with
+// the PutLogEvents of the AWS SDK, which opsemf doesn't depend on.
+package opsemf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opsemf")
+}
+
+// Limits of a single PutLogEvents call.
+const (
+	maxBatchEvents = 10000
+	maxBatchBytes  = 1048576
+	// eventOverhead is the number of bytes CloudWatch Logs counts for each
+	// event on top of its message.
+	eventOverhead = 26
+)
+
+// queueSize is how many events can wait to be sent with PutLogEvents before
+// events are dropped.
+const queueSize = 10000
+
+// LogEvent is a log event to send with the CloudWatch Logs API.
+type LogEvent struct {
+	Timestamp time.Time
+	Message   string
+}
+
+// Options configures a Reporter. Zero values use the defaults noted on each
+// field.
+type Options struct {
+	// Namespace is the CloudWatch namespace of the metrics (default "ops").
+	Namespace string
+
+	// Dimensions are the context keys that become dimensions of the metrics,
+	// along with the op name under "op", for example "country". Ops without a
+	// value for a dimension report it as "unknown". Keep in mind that each
+	// combination of dimension values is billed as a separate metric.
+	Dimensions []string
+
+	// Properties are additional context keys included in events without
+	// becoming dimensions, so that they can be searched with CloudWatch Logs
+	// Insights. The trace and op ids are always included.
+	Properties []string
+
+	// Writer is where events are written, one per line, unless PutLogEvents
+	// is set (default os.Stdout).
+	Writer io.Writer
+
+	// PutLogEvents, if set, sends batches of events to CloudWatch Logs instead
+	// of writing them to Writer. Batches respect the limits of the API and
+	// are sent from a background goroutine every FlushInterval. Batches that
+	// fail aren't retried.
+	PutLogEvents func(events []LogEvent) error
+
+	// FlushInterval is how often batches are sent with PutLogEvents (default
+	// 5 seconds).
+	FlushInterval time.Duration
+}
+
+// Reporter emits a metric event for each op, with the metrics Duration (in
+// milliseconds) and Failure (1 for failed ops, otherwise 0).
+type Reporter struct {
+	opts      Options
+	writeMx   sync.Mutex
+	queue     chan LogEvent
+	closed    bool
+	queueMx   sync.Mutex
+	dropped   int64
+	done      chan interface{}
+	closeOnce sync.Once
+}
+
+// New creates a Reporter with the given options. Register it with
+// ops.RegisterStructuredReporter(reporter.Report) and Close it before the
+// process exits to send queued events.
+func New(opts Options) *Reporter {
+	if opts.Namespace == "" {
+		opts.Namespace = "ops"
+	}
+	if opts.Writer == nil {
+		opts.Writer = os.Stdout
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 5 * time.Second
+	}
+	r := &Reporter{
+		opts: opts,
+		done: make(chan interface{}),
+	}
+	if opts.PutLogEvents != nil {
+		r.queue = make(chan LogEvent, queueSize)
+		go r.run()
+	} else {
+		close(r.done)
+	}
+	return r
+}
+
+// Report emits an event for the given report.
+func (r *Reporter) Report(report *ops.Report) {
+	message, err := r.Encode(report)
+	if err != nil {
+		return
+	}
+	if r.queue == nil {
+		r.writeMx.Lock()
+		r.opts.Writer.Write(append(message, '\n'))
+		r.writeMx.Unlock()
+		return
+	}
+	r.queueMx.Lock()
+	defer r.queueMx.Unlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.queue <- LogEvent{Timestamp: r.timestamp(report), Message: string(message)}:
+	default:
+		atomic.AddInt64(&r.dropped, 1)
+	}
+}
+
+// Dropped returns the number of events that were dropped because too many
+// were waiting to be sent with PutLogEvents.
+func (r *Reporter) Dropped() int64 {
+	return atomic.LoadInt64(&r.dropped)
+}
+
+func (r *Reporter) timestamp(report *ops.Report) time.Time {
+	return report.Start.Add(report.Duration)
+}
+
+// Encode returns the EMF event for the given report.
+func (r *Reporter) Encode(report *ops.Report) ([]byte, error) {
+	dimensions := make([]string, 0, len(r.opts.Dimensions)+1)
+	dimensions = append(dimensions, "op")
+	event := map[string]interface{}{
+		"op":       report.Name,
+		"op_id":    report.ID,
+		"trace_id": report.TraceID,
+		"Duration": float64(report.Duration) / float64(time.Millisecond),
+		"Failure":  0,
+	}
+	if !report.Succeeded() {
+		event["Failure"] = 1
+		event["error"] = ops.ErrorText(report.Failure)
+	}
+	for _, key := range r.opts.Properties {
+		if value, found := report.Context[key]; found {
+			event[key] = value
+		}
+	}
+	for _, key := range r.opts.Dimensions {
+		// Dimension values must be strings
+		value := "unknown"
+		if v, found := report.Context[key]; found && v != nil {
+			value = fmt.Sprint(v)
+		}
+		event[key] = value
+		dimensions = append(dimensions, key)
+	}
+	event["_aws"] = map[string]interface{}{
+		"Timestamp": r.timestamp(report).UnixNano() / int64(time.Millisecond),
+		"CloudWatchMetrics": []interface{}{
+			map[string]interface{}{
+				"Namespace":  r.opts.Namespace,
+				"Dimensions": [][]string{dimensions},
+				"Metrics": []interface{}{
+					map[string]string{"Name": "Duration", "Unit": "Milliseconds"},
+					map[string]string{"Name": "Failure", "Unit": "Count"},
+				},
+			},
+		},
+	}
+	return json.Marshal(event)
+}
+
+func (r *Reporter) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.opts.FlushInterval)
+	defer ticker.Stop()
+	var batch []LogEvent
+	for {
+		select {
+		case event, ok := <-r.queue:
+			if !ok {
+				r.send(batch)
+				return
+			}
+			batch = append(batch, event)
+		case <-ticker.C:
+			r.send(batch)
+			batch = nil
+		}
+	}
+}
+
+// send sends the given events in as few calls as the limits of PutLogEvents
+// allow.
+func (r *Reporter) send(events []LogEvent) {
+	// Events in a batch must be in chronological order
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp.Before(events[j].Timestamp)
+	})
+	for len(events) > 0 {
+		n, size := 0, 0
+		for n < len(events) && n < maxBatchEvents {
+			eventSize := len(events[n].Message) + eventOverhead
+			if n > 0 && size+eventSize > maxBatchBytes {
+				break
+			}
+			size += eventSize
+			n++
+		}
+		r.opts.PutLogEvents(events[:n])
+		events = events[n:]
+	}
+}
+
+// Close sends queued events and stops the Reporter. Reports received after
+// Close are dropped.
+func (r *Reporter) Close() {
+	r.closeOnce.Do(func() {
+		if r.queue != nil {
+			r.queueMx.Lock()
+			r.closed = true
+			close(r.queue)
+			r.queueMx.Unlock()
+		}
+	})
+	<-r.done
+}
@@ -0,0 +1,87 @@
+package opsemf_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opsemf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	r := opsemf.New(opsemf.Options{
+		Namespace:  "proxy",
+		Dimensions: []string{"country"},
+		Properties: []string{"client_ip"},
+		Writer:     &buf,
+	})
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	r.Report(&ops.Report{Name: "dial", ID: "o1", TraceID: "t1", Start: start, Duration: 1500 * time.Microsecond,
+		Context: map[string]interface{}{"country": "US", "client_ip": "10.0.0.1", "other": 1}})
+	r.Report(&ops.Report{Name: "dial", Start: start, Duration: time.Millisecond, Failure: errors.New("refused")})
+	r.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if !assert.Len(t, lines, 2) {
+		return
+	}
+	var event map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal([]byte(lines[0]), &event)) {
+		return
+	}
+	assert.Equal(t, "dial", event["op"])
+	assert.Equal(t, "US", event["country"])
+	assert.Equal(t, "10.0.0.1", event["client_ip"])
+	assert.Equal(t, "t1", event["trace_id"])
+	assert.Nil(t, event["other"])
+	assert.Equal(t, 1.5, event["Duration"])
+	assert.EqualValues(t, 0, event["Failure"])
+	aws := event["_aws"].(map[string]interface{})
+	assert.EqualValues(t, start.Add(1500*time.Microsecond).UnixNano()/int64(time.Millisecond), aws["Timestamp"])
+	metrics := aws["CloudWatchMetrics"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "proxy", metrics["Namespace"])
+	assert.Equal(t, []interface{}{[]interface{}{"op", "country"}}, metrics["Dimensions"])
+	assert.Len(t, metrics["Metrics"], 2)
+
+	event = nil
+	if assert.NoError(t, json.Unmarshal([]byte(lines[1]), &event)) {
+		assert.Equal(t, "unknown", event["country"])
+		assert.EqualValues(t, 1, event["Failure"])
+		assert.Equal(t, "refused", event["error"])
+	}
+}
+
+func TestPutLogEvents(t *testing.T) {
+	var mx sync.Mutex
+	var batches [][]opsemf.LogEvent
+	r := opsemf.New(opsemf.Options{
+		FlushInterval: time.Hour,
+		PutLogEvents: func(events []opsemf.LogEvent) error {
+			mx.Lock()
+			batches = append(batches, append([]opsemf.LogEvent{}, events...))
+			mx.Unlock()
+			return nil
+		},
+	})
+	now := time.Now()
+	r.Report(&ops.Report{Name: "b", Start: now.Add(time.Second)})
+	r.Report(&ops.Report{Name: "a", Start: now})
+	r.Close()
+	r.Report(&ops.Report{Name: "after_close", Start: now})
+
+	mx.Lock()
+	defer mx.Unlock()
+	if assert.Len(t, batches, 1) && assert.Len(t, batches[0], 2) {
+		assert.Contains(t, batches[0][0].Message, `"op":"a"`, "events should be in chronological order")
+		assert.True(t, now.Equal(batches[0][0].Timestamp))
+		assert.Contains(t, batches[0][1].Message, `"op":"b"`)
+	}
+	assert.EqualValues(t, 0, r.Dropped())
+}
@@ -0,0 +1,242 @@
+// Package opsflags provides ops.Flags that poll flag definitions over HTTP, in
+// the style of a LaunchDarkly polling client, so that operators can adjust
+// sampling, disable ops or turn on debug capture for particular cohorts by
+// editing a document rather than deploying.
+//
+// The document maps flag names to their definitions. Each flag has a default
+// value and rules that are tried in order, the first one whose clauses all
+// match the op's context choosing the value. For example, this samples 10% of
+// reports except for the "checkout" op and for users in the beta cohort, and
+// turns on debug capture for one customer:
+//
+//	{
+//		"ops.sample_rate": {
+//			"value": 0.1,
+//			"rules": [
+//				{"clauses": [{"attribute": "op", "values": ["checkout"]}], "value": 1},
+//				{"clauses": [{"attribute": "cohort", "values": ["beta"]}], "value": 1}
+//			]
+//		},
+//		"ops.debug": {
+//			"value": false,
+//			"rules": [{"clauses": [{"attribute": "customer_id", "values": ["c42"]}], "value": true}]
+//		}
+//	}
+//
+// Use it with ops.SetFlags(poller).
+package opsflags
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opsflags")
+}
+
+// Flag is the definition of a flag.
+type Flag struct {
+	// Value is the value of the flag when no rule matches.
+	Value interface{} `json:"value"`
+
+	// Rules are tried in order.
+	Rules []Rule `json:"rules,omitempty"`
+}
+
+// Rule chooses the value of a flag for contexts matching all of its clauses.
+type Rule struct {
+	Clauses []Clause    `json:"clauses"`
+	Value   interface{} `json:"value"`
+}
+
+// Clause matches contexts by the value of one of their keys.
+type Clause struct {
+	// Attribute is the context key of the value to match.
+	Attribute string `json:"attribute"`
+
+	// Op is "in" (the default), matching if the value is one of Values, or
+	// "notIn", matching if it isn't. Values are compared by their formatting
+	// with fmt.Sprint.
+	Op string `json:"op,omitempty"`
+
+	Values []interface{} `json:"values"`
+}
+
+// Options configures a Poller. Zero values use the defaults noted on each
+// field.
+type Options struct {
+	// URL is the URL of the document defining the flags.
+	URL string
+
+	// Header is added to requests, for example for authorization.
+	Header http.Header
+
+	// Client is the http.Client used to fetch the document (default
+	// http.DefaultClient).
+	Client *http.Client
+
+	// Interval is how often the document is fetched (default 30 seconds).
+	Interval time.Duration
+}
+
+// Poller is an ops.Flags that periodically fetches the definitions of the
+// flags.
+type Poller struct {
+	opts   Options
+	flags  atomic.Value
+	etag   string
+	errors int64
+	stop   chan interface{}
+	done   chan interface{}
+	once   sync.Once
+}
+
+// New fetches the flags once and then keeps polling in the background until
+// Close is called. It fails if the first fetch fails.
+func New(opts Options) (*Poller, error) {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 30 * time.Second
+	}
+	p := &Poller{
+		opts: opts,
+		stop: make(chan interface{}),
+		done: make(chan interface{}),
+	}
+	if err := p.fetch(); err != nil {
+		return nil, fmt.Errorf("unable to fetch flags from %v: %v", opts.URL, err)
+	}
+	go p.run()
+	return p, nil
+}
+
+func (p *Poller) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			if err := p.fetch(); err != nil {
+				atomic.AddInt64(&p.errors, 1)
+			}
+		}
+	}
+}
+
+// fetch fetches the document, keeping the current flags if it hasn't changed.
+func (p *Poller) fetch() error {
+	req, err := http.NewRequest(http.MethodGet, p.opts.URL, nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range p.opts.Header {
+		req.Header[key] = values
+	}
+	if p.etag != "" {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+	resp, err := p.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil
+	case http.StatusOK:
+	default:
+		io.Copy(io.Discard, resp.Body)
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	var flags map[string]*Flag
+	if err := json.NewDecoder(resp.Body).Decode(&flags); err != nil {
+		return err
+	}
+	p.flags.Store(flags)
+	p.etag = resp.Header.Get("ETag")
+	return nil
+}
+
+// Errors returns the number of failed fetches since New, during which the
+// last fetched flags remain in effect.
+func (p *Poller) Errors() int64 {
+	return atomic.LoadInt64(&p.errors)
+}
+
+// Close stops polling. The last fetched flags remain in effect.
+func (p *Poller) Close() {
+	p.once.Do(func() { close(p.stop) })
+	<-p.done
+}
+
+// Bool implements ops.Flags.
+func (p *Poller) Bool(flag string, ctx map[string]interface{}, fallback bool) bool {
+	if value, ok := p.evaluate(flag, ctx).(bool); ok {
+		return value
+	}
+	return fallback
+}
+
+// Float implements ops.Flags.
+func (p *Poller) Float(flag string, ctx map[string]interface{}, fallback float64) float64 {
+	if value, ok := p.evaluate(flag, ctx).(float64); ok {
+		return value
+	}
+	return fallback
+}
+
+// evaluate returns the value of the flag for the context, or nil if the flag
+// isn't defined.
+func (p *Poller) evaluate(name string, ctx map[string]interface{}) interface{} {
+	flags, _ := p.flags.Load().(map[string]*Flag)
+	flag := flags[name]
+	if flag == nil {
+		return nil
+	}
+	for _, rule := range flag.Rules {
+		if rule.matches(ctx) {
+			return rule.Value
+		}
+	}
+	return flag.Value
+}
+
+func (r *Rule) matches(ctx map[string]interface{}) bool {
+	for _, clause := range r.Clauses {
+		if !clause.matches(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Clause) matches(ctx map[string]interface{}) bool {
+	value, found := ctx[c.Attribute]
+	in := false
+	if found {
+		formatted := fmt.Sprint(value)
+		for _, candidate := range c.Values {
+			if fmt.Sprint(candidate) == formatted {
+				in = true
+				break
+			}
+		}
+	}
+	if c.Op == "notIn" {
+		return !in
+	}
+	return in
+}
@@ -0,0 +1,93 @@
+package opsflags_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opsflags"
+	"github.com/stretchr/testify/assert"
+)
+
+const document = `{
+	"ops.sample_rate": {
+		"value": 0.1,
+		"rules": [
+			{"clauses": [{"attribute": "op", "values": ["checkout"]}], "value": 1},
+			{"clauses": [{"attribute": "cohort", "values": ["beta"]}, {"attribute": "tier", "op": "notIn", "values": [1]}], "value": 0.5}
+		]
+	},
+	"ops.debug": {
+		"value": false,
+		"rules": [{"clauses": [{"attribute": "customer_id", "values": ["c42"]}], "value": true}]
+	}
+}`
+
+func TestPoller(t *testing.T) {
+	var mx sync.Mutex
+	body := document
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		mx.Lock()
+		defer mx.Unlock()
+		requests++
+		assert.Equal(t, "sdk-key", req.Header.Get("Authorization"))
+		if req.Header.Get("If-None-Match") == `"1"` && body == document {
+			resp.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if body == document {
+			resp.Header().Set("ETag", `"1"`)
+		}
+		resp.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	p, err := opsflags.New(opsflags.Options{
+		URL:      server.URL,
+		Header:   http.Header{"Authorization": []string{"sdk-key"}},
+		Interval: 10 * time.Millisecond,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer p.Close()
+	var _ ops.Flags = p
+
+	assert.Equal(t, 0.1, p.Float(ops.FlagSampleRate, map[string]interface{}{"op": "fetch"}, 1))
+	assert.Equal(t, 1.0, p.Float(ops.FlagSampleRate, map[string]interface{}{"op": "checkout", "cohort": "beta"}, 1))
+	assert.Equal(t, 0.5, p.Float(ops.FlagSampleRate, map[string]interface{}{"cohort": "beta", "tier": 2}, 1))
+	assert.Equal(t, 0.1, p.Float(ops.FlagSampleRate, map[string]interface{}{"cohort": "beta", "tier": 1}, 1))
+	assert.True(t, p.Bool(ops.FlagDebug, map[string]interface{}{"customer_id": "c42"}, false))
+	assert.False(t, p.Bool(ops.FlagDebug, map[string]interface{}{}, true))
+	assert.True(t, p.Bool(ops.FlagEnabled, nil, true), "undefined flags should use the fallback")
+	assert.Equal(t, 0.7, p.Float(ops.FlagDebug, nil, 0.7), "flags of another type should use the fallback")
+
+	time.Sleep(50 * time.Millisecond)
+	mx.Lock()
+	assert.True(t, requests > 1, "should have kept polling")
+	body = `{"ops.enabled": {"value": false}}`
+	mx.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, p.Bool(ops.FlagEnabled, nil, true))
+	assert.Equal(t, 1.0, p.Float(ops.FlagSampleRate, nil, 1))
+
+	mx.Lock()
+	body = `not json`
+	mx.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	assert.True(t, p.Errors() > 0)
+	assert.False(t, p.Bool(ops.FlagEnabled, nil, true), "flags should remain after failed fetches")
+}
+
+func TestPollerUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	_, err := opsflags.New(opsflags.Options{URL: server.URL})
+	assert.Error(t, err)
+}
@@ -0,0 +1,435 @@
+// Package opsgcp exports ops to Google Cloud: op counts and durations to Cloud
+// Monitoring as custom metrics and failed ops to Error Reporting, for the
+// monitored resource detected from the metadata server on GCE and GKE (see
+// DetectResource).
+//
+// It uses the REST APIs directly, authenticating with the default service
+// account from the metadata server unless Options.TokenSource is set, so it
+// doesn't depend on the Google Cloud client libraries.
+package opsgcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opsgcp")
+}
+
+// Endpoints of the APIs.
+const (
+	DefaultMonitoringURL     = "https://monitoring.googleapis.com"
+	DefaultErrorReportingURL = "https://clouderrorreporting.googleapis.com"
+)
+
+// DefaultBounds are the default bucket bounds of the duration distribution, in
+// milliseconds.
+var DefaultBounds = []float64{1, 2, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+const (
+	// maxTimeSeries is the most time series Cloud Monitoring accepts per
+	// request.
+	maxTimeSeries = 200
+	// errorQueueSize is how many failures can wait to be sent to Error
+	// Reporting before failures are dropped.
+	errorQueueSize = 100
+)
+
+// Options configures an Exporter. Zero values use the defaults noted on each
+// field.
+type Options struct {
+	// ProjectID is the project to export to (default the project of
+	// Resource).
+	ProjectID string
+
+	// Resource is the monitored resource that metrics are written for
+	// (default detected with DetectResource, falling back to global).
+	Resource *Resource
+
+	// MetricPrefix is the prefix of the metric types (default
+	// "custom.googleapis.com/ops").
+	MetricPrefix string
+
+	// Labels are context keys recorded as metric labels along with "op" and
+	// "result" (success or failure). Keep their cardinality low.
+	Labels []string
+
+	// Bounds are the finite bucket bounds of the duration distribution, in
+	// milliseconds (default DefaultBounds).
+	Bounds []float64
+
+	// FlushInterval is how often metrics are written (default 1 minute, Cloud
+	// Monitoring accepts at most one point per time series every 5 seconds).
+	FlushInterval time.Duration
+
+	// Service and Version identify this service in Error Reporting (default
+	// "ops" and no version).
+	Service string
+	Version string
+
+	// MaxErrorsPerMinute limits how many failures are sent to Error Reporting
+	// per minute; failures beyond that are dropped (default 60, negative
+	// disables Error Reporting).
+	MaxErrorsPerMinute int
+
+	// TokenSource returns the OAuth2 access token for requests (default the
+	// default service account's token from the metadata server).
+	TokenSource func() (string, error)
+
+	// Client is the http.Client used to call the APIs (default
+	// http.DefaultClient).
+	Client *http.Client
+
+	// MetadataURL, MonitoringURL and ErrorReportingURL override the endpoints
+	// (default DefaultMetadataURL, DefaultMonitoringURL and
+	// DefaultErrorReportingURL).
+	MetadataURL       string
+	MonitoringURL     string
+	ErrorReportingURL string
+}
+
+// Exporter is a reporter that exports ops to Google Cloud. It writes, for each
+// combination of labels, the cumulative metrics:
+//
+//	<prefix>/count     INT64 count of ops
+//	<prefix>/duration  DISTRIBUTION of durations in milliseconds
+//
+// Failed ops are sent to Error Reporting with their stack trace when one was
+// captured (see ops.DebugKey).
+type Exporter struct {
+	opts        Options
+	start       time.Time
+	series      map[string]*series
+	mx          sync.Mutex
+	errors      chan *errorEvent
+	windowStart time.Time
+	inWindow    int
+	closed      bool
+	errorsMx    sync.Mutex
+	dropped     int64
+	stop        chan interface{}
+	done        sync.WaitGroup
+	closeOnce   sync.Once
+}
+
+type series struct {
+	labels  map[string]string
+	count   int64
+	mean    float64
+	ssd     float64
+	buckets []int64
+}
+
+type errorEvent struct {
+	EventTime      string                 `json:"eventTime"`
+	ServiceContext map[string]string      `json:"serviceContext"`
+	Message        string                 `json:"message"`
+	Context        map[string]interface{} `json:"context,omitempty"`
+}
+
+// New creates an Exporter with the given options. Register it with
+// ops.RegisterStructuredReporter(exporter.Report) and Close it before the
+// process exits to write the latest metrics.
+func New(opts Options) (*Exporter, error) {
+	m := newMetadata(opts.MetadataURL)
+	if opts.Resource == nil {
+		resource, err := detectResource(m)
+		if err != nil {
+			if opts.ProjectID == "" {
+				return nil, err
+			}
+			resource = &Resource{Type: "global", Labels: map[string]string{"project_id": opts.ProjectID}}
+		}
+		opts.Resource = resource
+	}
+	if opts.ProjectID == "" {
+		opts.ProjectID = opts.Resource.Labels["project_id"]
+		if opts.ProjectID == "" {
+			return nil, fmt.Errorf("no project id")
+		}
+	}
+	if opts.MetricPrefix == "" {
+		opts.MetricPrefix = "custom.googleapis.com/ops"
+	}
+	if len(opts.Bounds) == 0 {
+		opts.Bounds = DefaultBounds
+	}
+	opts.Bounds = append([]float64{}, opts.Bounds...)
+	sort.Float64s(opts.Bounds)
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Minute
+	}
+	if opts.Service == "" {
+		opts.Service = "ops"
+	}
+	if opts.MaxErrorsPerMinute == 0 {
+		opts.MaxErrorsPerMinute = 60
+	}
+	if opts.TokenSource == nil {
+		opts.TokenSource = (&metadataTokens{m: m}).get
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.MonitoringURL == "" {
+		opts.MonitoringURL = DefaultMonitoringURL
+	}
+	if opts.ErrorReportingURL == "" {
+		opts.ErrorReportingURL = DefaultErrorReportingURL
+	}
+	e := &Exporter{
+		opts:   opts,
+		start:  time.Now(),
+		series: make(map[string]*series),
+		errors: make(chan *errorEvent, errorQueueSize),
+		stop:   make(chan interface{}),
+	}
+	e.done.Add(2)
+	go e.run()
+	go e.reportErrors()
+	return e, nil
+}
+
+// Report records the given report and queues it for Error Reporting if it
+// failed.
+func (e *Exporter) Report(report *ops.Report) {
+	labels := map[string]string{"op": report.Name, "result": "success"}
+	if !report.Succeeded() {
+		labels["result"] = "failure"
+	}
+	for _, key := range e.opts.Labels {
+		if value, found := report.Context[key]; found && value != nil {
+			labels[key] = fmt.Sprint(value)
+		}
+	}
+	key := seriesKey(labels)
+	value := float64(report.Duration) / float64(time.Millisecond)
+
+	e.mx.Lock()
+	s := e.series[key]
+	if s == nil {
+		s = &series{labels: labels, buckets: make([]int64, len(e.opts.Bounds)+1)}
+		e.series[key] = s
+	}
+	// Welford's algorithm, for the sum of squared deviations
+	s.count++
+	delta := value - s.mean
+	s.mean += delta / float64(s.count)
+	s.ssd += delta * (value - s.mean)
+	// Buckets include their lower bound
+	s.buckets[sort.Search(len(e.opts.Bounds), func(i int) bool { return e.opts.Bounds[i] > value })]++
+	e.mx.Unlock()
+
+	if !report.Succeeded() {
+		e.queueError(report)
+	}
+}
+
+func seriesKey(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(key)
+		b.WriteByte(0)
+		b.WriteString(labels[key])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+func (e *Exporter) queueError(report *ops.Report) {
+	if e.opts.MaxErrorsPerMinute < 0 {
+		return
+	}
+	event := &errorEvent{
+		EventTime:      report.Start.Add(report.Duration).UTC().Format(time.RFC3339Nano),
+		ServiceContext: map[string]string{"service": e.opts.Service},
+		Message:        fmt.Sprintf("%v: %v", report.Name, ops.ErrorText(report.Failure)),
+	}
+	if e.opts.Version != "" {
+		event.ServiceContext["version"] = e.opts.Version
+	}
+	if stack, ok := report.Context["stack"].(string); ok {
+		event.Message += "\n\n" + stack
+	} else {
+		// Error Reporting needs either a stack trace or a location
+		event.Context = map[string]interface{}{
+			"reportLocation": map[string]string{"functionName": report.Name},
+		}
+	}
+
+	e.errorsMx.Lock()
+	defer e.errorsMx.Unlock()
+	if e.closed {
+		return
+	}
+	now := time.Now()
+	if now.Sub(e.windowStart) >= time.Minute {
+		e.windowStart = now
+		e.inWindow = 0
+	}
+	if e.inWindow >= e.opts.MaxErrorsPerMinute {
+		atomic.AddInt64(&e.dropped, 1)
+		return
+	}
+	select {
+	case e.errors <- event:
+		e.inWindow++
+	default:
+		atomic.AddInt64(&e.dropped, 1)
+	}
+}
+
+// Dropped returns the number of failures that weren't sent to Error Reporting
+// because of its rate limit or because too many were waiting to be sent.
+func (e *Exporter) Dropped() int64 {
+	return atomic.LoadInt64(&e.dropped)
+}
+
+func (e *Exporter) run() {
+	defer e.done.Done()
+	ticker := time.NewTicker(e.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.Flush()
+		case <-e.stop:
+			return
+		}
+	}
+}
+
+func (e *Exporter) reportErrors() {
+	defer e.done.Done()
+	url := fmt.Sprintf("%v/v1beta1/projects/%v/events:report", e.opts.ErrorReportingURL, e.opts.ProjectID)
+	for event := range e.errors {
+		e.post(url, event)
+	}
+}
+
+// Flush immediately writes the current metrics to Cloud Monitoring.
+func (e *Exporter) Flush() error {
+	now := time.Now().UTC()
+	interval := map[string]string{
+		"startTime": e.start.UTC().Format(time.RFC3339Nano),
+		"endTime":   now.Format(time.RFC3339Nano),
+	}
+	resource := map[string]interface{}{
+		"type":   e.opts.Resource.Type,
+		"labels": e.opts.Resource.Labels,
+	}
+	e.mx.Lock()
+	keys := make([]string, 0, len(e.series))
+	for key := range e.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var timeSeries []interface{}
+	for _, key := range keys {
+		s := e.series[key]
+		bucketCounts := make([]string, len(s.buckets))
+		for i, count := range s.buckets {
+			bucketCounts[i] = strconv.FormatInt(count, 10)
+		}
+		timeSeries = append(timeSeries,
+			map[string]interface{}{
+				"metric":     map[string]interface{}{"type": e.opts.MetricPrefix + "/count", "labels": s.labels},
+				"resource":   resource,
+				"metricKind": "CUMULATIVE",
+				"valueType":  "INT64",
+				"points": []interface{}{map[string]interface{}{
+					"interval": interval,
+					"value":    map[string]string{"int64Value": strconv.FormatInt(s.count, 10)},
+				}},
+			},
+			map[string]interface{}{
+				"metric":     map[string]interface{}{"type": e.opts.MetricPrefix + "/duration", "labels": s.labels},
+				"resource":   resource,
+				"metricKind": "CUMULATIVE",
+				"valueType":  "DISTRIBUTION",
+				"points": []interface{}{map[string]interface{}{
+					"interval": interval,
+					"value": map[string]interface{}{"distributionValue": map[string]interface{}{
+						"count":                 strconv.FormatInt(s.count, 10),
+						"mean":                  s.mean,
+						"sumOfSquaredDeviation": s.ssd,
+						"bucketOptions":         map[string]interface{}{"explicitBuckets": map[string]interface{}{"bounds": e.opts.Bounds}},
+						"bucketCounts":          bucketCounts,
+					}},
+				}},
+			})
+	}
+	e.mx.Unlock()
+
+	url := fmt.Sprintf("%v/v3/projects/%v/timeSeries", e.opts.MonitoringURL, e.opts.ProjectID)
+	for len(timeSeries) > 0 {
+		n := len(timeSeries)
+		if n > maxTimeSeries {
+			n = maxTimeSeries
+		}
+		if err := e.post(url, map[string]interface{}{"timeSeries": timeSeries[:n]}); err != nil {
+			return err
+		}
+		timeSeries = timeSeries[n:]
+	}
+	return nil
+}
+
+func (e *Exporter) post(url string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	token, err := e.opts.TokenSource()
+	if err != nil {
+		return fmt.Errorf("unable to get token: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := e.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
+
+// Close writes the latest metrics, sends queued failures to Error Reporting
+// and stops the Exporter. Failures reported after Close aren't sent to Error
+// Reporting.
+func (e *Exporter) Close() error {
+	var err error
+	e.closeOnce.Do(func() {
+		close(e.stop)
+		e.errorsMx.Lock()
+		e.closed = true
+		close(e.errors)
+		e.errorsMx.Unlock()
+		e.done.Wait()
+		err = e.Flush()
+	})
+	return err
+}
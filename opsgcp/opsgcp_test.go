@@ -0,0 +1,98 @@
+package opsgcp_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opsgcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExporter(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	metadata := metadataServer(gceMetadata)
+	defer metadata.Close()
+
+	var mx sync.Mutex
+	requests := make(map[string][]map[string]interface{})
+	var auth []string
+	api := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		b, _ := io.ReadAll(req.Body)
+		var body map[string]interface{}
+		json.Unmarshal(b, &body)
+		mx.Lock()
+		requests[req.URL.Path] = append(requests[req.URL.Path], body)
+		auth = append(auth, req.Header.Get("Authorization"))
+		mx.Unlock()
+	}))
+	defer api.Close()
+
+	e, err := opsgcp.New(opsgcp.Options{
+		MetadataURL:       metadata.URL,
+		MonitoringURL:     api.URL,
+		ErrorReportingURL: api.URL,
+		Labels:            []string{"country"},
+		Bounds:            []float64{10, 1},
+		FlushInterval:     time.Hour,
+		Service:           "proxy",
+		Version:           "1.0",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	e.Report(&ops.Report{Name: "dial", Duration: 500 * time.Microsecond, Context: map[string]interface{}{"country": "US"}})
+	e.Report(&ops.Report{Name: "dial", Duration: time.Millisecond, Context: map[string]interface{}{"country": "US"}})
+	e.Report(&ops.Report{Name: "dial", Duration: 20 * time.Millisecond, Context: map[string]interface{}{"country": "US"}})
+	e.Report(&ops.Report{Name: "dial", Duration: time.Millisecond, Failure: errors.New("refused"),
+		Context: map[string]interface{}{"stack": "goroutine 1 [running]:\nmain.main()"}})
+	e.Report(&ops.Report{Name: "fetch", Failure: errors.New("timeout")})
+	assert.NoError(t, e.Close())
+
+	mx.Lock()
+	defer mx.Unlock()
+	for _, a := range auth {
+		assert.Equal(t, "Bearer tok", a)
+	}
+
+	writes := requests["/v3/projects/my-project/timeSeries"]
+	if assert.Len(t, writes, 1) {
+		timeSeries := writes[0]["timeSeries"].([]interface{})
+		// count and duration for dial US success, dial failure and fetch failure
+		if assert.Len(t, timeSeries, 6) {
+			var duration map[string]interface{}
+			for _, ts := range timeSeries {
+				ts := ts.(map[string]interface{})
+				metric := ts["metric"].(map[string]interface{})
+				labels := metric["labels"].(map[string]interface{})
+				assert.Equal(t, "gce_instance", ts["resource"].(map[string]interface{})["type"])
+				if labels["op"] == "dial" && labels["country"] == "US" && metric["type"] == "custom.googleapis.com/ops/duration" {
+					duration = ts
+				}
+			}
+			if assert.NotNil(t, duration) {
+				value := duration["points"].([]interface{})[0].(map[string]interface{})["value"].(map[string]interface{})
+				dist := value["distributionValue"].(map[string]interface{})
+				assert.Equal(t, "3", dist["count"])
+				assert.InDelta(t, 7.1666, dist["mean"], 0.001)
+				assert.Equal(t, []interface{}{"1", "1", "1"}, dist["bucketCounts"])
+				assert.Equal(t, []interface{}{1.0, 10.0}, dist["bucketOptions"].(map[string]interface{})["explicitBuckets"].(map[string]interface{})["bounds"])
+			}
+		}
+	}
+
+	events := requests["/v1beta1/projects/my-project/events:report"]
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, "dial: refused\n\ngoroutine 1 [running]:\nmain.main()", events[0]["message"])
+		assert.Nil(t, events[0]["context"])
+		assert.Equal(t, map[string]interface{}{"service": "proxy", "version": "1.0"}, events[0]["serviceContext"])
+		assert.Equal(t, "fetch: timeout", events[1]["message"])
+		assert.Equal(t, map[string]interface{}{"reportLocation": map[string]interface{}{"functionName": "fetch"}}, events[1]["context"])
+	}
+}
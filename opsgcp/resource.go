@@ -0,0 +1,154 @@
+package opsgcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMetadataURL is the URL of the metadata server of GCE and GKE.
+const DefaultMetadataURL = "http://metadata.google.internal"
+
+// Resource is the monitored resource that metrics are written for, like
+// gce_instance or k8s_container.
+type Resource struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+}
+
+// metadata queries the metadata server.
+type metadata struct {
+	url    string
+	client *http.Client
+}
+
+func newMetadata(url string) *metadata {
+	if url == "" {
+		url = DefaultMetadataURL
+		if host := os.Getenv("GCE_METADATA_HOST"); host != "" {
+			url = "http://" + host
+		}
+	}
+	return &metadata{url: strings.TrimSuffix(url, "/"), client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (m *metadata) get(path string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, m.url+"/computeMetadata/v1/"+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status getting %v from metadata server: %v", path, resp.Status)
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// DetectResource detects the monitored resource of this process using the
+// metadata server at metadataURL (default DefaultMetadataURL, or the host in
+// GCE_METADATA_HOST):
+//
+//   - k8s_container on GKE, with the namespace taken from POD_NAMESPACE (or
+//     the service account's namespace), the pod from HOSTNAME and the
+//     container from CONTAINER_NAME, which are best set with the downward API
+//   - gce_instance on other GCE instances
+//
+// It returns an error if there's no metadata server, as outside of Google
+// Cloud.
+func DetectResource(metadataURL string) (*Resource, error) {
+	return detectResource(newMetadata(metadataURL))
+}
+
+func detectResource(m *metadata) (*Resource, error) {
+	projectID, err := m.get("project/project-id")
+	if err != nil {
+		return nil, fmt.Errorf("unable to detect resource: %v", err)
+	}
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		if cluster, err := m.get("instance/attributes/cluster-name"); err == nil {
+			location, err := m.get("instance/attributes/cluster-location")
+			if err != nil {
+				return nil, fmt.Errorf("unable to detect cluster location: %v", err)
+			}
+			return &Resource{Type: "k8s_container", Labels: map[string]string{
+				"project_id":     projectID,
+				"location":       location,
+				"cluster_name":   cluster,
+				"namespace_name": podNamespace(),
+				"pod_name":       os.Getenv("HOSTNAME"),
+				"container_name": os.Getenv("CONTAINER_NAME"),
+			}}, nil
+		}
+	}
+	instanceID, err := m.get("instance/id")
+	if err != nil {
+		return nil, fmt.Errorf("unable to detect instance id: %v", err)
+	}
+	zone, err := m.get("instance/zone")
+	if err != nil {
+		return nil, fmt.Errorf("unable to detect zone: %v", err)
+	}
+	// Zones look like projects/123456789/zones/us-central1-a
+	zone = zone[strings.LastIndexByte(zone, '/')+1:]
+	return &Resource{Type: "gce_instance", Labels: map[string]string{
+		"project_id":  projectID,
+		"instance_id": instanceID,
+		"zone":        zone,
+	}}, nil
+}
+
+func podNamespace() string {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	namespace, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(namespace))
+}
+
+// metadataTokens gets access tokens for the default service account from the
+// metadata server, caching them until shortly before they expire.
+type metadataTokens struct {
+	m       *metadata
+	token   string
+	expires time.Time
+	mx      sync.Mutex
+}
+
+func (t *metadataTokens) get() (string, error) {
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	if t.token != "" && time.Now().Before(t.expires) {
+		return t.token, nil
+	}
+	body, err := t.m.get("instance/service-accounts/default/token")
+	if err != nil {
+		return "", err
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.Unmarshal([]byte(body), &token); err != nil {
+		return "", fmt.Errorf("unable to decode token: %v", err)
+	}
+	t.token = token.AccessToken
+	t.expires = time.Now().Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)
+	return t.token, nil
+}
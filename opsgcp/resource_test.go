@@ -0,0 +1,82 @@
+package opsgcp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getlantern/ops/opsgcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func metadataServer(values map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Metadata-Flavor") != "Google" {
+			resp.WriteHeader(http.StatusForbidden)
+			return
+		}
+		value, found := values[req.URL.Path]
+		if !found {
+			resp.WriteHeader(http.StatusNotFound)
+			return
+		}
+		resp.Write([]byte(value))
+	}))
+}
+
+var gceMetadata = map[string]string{
+	"/computeMetadata/v1/project/project-id":                      "my-project",
+	"/computeMetadata/v1/instance/id":                             "1234",
+	"/computeMetadata/v1/instance/zone":                           "projects/5678/zones/us-central1-a",
+	"/computeMetadata/v1/instance/service-accounts/default/token": `{"access_token":"tok","expires_in":3600,"token_type":"Bearer"}`,
+}
+
+func TestDetectGCE(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	server := metadataServer(gceMetadata)
+	defer server.Close()
+
+	resource, err := opsgcp.DetectResource(server.URL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &opsgcp.Resource{Type: "gce_instance", Labels: map[string]string{
+			"project_id":  "my-project",
+			"instance_id": "1234",
+			"zone":        "us-central1-a",
+		}}, resource)
+	}
+}
+
+func TestDetectGKE(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("POD_NAMESPACE", "proxies")
+	t.Setenv("HOSTNAME", "proxy-abc")
+	t.Setenv("CONTAINER_NAME", "proxy")
+	values := map[string]string{
+		"/computeMetadata/v1/instance/attributes/cluster-name":     "fleet",
+		"/computeMetadata/v1/instance/attributes/cluster-location": "us-central1",
+	}
+	for path, value := range gceMetadata {
+		values[path] = value
+	}
+	server := metadataServer(values)
+	defer server.Close()
+
+	resource, err := opsgcp.DetectResource(server.URL)
+	if assert.NoError(t, err) {
+		assert.Equal(t, &opsgcp.Resource{Type: "k8s_container", Labels: map[string]string{
+			"project_id":     "my-project",
+			"location":       "us-central1",
+			"cluster_name":   "fleet",
+			"namespace_name": "proxies",
+			"pod_name":       "proxy-abc",
+			"container_name": "proxy",
+		}}, resource)
+	}
+}
+
+func TestDetectOutsideGCP(t *testing.T) {
+	server := metadataServer(nil)
+	defer server.Close()
+	_, err := opsgcp.DetectResource(server.URL)
+	assert.Error(t, err)
+}
@@ -0,0 +1,64 @@
+// Package opsgolog bridges github.com/getlantern/golog and ops, so that errors
+// logged with golog inside an active op are recorded on that op.
+//
+// golog already includes the current op context in its output, so only the
+// error reporting direction needs bridging.
+//
+// opsgolog is a separate Go module, so that programs using ops without golog
+// don't depend on it.
+package opsgolog
+
+import (
+	"sync"
+
+	"github.com/getlantern/golog"
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opsgolog")
+}
+
+// Mode determines what happens to the active op when golog reports an error.
+type Mode int
+
+const (
+	// Fail marks the active op as failed with the logged error (see
+	// ops.Op.FailIf), unless it has already failed.
+	Fail Mode = iota
+
+	// Warn records the logged error as a warning on the active op (see
+	// ops.Op.Warn) without failing it.
+	Warn
+)
+
+var installOnce sync.Once
+
+// Install registers a golog error reporter that records every error logged
+// with golog on the op that's active on the logging goroutine, if any. Errors
+// logged outside of an op are unaffected. Only the first call has an effect.
+func Install(mode Mode) {
+	installOnce.Do(func() {
+		ops.TrackActive()
+		golog.RegisterReporter(Reporter(mode))
+	})
+}
+
+// Reporter returns a golog.ErrorReporter that records errors on the active op
+// in the given mode. Most callers should use Install instead.
+func Reporter(mode Mode) golog.ErrorReporter {
+	return func(err error, severity golog.Severity, ctx map[string]interface{}) {
+		if err == nil {
+			return
+		}
+		op, ok := ops.Active()
+		if !ok {
+			return
+		}
+		if mode == Warn {
+			op.Warn(err)
+			return
+		}
+		op.FailIf(err)
+	}
+}
@@ -0,0 +1,50 @@
+package opsgolog
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/getlantern/golog"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstall(t *testing.T) {
+	reported := make(map[string]*ops.Report)
+	ops.RegisterStructuredReporter(func(report *ops.Report) {
+		reported[report.Name] = report
+	})
+	Install(Fail)
+	log := golog.LoggerFor("opsgolog_test")
+
+	log.Error(errors.New("outside"))
+
+	op := ops.Begin("golog_failed")
+	log.Error(errors.New("inside"))
+	op.End()
+
+	if assert.NotNil(t, reported["golog_failed"]) {
+		assert.EqualError(t, reported["golog_failed"].Failure, "inside")
+	}
+}
+
+func TestWarn(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporter(func(report *ops.Report) {
+		if report.Name == "golog_warned" {
+			reported = report
+		}
+	})
+	ops.TrackActive()
+	reporter := Reporter(Warn)
+
+	op := ops.Begin("golog_warned")
+	reporter(errors.New("just a warning"), golog.ERROR, nil)
+	op.End()
+
+	if assert.NotNil(t, reported) {
+		assert.True(t, reported.Succeeded())
+		assert.Equal(t, ops.SeverityWarning, reported.Severity)
+		assert.Equal(t, "just a warning", reported.Context["warning"])
+	}
+}
@@ -0,0 +1,276 @@
+// Package opsgraphite provides a reporter that periodically sends op counts
+// and durations to Graphite or statsite using the Graphite plaintext protocol,
+// for monitoring stacks that haven't moved on from Graphite.
+package opsgraphite
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opsgraphite")
+}
+
+// DefaultTemplate is the default metric path template.
+const DefaultTemplate = "ops.{op}.{result}"
+
+// maxPacketSize is the most bytes sent in one UDP packet, which keeps packets
+// from being fragmented on typical networks.
+const maxPacketSize = 1400
+
+// Options configures a Reporter. Zero values use the defaults noted on each
+// field.
+type Options struct {
+	// Addr is the host:port of the Graphite or statsite server.
+	Addr string
+
+	// Network is the network used to reach Addr, "udp" or "tcp" (default
+	// "udp").
+	Network string
+
+	// Template is the path under which the metrics of each op are sent, with
+	// {key} replaced by the value of key in the op's context, for example
+	// "ops.{op}.{country}" (default DefaultTemplate). {op} is the name of the
+	// op and {result} is "success" or "failure". Missing values are replaced
+	// by "unknown" and characters in values other than letters, digits, - and
+	// _ by _.
+	Template string
+
+	// FlushInterval is how often metrics are sent (default 10 seconds).
+	FlushInterval time.Duration
+}
+
+// Reporter aggregates ops per metric path and sends, every flush interval,
+// the following metrics under each path that saw ops:
+//
+//	<path>.count
+//	<path>.failures
+//	<path>.duration_ms.mean
+//	<path>.duration_ms.max
+type Reporter struct {
+	opts      Options
+	template  []segment
+	conn      net.Conn
+	paths     map[string]*stats
+	mx        sync.Mutex
+	stop      chan interface{}
+	stopped   chan interface{}
+	closeOnce sync.Once
+}
+
+// segment is a part of a template, either literal text or a key to look up.
+type segment struct {
+	text  string
+	isKey bool
+}
+
+type stats struct {
+	count    int
+	failures int
+	total    time.Duration
+	max      time.Duration
+}
+
+// New creates a Reporter with the given options, connecting to opts.Addr.
+// Register it with ops.RegisterStructuredReporter(reporter.Report) and Close it
+// before the process exits to send the latest metrics.
+func New(opts Options) (*Reporter, error) {
+	if opts.Network == "" {
+		opts.Network = "udp"
+	}
+	if opts.Template == "" {
+		opts.Template = DefaultTemplate
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 10 * time.Second
+	}
+	template, err := parseTemplate(opts.Template)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial(opts.Network, opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to %v: %v", opts.Addr, err)
+	}
+	r := &Reporter{
+		opts:     opts,
+		template: template,
+		conn:     conn,
+		paths:    make(map[string]*stats),
+		stop:     make(chan interface{}),
+		stopped:  make(chan interface{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+func parseTemplate(template string) ([]segment, error) {
+	var result []segment
+	for rest := template; rest != ""; {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			result = append(result, segment{text: rest})
+			break
+		}
+		if open > 0 {
+			result = append(result, segment{text: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("unclosed { in template %q", template)
+		}
+		key := rest[open+1 : open+end]
+		if key == "" {
+			return nil, fmt.Errorf("empty key in template %q", template)
+		}
+		result = append(result, segment{text: key, isKey: true})
+		rest = rest[open+end+1:]
+	}
+	return result, nil
+}
+
+// Report records the given report under its metric path.
+func (r *Reporter) Report(report *ops.Report) {
+	path := r.path(report)
+	r.mx.Lock()
+	s := r.paths[path]
+	if s == nil {
+		s = &stats{}
+		r.paths[path] = s
+	}
+	s.count++
+	if !report.Succeeded() {
+		s.failures++
+	}
+	s.total += report.Duration
+	if report.Duration > s.max {
+		s.max = report.Duration
+	}
+	r.mx.Unlock()
+}
+
+func (r *Reporter) path(report *ops.Report) string {
+	var b strings.Builder
+	for _, seg := range r.template {
+		if !seg.isKey {
+			b.WriteString(seg.text)
+			continue
+		}
+		var value interface{}
+		switch seg.text {
+		case "op":
+			value = report.Name
+		case "result":
+			value = "success"
+			if !report.Succeeded() {
+				value = "failure"
+			}
+		default:
+			value = report.Context[seg.text]
+		}
+		b.WriteString(sanitize(value))
+	}
+	return b.String()
+}
+
+func sanitize(value interface{}) string {
+	if value == nil {
+		return "unknown"
+	}
+	s := fmt.Sprint(value)
+	if s == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func (r *Reporter) run() {
+	defer close(r.stopped)
+	ticker := time.NewTicker(r.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.Flush()
+		case <-r.stop:
+			return
+		}
+	}
+}
+
+// Flush immediately sends the metrics recorded since the last flush.
+func (r *Reporter) Flush() error {
+	r.mx.Lock()
+	paths := r.paths
+	r.paths = make(map[string]*stats)
+	r.mx.Unlock()
+	if len(paths) == 0 {
+		return nil
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+	ts := time.Now().Unix()
+	var lines []string
+	for _, path := range sorted {
+		s := paths[path]
+		mean := float64(s.total) / float64(s.count) / float64(time.Millisecond)
+		lines = append(lines,
+			fmt.Sprintf("%s.count %d %d\n", path, s.count, ts),
+			fmt.Sprintf("%s.failures %d %d\n", path, s.failures, ts),
+			fmt.Sprintf("%s.duration_ms.mean %.3f %d\n", path, mean, ts),
+			fmt.Sprintf("%s.duration_ms.max %.3f %d\n", path, float64(s.max)/float64(time.Millisecond), ts))
+	}
+	return r.send(lines)
+}
+
+// send writes the given lines, batching them into packets that don't exceed
+// maxPacketSize when using UDP.
+func (r *Reporter) send(lines []string) error {
+	if r.opts.Network != "udp" {
+		_, err := r.conn.Write([]byte(strings.Join(lines, "")))
+		return err
+	}
+	var packet []byte
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+len(line) > maxPacketSize {
+			if _, err := r.conn.Write(packet); err != nil {
+				return err
+			}
+			packet = packet[:0]
+		}
+		packet = append(packet, line...)
+	}
+	_, err := r.conn.Write(packet)
+	return err
+}
+
+// Close sends the latest metrics and closes the connection.
+func (r *Reporter) Close() error {
+	var err error
+	r.closeOnce.Do(func() {
+		close(r.stop)
+		<-r.stopped
+		err = r.Flush()
+		if closeErr := r.conn.Close(); err == nil {
+			err = closeErr
+		}
+	})
+	return err
+}
@@ -0,0 +1,68 @@
+package opsgraphite_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opsgraphite"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReporter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	r, err := opsgraphite.New(opsgraphite.Options{
+		Addr:          conn.LocalAddr().String(),
+		Template:      "ops.{op}.{country}.{result}",
+		FlushInterval: time.Hour,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	r.Report(&ops.Report{Name: "dial", Duration: 2 * time.Millisecond, Context: map[string]interface{}{"country": "US"}})
+	r.Report(&ops.Report{Name: "dial", Duration: 4 * time.Millisecond, Context: map[string]interface{}{"country": "US"}})
+	r.Report(&ops.Report{Name: "dial", Duration: 3 * time.Millisecond, Failure: errors.New("refused")})
+	r.Report(&ops.Report{Name: "fetch.page", Duration: time.Millisecond, Context: map[string]interface{}{"country": "a b"}})
+	assert.NoError(t, r.Close())
+
+	b := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(b)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(string(b[:n])), "\n") {
+		// Drop the timestamp
+		lines = append(lines, line[:strings.LastIndexByte(line, ' ')])
+	}
+	assert.Equal(t, []string{
+		"ops.dial.US.success.count 2",
+		"ops.dial.US.success.failures 0",
+		"ops.dial.US.success.duration_ms.mean 3.000",
+		"ops.dial.US.success.duration_ms.max 4.000",
+		"ops.dial.unknown.failure.count 1",
+		"ops.dial.unknown.failure.failures 1",
+		"ops.dial.unknown.failure.duration_ms.mean 3.000",
+		"ops.dial.unknown.failure.duration_ms.max 3.000",
+		"ops.fetch_page.a_b.success.count 1",
+		"ops.fetch_page.a_b.success.failures 0",
+		"ops.fetch_page.a_b.success.duration_ms.mean 1.000",
+		"ops.fetch_page.a_b.success.duration_ms.max 1.000",
+	}, lines)
+}
+
+func TestBadTemplate(t *testing.T) {
+	_, err := opsgraphite.New(opsgraphite.Options{Addr: "127.0.0.1:2003", Template: "ops.{op"})
+	assert.Error(t, err)
+	_, err = opsgraphite.New(opsgraphite.Options{Addr: "127.0.0.1:2003", Template: "ops.{}"})
+	assert.Error(t, err)
+}
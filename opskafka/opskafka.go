@@ -0,0 +1,286 @@
+// Package opskafka provides a reporter that produces reports to Kafka in
+// batches. Messages are keyed by the trace ID (or the ID of the root op) of the
+// report, so that with Kafka's usual key-hash partitioning all reports of one
+// trace land in the same partition, in order, and downstream stream processors
+// can assemble traces without repartitioning. Values are the JSON of
+// ops.Report, which consumers can decode with json.Unmarshal into an
+// ops.Report.
+//
+// opskafka doesn't depend on a Kafka client. Pass it a function producing a
+// batch of messages, for example with github.com/segmentio/kafka-go:
+//
+//	w := &kafka.Writer{Addr: kafka.TCP("localhost:9092"), Balancer: &kafka.Hash{}}
+//	producer := opskafka.New(opskafka.Options{
+//		Produce: func(msgs []opskafka.Message) error {
+//			batch := make([]kafka.Message, 0, len(msgs))
+//			for _, msg := range msgs {
+//				batch = append(batch, kafka.Message{Topic: msg.Topic, Key: msg.Key, Value: msg.Value})
+//			}
+//			return w.WriteMessages(context.Background(), batch...)
+//		},
+//	})
+//	ops.RegisterStructuredReporter(producer.Report)
+package opskafka
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opskafka")
+}
+
+// DefaultTopic is the default topic that reports are produced to.
+const DefaultTopic = "ops.reports"
+
+// ContentEncodingHeader is the header that marks compressed values.
+const ContentEncodingHeader = "content-encoding"
+
+// Header is a header of a Message.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// Message is a report to produce to Kafka.
+type Message struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers []Header
+}
+
+// ByTraceID keys messages by the trace ID of the report, so that all reports of
+// a trace, including those from other processes, share a partition.
+func ByTraceID(report *ops.Report) string {
+	return report.TraceID
+}
+
+// ByRootOp keys messages by the ID of the root op of the report, so that all
+// reports of an op hierarchy within a process share a partition.
+func ByRootOp(report *ops.Report) string {
+	return report.RootID
+}
+
+// Compression selects how message values are compressed.
+type Compression int
+
+const (
+	// CompressionNone leaves values uncompressed, which is best when the Kafka
+	// client compresses batches itself.
+	CompressionNone Compression = iota
+
+	// CompressionGzip gzips each value and sets the ContentEncodingHeader to
+	// "gzip".
+	CompressionGzip
+)
+
+// Options configures a Producer. Zero values use the defaults noted on each
+// field.
+type Options struct {
+	// Produce produces a batch of messages, returning once they're
+	// acknowledged.
+	Produce func(msgs []Message) error
+
+	// Topic is the topic that reports are produced to (default DefaultTopic).
+	Topic string
+
+	// Key chooses the key of the message for a report (default ByTraceID).
+	// Reports for which it returns "" use their own ID, which spreads them
+	// over partitions.
+	Key func(report *ops.Report) string
+
+	// Compression selects how values are compressed (default CompressionNone).
+	Compression Compression
+
+	// BatchSize is how many messages are produced at most per batch (default
+	// 500).
+	BatchSize int
+
+	// FlushInterval is how long reports wait at most before being produced
+	// (default 1 second).
+	FlushInterval time.Duration
+
+	// Retries is how many times a failed batch is retried (default 3,
+	// negative disables retries).
+	Retries int
+
+	// Backoff is how long to wait before the first retry, doubling for each
+	// following retry (default 100 milliseconds).
+	Backoff time.Duration
+}
+
+// Producer is a reporter that produces reports to Kafka in the background.
+type Producer struct {
+	opts     Options
+	queue    chan interface{}
+	dropped  int64
+	done     chan interface{}
+	closed   bool
+	closedMx sync.RWMutex
+}
+
+// New creates a Producer with the given options. Register it with
+// ops.RegisterStructuredReporter(producer.Report) and Close it before the
+// process exits to produce queued reports.
+func New(opts Options) *Producer {
+	if opts.Topic == "" {
+		opts.Topic = DefaultTopic
+	}
+	if opts.Key == nil {
+		opts.Key = ByTraceID
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	} else if opts.Retries == 0 {
+		opts.Retries = 3
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 100 * time.Millisecond
+	}
+	p := &Producer{
+		opts:  opts,
+		queue: make(chan interface{}, opts.BatchSize*4),
+		done:  make(chan interface{}),
+	}
+	go p.run()
+	return p
+}
+
+// Report queues the report to be produced. Reports are dropped if the queue is
+// full or the Producer is closed.
+func (p *Producer) Report(report *ops.Report) {
+	msg, err := p.message(report)
+	if err != nil {
+		atomic.AddInt64(&p.dropped, 1)
+		return
+	}
+	p.closedMx.RLock()
+	defer p.closedMx.RUnlock()
+	if p.closed {
+		return
+	}
+	select {
+	case p.queue <- msg:
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+	}
+}
+
+func (p *Producer) message(report *ops.Report) (*Message, error) {
+	value, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	key := p.opts.Key(report)
+	if key == "" {
+		key = report.ID
+	}
+	msg := &Message{Topic: p.opts.Topic, Key: []byte(key), Value: value}
+	if p.opts.Compression == CompressionGzip {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(value)
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		msg.Value = buf.Bytes()
+		msg.Headers = []Header{{Key: ContentEncodingHeader, Value: []byte("gzip")}}
+	}
+	return msg, nil
+}
+
+// Dropped returns the number of reports that were dropped because too many
+// were waiting or because producing them kept failing.
+func (p *Producer) Dropped() int64 {
+	return atomic.LoadInt64(&p.dropped)
+}
+
+// Flush waits until all queued reports have been produced.
+func (p *Producer) Flush() {
+	flushed := make(chan interface{})
+	p.closedMx.RLock()
+	if p.closed {
+		p.closedMx.RUnlock()
+		return
+	}
+	p.queue <- flushed
+	p.closedMx.RUnlock()
+	<-flushed
+}
+
+// Close produces any queued reports and stops the Producer. It doesn't close
+// the Kafka client.
+func (p *Producer) Close() {
+	p.closedMx.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.closedMx.Unlock()
+	<-p.done
+}
+
+func (p *Producer) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.opts.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]Message, 0, p.opts.BatchSize)
+	produce := func() {
+		if len(batch) > 0 {
+			if !p.produce(batch) {
+				atomic.AddInt64(&p.dropped, int64(len(batch)))
+			}
+			// Produce may hold on to the batch, so don't reuse it
+			batch = make([]Message, 0, p.opts.BatchSize)
+		}
+	}
+	for {
+		select {
+		case item, ok := <-p.queue:
+			if !ok {
+				produce()
+				return
+			}
+			switch t := item.(type) {
+			case *Message:
+				batch = append(batch, *t)
+				if len(batch) >= p.opts.BatchSize {
+					produce()
+				}
+			case chan interface{}:
+				produce()
+				close(t)
+			}
+		case <-ticker.C:
+			produce()
+		}
+	}
+}
+
+func (p *Producer) produce(batch []Message) bool {
+	backoff := p.opts.Backoff
+	for attempt := 0; attempt <= p.opts.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err := p.opts.Produce(batch); err == nil {
+			return true
+		}
+	}
+	return false
+}
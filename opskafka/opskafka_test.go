@@ -0,0 +1,117 @@
+package opskafka_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opskafka"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProducer(t *testing.T) {
+	var mx sync.Mutex
+	var batches [][]opskafka.Message
+	attempts := 0
+	p := opskafka.New(opskafka.Options{
+		BatchSize: 2,
+		Backoff:   time.Millisecond,
+		Produce: func(msgs []opskafka.Message) error {
+			mx.Lock()
+			defer mx.Unlock()
+			attempts++
+			if attempts == 1 {
+				return errors.New("not leader")
+			}
+			batches = append(batches, msgs)
+			return nil
+		},
+	})
+	p.Report(&ops.Report{SchemaVersion: ops.SchemaVersion, Name: "a", ID: "1", TraceID: "t1", Start: time.Now()})
+	p.Report(&ops.Report{SchemaVersion: ops.SchemaVersion, Name: "b", ID: "2", TraceID: "t2", Start: time.Now(), Failure: errors.New("broken")})
+	p.Report(&ops.Report{SchemaVersion: ops.SchemaVersion, Name: "c", ID: "3", Start: time.Now()})
+	p.Flush()
+
+	mx.Lock()
+	assert.Equal(t, 3, attempts, "first batch should have been retried")
+	if assert.Len(t, batches, 2) && assert.Len(t, batches[0], 2) && assert.Len(t, batches[1], 1) {
+		msg := batches[0][1]
+		assert.Equal(t, opskafka.DefaultTopic, msg.Topic)
+		assert.Equal(t, "t2", string(msg.Key))
+		assert.Empty(t, msg.Headers)
+		var decoded ops.Report
+		if assert.NoError(t, json.Unmarshal(msg.Value, &decoded)) {
+			assert.Equal(t, "b", decoded.Name)
+			assert.EqualError(t, decoded.Failure, "broken")
+		}
+		assert.Equal(t, "3", string(batches[1][0].Key), "reports without a trace should be keyed by their own ID")
+	}
+	mx.Unlock()
+
+	p.Close()
+	p.Report(&ops.Report{Name: "d"})
+	assert.EqualValues(t, 0, p.Dropped())
+}
+
+func TestProducerByRootOpCompressed(t *testing.T) {
+	var mx sync.Mutex
+	var produced []opskafka.Message
+	p := opskafka.New(opskafka.Options{
+		Topic:       "telemetry",
+		Key:         opskafka.ByRootOp,
+		Compression: opskafka.CompressionGzip,
+		Produce: func(msgs []opskafka.Message) error {
+			mx.Lock()
+			defer mx.Unlock()
+			produced = append(produced, msgs...)
+			return nil
+		},
+	})
+	root := ops.Begin("root")
+	root.RegisterStructuredReporter(p.Report)
+	root.Begin("child").End()
+	root.End()
+	other := ops.Begin("other")
+	other.RegisterStructuredReporter(p.Report)
+	other.End()
+	p.Close()
+
+	mx.Lock()
+	defer mx.Unlock()
+	if !assert.Len(t, produced, 3) {
+		return
+	}
+	assert.Equal(t, produced[0].Key, produced[1].Key, "child and root should share a key")
+	assert.NotEqual(t, produced[0].Key, produced[2].Key)
+	msg := produced[0]
+	assert.Equal(t, "telemetry", msg.Topic)
+	assert.Equal(t, []opskafka.Header{{Key: opskafka.ContentEncodingHeader, Value: []byte("gzip")}}, msg.Headers)
+	r, err := gzip.NewReader(bytes.NewReader(msg.Value))
+	if assert.NoError(t, err) {
+		value, _ := io.ReadAll(r)
+		var decoded ops.Report
+		if assert.NoError(t, json.Unmarshal(value, &decoded)) {
+			assert.Equal(t, "child", decoded.Name)
+			assert.Equal(t, string(msg.Key), decoded.RootID)
+		}
+	}
+}
+
+func TestProducerGivesUp(t *testing.T) {
+	p := opskafka.New(opskafka.Options{
+		Retries: -1,
+		Produce: func(msgs []opskafka.Message) error {
+			return errors.New("broker down")
+		},
+	})
+	p.Report(&ops.Report{Name: "a"})
+	p.Report(&ops.Report{Name: "b"})
+	p.Close()
+	assert.EqualValues(t, 2, p.Dropped())
+}
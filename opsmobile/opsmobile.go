@@ -0,0 +1,251 @@
+// Package opsmobile is a facade over ops that can be bound with gomobile, so
+// that the Java/Kotlin and Swift layers of mobile apps can report ops into the
+// same pipeline as the Go code they embed. Its API only uses types that
+// gomobile supports.
+//
+// Calls from the native layer arrive on arbitrary goroutines, so each Op
+// begun here lives on a goroutine of its own until it's ended, which keeps the
+// per-goroutine context stacks that ops relies on consistent.
+package opsmobile
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opsmobile")
+}
+
+// Op is an ops.Op begun from the native layer.
+type Op struct {
+	op    ops.Op
+	end   chan interface{}
+	ended chan interface{}
+	once  sync.Once
+}
+
+// Begin begins a new top-level Op.
+func Begin(name string) *Op {
+	return start(func() ops.Op { return ops.Begin(name) })
+}
+
+// Begin begins a new Op under this one.
+func (o *Op) Begin(name string) *Op {
+	return start(func() ops.Op { return o.op.Begin(name) })
+}
+
+func start(begin func() ops.Op) *Op {
+	o := &Op{end: make(chan interface{}), ended: make(chan interface{})}
+	begun := make(chan interface{})
+	go func() {
+		o.op = begin()
+		close(begun)
+		<-o.end
+		o.op.End()
+		close(o.ended)
+	}()
+	<-begun
+	return o
+}
+
+// ID returns the unique id of this Op.
+func (o *Op) ID() string {
+	return o.op.ID()
+}
+
+// TraceID returns the id of the trace to which this Op belongs.
+func (o *Op) TraceID() string {
+	return o.op.TraceID()
+}
+
+// PutString puts a string value into this Op's context.
+func (o *Op) PutString(key string, value string) {
+	o.op.Set(key, value)
+}
+
+// PutInt puts an integer value into this Op's context.
+func (o *Op) PutInt(key string, value int64) {
+	o.op.Set(key, value)
+}
+
+// PutFloat puts a floating point value into this Op's context.
+func (o *Op) PutFloat(key string, value float64) {
+	o.op.Set(key, value)
+}
+
+// PutBool puts a boolean value into this Op's context.
+func (o *Op) PutBool(key string, value bool) {
+	o.op.Set(key, value)
+}
+
+// Fail marks this Op as failed with the given error message.
+func (o *Op) Fail(message string) {
+	o.op.FailIf(errors.New(message))
+}
+
+// Warn records a problem that doesn't fail this Op (see ops.Op.Warn).
+func (o *Op) Warn(message string) {
+	o.op.Warn(errors.New(message))
+}
+
+// End ends this Op, reporting it. Calling End more than once has no effect.
+func (o *Op) End() {
+	o.once.Do(func() {
+		close(o.end)
+	})
+	<-o.ended
+}
+
+// Exporter is implemented by the native layer to receive batches of reports,
+// for example to upload them with the platform's HTTP stack. Each batch is a
+// JSON array of reports in their canonical encoding (see
+// ops.ReportJSONSchema). If Export returns an error, the batch is retried
+// with the next one.
+type Exporter interface {
+	Export(batch []byte) error
+}
+
+var (
+	exportMx       sync.Mutex
+	exporter       *batchExporter
+	registerReport sync.Once
+)
+
+// StartExport starts delivering reports to the given Exporter in batches of at
+// most maxBatch reports, at least every intervalMillis milliseconds while
+// there are reports to deliver. Up to 10 batches are kept while the exporter
+// is failing, after which the oldest reports are dropped. Calling StartExport
+// again replaces the previous Exporter.
+func StartExport(e Exporter, maxBatch int, intervalMillis int64) {
+	if maxBatch <= 0 {
+		maxBatch = 100
+	}
+	b := &batchExporter{
+		exporter: e,
+		maxBatch: maxBatch,
+		stop:     make(chan interface{}),
+		stopped:  make(chan interface{}),
+	}
+	registerReport.Do(func() {
+		ops.RegisterStructuredReporter(report)
+	})
+	exportMx.Lock()
+	previous := exporter
+	exporter = b
+	exportMx.Unlock()
+	if previous != nil {
+		previous.close()
+	}
+	go b.run(time.Duration(intervalMillis) * time.Millisecond)
+}
+
+// StopExport stops delivering reports, exporting any that are pending first.
+func StopExport() {
+	exportMx.Lock()
+	b := exporter
+	exporter = nil
+	exportMx.Unlock()
+	if b != nil {
+		b.close()
+	}
+}
+
+// Flush immediately exports pending reports.
+func Flush() {
+	exportMx.Lock()
+	b := exporter
+	exportMx.Unlock()
+	if b != nil {
+		b.flush()
+	}
+}
+
+func report(r *ops.Report) {
+	exportMx.Lock()
+	b := exporter
+	exportMx.Unlock()
+	if b != nil {
+		b.add(r)
+	}
+}
+
+type batchExporter struct {
+	exporter Exporter
+	maxBatch int
+	pending  []*ops.Report
+	mx       sync.Mutex
+	exportMx sync.Mutex
+	stop     chan interface{}
+	stopped  chan interface{}
+}
+
+func (b *batchExporter) run(interval time.Duration) {
+	defer close(b.stopped)
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.flush()
+		case <-b.stop:
+			b.flush()
+			return
+		}
+	}
+}
+
+func (b *batchExporter) add(r *ops.Report) {
+	r = r.Retain()
+	b.mx.Lock()
+	b.pending = append(b.pending, r)
+	if overflow := len(b.pending) - 10*b.maxBatch; overflow > 0 {
+		b.pending = b.pending[overflow:]
+	}
+	full := len(b.pending) >= b.maxBatch
+	b.mx.Unlock()
+	if full {
+		go b.flush()
+	}
+}
+
+func (b *batchExporter) flush() {
+	// Only one export at a time, so that batches keep their order
+	b.exportMx.Lock()
+	defer b.exportMx.Unlock()
+	for {
+		b.mx.Lock()
+		n := len(b.pending)
+		if n > b.maxBatch {
+			n = b.maxBatch
+		}
+		batch := b.pending[:n:n]
+		b.mx.Unlock()
+		if n == 0 {
+			return
+		}
+		encoded, err := json.Marshal(batch)
+		if err == nil {
+			err = b.exporter.Export(encoded)
+		}
+		if err != nil {
+			// Keep the batch for next time
+			return
+		}
+		b.mx.Lock()
+		b.pending = b.pending[n:]
+		b.mx.Unlock()
+	}
+}
+
+func (b *batchExporter) close() {
+	close(b.stop)
+	<-b.stopped
+}
@@ -0,0 +1,114 @@
+package opsmobile_test
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opsmobile"
+	"github.com/stretchr/testify/assert"
+)
+
+type exporter struct {
+	mx      sync.Mutex
+	batches [][]map[string]interface{}
+	fail    bool
+}
+
+func (e *exporter) Export(batch []byte) error {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	if e.fail {
+		return errors.New("offline")
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(batch, &decoded); err != nil {
+		return err
+	}
+	e.batches = append(e.batches, decoded)
+	return nil
+}
+
+func (e *exporter) names() []interface{} {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	var names []interface{}
+	for _, batch := range e.batches {
+		for _, report := range batch {
+			names = append(names, report["name"])
+		}
+	}
+	return names
+}
+
+func TestOps(t *testing.T) {
+	reported := make(chan *ops.Report, 10)
+	// ops has no way to unregister reporters, so stop this one from delivering
+	// once the test is done, for example when it's run again with -count
+	var finished int32
+	t.Cleanup(func() { atomic.StoreInt32(&finished, 1) })
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		if atomic.LoadInt32(&finished) == 0 {
+			reported <- report
+		}
+	}, "mobile_parent", "mobile_child")
+
+	parent := opsmobile.Begin("mobile_parent")
+	parent.PutString("screen", "home")
+	child := parent.Begin("mobile_child")
+	child.PutInt("count", 3)
+	child.PutFloat("ratio", 0.5)
+	child.PutBool("cached", true)
+
+	// End from a different goroutine, as calls from the native layer may
+	done := make(chan interface{})
+	go func() {
+		child.Fail("request failed")
+		child.End()
+		child.End()
+		parent.Warn("slow")
+		parent.End()
+		close(done)
+	}()
+	<-done
+
+	childReport, parentReport := <-reported, <-reported
+	assert.Equal(t, "mobile_child", childReport.Name)
+	assert.EqualError(t, childReport.Failure, "request failed")
+	assert.Equal(t, "home", childReport.Context["screen"])
+	assert.EqualValues(t, 3, childReport.Context["count"])
+	assert.Equal(t, 0.5, childReport.Context["ratio"])
+	assert.Equal(t, true, childReport.Context["cached"])
+	assert.Equal(t, parent.ID(), childReport.ParentID)
+	assert.Equal(t, parent.TraceID(), childReport.TraceID)
+	assert.Equal(t, ops.SeverityWarning, parentReport.Severity)
+}
+
+func TestExport(t *testing.T) {
+	e := &exporter{fail: true}
+	opsmobile.StartExport(e, 2, 60000)
+	defer opsmobile.StopExport()
+
+	opsmobile.Begin("mobile_export_1").End()
+	opsmobile.Flush()
+	assert.Empty(t, e.names(), "failed batches should be kept")
+
+	e.mx.Lock()
+	e.fail = false
+	e.mx.Unlock()
+	opsmobile.Begin("mobile_export_2").End()
+	opsmobile.Begin("mobile_export_3").End()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(e.names()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	opsmobile.Flush()
+	assert.Equal(t, []interface{}{"mobile_export_1", "mobile_export_2", "mobile_export_3"}, e.names())
+	e.mx.Lock()
+	assert.Len(t, e.batches[0], 2, "batches should be limited in size")
+	e.mx.Unlock()
+}
@@ -0,0 +1,194 @@
+// Package opsnats provides a reporter that publishes reports to NATS, so that
+// fleets of processes can stream their ops to a central consumer with minimal
+// infrastructure. Reports are published as the JSON of ops.Report, which
+// consumers can decode with json.Unmarshal into an ops.Report.
+//
+// opsnats doesn't depend on a NATS client. Pass it the Publish of a
+// github.com/nats-io/nats.go connection for at-most-once delivery:
+//
+//	nc, _ := nats.Connect(nats.DefaultURL)
+//	publisher := opsnats.New(opsnats.Options{Publish: nc.Publish})
+//	ops.RegisterStructuredReporter(publisher.Report)
+//
+// or publish to a JetStream stream for at-least-once delivery, since
+// JetStream's Publish waits for the stream to acknowledge the message and
+// failed publishes are retried:
+//
+//	js, _ := nc.JetStream()
+//	publisher := opsnats.New(opsnats.Options{
+//		Publish: func(subject string, data []byte) error {
+//			_, err := js.Publish(subject, data)
+//			return err
+//		},
+//	})
+package opsnats
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opsnats")
+}
+
+// DefaultSubject is the default subject that reports are published to.
+const DefaultSubject = "ops.reports"
+
+// queueSize is how many reports can wait to be published before reports are
+// dropped.
+const queueSize = 1000
+
+// Options configures a Publisher. Zero values use the defaults noted on each
+// field.
+type Options struct {
+	// Publish publishes data to the given subject, like the Publish of a NATS
+	// connection.
+	Publish func(subject string, data []byte) error
+
+	// Subject is the subject that reports are published to, with {op}
+	// replaced by the name of the op, for example "ops.reports.{op}", so that
+	// consumers can subscribe to some ops only (default DefaultSubject).
+	// Characters that aren't allowed in subject tokens are replaced by _.
+	Subject string
+
+	// Filter decides which reports are published (default all).
+	Filter func(report *ops.Report) bool
+
+	// Retries is how many times a failed publish is retried (default 3,
+	// negative disables retries).
+	Retries int
+
+	// Backoff is how long to wait before the first retry, doubling for each
+	// following retry (default 100 milliseconds).
+	Backoff time.Duration
+}
+
+// Publisher is a reporter that publishes reports to NATS in the background.
+type Publisher struct {
+	opts      Options
+	queue     chan *message
+	closed    bool
+	dropped   int64
+	mx        sync.Mutex
+	done      chan interface{}
+	closeOnce sync.Once
+}
+
+type message struct {
+	subject string
+	data    []byte
+}
+
+// New creates a Publisher with the given options. Register it with
+// ops.RegisterStructuredReporter(publisher.Report) and Close it before the
+// process exits to publish queued reports.
+func New(opts Options) *Publisher {
+	if opts.Subject == "" {
+		opts.Subject = DefaultSubject
+	}
+	if opts.Filter == nil {
+		opts.Filter = func(report *ops.Report) bool { return true }
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	} else if opts.Retries == 0 {
+		opts.Retries = 3
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 100 * time.Millisecond
+	}
+	p := &Publisher{
+		opts:  opts,
+		queue: make(chan *message, queueSize),
+		done:  make(chan interface{}),
+	}
+	go p.run()
+	return p
+}
+
+// Report queues the report to be published if it passes the filter.
+func (p *Publisher) Report(report *ops.Report) {
+	if !p.opts.Filter(report) {
+		return
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		atomic.AddInt64(&p.dropped, 1)
+		return
+	}
+	msg := &message{subject: p.subject(report.Name), data: data}
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	if p.closed {
+		return
+	}
+	select {
+	case p.queue <- msg:
+	default:
+		atomic.AddInt64(&p.dropped, 1)
+	}
+}
+
+func (p *Publisher) subject(name string) string {
+	if !strings.Contains(p.opts.Subject, "{op}") {
+		return p.opts.Subject
+	}
+	token := strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, name)
+	if token == "" {
+		token = "_"
+	}
+	return strings.ReplaceAll(p.opts.Subject, "{op}", token)
+}
+
+// Dropped returns the number of reports that were dropped because too many
+// were waiting to be published or because publishing them kept failing.
+func (p *Publisher) Dropped() int64 {
+	return atomic.LoadInt64(&p.dropped)
+}
+
+func (p *Publisher) run() {
+	defer close(p.done)
+	for msg := range p.queue {
+		if !p.publish(msg) {
+			atomic.AddInt64(&p.dropped, 1)
+		}
+	}
+}
+
+func (p *Publisher) publish(msg *message) bool {
+	backoff := p.opts.Backoff
+	for attempt := 0; attempt <= p.opts.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err := p.opts.Publish(msg.subject, msg.data); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Close publishes any queued reports and stops the Publisher. Reports received
+// after Close are ignored. It doesn't close the NATS connection.
+func (p *Publisher) Close() {
+	p.closeOnce.Do(func() {
+		p.mx.Lock()
+		p.closed = true
+		close(p.queue)
+		p.mx.Unlock()
+	})
+	<-p.done
+}
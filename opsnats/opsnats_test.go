@@ -0,0 +1,66 @@
+package opsnats_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opsnats"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublisher(t *testing.T) {
+	var mx sync.Mutex
+	published := make(map[string][][]byte)
+	attempts := 0
+	p := opsnats.New(opsnats.Options{
+		Subject: "ops.{op}",
+		Backoff: time.Millisecond,
+		Filter:  func(report *ops.Report) bool { return report.Name != "ignored" },
+		Publish: func(subject string, data []byte) error {
+			mx.Lock()
+			defer mx.Unlock()
+			attempts++
+			if attempts == 1 {
+				return errors.New("no ack")
+			}
+			published[subject] = append(published[subject], data)
+			return nil
+		},
+	})
+	p.Report(&ops.Report{SchemaVersion: ops.SchemaVersion, Name: "dial.tcp", ID: "a", Start: time.Now(), Failure: errors.New("refused")})
+	p.Report(&ops.Report{Name: "ignored"})
+	p.Report(&ops.Report{Name: "fetch", ID: "b", Start: time.Now()})
+	p.Close()
+	p.Report(&ops.Report{Name: "fetch"})
+
+	mx.Lock()
+	defer mx.Unlock()
+	assert.Equal(t, 3, attempts, "first publish should have been retried")
+	if assert.Len(t, published["ops.dial_tcp"], 1) {
+		var decoded ops.Report
+		if assert.NoError(t, json.Unmarshal(published["ops.dial_tcp"][0], &decoded)) {
+			assert.Equal(t, "dial.tcp", decoded.Name)
+			assert.Equal(t, "a", decoded.ID)
+			assert.EqualError(t, decoded.Failure, "refused")
+		}
+	}
+	assert.Len(t, published["ops.fetch"], 1)
+	assert.EqualValues(t, 0, p.Dropped())
+}
+
+func TestPublisherGivesUp(t *testing.T) {
+	p := opsnats.New(opsnats.Options{
+		Retries: -1,
+		Publish: func(subject string, data []byte) error {
+			assert.Equal(t, opsnats.DefaultSubject, subject)
+			return errors.New("disconnected")
+		},
+	})
+	p.Report(&ops.Report{Name: "dial"})
+	p.Close()
+	assert.EqualValues(t, 1, p.Dropped())
+}
@@ -0,0 +1,306 @@
+// Package opsparquet provides an exporter that writes reports to rotating
+// Parquet files, so that op telemetry can be analyzed offline with standard
+// tools like pandas, DuckDB or Spark. Each file has the following columns:
+//
+//	name         string
+//	op_id        string
+//	trace_id     string
+//	parent_id    string
+//	start        timestamp (microseconds, UTC)
+//	duration_ns  int64
+//	succeeded    bool
+//	outcome      string
+//	error        string, null for ops that succeeded
+//	context      map<string, string>
+//
+// Context values that aren't strings are stored as JSON.
+//
+// Files are written to a temporary name and renamed once complete, so that
+// only complete files ever have the .parquet extension.
+package opsparquet
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opsparquet")
+}
+
+// queueSize is how many reports can wait to be written before reports are
+// dropped.
+const queueSize = 10000
+
+// Options configures an Exporter. Zero values use the defaults noted on each
+// field.
+type Options struct {
+	// Dir is the directory that files are written to.
+	Dir string
+
+	// Prefix starts the name of each file, which continues with the time the
+	// file was started, for example ops-20260102T030405.000Z.parquet (default
+	// "ops").
+	Prefix string
+
+	// RotateInterval is about how long a file is written to before starting
+	// the next one (default 1 hour).
+	RotateInterval time.Duration
+
+	// MaxRows is how many reports a file holds at most before starting the
+	// next one (default 1000000).
+	MaxRows int
+
+	// RowGroupSize is how many reports are buffered in memory before being
+	// written to the file as a row group (default 10000).
+	RowGroupSize int
+
+	// Compress compresses files with gzip.
+	Compress bool
+}
+
+// Exporter is a reporter that writes reports to Parquet files in the
+// background.
+type Exporter struct {
+	opts     Options
+	queue    chan interface{}
+	dropped  int64
+	errors   int64
+	done     chan interface{}
+	closed   bool
+	closedMx sync.RWMutex
+
+	// only used by run
+	file     *os.File
+	buffered *bufio.Writer
+	writer   *fileWriter
+	rows     int
+	started  time.Time
+}
+
+// New creates an Exporter writing to opts.Dir, creating it if necessary.
+// Register it with ops.RegisterStructuredReporter(exporter.Report) and Close it
+// before the process exits to complete the current file.
+func New(opts Options) (*Exporter, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = "ops"
+	}
+	if opts.RotateInterval <= 0 {
+		opts.RotateInterval = time.Hour
+	}
+	if opts.MaxRows <= 0 {
+		opts.MaxRows = 1000000
+	}
+	if opts.RowGroupSize <= 0 {
+		opts.RowGroupSize = 10000
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	e := &Exporter{
+		opts:  opts,
+		queue: make(chan interface{}, queueSize),
+		done:  make(chan interface{}),
+	}
+	go e.run()
+	return e, nil
+}
+
+// Report queues the report for writing. Reports are dropped if the queue is
+// full or the Exporter is closed.
+func (e *Exporter) Report(report *ops.Report) {
+	r := toRow(report)
+	e.closedMx.RLock()
+	defer e.closedMx.RUnlock()
+	if e.closed {
+		return
+	}
+	select {
+	case e.queue <- r:
+	default:
+		atomic.AddInt64(&e.dropped, 1)
+	}
+}
+
+func toRow(report *ops.Report) *row {
+	r := &row{
+		name:      report.Name,
+		id:        report.ID,
+		traceID:   report.TraceID,
+		parentID:  report.ParentID,
+		start:     report.Start.UnixNano() / int64(time.Microsecond),
+		duration:  int64(report.Duration),
+		succeeded: report.Succeeded(),
+		outcome:   report.Outcome.String(),
+		context:   make([][2]string, 0, len(report.Context)),
+	}
+	if report.Failure != nil {
+		failure := ops.ErrorText(report.Failure)
+		r.failure = &failure
+	}
+	for key, value := range report.Context {
+		s, ok := value.(string)
+		if !ok {
+			if encoded, err := json.Marshal(value); err == nil {
+				s = string(encoded)
+			} else {
+				s = fmt.Sprint(value)
+			}
+		}
+		r.context = append(r.context, [2]string{key, s})
+	}
+	sort.Slice(r.context, func(i, j int) bool {
+		return r.context[i][0] < r.context[j][0]
+	})
+	return r
+}
+
+// Dropped returns the number of reports that were dropped because too many
+// were waiting to be written.
+func (e *Exporter) Dropped() int64 {
+	return atomic.LoadInt64(&e.dropped)
+}
+
+// Errors returns the number of errors writing files, each of which loses the
+// file being written.
+func (e *Exporter) Errors() int64 {
+	return atomic.LoadInt64(&e.errors)
+}
+
+// Rotate completes the current file, if any, so that the next report starts
+// a new one.
+func (e *Exporter) Rotate() {
+	rotated := make(chan interface{})
+	e.closedMx.RLock()
+	if e.closed {
+		e.closedMx.RUnlock()
+		return
+	}
+	e.queue <- rotated
+	e.closedMx.RUnlock()
+	<-rotated
+}
+
+// Close completes the current file and stops the Exporter.
+func (e *Exporter) Close() {
+	e.closedMx.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.closedMx.Unlock()
+	<-e.done
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.opts.RotateInterval / 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case item, ok := <-e.queue:
+			if !ok {
+				e.complete()
+				return
+			}
+			switch t := item.(type) {
+			case *row:
+				e.add(t)
+			case chan interface{}:
+				e.complete()
+				close(t)
+			}
+		case now := <-ticker.C:
+			if e.writer != nil && now.Sub(e.started) >= e.opts.RotateInterval {
+				e.complete()
+			}
+		}
+	}
+}
+
+func (e *Exporter) add(r *row) {
+	if e.writer == nil && !e.open() {
+		return
+	}
+	e.writer.add(r)
+	e.rows++
+	if e.rows%e.opts.RowGroupSize == 0 {
+		if err := e.writer.flushRowGroup(); err != nil {
+			e.fail()
+			return
+		}
+	}
+	if e.rows >= e.opts.MaxRows {
+		e.complete()
+	}
+}
+
+func (e *Exporter) open() bool {
+	e.started = time.Now()
+	base := filepath.Join(e.opts.Dir, fmt.Sprintf("%v-%v", e.opts.Prefix, e.started.UTC().Format("20060102T150405.000Z")))
+	var file *os.File
+	for i := 0; file == nil; i++ {
+		name := base
+		if i > 0 {
+			// Files started within the same millisecond
+			name = fmt.Sprintf("%v-%d", base, i)
+		}
+		if _, err := os.Stat(name + ".parquet"); err == nil {
+			continue
+		}
+		var err error
+		file, err = os.OpenFile(name+".parquet.tmp", os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil && !os.IsExist(err) {
+			atomic.AddInt64(&e.errors, 1)
+			return false
+		}
+	}
+	e.file = file
+	e.buffered = bufio.NewWriter(file)
+	e.writer = newFileWriter(e.buffered, e.opts.Compress)
+	e.rows = 0
+	return true
+}
+
+// complete writes the footer of the current file, if any, and renames it.
+func (e *Exporter) complete() {
+	if e.writer == nil {
+		return
+	}
+	err := e.writer.close()
+	if err == nil {
+		err = e.buffered.Flush()
+	}
+	if err == nil {
+		err = e.file.Sync()
+	}
+	if closeErr := e.file.Close(); err == nil {
+		err = closeErr
+	}
+	tmp := e.file.Name()
+	if err == nil {
+		err = os.Rename(tmp, tmp[:len(tmp)-len(".tmp")])
+	}
+	if err != nil {
+		atomic.AddInt64(&e.errors, 1)
+		os.Remove(tmp)
+	}
+	e.writer = nil
+}
+
+// fail abandons the current file after an error writing it.
+func (e *Exporter) fail() {
+	atomic.AddInt64(&e.errors, 1)
+	e.file.Close()
+	os.Remove(e.file.Name())
+	e.writer = nil
+}
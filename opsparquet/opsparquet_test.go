@@ -0,0 +1,276 @@
+package opsparquet_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opsparquet"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir := t.TempDir()
+		e, err := opsparquet.New(opsparquet.Options{Dir: dir, RowGroupSize: 2, Compress: compress})
+		if !assert.NoError(t, err) {
+			return
+		}
+		start := time.Date(2026, 1, 2, 3, 4, 5, 6000, time.UTC)
+		e.Report(report("a", start, nil, map[string]interface{}{"country": "US", "attempt": 2}))
+		e.Report(report("b", start, errors.New("broken"), nil))
+		e.Report(report("c", start, nil, map[string]interface{}{"country": "DE"}))
+		e.Close()
+		assert.EqualValues(t, 0, e.Errors())
+
+		files := parquetFiles(t, dir)
+		if !assert.Len(t, files, 1) {
+			return
+		}
+		f := readFile(t, files[0])
+		assert.EqualValues(t, 3, f.meta[3], "num_rows")
+		var names []string
+		for _, element := range f.meta[2].([]interface{}) {
+			names = append(names, string(element.(fields)[4].([]byte)))
+		}
+		assert.Equal(t, []string{"schema", "name", "op_id", "trace_id", "parent_id", "start", "duration_ns",
+			"succeeded", "outcome", "error", "context", "key_value", "key", "value"}, names)
+		groups := f.meta[4].([]interface{})
+		assert.Len(t, groups, 2, "row groups")
+		assert.EqualValues(t, 2, groups[0].(fields)[3])
+		assert.EqualValues(t, 1, groups[1].(fields)[3])
+
+		assert.Equal(t, []string{"a", "b", "c"}, f.strings(t, 0, 0, false))
+		assert.Equal(t, []string{"broken"}, f.strings(t, 8, 1, false))
+		assert.Equal(t, []string{"attempt", "country", "country"}, f.strings(t, 9, 1, true))
+		assert.Equal(t, []string{"2", "US", "DE"}, f.strings(t, 10, 1, true))
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	e, err := opsparquet.New(opsparquet.Options{Dir: dir, Prefix: "test", MaxRows: 2})
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 5; i++ {
+		e.Report(report("a", time.Now(), nil, nil))
+	}
+	e.Rotate()
+	assert.Len(t, parquetFiles(t, dir), 3)
+	e.Rotate()
+	assert.Len(t, parquetFiles(t, dir), 3, "rotating without reports shouldn't create a file")
+	e.Report(report("a", time.Now(), nil, nil))
+	e.Close()
+	e.Report(report("a", time.Now(), nil, nil))
+	e.Close()
+
+	files := parquetFiles(t, dir)
+	assert.Len(t, files, 4)
+	var rows []int64
+	for _, file := range files {
+		assert.Contains(t, filepath.Base(file), "test-")
+		rows = append(rows, readFile(t, file).meta[3].(int64))
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i] < rows[j] })
+	assert.Equal(t, []int64{1, 1, 2, 2}, rows)
+	tmp, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	assert.Empty(t, tmp)
+}
+
+func TestRotateInterval(t *testing.T) {
+	dir := t.TempDir()
+	e, err := opsparquet.New(opsparquet.Options{Dir: dir, RotateInterval: 50 * time.Millisecond})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer e.Close()
+	e.Report(report("a", time.Now(), nil, nil))
+	time.Sleep(200 * time.Millisecond)
+	assert.Len(t, parquetFiles(t, dir), 1)
+}
+
+func report(name string, start time.Time, failure error, ctx map[string]interface{}) *ops.Report {
+	return &ops.Report{
+		Name:     name,
+		ID:       name + "-id",
+		TraceID:  "trace",
+		Start:    start,
+		Duration: time.Second,
+		Failure:  failure,
+		Context:  ctx,
+	}
+}
+
+func parquetFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.parquet"))
+	assert.NoError(t, err)
+	return files
+}
+
+// file is a Parquet file as decoded by the test.
+type file struct {
+	data []byte
+	meta fields
+}
+
+func readFile(t *testing.T, name string) *file {
+	data, err := os.ReadFile(name)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if !assert.True(t, len(data) > 12) ||
+		!assert.Equal(t, "PAR1", string(data[:4])) ||
+		!assert.Equal(t, "PAR1", string(data[len(data)-4:])) {
+		t.FailNow()
+	}
+	length := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := data[len(data)-8-length : len(data)-8]
+	d := &decoder{b: footer}
+	meta := d.readStruct()
+	assert.Equal(t, len(footer), d.pos, "footer length")
+	return &file{data: data, meta: meta}
+}
+
+// strings returns the string values of the given column in all row groups,
+// skipping missing values.
+func (f *file) strings(t *testing.T, column int, maxDef int, repeated bool) []string {
+	var result []string
+	for _, group := range f.meta[4].([]interface{}) {
+		chunk := group.(fields)[1].([]interface{})[column].(fields)
+		meta := chunk[3].(fields)
+		d := &decoder{b: f.data[meta[9].(int64):]}
+		header := d.readStruct()
+		data := d.b[d.pos : d.pos+int(header[3].(int32))]
+		if meta[4].(int32) != 0 {
+			r, err := gzip.NewReader(bytes.NewReader(data))
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			data, _ = io.ReadAll(r)
+		}
+		numValues := int(header[5].(fields)[1].(int32))
+		if repeated {
+			data = data[4+binary.LittleEndian.Uint32(data):]
+		}
+		defined := numValues
+		if maxDef > 0 {
+			levels := decodeLevels(data[4:4+binary.LittleEndian.Uint32(data)], numValues)
+			data = data[4+binary.LittleEndian.Uint32(data):]
+			defined = 0
+			for _, level := range levels {
+				if level == maxDef {
+					defined++
+				}
+			}
+		}
+		for i := 0; i < defined; i++ {
+			n := binary.LittleEndian.Uint32(data)
+			result = append(result, string(data[4:4+n]))
+			data = data[4+n:]
+		}
+	}
+	return result
+}
+
+// decodeLevels decodes levels of width 1 using the RLE/bit-packing hybrid
+// encoding.
+func decodeLevels(b []byte, n int) []int {
+	var levels []int
+	for len(b) > 0 && len(levels) < n {
+		header, read := binary.Uvarint(b)
+		b = b[read:]
+		if header&1 == 0 {
+			for i := 0; i < int(header>>1); i++ {
+				levels = append(levels, int(b[0]))
+			}
+			b = b[1:]
+		} else {
+			for i := 0; i < int(header>>1)*8; i++ {
+				levels = append(levels, int(b[i/8]>>(i%8))&1)
+			}
+			b = b[header>>1:]
+		}
+	}
+	return levels[:n]
+}
+
+// fields are the fields of a Thrift struct by id.
+type fields map[int16]interface{}
+
+// decoder decodes the Thrift compact protocol.
+type decoder struct {
+	b   []byte
+	pos int
+}
+
+func (d *decoder) byte() byte {
+	b := d.b[d.pos]
+	d.pos++
+	return b
+}
+
+func (d *decoder) varint() uint64 {
+	v, n := binary.Uvarint(d.b[d.pos:])
+	d.pos += n
+	return v
+}
+
+func (d *decoder) zigzag() int64 {
+	v := d.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (d *decoder) readStruct() fields {
+	result := make(fields)
+	var id int16
+	for {
+		header := d.byte()
+		if header == 0 {
+			return result
+		}
+		if delta := header >> 4; delta != 0 {
+			id += int16(delta)
+		} else {
+			id = int16(d.zigzag())
+		}
+		result[id] = d.read(header & 0x0f)
+	}
+}
+
+func (d *decoder) read(typ byte) interface{} {
+	switch typ {
+	case 1, 2:
+		return typ == 1
+	case 5:
+		return int32(d.zigzag())
+	case 6:
+		return d.zigzag()
+	case 8:
+		n := int(d.varint())
+		d.pos += n
+		return d.b[d.pos-n : d.pos]
+	case 9:
+		header := d.byte()
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(d.varint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = d.read(header & 0x0f)
+		}
+		return list
+	case 12:
+		return d.readStruct()
+	}
+	panic("unsupported type")
+}
@@ -0,0 +1,385 @@
+package opsparquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math/bits"
+)
+
+// Parquet physical types.
+const (
+	typeBoolean   = 0
+	typeInt64     = 2
+	typeByteArray = 6
+)
+
+// Parquet repetition types.
+const (
+	required = 0
+	optional = 1
+	repeated = 2
+)
+
+// Parquet converted types.
+const (
+	convertedUTF8            = 0
+	convertedMap             = 1
+	convertedTimestampMicros = 10
+)
+
+// Other Parquet enums.
+const (
+	codecUncompressed = 0
+	codecGzip         = 2
+	encodingPlain     = 0
+	encodingRLE       = 3
+	pageData          = 0
+)
+
+const magic = "PAR1"
+
+// schemaElement is a node of the schema, which is written depth first.
+type schemaElement struct {
+	name        string
+	typ         int32 // -1 for groups
+	repetition  int32
+	converted   int32 // -1 for none
+	numChildren int32
+}
+
+// schema is the schema of the files, with the leaves in the order of
+// fileWriter's columns.
+var schema = []schemaElement{
+	{name: "schema", typ: -1, repetition: -1, converted: -1, numChildren: 10},
+	{name: "name", typ: typeByteArray, repetition: required, converted: convertedUTF8},
+	{name: "op_id", typ: typeByteArray, repetition: required, converted: convertedUTF8},
+	{name: "trace_id", typ: typeByteArray, repetition: required, converted: convertedUTF8},
+	{name: "parent_id", typ: typeByteArray, repetition: required, converted: convertedUTF8},
+	{name: "start", typ: typeInt64, repetition: required, converted: convertedTimestampMicros},
+	{name: "duration_ns", typ: typeInt64, repetition: required, converted: -1},
+	{name: "succeeded", typ: typeBoolean, repetition: required, converted: -1},
+	{name: "outcome", typ: typeByteArray, repetition: required, converted: convertedUTF8},
+	{name: "error", typ: typeByteArray, repetition: optional, converted: convertedUTF8},
+	{name: "context", typ: -1, repetition: required, converted: convertedMap, numChildren: 1},
+	{name: "key_value", typ: -1, repetition: repeated, converted: -1, numChildren: 2},
+	{name: "key", typ: typeByteArray, repetition: required, converted: convertedUTF8},
+	{name: "value", typ: typeByteArray, repetition: required, converted: convertedUTF8},
+}
+
+// column accumulates the values and levels of a leaf column for the current
+// row group, with values PLAIN encoded.
+type column struct {
+	path   []string
+	typ    int32
+	maxDef int
+	maxRep int
+	values []byte
+	bools  []bool
+	defs   []int
+	reps   []int
+	// count is the number of values, which is only used for columns without
+	// levels
+	count int
+}
+
+func (c *column) addBytes(v string) {
+	c.values = binary.LittleEndian.AppendUint32(c.values, uint32(len(v)))
+	c.values = append(c.values, v...)
+	c.count++
+}
+
+func (c *column) addInt64(v int64) {
+	c.values = binary.LittleEndian.AppendUint64(c.values, uint64(v))
+	c.count++
+}
+
+func (c *column) addBool(v bool) {
+	c.bools = append(c.bools, v)
+	c.count++
+}
+
+// addLevels records the levels of a value, or of a missing value if def is
+// below maxDef.
+func (c *column) addLevels(rep, def int) {
+	c.reps = append(c.reps, rep)
+	c.defs = append(c.defs, def)
+}
+
+// page returns the data of a data page holding the column's values.
+func (c *column) page() []byte {
+	var page []byte
+	if c.maxRep > 0 {
+		page = appendLevels(page, c.reps, c.maxRep)
+	}
+	if c.maxDef > 0 {
+		page = appendLevels(page, c.defs, c.maxDef)
+	}
+	if c.typ == typeBoolean {
+		packed := make([]byte, (len(c.bools)+7)/8)
+		for i, v := range c.bools {
+			if v {
+				packed[i/8] |= 1 << (i % 8)
+			}
+		}
+		return append(page, packed...)
+	}
+	return append(page, c.values...)
+}
+
+func (c *column) reset() {
+	c.values = c.values[:0]
+	c.bools = c.bools[:0]
+	c.defs = c.defs[:0]
+	c.reps = c.reps[:0]
+	c.count = 0
+}
+
+// appendLevels appends levels using the RLE/bit-packing hybrid encoding,
+// prefixed with their length, using only RLE runs.
+func appendLevels(b []byte, levels []int, maxLevel int) []byte {
+	width := (bits.Len(uint(maxLevel)) + 7) / 8
+	var encoded []byte
+	for i := 0; i < len(levels); {
+		j := i + 1
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		encoded = binary.AppendUvarint(encoded, uint64(j-i)<<1)
+		for k := 0; k < width; k++ {
+			encoded = append(encoded, byte(levels[i]>>(8*k)))
+		}
+		i = j
+	}
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(encoded)))
+	return append(b, encoded...)
+}
+
+type chunk struct {
+	offset           int64
+	numValues        int
+	uncompressedSize int64
+	compressedSize   int64
+}
+
+type rowGroup struct {
+	chunks  []chunk
+	numRows int
+}
+
+// fileWriter writes a Parquet file with one data page per column and row
+// group.
+type fileWriter struct {
+	w         io.Writer
+	offset    int64
+	compress  bool
+	columns   []*column
+	rows      int
+	rowGroups []rowGroup
+	err       error
+}
+
+// row is a report as written.
+type row struct {
+	name      string
+	id        string
+	traceID   string
+	parentID  string
+	start     int64
+	duration  int64
+	succeeded bool
+	outcome   string
+	failure   *string
+	context   [][2]string
+}
+
+func newFileWriter(w io.Writer, compress bool) *fileWriter {
+	leaf := func(typ int32, maxDef, maxRep int, path ...string) *column {
+		return &column{path: path, typ: typ, maxDef: maxDef, maxRep: maxRep}
+	}
+	fw := &fileWriter{
+		w:        w,
+		compress: compress,
+		columns: []*column{
+			leaf(typeByteArray, 0, 0, "name"),
+			leaf(typeByteArray, 0, 0, "op_id"),
+			leaf(typeByteArray, 0, 0, "trace_id"),
+			leaf(typeByteArray, 0, 0, "parent_id"),
+			leaf(typeInt64, 0, 0, "start"),
+			leaf(typeInt64, 0, 0, "duration_ns"),
+			leaf(typeBoolean, 0, 0, "succeeded"),
+			leaf(typeByteArray, 0, 0, "outcome"),
+			leaf(typeByteArray, 1, 0, "error"),
+			leaf(typeByteArray, 1, 1, "context", "key_value", "key"),
+			leaf(typeByteArray, 1, 1, "context", "key_value", "value"),
+		},
+	}
+	fw.write([]byte(magic))
+	return fw
+}
+
+func (fw *fileWriter) write(b []byte) {
+	if fw.err != nil {
+		return
+	}
+	n, err := fw.w.Write(b)
+	fw.offset += int64(n)
+	fw.err = err
+}
+
+func (fw *fileWriter) add(r *row) {
+	c := fw.columns
+	c[0].addBytes(r.name)
+	c[1].addBytes(r.id)
+	c[2].addBytes(r.traceID)
+	c[3].addBytes(r.parentID)
+	c[4].addInt64(r.start)
+	c[5].addInt64(r.duration)
+	c[6].addBool(r.succeeded)
+	c[7].addBytes(r.outcome)
+	if r.failure == nil {
+		c[8].addLevels(0, 0)
+	} else {
+		c[8].addLevels(0, 1)
+		c[8].addBytes(*r.failure)
+	}
+	if len(r.context) == 0 {
+		c[9].addLevels(0, 0)
+		c[10].addLevels(0, 0)
+	}
+	for i, kv := range r.context {
+		rep := 1
+		if i == 0 {
+			rep = 0
+		}
+		for j, col := range c[9:] {
+			col.addLevels(rep, 1)
+			col.addBytes(kv[j])
+		}
+	}
+	fw.rows++
+}
+
+// flushRowGroup writes the rows added since the last flush as a row group.
+func (fw *fileWriter) flushRowGroup() error {
+	if fw.rows == 0 {
+		return fw.err
+	}
+	group := rowGroup{numRows: fw.rows}
+	for _, c := range fw.columns {
+		data := c.page()
+		uncompressedSize := len(data)
+		if fw.compress {
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write(data)
+			gz.Close()
+			data = buf.Bytes()
+		}
+		numValues := c.count
+		if c.maxDef > 0 {
+			numValues = len(c.defs)
+		}
+		header := &thriftWriter{}
+		header.beginStruct(0)
+		header.i32(1, pageData)
+		header.i32(2, int32(uncompressedSize))
+		header.i32(3, int32(len(data)))
+		header.beginStruct(5)
+		header.i32(1, int32(numValues))
+		header.i32(2, encodingPlain)
+		header.i32(3, encodingRLE)
+		header.i32(4, encodingRLE)
+		header.endStruct()
+		header.endStruct()
+
+		group.chunks = append(group.chunks, chunk{
+			offset:           fw.offset,
+			numValues:        numValues,
+			uncompressedSize: int64(len(header.buf) + uncompressedSize),
+			compressedSize:   int64(len(header.buf) + len(data)),
+		})
+		fw.write(header.buf)
+		fw.write(data)
+		c.reset()
+	}
+	fw.rowGroups = append(fw.rowGroups, group)
+	fw.rows = 0
+	return fw.err
+}
+
+// close flushes the last row group and writes the footer. It doesn't close
+// the underlying writer.
+func (fw *fileWriter) close() error {
+	fw.flushRowGroup()
+	codec := int32(codecUncompressed)
+	if fw.compress {
+		codec = codecGzip
+	}
+
+	m := &thriftWriter{}
+	m.beginStruct(0)
+	m.i32(1, 1)
+	m.list(2, thriftStruct, len(schema))
+	for _, e := range schema {
+		m.beginStruct(0)
+		if e.typ >= 0 {
+			m.i32(1, e.typ)
+		}
+		if e.repetition >= 0 {
+			m.i32(3, e.repetition)
+		}
+		m.binary(4, e.name)
+		if e.numChildren > 0 {
+			m.i32(5, e.numChildren)
+		}
+		if e.converted >= 0 {
+			m.i32(6, e.converted)
+		}
+		m.endStruct()
+	}
+	numRows := 0
+	for _, group := range fw.rowGroups {
+		numRows += group.numRows
+	}
+	m.i64(3, int64(numRows))
+	m.list(4, thriftStruct, len(fw.rowGroups))
+	for _, group := range fw.rowGroups {
+		m.beginStruct(0)
+		m.list(1, thriftStruct, len(group.chunks))
+		var totalSize int64
+		for i, ch := range group.chunks {
+			c := fw.columns[i]
+			totalSize += ch.uncompressedSize
+			m.beginStruct(0)
+			m.i64(2, ch.offset)
+			m.beginStruct(3)
+			m.i32(1, c.typ)
+			m.list(2, thriftI32, 2)
+			m.element(encodingPlain)
+			m.element(encodingRLE)
+			m.list(3, thriftBinary, len(c.path))
+			for _, name := range c.path {
+				m.rawBinary(name)
+			}
+			m.i32(4, codec)
+			m.i64(5, int64(ch.numValues))
+			m.i64(6, ch.uncompressedSize)
+			m.i64(7, ch.compressedSize)
+			m.i64(9, ch.offset)
+			m.endStruct()
+			m.endStruct()
+		}
+		m.i64(2, totalSize)
+		m.i64(3, int64(group.numRows))
+		m.endStruct()
+	}
+	m.binary(6, "github.com/getlantern/ops/opsparquet")
+	m.endStruct()
+
+	fw.write(m.buf)
+	fw.write(binary.LittleEndian.AppendUint32(nil, uint32(len(m.buf))))
+	fw.write([]byte(magic))
+	return fw.err
+}
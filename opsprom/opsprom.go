@@ -0,0 +1,162 @@
+// Package opsprom exposes op durations as Prometheus histograms in the
+// OpenMetrics text format, attaching exemplars with the trace and op ids of
+// recent ops so that Grafana can link from a latency spike to example traces.
+package opsprom
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opsprom")
+}
+
+// DefaultBuckets are the default histogram bucket upper bounds, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+const metricName = "ops_duration_seconds"
+
+// Reporter aggregates op durations into the histogram ops_duration_seconds,
+// labeled by op and result (success or failure). Each bucket carries an
+// exemplar from the most recent op that fell into it.
+type Reporter struct {
+	buckets []float64
+	series  map[seriesKey]*series
+	mx      sync.Mutex
+}
+
+type seriesKey struct {
+	op     string
+	result string
+}
+
+type series struct {
+	counts    []uint64
+	exemplars []*exemplar
+	count     uint64
+	sum       float64
+}
+
+type exemplar struct {
+	traceID string
+	opID    string
+	value   float64
+	ts      time.Time
+}
+
+// New creates a Reporter using the given bucket upper bounds (in seconds), or
+// DefaultBuckets if none are given. Register it with
+// ops.RegisterStructuredReporter(reporter.Report) and serve it as an
+// http.Handler.
+func New(buckets ...float64) *Reporter {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+	return &Reporter{
+		buckets: append(sorted, math.Inf(1)),
+		series:  make(map[seriesKey]*series),
+	}
+}
+
+// Report observes the duration of the given report. Progress reports (see
+// ops.Report.InProgress) are ignored.
+func (r *Reporter) Report(report *ops.Report) {
+	if report.InProgress {
+		return
+	}
+	result := "success"
+	if !report.Succeeded() {
+		result = "failure"
+	}
+	key := seriesKey{report.Name, result}
+	value := report.Duration.Seconds()
+	ex := &exemplar{traceID: report.TraceID, opID: report.ID, value: value, ts: time.Now()}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	s := r.series[key]
+	if s == nil {
+		s = &series{counts: make([]uint64, len(r.buckets)), exemplars: make([]*exemplar, len(r.buckets))}
+		r.series[key] = s
+	}
+	i := sort.SearchFloat64s(r.buckets, value)
+	s.counts[i]++
+	if ex.traceID != "" {
+		s.exemplars[i] = ex
+	}
+	s.count++
+	s.sum += value
+}
+
+// ServeHTTP serves the collected metrics in the OpenMetrics text format, which
+// is required for exemplars.
+func (r *Reporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// WriteTo writes the collected metrics to w in the OpenMetrics text format.
+func (r *Reporter) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# TYPE %s histogram\n", metricName)
+	fmt.Fprintf(&b, "# HELP %s Duration of ops.\n", metricName)
+
+	r.mx.Lock()
+	keys := make([]seriesKey, 0, len(r.series))
+	for key := range r.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].op != keys[j].op {
+			return keys[i].op < keys[j].op
+		}
+		return keys[i].result < keys[j].result
+	})
+	for _, key := range keys {
+		s := r.series[key]
+		labels := fmt.Sprintf(`op="%s",result="%s"`, escape(key.op), escape(key.result))
+		var cumulative uint64
+		for i, le := range r.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(&b, "%s_bucket{%s,le=\"%s\"} %d", metricName, labels, formatFloat(le), cumulative)
+			if ex := s.exemplars[i]; ex != nil {
+				fmt.Fprintf(&b, " # {trace_id=\"%s\",op_id=\"%s\"} %s %s",
+					escape(ex.traceID), escape(ex.opID), formatFloat(ex.value),
+					strconv.FormatFloat(float64(ex.ts.UnixNano())/1e9, 'f', 3, 64))
+			}
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s_sum{%s} %s\n", metricName, labels, formatFloat(s.sum))
+		fmt.Fprintf(&b, "%s_count{%s} %d\n", metricName, labels, s.count)
+	}
+	r.mx.Unlock()
+
+	b.WriteString("# EOF\n")
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
@@ -0,0 +1,35 @@
+package opsprom
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExemplars(t *testing.T) {
+	r := New(0.01, 0.1)
+	r.Report(&ops.Report{Name: "dial", TraceID: "t1", ID: "o1", Duration: 5 * time.Millisecond})
+	r.Report(&ops.Report{Name: "dial", TraceID: "t2", ID: "o2", Duration: 50 * time.Millisecond})
+	r.Report(&ops.Report{Name: "dial", TraceID: "t3", ID: "o3", Duration: time.Second, Failure: errors.New("timeout")})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/openmetrics-text")
+	body, _ := io.ReadAll(w.Body)
+	lines := strings.Split(string(body), "\n")
+
+	assert.Equal(t, "# TYPE ops_duration_seconds histogram", lines[0])
+	assert.Contains(t, lines, `ops_duration_seconds_bucket{op="dial",result="failure",le="0.01"} 0`)
+	assert.Contains(t, lines, `ops_duration_seconds_count{op="dial",result="failure"} 1`)
+	assert.Contains(t, lines, `ops_duration_seconds_count{op="dial",result="success"} 2`)
+	assert.Contains(t, string(body), `ops_duration_seconds_bucket{op="dial",result="success",le="0.01"} 1 # {trace_id="t1",op_id="o1"} 0.005 `)
+	assert.Contains(t, string(body), `ops_duration_seconds_bucket{op="dial",result="success",le="0.1"} 2 # {trace_id="t2",op_id="o2"} 0.05 `)
+	assert.Contains(t, string(body), `ops_duration_seconds_bucket{op="dial",result="failure",le="+Inf"} 1 # {trace_id="t3",op_id="o3"} 1 `)
+	assert.Equal(t, "# EOF", lines[len(lines)-2])
+}
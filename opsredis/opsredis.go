@@ -0,0 +1,147 @@
+// Package opsredis provides a Sampler that coordinates through Redis, so that
+// a fleet of identical processes delivers at most a global budget of reports
+// per interval in aggregate, rather than per-process limits multiplying with
+// the size of the fleet.
+//
+// Processes count the reports they keep in a shared Redis counter per
+// interval. To avoid a round trip per report, each process leases a few
+// tokens at a time with INCRBY and keeps reports until its lease runs out.
+//
+// opsredis doesn't depend on a Redis client. Pass it a function that
+// increments a key and sets its expiry, for example with
+// github.com/redis/go-redis:
+//
+//	rdb := redis.NewClient(&redis.Options{Addr: "localhost:6379"})
+//	sampler := opsredis.New(opsredis.Options{
+//		Budget: 1000,
+//		IncrBy: func(key string, n int64, ttl time.Duration) (int64, error) {
+//			ctx := context.Background()
+//			pipe := rdb.TxPipeline()
+//			incr := pipe.IncrBy(ctx, key, n)
+//			pipe.Expire(ctx, key, ttl)
+//			_, err := pipe.Exec(ctx)
+//			return incr.Val(), err
+//		},
+//	})
+//	ops.SetSampler(sampler.Sample)
+package opsredis
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opsredis")
+}
+
+// Options configures a Sampler. Zero values use the defaults noted on each
+// field.
+type Options struct {
+	// IncrBy increments key by n, sets it to expire after ttl and returns its
+	// new value.
+	IncrBy func(key string, n int64, ttl time.Duration) (int64, error)
+
+	// Key prefixes the keys of the counters, which continue with the number of
+	// the interval (default "ops:sample"). Services sharing a Redis should use
+	// different keys.
+	Key string
+
+	// Budget is how many reports are kept per Interval across all processes.
+	Budget int64
+
+	// Interval is the interval that the Budget applies to (default 1 second).
+	Interval time.Duration
+
+	// Lease is how many tokens a process takes from the budget at a time
+	// (default 1% of the Budget, at least 1). Larger leases mean fewer round
+	// trips to Redis, but tokens left unused in a lease at the end of the
+	// interval are lost to the other processes.
+	Lease int64
+
+	// Fallback decides which reports are kept while Redis can't be reached
+	// (default all).
+	Fallback ops.Sampler
+}
+
+// Sampler keeps reports within a budget shared through Redis.
+type Sampler struct {
+	opts   Options
+	errors int64
+
+	mx        sync.Mutex
+	interval  int64
+	tokens    int64
+	exhausted bool
+}
+
+// New creates a Sampler with the given options. Use it with
+// ops.SetSampler(sampler.Sample).
+func New(opts Options) *Sampler {
+	if opts.Key == "" {
+		opts.Key = "ops:sample"
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Lease <= 0 {
+		opts.Lease = opts.Budget / 100
+		if opts.Lease < 1 {
+			opts.Lease = 1
+		}
+	}
+	if opts.Fallback == nil {
+		opts.Fallback = func(report *ops.Report) bool { return true }
+	}
+	return &Sampler{opts: opts}
+}
+
+// Sample is an ops.Sampler that keeps the report if the budget of the current
+// interval isn't exhausted. It blocks while leasing tokens from Redis.
+func (s *Sampler) Sample(report *ops.Report) bool {
+	interval := time.Now().UnixNano() / int64(s.opts.Interval)
+	s.mx.Lock()
+	if interval != s.interval {
+		s.interval = interval
+		s.tokens = 0
+		s.exhausted = false
+	}
+	if s.tokens > 0 {
+		s.tokens--
+		s.mx.Unlock()
+		return true
+	}
+	if s.exhausted || s.opts.Budget <= 0 {
+		s.mx.Unlock()
+		return false
+	}
+	key := fmt.Sprintf("%v:%d", s.opts.Key, interval)
+	total, err := s.opts.IncrBy(key, s.opts.Lease, 2*s.opts.Interval)
+	if err != nil {
+		s.mx.Unlock()
+		atomic.AddInt64(&s.errors, 1)
+		return s.opts.Fallback(report)
+	}
+	granted := s.opts.Lease
+	if total >= s.opts.Budget {
+		// Only part of the lease, if any, was left in the budget
+		granted -= total - s.opts.Budget
+		s.exhausted = true
+	}
+	keep := granted > 0
+	if keep {
+		s.tokens = granted - 1
+	}
+	s.mx.Unlock()
+	return keep
+}
+
+// Errors returns the number of failed round trips to Redis, for which the
+// Fallback was used.
+func (s *Sampler) Errors() int64 {
+	return atomic.LoadInt64(&s.errors)
+}
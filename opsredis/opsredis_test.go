@@ -0,0 +1,95 @@
+package opsredis_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opsredis"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis is a shared set of counters.
+type fakeRedis struct {
+	mx       sync.Mutex
+	counters map[string]int64
+	calls    int
+	down     bool
+}
+
+func (r *fakeRedis) IncrBy(key string, n int64, ttl time.Duration) (int64, error) {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.calls++
+	if r.down {
+		return 0, errors.New("connection refused")
+	}
+	r.counters[key] += n
+	return r.counters[key], nil
+}
+
+func TestGlobalBudget(t *testing.T) {
+	redis := &fakeRedis{counters: make(map[string]int64)}
+	var kept int64
+	var mx sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		s := opsredis.New(opsredis.Options{
+			IncrBy:   redis.IncrBy,
+			Key:      "test",
+			Budget:   100,
+			Lease:    7,
+			Interval: time.Hour,
+		})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if s.Sample(&ops.Report{Name: "op"}) {
+					mx.Lock()
+					kept++
+					mx.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 100, kept, "all processes together should keep exactly the budget")
+	assert.True(t, redis.calls < 30, "tokens should have been leased in blocks, not %d", redis.calls)
+	for key := range redis.counters {
+		assert.True(t, strings.HasPrefix(key, "test:"), key)
+	}
+}
+
+func TestNextInterval(t *testing.T) {
+	redis := &fakeRedis{counters: make(map[string]int64)}
+	s := opsredis.New(opsredis.Options{IncrBy: redis.IncrBy, Budget: 2, Interval: 50 * time.Millisecond})
+	// Start at the beginning of an interval
+	time.Sleep(50*time.Millisecond - time.Duration(time.Now().UnixNano()%int64(50*time.Millisecond)))
+	assert.True(t, s.Sample(&ops.Report{}))
+	assert.True(t, s.Sample(&ops.Report{}))
+	assert.False(t, s.Sample(&ops.Report{}))
+	calls := redis.calls
+	assert.False(t, s.Sample(&ops.Report{}))
+	assert.Equal(t, calls, redis.calls, "exhausted budget shouldn't need Redis")
+	time.Sleep(60 * time.Millisecond)
+	assert.True(t, s.Sample(&ops.Report{}), "next interval should have a new budget")
+}
+
+func TestFallback(t *testing.T) {
+	redis := &fakeRedis{counters: make(map[string]int64), down: true}
+	s := opsredis.New(opsredis.Options{
+		IncrBy:   redis.IncrBy,
+		Budget:   10,
+		Fallback: func(report *ops.Report) bool { return report.Failure != nil },
+	})
+	assert.False(t, s.Sample(&ops.Report{}))
+	assert.True(t, s.Sample(&ops.Report{Failure: errors.New("broken")}))
+	assert.EqualValues(t, 2, s.Errors())
+
+	redis.down = false
+	assert.True(t, s.Sample(&ops.Report{}))
+}
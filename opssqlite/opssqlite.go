@@ -0,0 +1,328 @@
+// Package opssqlite provides a reporter that stores reports in a local SQLite
+// database, giving desktop clients a durable, queryable history of operations
+// for support diagnostics.
+//
+// The package works with any SQLite driver for database/sql, for example
+// modernc.org/sqlite or github.com/mattn/go-sqlite3; open the database with
+// the driver of your choice and pass it to New.
+//
+// opssqlite is a separate Go module, so that programs using ops without SQLite
+// don't depend on a driver (its tests use modernc.org/sqlite).
+package opssqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opssqlite")
+}
+
+const schema = `
+CREATE TABLE IF NOT EXISTS ops_reports (
+	id        INTEGER PRIMARY KEY AUTOINCREMENT,
+	name      TEXT NOT NULL,
+	op_id     TEXT NOT NULL,
+	trace_id  TEXT NOT NULL,
+	parent_id TEXT NOT NULL,
+	start     INTEGER NOT NULL,
+	duration  INTEGER NOT NULL,
+	succeeded INTEGER NOT NULL,
+	error     TEXT NOT NULL,
+	context   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS ops_reports_name ON ops_reports (name, start);
+CREATE INDEX IF NOT EXISTS ops_reports_start ON ops_reports (start);
+CREATE INDEX IF NOT EXISTS ops_reports_succeeded ON ops_reports (succeeded, start);
+`
+
+const (
+	queueSize = 1000
+	batchSize = 100
+)
+
+// PrunePolicy limits how much history a Store keeps. Zero values mean no
+// limit.
+type PrunePolicy struct {
+	// MaxAge is how long reports are kept, measured from their start.
+	MaxAge time.Duration
+
+	// MaxRows is the maximum number of reports kept.
+	MaxRows int
+}
+
+// Record is a stored report.
+type Record struct {
+	Name      string
+	ID        string
+	TraceID   string
+	ParentID  string
+	Start     time.Time
+	Duration  time.Duration
+	Succeeded bool
+	Error     string
+	Context   map[string]interface{}
+}
+
+// Query selects stored reports. Zero values don't restrict the results.
+type Query struct {
+	Name         string
+	Since        time.Time
+	Until        time.Time
+	OnlyFailures bool
+
+	// Limit is the maximum number of records returned (default 100).
+	Limit int
+}
+
+// Store is a reporter that writes reports to SQLite in the background,
+// batching them into transactions.
+type Store struct {
+	db       *sql.DB
+	policy   PrunePolicy
+	queue    chan interface{}
+	done     chan interface{}
+	closed   bool
+	closedMx sync.RWMutex
+	errors   int64
+	lastErr  atomic.Value
+}
+
+// New creates the reports table in db (if necessary) and returns a Store that
+// writes to it, pruning according to policy after every batch of writes.
+// Register it with ops.RegisterStructuredReporter(store.Report).
+func New(db *sql.DB, policy PrunePolicy) (*Store, error) {
+	if _, err := db.Exec(schema); err != nil {
+		return nil, err
+	}
+	s := &Store{
+		db:     db,
+		policy: policy,
+		queue:  make(chan interface{}, queueSize),
+		done:   make(chan interface{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Report queues the report for writing. Reports are dropped if the queue is
+// full or the Store is closed.
+func (s *Store) Report(report *ops.Report) {
+	s.closedMx.RLock()
+	defer s.closedMx.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- report.Retain():
+	default:
+	}
+}
+
+// Flush waits until all queued reports have been written.
+func (s *Store) Flush() {
+	flushed := make(chan interface{})
+	s.closedMx.RLock()
+	if s.closed {
+		s.closedMx.RUnlock()
+		return
+	}
+	s.queue <- flushed
+	s.closedMx.RUnlock()
+	<-flushed
+}
+
+// Close writes any queued reports and stops the Store. It doesn't close the
+// database.
+func (s *Store) Close() {
+	s.closedMx.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.closedMx.Unlock()
+	<-s.done
+}
+
+func (s *Store) run() {
+	defer close(s.done)
+	batch := make([]*ops.Report, 0, batchSize)
+	var flushes []chan interface{}
+	for item := range s.queue {
+		batch, flushes = add(batch, flushes, item)
+		// Batch up whatever else is already waiting
+	drain:
+		for len(batch) < batchSize {
+			select {
+			case item, ok := <-s.queue:
+				if !ok {
+					break drain
+				}
+				batch, flushes = add(batch, flushes, item)
+			default:
+				break drain
+			}
+		}
+		if len(batch) > 0 {
+			if err := s.write(batch); err != nil {
+				s.recordError(fmt.Errorf("unable to write %d reports: %v", len(batch), err))
+			}
+			if _, err := s.Prune(s.policy); err != nil {
+				s.recordError(fmt.Errorf("unable to prune reports: %v", err))
+			}
+		}
+		for _, flushed := range flushes {
+			close(flushed)
+		}
+		batch, flushes = batch[:0], flushes[:0]
+	}
+}
+
+func (s *Store) recordError(err error) {
+	atomic.AddInt64(&s.errors, 1)
+	s.lastErr.Store(err)
+}
+
+// Errors returns the number of failed background writes and prunes since New.
+// Reports in a batch that failed to be written are lost.
+func (s *Store) Errors() int64 {
+	return atomic.LoadInt64(&s.errors)
+}
+
+// LastError returns the error of the latest failed background write or prune,
+// or nil if there hasn't been one.
+func (s *Store) LastError() error {
+	err, _ := s.lastErr.Load().(error)
+	return err
+}
+
+func add(batch []*ops.Report, flushes []chan interface{}, item interface{}) ([]*ops.Report, []chan interface{}) {
+	switch t := item.(type) {
+	case *ops.Report:
+		batch = append(batch, t)
+	case chan interface{}:
+		flushes = append(flushes, t)
+	}
+	return batch, flushes
+}
+
+func (s *Store) write(batch []*ops.Report) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`INSERT INTO ops_reports
+		(name, op_id, trace_id, parent_id, start, duration, succeeded, error, context)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, report := range batch {
+		var errorText string
+		if report.Failure != nil {
+			errorText = ops.ErrorText(report.Failure)
+		}
+		ctx, err := json.Marshal(report.Context)
+		if err != nil {
+			ctx = []byte("{}")
+		}
+		succeeded := 0
+		if report.Succeeded() {
+			succeeded = 1
+		}
+		_, err = stmt.Exec(report.Name, report.ID, report.TraceID, report.ParentID,
+			report.Start.UnixNano(), int64(report.Duration), succeeded, errorText, string(ctx))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Query returns the stored reports matching q, most recent first.
+func (s *Store) Query(q Query) ([]*Record, error) {
+	var conditions []string
+	var args []interface{}
+	if q.Name != "" {
+		conditions = append(conditions, "name = ?")
+		args = append(args, q.Name)
+	}
+	if !q.Since.IsZero() {
+		conditions = append(conditions, "start >= ?")
+		args = append(args, q.Since.UnixNano())
+	}
+	if !q.Until.IsZero() {
+		conditions = append(conditions, "start < ?")
+		args = append(args, q.Until.UnixNano())
+	}
+	if q.OnlyFailures {
+		conditions = append(conditions, "succeeded = 0")
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	query := "SELECT name, op_id, trace_id, parent_id, start, duration, succeeded, error, context FROM ops_reports"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY start DESC, id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []*Record
+	for rows.Next() {
+		r := &Record{}
+		var start, duration int64
+		var succeeded int
+		var ctx string
+		if err := rows.Scan(&r.Name, &r.ID, &r.TraceID, &r.ParentID, &start, &duration, &succeeded, &r.Error, &ctx); err != nil {
+			return nil, err
+		}
+		r.Start = time.Unix(0, start)
+		r.Duration = time.Duration(duration)
+		r.Succeeded = succeeded == 1
+		json.Unmarshal([]byte(ctx), &r.Context)
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+// Prune deletes reports beyond the limits of the given policy, returning the
+// number of reports deleted.
+func (s *Store) Prune(policy PrunePolicy) (int64, error) {
+	var deleted int64
+	if policy.MaxAge > 0 {
+		result, err := s.db.Exec("DELETE FROM ops_reports WHERE start < ?", time.Now().Add(-policy.MaxAge).UnixNano())
+		if err != nil {
+			return deleted, err
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+	}
+	if policy.MaxRows > 0 {
+		result, err := s.db.Exec(`DELETE FROM ops_reports WHERE id <=
+			(SELECT id FROM ops_reports ORDER BY id DESC LIMIT 1 OFFSET ?)`, policy.MaxRows)
+		if err != nil {
+			return deleted, err
+		}
+		n, _ := result.RowsAffected()
+		deleted += n
+	}
+	return deleted, nil
+}
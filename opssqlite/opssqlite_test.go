@@ -0,0 +1,93 @@
+package opssqlite_test
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opssqlite"
+	"github.com/stretchr/testify/assert"
+
+	_ "modernc.org/sqlite"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "ops.db"))
+	if err == nil {
+		err = db.Ping()
+	}
+	if err != nil {
+		t.Fatalf("unable to open database: %v", err)
+	}
+	return db
+}
+
+func TestStore(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	store, err := opssqlite.New(db, opssqlite.PrunePolicy{MaxRows: 3})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer store.Close()
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 4; i++ {
+		store.Report(&ops.Report{
+			Name:     "dial",
+			ID:       "id",
+			Start:    start.Add(time.Duration(i) * time.Second),
+			Duration: time.Millisecond,
+			Context:  map[string]interface{}{"i": i},
+		})
+	}
+	store.Report(&ops.Report{Name: "dial", Start: start.Add(5 * time.Second), Failure: errors.New("refused")})
+	store.Report(&ops.Report{Name: "fetch", Start: start.Add(6 * time.Second)})
+	store.Flush()
+
+	all, err := store.Query(opssqlite.Query{})
+	if assert.NoError(t, err) && assert.Len(t, all, 3, "should have pruned to 3 rows") {
+		assert.Equal(t, "fetch", all[0].Name)
+	}
+
+	dials, err := store.Query(opssqlite.Query{Name: "dial"})
+	if assert.NoError(t, err) && assert.Len(t, dials, 2) {
+		assert.Equal(t, "refused", dials[0].Error)
+		assert.False(t, dials[0].Succeeded)
+		assert.True(t, dials[1].Succeeded)
+		assert.EqualValues(t, 3, dials[1].Context["i"])
+		assert.Equal(t, time.Millisecond, dials[1].Duration)
+	}
+
+	failures, err := store.Query(opssqlite.Query{OnlyFailures: true, Since: start.Add(time.Second)})
+	if assert.NoError(t, err) {
+		assert.Len(t, failures, 1)
+	}
+
+	deleted, err := store.Prune(opssqlite.PrunePolicy{MaxAge: time.Since(start) - 5500*time.Millisecond})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, deleted)
+}
+
+func TestStoreWriteErrors(t *testing.T) {
+	db := openDB(t)
+	defer db.Close()
+	store, err := opssqlite.New(db, opssqlite.PrunePolicy{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer store.Close()
+	assert.NoError(t, store.LastError())
+
+	_, err = db.Exec("DROP TABLE ops_reports")
+	if !assert.NoError(t, err) {
+		return
+	}
+	store.Report(&ops.Report{Name: "dial", Start: time.Now()})
+	store.Flush()
+	assert.EqualValues(t, 1, store.Errors())
+	assert.Contains(t, store.LastError().Error(), "unable to write 1 reports")
+}
@@ -0,0 +1,227 @@
+// Package opstest provides a simulated reporter backend for testing exporters
+// and custom reporters, with configurable latency, errors, outages and
+// capacity. Errors are drawn from a seeded source, so a sequence of calls
+// always has the same outcome.
+//
+// A Backend is called directly from the hooks of the exporters that take them,
+// for example:
+//
+//	backend := opstest.New(opstest.Options{Script: []error{opstest.ErrFailed}})
+//	publisher := opsnats.New(opsnats.Options{
+//		Publish: func(subject string, data []byte) error { return backend.Call(data) },
+//	})
+//
+// or served over HTTP with httptest.NewServer(backend) for exporters that post
+// to a URL.
+package opstest
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+var (
+	// ErrFailed is returned for calls that fail, as chosen by the Script or
+	// ErrorRate.
+	ErrFailed = errors.New("opstest: call failed")
+
+	// ErrDown is returned for calls while the Backend is down.
+	ErrDown = errors.New("opstest: backend down")
+
+	// ErrOverloaded is returned for calls beyond the Backend's MaxInFlight.
+	ErrOverloaded = errors.New("opstest: too many calls in flight")
+
+	// ErrTooLarge is returned for calls with more items than MaxBatch.
+	ErrTooLarge = errors.New("opstest: too many items")
+)
+
+// Options configures a Backend. Zero values use the defaults noted on each
+// field.
+type Options struct {
+	// Latency is how long each call takes (default none).
+	Latency time.Duration
+
+	// Script is the outcomes of the first calls that aren't rejected for the
+	// Backend being down or over its limits, in order, nil meaning success.
+	// Later calls fail according to the ErrorRate.
+	Script []error
+
+	// ErrorRate is the fraction of calls after the Script that fail with
+	// ErrFailed (default none).
+	ErrorRate float64
+
+	// Seed seeds the source that decides which calls fail at the ErrorRate.
+	Seed int64
+
+	// MaxInFlight is how many calls can be in flight at once before calls are
+	// rejected with ErrOverloaded (default no limit).
+	MaxInFlight int
+
+	// MaxBatch is how many items a call can have before it's rejected with
+	// ErrTooLarge (default no limit).
+	MaxBatch int
+}
+
+// Stats counts the calls to a Backend.
+type Stats struct {
+	// Calls counts all calls.
+	Calls int
+
+	// Succeeded counts the calls that succeeded.
+	Succeeded int
+
+	// Failed counts the calls that failed, for any reason.
+	Failed int
+
+	// Items counts the items received by calls that succeeded.
+	Items int
+
+	// MaxInFlight is the most calls that were in flight at once.
+	MaxInFlight int
+
+	// MaxBatch is the most items received by one call.
+	MaxBatch int
+}
+
+// Backend is a simulated reporter backend, safe for concurrent use.
+type Backend struct {
+	opts     Options
+	mx       sync.Mutex
+	rand     *rand.Rand
+	down     bool
+	inFlight int
+	// decided counts the calls that weren't rejected right away
+	decided  int
+	stats    Stats
+	received [][]byte
+}
+
+// New creates a Backend with the given options.
+func New(opts Options) *Backend {
+	return &Backend{
+		opts: opts,
+		rand: rand.New(rand.NewSource(opts.Seed)),
+	}
+}
+
+// Call simulates a call to the backend delivering the given items, waiting for
+// the Latency and returning nil if the call succeeded. Items of calls that
+// succeed are recorded. Outcomes are decided in the order of calls, so
+// concurrent calls get the same outcomes as the same calls made one at a time.
+func (b *Backend) Call(items ...[]byte) error {
+	outcome, err := b.begin(len(items))
+	if err != nil {
+		return err
+	}
+	if b.opts.Latency > 0 {
+		time.Sleep(b.opts.Latency)
+	}
+	return b.end(items, outcome)
+}
+
+// begin decides the outcome of a call with n items, returning an error if it
+// was rejected right away or otherwise counting it as in flight and returning
+// the outcome to report once it ends.
+func (b *Backend) begin(n int) (outcome error, err error) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	b.stats.Calls++
+	switch {
+	case b.down:
+		err = ErrDown
+	case b.opts.MaxBatch > 0 && n > b.opts.MaxBatch:
+		err = ErrTooLarge
+	case b.opts.MaxInFlight > 0 && b.inFlight >= b.opts.MaxInFlight:
+		err = ErrOverloaded
+	}
+	if err != nil {
+		b.stats.Failed++
+		return nil, err
+	}
+	b.inFlight++
+	if b.inFlight > b.stats.MaxInFlight {
+		b.stats.MaxInFlight = b.inFlight
+	}
+	call := b.decided
+	b.decided++
+	if call < len(b.opts.Script) {
+		outcome = b.opts.Script[call]
+	} else if b.opts.ErrorRate > 0 && b.rand.Float64() < b.opts.ErrorRate {
+		outcome = ErrFailed
+	}
+	return outcome, nil
+}
+
+func (b *Backend) end(items [][]byte, err error) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	b.inFlight--
+	if err != nil {
+		b.stats.Failed++
+		return err
+	}
+	b.stats.Succeeded++
+	b.stats.Items += len(items)
+	if len(items) > b.stats.MaxBatch {
+		b.stats.MaxBatch = len(items)
+	}
+	b.received = append(b.received, items...)
+	return nil
+}
+
+// Report is an ops.StructuredReporter that calls the backend with the report,
+// for testing code that wraps reporters. The items it records are the JSON of
+// the reports.
+func (b *Backend) Report(report *ops.Report) {
+	item, _ := report.MarshalJSON()
+	b.Call(item)
+}
+
+// ServeHTTP calls the backend with the body of the request as its only item,
+// responding with 200 if the call succeeded, 413 for ErrTooLarge, 429 for
+// ErrOverloaded and 503 otherwise.
+func (b *Backend) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	switch b.Call(body) {
+	case nil:
+		resp.WriteHeader(http.StatusOK)
+	case ErrTooLarge:
+		resp.WriteHeader(http.StatusRequestEntityTooLarge)
+	case ErrOverloaded:
+		resp.WriteHeader(http.StatusTooManyRequests)
+	default:
+		resp.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// SetDown simulates an outage, failing all calls with ErrDown until it's
+// called again with false.
+func (b *Backend) SetDown(down bool) {
+	b.mx.Lock()
+	b.down = down
+	b.mx.Unlock()
+}
+
+// Stats returns the current statistics of the backend.
+func (b *Backend) Stats() Stats {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return b.stats
+}
+
+// Received returns the items received by calls that succeeded, in order.
+func (b *Backend) Received() [][]byte {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	return append([][]byte(nil), b.received...)
+}
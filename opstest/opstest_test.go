@@ -0,0 +1,128 @@
+package opstest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opskafka"
+	"github.com/getlantern/ops/opstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScript(t *testing.T) {
+	b := opstest.New(opstest.Options{Script: []error{opstest.ErrFailed, nil, opstest.ErrFailed}})
+	assert.Equal(t, opstest.ErrFailed, b.Call([]byte("a")))
+	assert.NoError(t, b.Call([]byte("b")))
+	b.SetDown(true)
+	assert.Equal(t, opstest.ErrDown, b.Call([]byte("c")))
+	b.SetDown(false)
+	assert.Equal(t, opstest.ErrFailed, b.Call([]byte("c")), "calls while down shouldn't use up the script")
+	assert.NoError(t, b.Call([]byte("c"), []byte("d")))
+	assert.Equal(t, [][]byte{[]byte("b"), []byte("c"), []byte("d")}, b.Received())
+	assert.Equal(t, opstest.Stats{Calls: 5, Succeeded: 2, Failed: 3, Items: 3, MaxInFlight: 1, MaxBatch: 2}, b.Stats())
+}
+
+func TestErrorRateIsDeterministic(t *testing.T) {
+	outcomes := func() []bool {
+		b := opstest.New(opstest.Options{ErrorRate: 0.3, Seed: 42})
+		var result []bool
+		for i := 0; i < 1000; i++ {
+			result = append(result, b.Call() == nil)
+		}
+		return result
+	}
+	first := outcomes()
+	assert.Equal(t, first, outcomes())
+	failed := 0
+	for _, succeeded := range first {
+		if !succeeded {
+			failed++
+		}
+	}
+	assert.InDelta(t, 300, failed, 50)
+}
+
+func TestLimits(t *testing.T) {
+	b := opstest.New(opstest.Options{Latency: 50 * time.Millisecond, MaxInFlight: 2, MaxBatch: 3})
+	assert.Equal(t, opstest.ErrTooLarge, b.Call(nil, nil, nil, nil))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- b.Call(nil)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	overloaded := 0
+	for err := range errs {
+		if err == opstest.ErrOverloaded {
+			overloaded++
+		}
+	}
+	assert.Equal(t, 2, overloaded)
+	assert.Equal(t, 2, b.Stats().MaxInFlight)
+}
+
+func TestServeHTTP(t *testing.T) {
+	b := opstest.New(opstest.Options{Script: []error{nil, opstest.ErrFailed}})
+	server := httptest.NewServer(b)
+	defer server.Close()
+	for _, expected := range []int{http.StatusOK, http.StatusServiceUnavailable} {
+		resp, err := http.Post(server.URL, "text/plain", strings.NewReader("report"))
+		if assert.NoError(t, err) {
+			resp.Body.Close()
+			assert.Equal(t, expected, resp.StatusCode)
+		}
+	}
+	assert.Equal(t, [][]byte{[]byte("report")}, b.Received())
+}
+
+func TestReport(t *testing.T) {
+	b := opstest.New(opstest.Options{})
+	b.Report(&ops.Report{SchemaVersion: ops.SchemaVersion, Name: "dial", Start: time.Now()})
+	if received := b.Received(); assert.Len(t, received, 1) {
+		var decoded ops.Report
+		if assert.NoError(t, json.Unmarshal(received[0], &decoded)) {
+			assert.Equal(t, "dial", decoded.Name)
+		}
+	}
+}
+
+func TestExporterOutage(t *testing.T) {
+	b := opstest.New(opstest.Options{MaxBatch: 5})
+	p := opskafka.New(opskafka.Options{
+		BatchSize: 5,
+		Retries:   -1,
+		Produce: func(msgs []opskafka.Message) error {
+			items := make([][]byte, 0, len(msgs))
+			for _, msg := range msgs {
+				items = append(items, msg.Value)
+			}
+			return b.Call(items...)
+		},
+	})
+	for i := 0; i < 12; i++ {
+		p.Report(&ops.Report{Name: "a"})
+	}
+	p.Flush()
+	b.SetDown(true)
+	for i := 0; i < 3; i++ {
+		p.Report(&ops.Report{Name: "a"})
+	}
+	p.Close()
+
+	stats := b.Stats()
+	assert.Equal(t, 12, stats.Items)
+	assert.Equal(t, 5, stats.MaxBatch, "batches should respect the batch size")
+	assert.EqualValues(t, 3, p.Dropped(), "reports produced during the outage should be dropped")
+}
@@ -0,0 +1,83 @@
+// Package opstls instruments TLS handshakes, recording their outcome in an op.
+package opstls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opstls")
+}
+
+// Client is like tls.Client but performs the handshake immediately, recording
+// it in the given op as with Handshake.
+func Client(ctx context.Context, op ops.Op, conn net.Conn, config *tls.Config) (*tls.Conn, error) {
+	tlsConn := tls.Client(conn, config)
+	return tlsConn, Handshake(ctx, op, tlsConn)
+}
+
+// Server is like tls.Server but performs the handshake immediately, recording
+// it in the given op as with Handshake.
+func Server(ctx context.Context, op ops.Op, conn net.Conn, config *tls.Config) (*tls.Conn, error) {
+	tlsConn := tls.Server(conn, config)
+	return tlsConn, Handshake(ctx, op, tlsConn)
+}
+
+// Handshake runs the handshake on the given conn and records
+// tls_handshake_duration in the op. On success it also records tls_version,
+// tls_cipher_suite, tls_alpn, tls_sni and tls_resumed. On failure it records
+// tls_error_class (see Classify) and fails the op.
+func Handshake(ctx context.Context, op ops.Op, conn *tls.Conn) error {
+	start := time.Now()
+	err := conn.HandshakeContext(ctx)
+	op.Set("tls_handshake_duration", time.Since(start))
+	if err != nil {
+		op.Set("tls_error_class", Classify(err))
+		return op.FailIf(err)
+	}
+
+	state := conn.ConnectionState()
+	op.Set("tls_version", tls.VersionName(state.Version)).
+		Set("tls_cipher_suite", tls.CipherSuiteName(state.CipherSuite)).
+		Set("tls_resumed", state.DidResume)
+	if state.NegotiatedProtocol != "" {
+		op.Set("tls_alpn", state.NegotiatedProtocol)
+	}
+	if state.ServerName != "" {
+		op.Set("tls_sni", state.ServerName)
+	}
+	return nil
+}
+
+// Classify classifies a handshake error as one of certificate, alert, timeout,
+// eof or other.
+func Classify(err error) string {
+	var (
+		verificationErr *tls.CertificateVerificationError
+		unknownAuthErr  x509.UnknownAuthorityError
+		hostnameErr     x509.HostnameError
+		invalidErr      x509.CertificateInvalidError
+		alertErr        tls.AlertError
+		netErr          net.Error
+	)
+	switch {
+	case errors.As(err, &verificationErr), errors.As(err, &unknownAuthErr),
+		errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return "certificate"
+	case errors.As(err, &alertErr):
+		return "alert"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return "eof"
+	}
+	return "other"
+}
@@ -0,0 +1,88 @@
+package opstls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func selfSignedConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test.local"},
+		DNSNames:     []string{"test.local"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{"h2"},
+	}
+}
+
+func handshake(t *testing.T, clientConfig *tls.Config) error {
+	serverConfig := selfSignedConfig(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		serverConn, err := l.Accept()
+		if err == nil {
+			tls.Server(serverConn, serverConfig).Handshake()
+			serverConn.Close()
+		}
+	}()
+
+	clientConn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close()
+	op := ops.Begin("tls_handshake")
+	defer op.End()
+	_, err = Client(context.Background(), op, clientConn, clientConfig)
+	return err
+}
+
+func TestHandshake(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporter(func(report *ops.Report) {
+		reported = report
+	})
+
+	err := handshake(t, &tls.Config{ServerName: "test.local", InsecureSkipVerify: true, NextProtos: []string{"h2"}})
+	assert.NoError(t, err)
+	assert.True(t, reported.Succeeded())
+	assert.Equal(t, "TLS 1.3", reported.Context["tls_version"])
+	assert.Equal(t, "h2", reported.Context["tls_alpn"])
+	assert.Equal(t, "test.local", reported.Context["tls_sni"])
+	assert.Equal(t, false, reported.Context["tls_resumed"])
+	assert.NotNil(t, reported.Context["tls_cipher_suite"])
+	assert.NotNil(t, reported.Context["tls_handshake_duration"])
+
+	err = handshake(t, &tls.Config{ServerName: "test.local"})
+	assert.Error(t, err)
+	assert.False(t, reported.Succeeded())
+	assert.Equal(t, "certificate", reported.Context["tls_error_class"])
+}
@@ -0,0 +1,14 @@
+// Command opsvet checks for misuses of github.com/getlantern/ops. Run it with
+// go vet:
+//
+//	go vet -vettool=$(which opsvet) ./...
+package main
+
+import (
+	"github.com/getlantern/ops/opsvet"
+	"golang.org/x/tools/go/analysis/unitchecker"
+)
+
+func main() {
+	unitchecker.Main(opsvet.Analyzer)
+}
@@ -0,0 +1,309 @@
+// Package opsvet provides a static analyzer for common misuses of
+// github.com/getlantern/ops that the runtime can't catch:
+//
+//   - ops that are begun but never ended, which leak in-flight ops and never
+//     report
+//   - results that are used after FailIf(err) without checking err, which
+//     carries on with an op that has failed as if it hadn't
+//   - changes to an op after it has ended, which have no effect
+//
+// Run it with go vet using the opsvet command:
+//
+//	go install github.com/getlantern/ops/opsvet/cmd/opsvet@latest
+//	go vet -vettool=$(which opsvet) ./...
+//
+// It's a separate module so that depending on ops doesn't pull in
+// golang.org/x/tools.
+package opsvet
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+const opsPath = "github.com/getlantern/ops"
+
+// Analyzer reports misuses of ops.
+var Analyzer = &analysis.Analyzer{
+	Name:     "opsvet",
+	Doc:      "check for ops that are never ended, ignored failures and changes to ended ops",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	nodes := []ast.Node{(*ast.AssignStmt)(nil), (*ast.ExprStmt)(nil), (*ast.BlockStmt)(nil), (*ast.CaseClause)(nil), (*ast.CommClause)(nil)}
+	inspect.WithStack(nodes, func(n ast.Node, push bool, stack []ast.Node) bool {
+		if !push {
+			return true
+		}
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			checkUnended(pass, n, enclosingBody(stack))
+		case *ast.ExprStmt:
+			if call, ok := n.X.(*ast.CallExpr); ok && beginsOp(pass, call) {
+				pass.Reportf(n.Pos(), "result of %v is discarded, so the op is never ended", callName(call))
+			}
+		case *ast.BlockStmt:
+			checkStatements(pass, n.List)
+		case *ast.CaseClause:
+			checkStatements(pass, n.Body)
+		case *ast.CommClause:
+			checkStatements(pass, n.Body)
+		}
+		return true
+	})
+	return nil, nil
+}
+
+// isOp checks whether t is ops.Op.
+func isOp(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == opsPath && obj.Name() == "Op"
+}
+
+// opMethod returns the receiver and name of a method call on an ops.Op.
+func opMethod(pass *analysis.Pass, call *ast.CallExpr) (ast.Expr, string, bool) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return nil, "", false
+	}
+	t := pass.TypesInfo.TypeOf(sel.X)
+	if t == nil || !isOp(t) {
+		return nil, "", false
+	}
+	return sel.X, sel.Sel.Name, true
+}
+
+// beginsOp checks whether call begins a new op, possibly followed by calls
+// like Set that return the same op, as in ops.Begin("name").Set("key", value).
+func beginsOp(pass *analysis.Pass, call *ast.CallExpr) bool {
+	if t := pass.TypesInfo.TypeOf(call); t == nil || !isOp(t) {
+		return false
+	}
+	if receiver, _, ok := opMethod(pass, call); ok {
+		if inner, ok := receiver.(*ast.CallExpr); ok {
+			return beginsOp(pass, inner) || isBegin(call)
+		}
+	}
+	return isBegin(call)
+}
+
+func isBegin(call *ast.CallExpr) bool {
+	name := callName(call)
+	return strings.HasPrefix(name, "Begin") || name == "FromEnv"
+}
+
+func callName(call *ast.CallExpr) string {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return fun.Name
+	case *ast.SelectorExpr:
+		return fun.Sel.Name
+	}
+	return ""
+}
+
+func enclosingBody(stack []ast.Node) *ast.BlockStmt {
+	for i := len(stack) - 1; i >= 0; i-- {
+		switch fn := stack[i].(type) {
+		case *ast.FuncDecl:
+			return fn.Body
+		case *ast.FuncLit:
+			return fn.Body
+		}
+	}
+	return nil
+}
+
+// checkUnended reports ops assigned to local variables that are neither
+// ended nor handed off anywhere in the function.
+func checkUnended(pass *analysis.Pass, assign *ast.AssignStmt, body *ast.BlockStmt) {
+	if body == nil || len(assign.Lhs) != len(assign.Rhs) {
+		return
+	}
+	for i, rhs := range assign.Rhs {
+		call, ok := rhs.(*ast.CallExpr)
+		if !ok || !beginsOp(pass, call) {
+			continue
+		}
+		ident, ok := assign.Lhs[i].(*ast.Ident)
+		if !ok || ident.Name == "_" {
+			continue
+		}
+		obj := pass.TypesInfo.ObjectOf(ident)
+		if obj == nil || obj.Parent() == pass.Pkg.Scope() {
+			continue
+		}
+		if !endedOrHandedOff(pass, obj, body) {
+			pass.Reportf(assign.Pos(), "%v is begun but never ended; call %v.End(), typically with defer", ident.Name, ident.Name)
+		}
+	}
+}
+
+func endedOrHandedOff(pass *analysis.Pass, obj types.Object, body *ast.BlockStmt) bool {
+	// Uses as the receiver of a method call are handled when visiting the
+	// call and assignments to the variable don't hand the op off, so they're
+	// ignored when visiting identifiers
+	ignored := make(map[*ast.Ident]bool)
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		if found {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				if ident, ok := lhs.(*ast.Ident); ok {
+					ignored[ident] = true
+				}
+			}
+		case *ast.CallExpr:
+			if receiver, method, ok := opMethod(pass, n); ok {
+				if ident, ok := receiver.(*ast.Ident); ok && pass.TypesInfo.Uses[ident] == obj {
+					ignored[ident] = true
+					switch method {
+					case "End", "EndWithError", "Cancel":
+						found = true
+					}
+				}
+			}
+		case *ast.Ident:
+			if pass.TypesInfo.Uses[n] == obj && !ignored[n] {
+				found = true
+			}
+		}
+		return true
+	})
+	return found
+}
+
+// checkStatements checks a list of statements for results used after an
+// unchecked FailIf and for changes to ops after they've ended.
+func checkStatements(pass *analysis.Pass, list []ast.Stmt) {
+	for i, stmt := range list {
+		expr, ok := stmt.(*ast.ExprStmt)
+		if !ok {
+			continue
+		}
+		call, ok := expr.X.(*ast.CallExpr)
+		if !ok {
+			continue
+		}
+		receiver, method, ok := opMethod(pass, call)
+		if !ok {
+			continue
+		}
+		switch method {
+		case "FailIf":
+			if i > 0 && len(call.Args) == 1 {
+				checkIgnoredFailure(pass, list[i-1], call.Args[0], list[i+1:])
+			}
+		case "End", "EndWithError":
+			if ident, ok := receiver.(*ast.Ident); ok {
+				checkChangedAfterEnd(pass, pass.TypesInfo.Uses[ident], list[i+1:])
+			}
+		}
+	}
+}
+
+// checkIgnoredFailure reports the results of the statement before a FailIf
+// that are used after it, like conn in:
+//
+//	conn, err := dial()
+//	op.FailIf(err)
+//	conn.Write(b)
+func checkIgnoredFailure(pass *analysis.Pass, prev ast.Stmt, arg ast.Expr, rest []ast.Stmt) {
+	assign, ok := prev.(*ast.AssignStmt)
+	errIdent, isIdent := arg.(*ast.Ident)
+	if !ok || !isIdent {
+		return
+	}
+	errObj := pass.TypesInfo.ObjectOf(errIdent)
+	results := make(map[types.Object]bool)
+	assignsErr := false
+	for _, lhs := range assign.Lhs {
+		ident, ok := lhs.(*ast.Ident)
+		if !ok || ident.Name == "_" {
+			continue
+		}
+		obj := pass.TypesInfo.ObjectOf(ident)
+		if obj == errObj {
+			assignsErr = true
+		} else if obj != nil {
+			results[obj] = true
+		}
+	}
+	if !assignsErr || len(results) == 0 {
+		return
+	}
+	for _, stmt := range rest {
+		var used *ast.Ident
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok && used == nil {
+				if _, found := results[pass.TypesInfo.Uses[ident]]; found {
+					used = ident
+				}
+			}
+			return used == nil
+		})
+		if used != nil {
+			pass.Reportf(used.Pos(), "%v is used after FailIf(%v) without checking %v; return the result of FailIf if %v != nil", used.Name, errIdent.Name, errIdent.Name, errIdent.Name)
+			return
+		}
+	}
+}
+
+// checkChangedAfterEnd reports calls that change the given op in statements
+// following its End, up to where the variable is assigned another op.
+func checkChangedAfterEnd(pass *analysis.Pass, obj types.Object, rest []ast.Stmt) {
+	if obj == nil {
+		return
+	}
+	for _, stmt := range rest {
+		if assign, ok := stmt.(*ast.AssignStmt); ok {
+			for _, lhs := range assign.Lhs {
+				if ident, ok := lhs.(*ast.Ident); ok && pass.TypesInfo.ObjectOf(ident) == obj {
+					return
+				}
+			}
+		}
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if _, ok := n.(*ast.FuncLit); ok {
+				// Might run at any time
+				return false
+			}
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			receiver, method, ok := opMethod(pass, call)
+			if !ok || !changesOp(method) {
+				return true
+			}
+			if ident, ok := receiver.(*ast.Ident); ok && pass.TypesInfo.Uses[ident] == obj {
+				pass.Reportf(call.Pos(), "%v.%v after %v.End has no effect", ident.Name, method, ident.Name)
+			}
+			return true
+		})
+	}
+}
+
+func changesOp(method string) bool {
+	for _, prefix := range []string{"Set", "Put", "Fail", "Warn", "Mark", "DependsOn"} {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
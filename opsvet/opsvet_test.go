@@ -0,0 +1,12 @@
+package opsvet_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/ops/opsvet"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), opsvet.Analyzer, "a")
+}
@@ -0,0 +1,127 @@
+package a
+
+import (
+	"errors"
+
+	"github.com/getlantern/ops"
+)
+
+type conn struct{}
+
+func (c *conn) Write(b []byte) {}
+
+func dial() (*conn, error) {
+	return nil, errors.New("unreachable")
+}
+
+func ended() {
+	op := ops.Begin("ended")
+	defer op.End()
+	op.Set("key", "value")
+}
+
+func endedWithError() error {
+	op := ops.Begin("ended_with_error").Set("key", "value")
+	return op.EndWithError(nil)
+}
+
+func canceled() {
+	op := ops.Begin("canceled")
+	op.Cancel()
+}
+
+func handedOff() ops.Op {
+	op := ops.Begin("returned")
+	return op
+}
+
+func handedOffToFunction() {
+	op := ops.Begin("passed")
+	finish(op)
+}
+
+func finish(op ops.Op) {
+	op.End()
+}
+
+func endedInClosure() {
+	op := ops.Begin("closure")
+	go func() {
+		op.End()
+	}()
+}
+
+func neverEnded() {
+	op := ops.Begin("never_ended") // want `op is begun but never ended`
+	op.Set("key", "value")
+}
+
+func childNeverEnded(parent ops.Op) {
+	child := parent.Begin("child") // want `child is begun but never ended`
+	child.ID()
+}
+
+func reassigned() {
+	var op ops.Op
+	op = ops.BeginRemote("reassigned", nil) // want `op is begun but never ended`
+	op.Set("key", "value")
+}
+
+func discarded() {
+	ops.Begin("discarded")                   // want `result of Begin is discarded`
+	ops.Begin("discarded").Set("key", "val") // want `result of Set is discarded`
+}
+
+func ignoredFailure(op ops.Op) {
+	c, err := dial()
+	op.FailIf(err)
+	c.Write(nil) // want `c is used after FailIf\(err\) without checking err`
+}
+
+func checkedFailure(op ops.Op) error {
+	c, err := dial()
+	if err != nil {
+		return op.FailIf(err)
+	}
+	c.Write(nil)
+	return nil
+}
+
+func failureOnly(op ops.Op) {
+	_, err := dial()
+	op.FailIf(err)
+	op.End()
+}
+
+func changedAfterEnd() {
+	op := ops.Begin("changed_after_end")
+	op.End()
+	op.Set("key", "value")        // want `op.Set after op.End has no effect`
+	op.FailIf(errors.New("late")) // want `op.FailIf after op.End has no effect`
+	op.ID()
+}
+
+func reusedAfterEnd() {
+	op := ops.Begin("first")
+	op.End()
+	op = ops.Begin("second")
+	op.Set("key", "value")
+	op.End()
+}
+
+func changedInDeferredEnd() {
+	op := ops.Begin("deferred")
+	defer op.End()
+	op.Set("key", "value")
+}
+
+func changedInSwitch(fail bool) {
+	op := ops.Begin("switch")
+	switch {
+	case fail:
+		op.End()
+		op.PutTag("key", "value") // want `op.PutTag after op.End has no effect`
+	default:
+		op.End()
+	}
+}
@@ -0,0 +1,115 @@
+//go:build js && wasm
+
+package opswasm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"syscall/js"
+)
+
+// maxKeepaliveBody is the largest body browsers allow requests with keepalive
+// to have.
+const maxKeepaliveBody = 64 * 1024
+
+// post sends body with fetch. Small requests use keepalive so that they
+// complete even if the page is unloaded in the meantime.
+func post(url string, body []byte) error {
+	array := js.Global().Get("Uint8Array").New(len(body))
+	js.CopyBytesToJS(array, body)
+	init := map[string]interface{}{
+		"method":    "POST",
+		"body":      array,
+		"keepalive": len(body) < maxKeepaliveBody,
+		"headers":   map[string]interface{}{"Content-Type": "application/json"},
+	}
+
+	done := make(chan error, 1)
+	onResponse := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		resp := args[0]
+		if !resp.Get("ok").Bool() {
+			done <- fmt.Errorf("unexpected status %d", resp.Get("status").Int())
+		} else {
+			done <- nil
+		}
+		return nil
+	})
+	defer onResponse.Release()
+	onError := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		done <- errors.New(args[0].Call("toString").String())
+		return nil
+	})
+	defer onError.Release()
+	js.Global().Call("fetch", url, init).Call("then", onResponse, onError)
+	return <-done
+}
+
+// localStorageSpool keeps reports in localStorage as a JSON array.
+type localStorageSpool struct {
+	key string
+}
+
+func newSpool(key string) spool {
+	return &localStorageSpool{key}
+}
+
+func localStorage() (js.Value, bool) {
+	storage := js.Global().Get("localStorage")
+	return storage, !storage.IsUndefined() && !storage.IsNull()
+}
+
+func (s *localStorageSpool) load() []json.RawMessage {
+	storage, ok := localStorage()
+	if !ok {
+		return nil
+	}
+	item := storage.Call("getItem", s.key)
+	if item.IsNull() {
+		return nil
+	}
+	var reports []json.RawMessage
+	if err := json.Unmarshal([]byte(item.String()), &reports); err != nil {
+		// Corrupted spool, start over
+		storage.Call("removeItem", s.key)
+		return nil
+	}
+	return reports
+}
+
+func (s *localStorageSpool) store(reports []json.RawMessage) {
+	storage, ok := localStorage()
+	if !ok {
+		return
+	}
+	defer func() {
+		// setItem throws when over quota, in which case the reports are lost
+		recover()
+	}()
+	if len(reports) == 0 {
+		storage.Call("removeItem", s.key)
+		return
+	}
+	encoded, err := json.Marshal(reports)
+	if err != nil {
+		return
+	}
+	storage.Call("setItem", s.key, string(encoded))
+}
+
+// onHide calls fn when the page is hidden, which is the last reliable chance
+// to save state before it may be unloaded.
+func onHide(fn func()) {
+	document := js.Global().Get("document")
+	if document.IsUndefined() {
+		return
+	}
+	document.Call("addEventListener", "visibilitychange", js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		if document.Get("visibilityState").String() == "hidden" {
+			// Callbacks must not block, since fn may wait for a fetch to
+			// complete
+			go fn()
+		}
+		return nil
+	}))
+}
@@ -0,0 +1,53 @@
+//go:build !(js && wasm)
+
+package opswasm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+func post(url string, body []byte) error {
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
+
+// memorySpools stands in for localStorage, shared by Exporters with the same
+// spool key like the browser's storage would be.
+var (
+	memorySpools   = make(map[string][]json.RawMessage)
+	memorySpoolsMx sync.Mutex
+)
+
+type memorySpool struct {
+	key string
+}
+
+func newSpool(key string) spool {
+	return &memorySpool{key}
+}
+
+func (s *memorySpool) load() []json.RawMessage {
+	memorySpoolsMx.Lock()
+	defer memorySpoolsMx.Unlock()
+	return append([]json.RawMessage(nil), memorySpools[s.key]...)
+}
+
+func (s *memorySpool) store(reports []json.RawMessage) {
+	memorySpoolsMx.Lock()
+	memorySpools[s.key] = reports
+	memorySpoolsMx.Unlock()
+}
+
+func onHide(fn func()) {
+}
@@ -0,0 +1,198 @@
+// Package opswasm provides a reporter for browser-based clients built for
+// js/wasm. It sends batches of reports to an HTTP endpoint using the browser's
+// fetch API and spools reports that couldn't be sent to localStorage, so that
+// they survive going offline and page reloads.
+//
+// On other platforms, reports are sent with net/http and spooled in memory,
+// which is mostly useful for testing.
+package opswasm
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opswasm")
+}
+
+// Options configures an Exporter. Zero values use the defaults noted on each
+// field.
+type Options struct {
+	// URL is the endpoint to POST batches of reports to. Each batch is a JSON
+	// array of reports in their canonical encoding (see
+	// ops.ReportJSONSchema).
+	URL string
+
+	// MaxBatch is the largest number of reports sent in one request (default
+	// 100).
+	MaxBatch int
+
+	// Interval is how often reports are sent (default 10 seconds).
+	Interval time.Duration
+
+	// MaxSpooled is how many unsent reports are kept, after which the oldest
+	// are dropped (default 1000).
+	MaxSpooled int
+
+	// SpoolKey is the localStorage key under which unsent reports are kept
+	// (default "ops_spool").
+	SpoolKey string
+}
+
+// spool stores reports that haven't been sent yet.
+type spool interface {
+	load() []json.RawMessage
+	store(reports []json.RawMessage)
+}
+
+// Exporter is a reporter that sends reports in the background.
+type Exporter struct {
+	opts    Options
+	spool   spool
+	pending []json.RawMessage
+	mx      sync.Mutex
+	flushMx sync.Mutex
+	stop    chan interface{}
+	stopped chan interface{}
+	once    sync.Once
+}
+
+// New creates an Exporter. Register it with
+// ops.RegisterStructuredReporter(exporter.Report). Reports spooled by a
+// previous Exporter with the same SpoolKey are sent along with new ones.
+func New(opts Options) *Exporter {
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = 100
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.MaxSpooled <= 0 {
+		opts.MaxSpooled = 1000
+	}
+	if opts.SpoolKey == "" {
+		opts.SpoolKey = "ops_spool"
+	}
+	e := &Exporter{
+		opts:    opts,
+		spool:   newSpool(opts.SpoolKey),
+		stop:    make(chan interface{}),
+		stopped: make(chan interface{}),
+	}
+	go e.run()
+	onHide(e.persist)
+	return e
+}
+
+func (e *Exporter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(e.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.Flush()
+		case <-e.stop:
+			e.Flush()
+			return
+		}
+	}
+}
+
+// Report queues the given report for sending. Reports that can't be encoded
+// are dropped.
+func (e *Exporter) Report(report *ops.Report) {
+	encoded, err := json.Marshal(report)
+	if err != nil {
+		return
+	}
+	e.mx.Lock()
+	e.pending = append(e.pending, encoded)
+	if overflow := len(e.pending) - e.opts.MaxSpooled; overflow > 0 {
+		e.pending = e.pending[overflow:]
+	}
+	e.mx.Unlock()
+}
+
+// Flush sends all spooled and queued reports. Queued reports are spooled before
+// sending, so that they aren't lost if the page goes away in the meantime, and
+// removed from the spool once sent.
+func (e *Exporter) Flush() {
+	e.flushMx.Lock()
+	defer e.flushMx.Unlock()
+	e.mx.Lock()
+	reports := e.store(append(e.spool.load(), e.pending...))
+	e.pending = nil
+	e.mx.Unlock()
+
+	sent := 0
+	for sent < len(reports) {
+		n := len(reports) - sent
+		if n > e.opts.MaxBatch {
+			n = e.opts.MaxBatch
+		}
+		body, err := json.Marshal(reports[sent : sent+n])
+		if err == nil {
+			err = post(e.opts.URL, body)
+		}
+		if err != nil {
+			break
+		}
+		sent += n
+	}
+	if sent == 0 {
+		return
+	}
+
+	// Reports may have been persisted while sending, so only remove the ones
+	// that were sent
+	e.mx.Lock()
+	spooled := e.spool.load()
+	if sent > len(spooled) {
+		sent = len(spooled)
+	}
+	e.store(spooled[sent:])
+	e.mx.Unlock()
+}
+
+// persist moves queued reports to the spool without sending them, for when
+// the page is about to go away.
+func (e *Exporter) persist() {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	if len(e.pending) == 0 {
+		return
+	}
+	e.store(append(e.spool.load(), e.pending...))
+	e.pending = nil
+}
+
+// store replaces the spool with the given reports, dropping the oldest beyond
+// MaxSpooled, and returns what was stored.
+func (e *Exporter) store(reports []json.RawMessage) []json.RawMessage {
+	if overflow := len(reports) - e.opts.MaxSpooled; overflow > 0 {
+		reports = reports[overflow:]
+	}
+	e.spool.store(reports)
+	return reports
+}
+
+// Spooled returns the number of reports waiting in the spool.
+func (e *Exporter) Spooled() int {
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	return len(e.spool.load())
+}
+
+// Close stops sending reports in the background, trying to send any that are
+// left first.
+func (e *Exporter) Close() {
+	e.once.Do(func() {
+		close(e.stop)
+		<-e.stopped
+	})
+}
@@ -0,0 +1,73 @@
+package opswasm_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opswasm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExporter(t *testing.T) {
+	var mx sync.Mutex
+	var batches [][]*ops.Report
+	var failing int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if atomic.LoadInt32(&failing) == 1 {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var batch []*ops.Report
+		if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mx.Lock()
+		batches = append(batches, batch)
+		mx.Unlock()
+	}))
+	defer server.Close()
+
+	opts := opswasm.Options{URL: server.URL, MaxBatch: 2, Interval: time.Hour, SpoolKey: "test_spool"}
+	e := opswasm.New(opts)
+	for _, name := range []string{"a", "b", "c"} {
+		e.Report(&ops.Report{SchemaVersion: ops.SchemaVersion, Name: name})
+	}
+	e.Flush()
+	assert.Equal(t, 3, e.Spooled(), "unsent reports should be spooled")
+	e.Close()
+
+	// A new exporter, like after a page reload, picks up the spool
+	atomic.StoreInt32(&failing, 0)
+	e = opswasm.New(opts)
+	e.Report(&ops.Report{SchemaVersion: ops.SchemaVersion, Name: "d"})
+	e.Close()
+	assert.Equal(t, 0, e.Spooled())
+
+	mx.Lock()
+	defer mx.Unlock()
+	var names []string
+	for _, batch := range batches {
+		assert.True(t, len(batch) <= 2, "batches should be limited in size")
+		for _, report := range batch {
+			names = append(names, report.Name)
+		}
+	}
+	assert.Equal(t, []string{"a", "b", "c", "d"}, names)
+}
+
+func TestMaxSpooled(t *testing.T) {
+	e := opswasm.New(opswasm.Options{URL: "http://127.0.0.1:0", MaxSpooled: 2, Interval: time.Hour, SpoolKey: "test_max_spooled"})
+	defer e.Close()
+	for i := 0; i < 5; i++ {
+		e.Report(&ops.Report{SchemaVersion: ops.SchemaVersion, Name: "spooled"})
+	}
+	e.Flush()
+	assert.Equal(t, 2, e.Spooled())
+}
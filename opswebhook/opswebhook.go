@@ -0,0 +1,242 @@
+// Package opswebhook provides a reporter that POSTs failed ops to a webhook,
+// like a Slack incoming webhook, PagerDuty or an internal alerting hook, so
+// that small deployments get alerting without running a metrics stack.
+package opswebhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/getlantern/ops"
+)
+
+func init() {
+	ops.RegisterIntegration("opswebhook")
+}
+
+// Options configures a Webhook. Zero values use the defaults noted on each
+// field.
+type Options struct {
+	// URL is the webhook to POST to.
+	URL string
+
+	// Template renders the request body from the *ops.Report. Templates can
+	// use the function json to encode values as JSON and errorText for the
+	// text of errors (see ops.ErrorText), for example:
+	//
+	//	{"text": {{json (printf "%v failed: %v" .Name (errorText .Failure))}}}
+	//
+	// By default, the body is a JSON object with the keys op, id, trace_id,
+	// start, duration, error and context.
+	Template *template.Template
+
+	// ContentType is the Content-Type of requests (default application/json).
+	ContentType string
+
+	// Filter decides which reports are sent (default failures only).
+	Filter func(report *ops.Report) bool
+
+	// MaxPerMinute limits how many reports are sent per minute; reports
+	// beyond that are dropped (default 10).
+	MaxPerMinute int
+
+	// Retries is how many times a failed request is retried (default 3,
+	// negative disables retries).
+	Retries int
+
+	// Backoff is how long to wait before the first retry, doubling for each
+	// following retry (default 1 second).
+	Backoff time.Duration
+
+	// Client is the http.Client used to send requests (default
+	// http.DefaultClient).
+	Client *http.Client
+
+	// Timeout bounds each request, including reading the response, whatever
+	// the Client's own timeout (default 10 seconds).
+	Timeout time.Duration
+}
+
+// Funcs are the functions available to templates.
+var Funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"errorText": func(err error) string {
+		if err == nil {
+			return ""
+		}
+		return ops.ErrorText(err)
+	},
+}
+
+// queueSize is how many reports can wait to be sent before reports are
+// dropped.
+const queueSize = 100
+
+// Webhook is a reporter that sends reports to a webhook in the background.
+type Webhook struct {
+	opts        Options
+	queue       chan *ops.Report
+	windowStart time.Time
+	inWindow    int
+	closed      bool
+	dropped     int64
+	mx          sync.Mutex
+	done        chan interface{}
+	closeOnce   sync.Once
+}
+
+// New creates a Webhook with the given options. Register it with
+// ops.RegisterStructuredReporter(webhook.Report).
+func New(opts Options) *Webhook {
+	if opts.ContentType == "" {
+		opts.ContentType = "application/json"
+	}
+	if opts.Filter == nil {
+		opts.Filter = func(report *ops.Report) bool { return !report.Succeeded() }
+	}
+	if opts.MaxPerMinute <= 0 {
+		opts.MaxPerMinute = 10
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	} else if opts.Retries == 0 {
+		opts.Retries = 3
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	w := &Webhook{
+		opts:  opts,
+		queue: make(chan *ops.Report, queueSize),
+		done:  make(chan interface{}),
+	}
+	go w.run()
+	return w
+}
+
+// Report queues the report to be sent if it passes the filter and rate limit.
+// Progress reports (see ops.Report.InProgress) are ignored.
+func (w *Webhook) Report(report *ops.Report) {
+	if report.InProgress || !w.opts.Filter(report) {
+		return
+	}
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	if w.closed {
+		return
+	}
+	now := time.Now()
+	if now.Sub(w.windowStart) >= time.Minute {
+		w.windowStart = now
+		w.inWindow = 0
+	}
+	if w.inWindow >= w.opts.MaxPerMinute {
+		atomic.AddInt64(&w.dropped, 1)
+		return
+	}
+	select {
+	case w.queue <- report.Retain():
+		w.inWindow++
+	default:
+		atomic.AddInt64(&w.dropped, 1)
+	}
+}
+
+// Dropped returns the number of reports that were dropped because of the rate
+// limit or because too many reports were waiting to be sent.
+func (w *Webhook) Dropped() int64 {
+	return atomic.LoadInt64(&w.dropped)
+}
+
+func (w *Webhook) run() {
+	defer close(w.done)
+	for report := range w.queue {
+		body, err := w.render(report)
+		if err != nil {
+			continue
+		}
+		w.send(body)
+	}
+}
+
+func (w *Webhook) render(report *ops.Report) ([]byte, error) {
+	if w.opts.Template != nil {
+		var buf bytes.Buffer
+		err := w.opts.Template.Execute(&buf, report)
+		return buf.Bytes(), err
+	}
+	payload := map[string]interface{}{
+		"op":       report.Name,
+		"id":       report.ID,
+		"trace_id": report.TraceID,
+		"start":    report.Start,
+		"duration": report.Duration.String(),
+		"context":  report.Context,
+	}
+	if report.Failure != nil {
+		payload["error"] = ops.ErrorText(report.Failure)
+	}
+	return json.Marshal(payload)
+}
+
+func (w *Webhook) send(body []byte) {
+	backoff := w.opts.Backoff
+	for attempt := 0; attempt <= w.opts.Retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if err := w.post(body); err == nil {
+			return
+		}
+	}
+}
+
+func (w *Webhook) post(body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.opts.ContentType)
+	resp, err := w.opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
+
+// Close sends any queued reports and stops the Webhook. Reports received after
+// Close are ignored.
+func (w *Webhook) Close() {
+	w.closeOnce.Do(func() {
+		w.mx.Lock()
+		w.closed = true
+		close(w.queue)
+		w.mx.Unlock()
+	})
+	<-w.done
+}
@@ -0,0 +1,97 @@
+package opswebhook_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/getlantern/ops/opswebhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	var mx sync.Mutex
+	var bodies []string
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		mx.Lock()
+		defer mx.Unlock()
+		requests++
+		if requests == 1 {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := io.ReadAll(req.Body)
+		bodies = append(bodies, string(b))
+	}))
+	defer server.Close()
+
+	w := opswebhook.New(opswebhook.Options{
+		URL:          server.URL,
+		Template:     template.Must(template.New("slack").Funcs(opswebhook.Funcs).Parse(`{"text": {{json (printf "%v failed: %v" .Name (errorText .Failure))}}}`)),
+		MaxPerMinute: 2,
+		Backoff:      time.Millisecond,
+	})
+	w.Report(&ops.Report{Name: "ok"})
+	for i := 0; i < 3; i++ {
+		w.Report(&ops.Report{Name: "dial", Failure: errors.New("refused")})
+	}
+	w.Close()
+	w.Report(&ops.Report{Name: "dial", Failure: errors.New("after close")})
+
+	mx.Lock()
+	defer mx.Unlock()
+	assert.Equal(t, 3, requests, "first request should have been retried")
+	assert.Equal(t, []string{`{"text": "dial failed: refused"}`, `{"text": "dial failed: refused"}`}, bodies)
+	assert.EqualValues(t, 1, w.Dropped())
+}
+
+func TestWebhookDefaultPayload(t *testing.T) {
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		b, _ := io.ReadAll(req.Body)
+		body = string(b)
+		assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+	}))
+	defer server.Close()
+
+	w := opswebhook.New(opswebhook.Options{URL: server.URL})
+	w.Report(&ops.Report{Name: "dial", TraceID: "t", Failure: errors.New("refused"), Context: map[string]interface{}{"a": 1}})
+	w.Close()
+	assert.Contains(t, body, `"op":"dial"`)
+	assert.Contains(t, body, `"error":"refused"`)
+	assert.Contains(t, body, `"trace_id":"t"`)
+	assert.Contains(t, body, `"context":{"a":1}`)
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	release := make(chan interface{})
+	var mx sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		mx.Lock()
+		requests++
+		first := requests == 1
+		mx.Unlock()
+		if first {
+			<-release
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	w := opswebhook.New(opswebhook.Options{URL: server.URL, Timeout: 20 * time.Millisecond, Retries: 1, Backoff: time.Millisecond})
+	start := time.Now()
+	w.Report(&ops.Report{Name: "dial", Failure: errors.New("refused")})
+	w.Close()
+	assert.True(t, time.Since(start) < 5*time.Second, "hung request should have timed out")
+	mx.Lock()
+	defer mx.Unlock()
+	assert.Equal(t, 2, requests, "timed out request should have been retried")
+}
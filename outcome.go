@@ -0,0 +1,76 @@
+package ops
+
+import (
+	stdcontext "context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// Outcome classifies how an Op ended in more detail than success or failure,
+// so that for example user-canceled operations can be told apart from genuine
+// failures.
+type Outcome int32
+
+const (
+	// Succeeded is the outcome of ops that completed successfully.
+	Succeeded Outcome = iota
+	// Failed is the outcome of ops that failed.
+	Failed
+	// Canceled is the outcome of ops that were canceled, for example by the
+	// user.
+	Canceled
+	// TimedOut is the outcome of ops that ran out of time.
+	TimedOut
+	// Skipped is the outcome of ops that had nothing to do, for example
+	// because of a cache hit or a disabled feature.
+	Skipped
+	// Throttled is the outcome of ops that were rejected by rate limiting, see
+	// Limiter.
+	Throttled
+)
+
+var outcomeNames = []string{"succeeded", "failed", "canceled", "timed_out", "skipped", "throttled"}
+
+func (o Outcome) String() string {
+	if o < 0 || int(o) >= len(outcomeNames) {
+		return "unknown"
+	}
+	return outcomeNames[o]
+}
+
+// ParseOutcome parses the result of Outcome.String.
+func ParseOutcome(s string) (Outcome, error) {
+	for i, name := range outcomeNames {
+		if name == s {
+			return Outcome(i), nil
+		}
+	}
+	return Succeeded, fmt.Errorf("unknown outcome %q", s)
+}
+
+// outcomeOf derives the outcome of an op that didn't set one explicitly from
+// its failure.
+func outcomeOf(failure error) Outcome {
+	switch {
+	case failure == nil:
+		return Succeeded
+	case errors.Is(failure, stdcontext.Canceled):
+		return Canceled
+	case errors.Is(failure, stdcontext.DeadlineExceeded):
+		return TimedOut
+	}
+	return Failed
+}
+
+func (o *op) SetOutcome(outcome Outcome) Op {
+	atomic.StoreInt32(&o.outcome, int32(outcome)+1)
+	return o
+}
+
+func (o *op) getOutcome(failure error) Outcome {
+	if outcome := atomic.LoadInt32(&o.outcome); outcome > 0 {
+		return Outcome(outcome - 1)
+	}
+	return outcomeOf(failure)
+}
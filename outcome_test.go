@@ -0,0 +1,56 @@
+package ops_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutcome(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "outcome")
+
+	ops.Begin("outcome").End()
+	assert.Equal(t, ops.Succeeded, reported.Outcome)
+	assert.Nil(t, reported.Context["outcome"])
+
+	ops.Begin("outcome").EndWithError(errors.New("broken"))
+	assert.Equal(t, ops.Failed, reported.Outcome)
+	assert.Equal(t, "failed", reported.Context["outcome"])
+
+	ops.Begin("outcome").EndWithError(fmt.Errorf("fetching: %w", context.Canceled))
+	assert.Equal(t, ops.Canceled, reported.Outcome)
+
+	ops.Begin("outcome").EndWithError(context.DeadlineExceeded)
+	assert.Equal(t, ops.TimedOut, reported.Outcome)
+
+	ops.Begin("outcome").SetOutcome(ops.Skipped).End()
+	assert.Equal(t, ops.Skipped, reported.Outcome)
+	assert.Equal(t, "skipped", reported.Context["outcome"])
+	assert.True(t, reported.Succeeded())
+
+	b, err := json.Marshal(reported)
+	if assert.NoError(t, err) {
+		decoded := &ops.Report{}
+		if assert.NoError(t, json.Unmarshal(b, decoded)) {
+			assert.Equal(t, ops.Skipped, decoded.Outcome)
+		}
+	}
+}
+
+func TestParseOutcome(t *testing.T) {
+	for _, outcome := range []ops.Outcome{ops.Succeeded, ops.Failed, ops.Canceled, ops.TimedOut, ops.Skipped} {
+		parsed, err := ops.ParseOutcome(outcome.String())
+		assert.NoError(t, err)
+		assert.Equal(t, outcome, parsed)
+	}
+	_, err := ops.ParseOutcome("exploded")
+	assert.Error(t, err)
+}
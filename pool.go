@@ -0,0 +1,92 @@
+package ops
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/getlantern/context"
+)
+
+// maxPooledContext is the largest context map that's returned to the pool, so
+// that an occasional huge context doesn't stay around.
+const maxPooledContext = 256
+
+var (
+	reuseContextMaps int32
+	contextMapPool   = sync.Pool{
+		New: func() interface{} {
+			return make(context.Map, 16)
+		},
+	}
+)
+
+// contextFiller is implemented by context backends that can add an op's
+// values to an existing map.
+type contextFiller interface {
+	fillMap(result context.Map, includeGlobals bool)
+}
+
+// SetReuseContextMaps enables or disables reusing the maps that hold the
+// Context of the reports of ended ops, which are otherwise allocated anew for
+// every report. With reuse enabled, a report's Context is cleared once all
+// reporters have returned, so reporters that keep reports around for later,
+// like ones that queue them for sending in the background, must keep the
+// result of Report.Retain instead. Reuse only takes effect with the
+// NativeContextBackend, since the other backend always allocates its maps.
+// Reporters and subscriptions in this package and its subpackages already
+// retain where needed.
+func SetReuseContextMaps(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&reuseContextMaps, value)
+}
+
+// Retain returns a Report that's safe to keep after the StructuredReporter it
+// was given to returns. Unless the report's Context is going to be reused
+// (see SetReuseContextMaps), that's the report itself, otherwise it's a copy
+// with a Context of its own. The values in the Context are not copied.
+func (r *Report) Retain() *Report {
+	if r.pooled == nil {
+		return r
+	}
+	retained := *r
+	retained.pooled = nil
+	retained.Context = make(map[string]interface{}, len(r.Context))
+	for key, value := range r.Context {
+		retained.Context[key] = value
+	}
+	return &retained
+}
+
+// reusableReport builds the report for an ended op, using a pooled map for its
+// context if reuse is enabled.
+func (o *op) reusableReport() *Report {
+	filler, ok := o.ctx.(contextFiller)
+	if !ok || atomic.LoadInt32(&reuseContextMaps) == 0 {
+		return o.report()
+	}
+	ctx := contextMapPool.Get().(context.Map)
+	filler.fillMap(ctx, true)
+	report := o.reportFrom(o.snapshotFrom(ctx))
+	report.pooled = ctx
+	return report
+}
+
+// releaseReport returns the report's context map to the pool if it came from
+// there.
+func releaseReport(report *Report) {
+	ctx := report.pooled
+	if ctx == nil {
+		return
+	}
+	report.pooled = nil
+	if len(ctx) > maxPooledContext {
+		return
+	}
+	for key := range ctx {
+		delete(ctx, key)
+	}
+	contextMapPool.Put(context.Map(ctx))
+}
@@ -0,0 +1,114 @@
+package ops_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReuseContextMaps(t *testing.T) {
+	ops.SetContextBackend(ops.NativeContextBackend)
+	defer ops.SetContextBackend(ops.GetlanternContextBackend)
+	ops.SetReuseContextMaps(true)
+	defer ops.SetReuseContextMaps(false)
+
+	var reported, retained []*ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		assert.Equal(t, 1, report.Context["a"], "context should be complete while reporting")
+		reported = append(reported, report)
+		retained = append(retained, report.Retain())
+	}, "test_reuse")
+
+	for i := 0; i < 2; i++ {
+		ops.Begin("test_reuse").Set("a", 1).End()
+	}
+	if assert.Len(t, reported, 2) {
+		for i := range reported {
+			assert.Empty(t, reported[i].Context, "reused context should be cleared after reporting")
+			assert.Equal(t, "test_reuse", retained[i].Context["op"])
+			assert.Equal(t, 1, retained[i].Context["a"])
+			assert.Same(t, retained[i], retained[i].Retain(), "retained report should not be copied again")
+		}
+	}
+
+	// Snapshots are never reused
+	op := ops.Begin("test_reuse_snapshot").Set("a", 1)
+	snapshot := op.Snapshot()
+	op.End()
+	assert.Equal(t, 1, snapshot["a"])
+}
+
+func TestReuseContextMapsConcurrently(t *testing.T) {
+	ops.SetContextBackend(ops.NativeContextBackend)
+	defer ops.SetContextBackend(ops.GetlanternContextBackend)
+	ops.SetReuseContextMaps(true)
+	defer ops.SetReuseContextMaps(false)
+
+	const goroutines, iterations = 8, 100
+	var mx sync.Mutex
+	retained := make(map[int]*ops.Report)
+	var children int
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		retain := report.Retain()
+		mx.Lock()
+		if retain.Name == "test_reuse_concurrent" {
+			retained[retain.Context["i"].(int)] = retain
+		} else if retain.Context["j"] != nil {
+			children++
+		}
+		mx.Unlock()
+	}, "test_reuse_concurrent", "test_reuse_concurrent_child")
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		g := g
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				i := g*iterations + j
+				op := ops.Begin("test_reuse_concurrent").Set("i", i)
+				op.Begin("test_reuse_concurrent_child").Set("j", j).End()
+				op.End()
+			}
+		}()
+	}
+	wg.Wait()
+
+	mx.Lock()
+	defer mx.Unlock()
+	assert.Equal(t, goroutines*iterations, children)
+	if assert.Len(t, retained, goroutines*iterations) {
+		for i, report := range retained {
+			assert.Equal(t, "test_reuse_concurrent", report.Context["op"])
+			assert.Equal(t, i, report.Context["i"])
+			assert.Nil(t, report.Context["j"], "reused maps shouldn't leak values between reports")
+		}
+	}
+}
+
+func TestRetainWithoutReuse(t *testing.T) {
+	var reported, retained *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported, retained = report, report.Retain()
+	}, "test_retain")
+	ops.Begin("test_retain").Set("a", 1).End()
+	assert.Same(t, reported, retained)
+	assert.Equal(t, 1, reported.Context["a"])
+}
+
+func BenchmarkEndReuseContextMaps(b *testing.B) {
+	ops.SetContextBackend(ops.NativeContextBackend)
+	defer ops.SetContextBackend(ops.GetlanternContextBackend)
+	ops.SetReuseContextMaps(true)
+	defer ops.SetReuseContextMaps(false)
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {}, "bench_reuse")
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ops.Begin("bench_reuse").Set("a", i).End()
+	}
+}
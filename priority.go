@@ -0,0 +1,73 @@
+package ops
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Priority expresses how important it is to keep the reports of an Op when
+// load is shed, for example by samplers.
+type Priority int32
+
+const (
+	// PriorityLow is for ops whose reports can be dropped first.
+	PriorityLow Priority = -1
+	// PriorityNormal is the default.
+	PriorityNormal Priority = 0
+	// PriorityHigh is for ops whose reports should be kept whenever possible,
+	// like payment flows. High-priority reports bypass the Sampler (see
+	// SetSampler) and aren't skipped by reporters wrapped with
+	// ReporterTimeout.
+	PriorityHigh Priority = 1
+)
+
+// priorityNames are indexed by Priority minus PriorityLow.
+var priorityNames = []string{"low", "normal", "high"}
+
+func (p Priority) String() string {
+	if p < PriorityLow || p > PriorityHigh {
+		return "unknown"
+	}
+	return priorityNames[p-PriorityLow]
+}
+
+// ParsePriority parses the result of Priority.String.
+func ParsePriority(s string) (Priority, error) {
+	for i, name := range priorityNames {
+		if name == s {
+			return Priority(i) + PriorityLow, nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("unknown priority %q", s)
+}
+
+func (o *op) SetPriority(priority Priority) Op {
+	atomic.StoreInt32(&o.priority, int32(priority-PriorityLow)+1)
+	return o
+}
+
+// getPriority returns the priority set on the op or else on its closest
+// ancestor that has one.
+func (o *op) getPriority() Priority {
+	for ; o != nil; o = o.parent {
+		if priority := atomic.LoadInt32(&o.priority); priority > 0 {
+			return Priority(priority-1) + PriorityLow
+		}
+	}
+	return PriorityNormal
+}
+
+// PrioritySampler returns a Sampler that samples using the Sampler configured
+// for each report's priority, or fallback if there's none, so that for
+// example low-priority reports can be sampled more aggressively. A nil Sampler
+// keeps all reports. Note that high-priority reports bypass the Sampler
+// altogether.
+func PrioritySampler(samplers map[Priority]Sampler, fallback Sampler) Sampler {
+	return func(report *Report) bool {
+		sampler, found := samplers[report.Priority]
+		if !found {
+			sampler = fallback
+		}
+		return sampler == nil || sampler(report)
+	}
+}
@@ -0,0 +1,70 @@
+package ops_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriority(t *testing.T) {
+	reported := make(map[string]*ops.Report)
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported[report.Name] = report
+	}, "priority_parent", "priority_inherited", "priority_own", "priority_normal")
+
+	parent := ops.Begin("priority_parent").SetPriority(ops.PriorityHigh)
+	parent.Begin("priority_inherited").End()
+	parent.Begin("priority_own").SetPriority(ops.PriorityLow).End()
+	parent.End()
+	ops.Begin("priority_normal").End()
+
+	assert.Equal(t, ops.PriorityHigh, reported["priority_parent"].Priority)
+	assert.Equal(t, "high", reported["priority_parent"].Context["priority"])
+	assert.Equal(t, ops.PriorityHigh, reported["priority_inherited"].Priority)
+	assert.Equal(t, ops.PriorityLow, reported["priority_own"].Priority)
+	assert.Equal(t, "low", reported["priority_own"].Context["priority"])
+	assert.Equal(t, ops.PriorityNormal, reported["priority_normal"].Priority)
+	assert.NotContains(t, reported["priority_normal"].Context, "priority")
+
+	b, err := json.Marshal(reported["priority_own"])
+	if assert.NoError(t, err) {
+		decoded := &ops.Report{}
+		if assert.NoError(t, json.Unmarshal(b, decoded)) {
+			assert.Equal(t, ops.PriorityLow, decoded.Priority)
+		}
+	}
+
+	for _, priority := range []ops.Priority{ops.PriorityLow, ops.PriorityNormal, ops.PriorityHigh} {
+		parsed, err := ops.ParsePriority(priority.String())
+		assert.NoError(t, err)
+		assert.Equal(t, priority, parsed)
+	}
+	_, err = ops.ParsePriority("urgent")
+	assert.Error(t, err)
+}
+
+func TestPrioritySampling(t *testing.T) {
+	ops.SetSampler(ops.PrioritySampler(map[ops.Priority]ops.Sampler{
+		ops.PriorityLow: func(report *ops.Report) bool { return false },
+	}, nil))
+	defer ops.SetSampler(nil)
+
+	var reported []string
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = append(reported, report.Context["level"].(string))
+	}, "priority_sampled")
+
+	ops.Begin("priority_sampled").Set("level", "low").SetPriority(ops.PriorityLow).End()
+	ops.Begin("priority_sampled").Set("level", "normal").End()
+	ops.Begin("priority_sampled").Set("level", "high").SetPriority(ops.PriorityHigh).End()
+	assert.Equal(t, []string{"normal", "high"}, reported)
+
+	// High priority reports bypass even a sampler that drops everything
+	reported = nil
+	ops.SetSampler(func(report *ops.Report) bool { return false })
+	ops.Begin("priority_sampled").Set("level", "normal").End()
+	ops.Begin("priority_sampled").Set("level", "high").SetPriority(ops.PriorityHigh).End()
+	assert.Equal(t, []string{"high"}, reported)
+}
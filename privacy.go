@@ -0,0 +1,113 @@
+package ops
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// PrivacyPolicy describes how identifying information is removed from reports
+// while privacy mode is enabled.
+type PrivacyPolicy struct {
+	// DropKeys are removed from reports entirely.
+	DropKeys []string
+
+	// HashKeys have their values replaced with a salted hash, so that values
+	// can still be correlated but not recovered.
+	HashKeys []string
+
+	// Salt is mixed into hashed values.
+	Salt string
+
+	// IPKeys have IP address values truncated to their /24 (IPv4) or /48
+	// (IPv6) network. Ports are dropped.
+	IPKeys []string
+
+	// DurationGranularity, if set, rounds report durations and all
+	// time.Duration values to multiples of itself.
+	DurationGranularity time.Duration
+}
+
+var (
+	privacyPolicy  atomic.Value
+	privacyEnabled int32
+)
+
+// SetPrivacyPolicy sets the PrivacyPolicy applied while privacy mode is
+// enabled.
+func SetPrivacyPolicy(policy PrivacyPolicy) {
+	privacyPolicy.Store(&policy)
+}
+
+// SetPrivacyMode enables or disables privacy mode. It can be toggled at any
+// time, for example when the user grants or revokes consent to telemetry.
+func SetPrivacyMode(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&privacyEnabled, value)
+}
+
+func applyPrivacy(report *Report) {
+	if atomic.LoadInt32(&privacyEnabled) == 0 {
+		return
+	}
+	policy, _ := privacyPolicy.Load().(*PrivacyPolicy)
+	if policy == nil {
+		return
+	}
+
+	ctx := report.Context
+	for _, key := range policy.DropKeys {
+		delete(ctx, key)
+	}
+	for _, key := range policy.HashKeys {
+		if value, found := ctx[key]; found {
+			sum := sha256.Sum256([]byte(policy.Salt + fmt.Sprint(value)))
+			ctx[key] = hex.EncodeToString(sum[:8])
+		}
+	}
+	for _, key := range policy.IPKeys {
+		if value, found := ctx[key]; found {
+			ctx[key] = truncateIP(value)
+		}
+	}
+	if g := policy.DurationGranularity; g > 0 {
+		report.Duration = report.Duration.Round(g)
+		for key, value := range ctx {
+			if d, ok := value.(time.Duration); ok {
+				ctx[key] = d.Round(g)
+			}
+		}
+	}
+}
+
+// truncateIP truncates an IP (or host:port) to its network, returning "" for
+// anything that isn't an IP.
+func truncateIP(value interface{}) string {
+	ip := parseIP(value)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	if ip != nil {
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	}
+	return ""
+}
+
+// parseIP parses an IP from a net.IP or a string containing an IP or
+// host:port, returning nil for anything else.
+func parseIP(value interface{}) net.IP {
+	if ip, ok := value.(net.IP); ok {
+		return ip
+	}
+	s := fmt.Sprint(value)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return net.ParseIP(s)
+}
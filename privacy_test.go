@@ -0,0 +1,53 @@
+package ops_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrivacyMode(t *testing.T) {
+	defer ops.SetPrivacyMode(false)
+
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_privacy")
+	ops.SetPrivacyPolicy(ops.PrivacyPolicy{
+		DropKeys:            []string{"email"},
+		HashKeys:            []string{"device_id"},
+		Salt:                "salt",
+		IPKeys:              []string{"client_ip", "client_ip6"},
+		DurationGranularity: time.Second,
+	})
+
+	report := func() *ops.Report {
+		ops.Begin("test_privacy").
+			Set("email", "user@example.com").
+			Set("device_id", "abc123").
+			Set("client_ip", "192.168.1.77:443").
+			Set("client_ip6", "2001:db8:1234:5678::1").
+			Set("phase_duration", 1400*time.Millisecond).
+			End()
+		return reported
+	}
+
+	ctx := report().Context
+	assert.Equal(t, "user@example.com", ctx["email"], "privacy mode should be off by default")
+
+	ops.SetPrivacyMode(true)
+	ctx = report().Context
+	assert.NotContains(t, ctx, "email")
+	assert.NotEqual(t, "abc123", ctx["device_id"])
+	assert.Len(t, ctx["device_id"], 16)
+	assert.Equal(t, "192.168.1.0", ctx["client_ip"])
+	assert.Equal(t, "2001:db8:1234::", ctx["client_ip6"])
+	assert.Equal(t, time.Second, ctx["phase_duration"])
+	assert.Equal(t, time.Duration(0), reported.Duration)
+	assert.Equal(t, ctx["device_id"], report().Context["device_id"], "hashes should be stable")
+
+	ops.SetPrivacyMode(false)
+	assert.Equal(t, "abc123", report().Context["device_id"])
+}
@@ -0,0 +1,68 @@
+package ops
+
+import (
+	"sync/atomic"
+)
+
+// FailurePropagation determines how the failure of an Op affects the Op it
+// was begun under (see Op.Begin).
+type FailurePropagation int32
+
+const (
+	// ContainFailures keeps failures to the Op that failed. This is the
+	// default.
+	ContainFailures FailurePropagation = iota
+
+	// PropagateFailures also fails the parent Op with the same error, unless
+	// it has failed already. The parent in turn propagates according to its
+	// own policy when it ends.
+	PropagateFailures
+
+	// WarnAboveFailures records the failure as a warning on the parent Op
+	// (see Op.Warn), without failing it.
+	WarnAboveFailures
+)
+
+var failurePropagation int32
+
+// SetFailurePropagation sets the FailurePropagation for all Ops, unless
+// overridden on a particular Op.
+func SetFailurePropagation(policy FailurePropagation) {
+	atomic.StoreInt32(&failurePropagation, int32(policy))
+}
+
+func (o *op) SetFailurePropagation(policy FailurePropagation) Op {
+	atomic.StoreInt32(&o.propagation, int32(policy)+1)
+	return o
+}
+
+func (o *op) failurePropagation() FailurePropagation {
+	if policy := atomic.LoadInt32(&o.propagation); policy > 0 {
+		return FailurePropagation(policy - 1)
+	}
+	return FailurePropagation(atomic.LoadInt32(&failurePropagation))
+}
+
+// propagateFailure applies the FailurePropagation policy to the parent of an
+// op that has ended. Propagated failures and warnings record the name of the
+// failed op under "failed_child".
+func (o *op) propagateFailure() {
+	if o.parent == nil {
+		return
+	}
+	_failure := o.failure.Load()
+	if _failure == nil {
+		return
+	}
+	failure := _failure.(error)
+	switch o.failurePropagation() {
+	case PropagateFailures:
+		if o.parent.failure.Load() == nil {
+			o.parent.FailIf(failure)
+			o.parent.PutTag("failed_child", o.name)
+		}
+	case WarnAboveFailures:
+		o.parent.Warn(failure)
+		o.parent.PutTag("failed_child", o.name)
+	}
+}
@@ -0,0 +1,57 @@
+package ops_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailurePropagation(t *testing.T) {
+	reported := make(map[string]*ops.Report)
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported[report.Name] = report
+	}, "propagate_root", "propagate_parent", "propagate_child")
+
+	run := func() {
+		root := ops.Begin("propagate_root")
+		parent := root.Begin("propagate_parent")
+		child := parent.Begin("propagate_child")
+		child.FailIf(errors.New("child failed"))
+		child.End()
+		parent.End()
+		root.End()
+	}
+
+	run()
+	assert.False(t, reported["propagate_child"].Succeeded())
+	assert.True(t, reported["propagate_parent"].Succeeded(), "failures should be contained by default")
+
+	ops.SetFailurePropagation(ops.PropagateFailures)
+	defer ops.SetFailurePropagation(ops.ContainFailures)
+	run()
+	assert.Equal(t, "child failed", ops.ErrorText(reported["propagate_parent"].Failure))
+	assert.Equal(t, "propagate_child", reported["propagate_parent"].Context["failed_child"])
+	assert.Equal(t, "child failed", ops.ErrorText(reported["propagate_root"].Failure), "should propagate all the way up")
+	assert.Equal(t, "propagate_parent", reported["propagate_root"].Context["failed_child"])
+
+	ops.SetFailurePropagation(ops.WarnAboveFailures)
+	run()
+	assert.True(t, reported["propagate_parent"].Succeeded())
+	assert.Equal(t, ops.SeverityWarning, reported["propagate_parent"].Severity)
+	assert.Equal(t, "child failed", reported["propagate_parent"].Context["warning"])
+	assert.Equal(t, ops.SeverityInfo, reported["propagate_root"].Severity, "warnings should not propagate further")
+
+	// Per-op policies override the global one
+	root := ops.Begin("propagate_root")
+	child := root.Begin("propagate_child").SetFailurePropagation(ops.PropagateFailures)
+	child.FailIf(errors.New("child failed"))
+	child.End()
+	existing := root.Begin("propagate_parent")
+	existing.FailIf(errors.New("own failure"))
+	existing.End()
+	root.End()
+	assert.Equal(t, "child failed", ops.ErrorText(reported["propagate_root"].Failure))
+	assert.Equal(t, "own failure", ops.ErrorText(reported["propagate_parent"].Failure))
+}
@@ -0,0 +1,134 @@
+package ops
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// Carrier is something that can carry propagated Op metadata, like an
+// http.Header.
+type Carrier interface {
+	Get(key string) string
+	Set(key, value string)
+}
+
+// TraceContext identifies an Op across process boundaries.
+type TraceContext struct {
+	TraceID string
+	SpanID  string
+}
+
+// Propagator serializes a TraceContext into a Carrier and back.
+type Propagator interface {
+	// Inject writes the given TraceContext into the carrier.
+	Inject(tc TraceContext, carrier Carrier)
+
+	// Extract reads a TraceContext from the carrier, returning false if the
+	// carrier doesn't contain one.
+	Extract(carrier Carrier) (TraceContext, bool)
+}
+
+var (
+	// B3Multi propagates using the multi-header B3 format (X-B3-TraceId,
+	// X-B3-SpanId).
+	B3Multi Propagator = b3Multi{}
+
+	// B3Single propagates using the single-header B3 format (b3).
+	B3Single Propagator = b3Single{}
+
+	// LanternHeaders propagates using X-Lantern-Op-* headers.
+	LanternHeaders = HeaderPropagator("X-Lantern-Op")
+
+	currentPropagator atomic.Value
+)
+
+func init() {
+	SetPropagator(B3Multi)
+}
+
+// SetPropagator sets the Propagator used by Inject and BeginRemote. The default
+// is B3Multi.
+func SetPropagator(p Propagator) {
+	currentPropagator.Store(&p)
+}
+
+func propagator() Propagator {
+	return *currentPropagator.Load().(*Propagator)
+}
+
+// Inject writes the identity of the given Op into carrier using the configured
+// Propagator, so that a remote process can continue the trace.
+func Inject(o Op, carrier Carrier) {
+	propagator().Inject(TraceContext{TraceID: o.TraceID(), SpanID: o.ID()}, carrier)
+	injectTiming(o, carrier)
+	injectBaggage(o, carrier)
+}
+
+// BeginRemote is like Begin but continues the trace found in carrier (if any),
+// making the remote Op this Op's parent. Baggage (see Op.PutBaggage) found in
+// carrier is put into the new Op.
+func BeginRemote(name string, carrier Carrier) Op {
+	o := Begin(name).(*op)
+	if tc, ok := propagator().Extract(carrier); ok {
+		o.traceID = tc.TraceID
+		o.parentID = tc.SpanID
+		o.ctx.Put("trace_id", tc.TraceID)
+		o.extractTiming(carrier)
+	}
+	o.extractBaggage(carrier)
+	return o
+}
+
+type b3Multi struct{}
+
+func (b3Multi) Inject(tc TraceContext, carrier Carrier) {
+	carrier.Set("X-B3-TraceId", tc.TraceID)
+	carrier.Set("X-B3-SpanId", tc.SpanID)
+}
+
+func (b3Multi) Extract(carrier Carrier) (TraceContext, bool) {
+	tc := TraceContext{
+		TraceID: carrier.Get("X-B3-TraceId"),
+		SpanID:  carrier.Get("X-B3-SpanId"),
+	}
+	return tc, tc.TraceID != "" && tc.SpanID != ""
+}
+
+type b3Single struct{}
+
+func (b3Single) Inject(tc TraceContext, carrier Carrier) {
+	carrier.Set("b3", tc.TraceID+"-"+tc.SpanID)
+}
+
+func (b3Single) Extract(carrier Carrier) (TraceContext, bool) {
+	// Format is {TraceId}-{SpanId}[-{SamplingState}[-{ParentSpanId}]]
+	parts := strings.Split(carrier.Get("b3"), "-")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return TraceContext{}, false
+	}
+	return TraceContext{TraceID: parts[0], SpanID: parts[1]}, true
+}
+
+// HeaderPropagator returns a Propagator that uses the headers
+// <prefix>-Trace-Id and <prefix>-Id.
+func HeaderPropagator(prefix string) Propagator {
+	return &headerPropagator{traceHeader: prefix + "-Trace-Id", idHeader: prefix + "-Id"}
+}
+
+type headerPropagator struct {
+	traceHeader string
+	idHeader    string
+}
+
+func (p *headerPropagator) Inject(tc TraceContext, carrier Carrier) {
+	carrier.Set(p.traceHeader, tc.TraceID)
+	carrier.Set(p.idHeader, tc.SpanID)
+}
+
+func (p *headerPropagator) Extract(carrier Carrier) (TraceContext, bool) {
+	tc := TraceContext{
+		TraceID: carrier.Get(p.traceHeader),
+		SpanID:  carrier.Get(p.idHeader),
+	}
+	return tc, tc.TraceID != "" && tc.SpanID != ""
+}
@@ -0,0 +1,44 @@
+package ops_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPropagation(t *testing.T) {
+	defer ops.SetPropagator(ops.B3Multi)
+
+	for _, p := range []ops.Propagator{ops.B3Multi, ops.B3Single, ops.LanternHeaders} {
+		ops.SetPropagator(p)
+		op := ops.Begin("client")
+		child := op.Begin("request")
+		assert.Equal(t, op.TraceID(), child.TraceID())
+		assert.Equal(t, op.ID(), child.ParentID())
+
+		h := make(http.Header)
+		ops.Inject(child, h)
+		remote := ops.BeginRemote("server", h)
+		assert.Equal(t, child.TraceID(), remote.TraceID())
+		assert.Equal(t, child.ID(), remote.ParentID())
+		assert.NotEqual(t, child.ID(), remote.ID())
+		remote.End()
+		child.End()
+		op.End()
+	}
+
+	h := make(http.Header)
+	h.Set("b3", "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1-05e3ac9a4f6e3b90")
+	ops.SetPropagator(ops.B3Single)
+	remote := ops.BeginRemote("server", h)
+	assert.Equal(t, "80f198ee56343ba864fe8b2a57d3eff7", remote.TraceID())
+	assert.Equal(t, "e457b5a2e4d86bd1", remote.ParentID())
+	remote.End()
+
+	fresh := ops.BeginRemote("server", make(http.Header))
+	assert.Empty(t, fresh.ParentID())
+	assert.Len(t, fresh.TraceID(), 32)
+	fresh.End()
+}
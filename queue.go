@@ -0,0 +1,38 @@
+package ops
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+func (o *op) MarkEnqueued(at time.Time) Op {
+	atomic.StoreInt64(&o.enqueued, at.UnixNano())
+	return o
+}
+
+func (o *op) MarkDequeued() Op {
+	atomic.StoreInt64(&o.dequeued, time.Now().UnixNano())
+	return o
+}
+
+// recordQueueTimes splits the time of ops representing queued work into
+// "queue_wait_duration", from when the work was queued until it was dequeued,
+// and "service_duration", from then until now. Ops that weren't marked with
+// MarkEnqueued count as queued when they began, and ops that weren't marked
+// with MarkDequeued as dequeued when they began.
+func (o *op) recordQueueTimes(ctx map[string]interface{}) {
+	enqueued := atomic.LoadInt64(&o.enqueued)
+	dequeued := atomic.LoadInt64(&o.dequeued)
+	if enqueued == 0 && dequeued == 0 {
+		return
+	}
+	start := o.start.UnixNano()
+	if enqueued == 0 {
+		enqueued = start
+	}
+	if dequeued == 0 {
+		dequeued = start
+	}
+	ctx["queue_wait_duration"] = time.Duration(dequeued - enqueued)
+	ctx["service_duration"] = time.Since(time.Unix(0, dequeued))
+}
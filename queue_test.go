@@ -0,0 +1,48 @@
+package ops_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueTimes(t *testing.T) {
+	reported := make(map[string]*ops.Report)
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported[report.Name] = report
+	}, "queue_dequeued", "queue_enqueued", "queue_both", "queue_none")
+
+	op := ops.Begin("queue_dequeued")
+	time.Sleep(20 * time.Millisecond)
+	op.MarkDequeued()
+	time.Sleep(10 * time.Millisecond)
+	op.End()
+
+	ops.Begin("queue_enqueued").MarkEnqueued(time.Now().Add(-time.Second)).End()
+
+	op = ops.Begin("queue_both").MarkEnqueued(time.Now().Add(-time.Second))
+	time.Sleep(10 * time.Millisecond)
+	op.MarkDequeued().End()
+
+	ops.Begin("queue_none").End()
+
+	ctx := reported["queue_dequeued"].Context
+	wait, service := ctx["queue_wait_duration"].(time.Duration), ctx["service_duration"].(time.Duration)
+	assert.True(t, wait >= 20*time.Millisecond, "wait %v", wait)
+	assert.True(t, service >= 10*time.Millisecond, "service %v", service)
+	assert.True(t, wait+service <= reported["queue_dequeued"].Duration+time.Millisecond)
+
+	ctx = reported["queue_enqueued"].Context
+	wait, service = ctx["queue_wait_duration"].(time.Duration), ctx["service_duration"].(time.Duration)
+	assert.InDelta(t, float64(time.Second), float64(wait), float64(50*time.Millisecond))
+	assert.True(t, service < 50*time.Millisecond, "service %v", service)
+
+	ctx = reported["queue_both"].Context
+	wait = ctx["queue_wait_duration"].(time.Duration)
+	assert.True(t, wait >= time.Second+10*time.Millisecond, "wait %v", wait)
+
+	assert.NotContains(t, reported["queue_none"].Context, "queue_wait_duration")
+	assert.NotContains(t, reported["queue_none"].Context, "service_duration")
+}
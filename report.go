@@ -0,0 +1,151 @@
+package ops
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/getlantern/hidden"
+)
+
+// SchemaVersion is the version of the Report structure. It is incremented
+// whenever an existing field changes meaning or is removed; adding fields does
+// not change the version. The version is also included in every report's
+// context under the key "schema_version".
+const SchemaVersion = 1
+
+// Report is the outcome of an Op as given to StructuredReporters.
+//
+// Fields in schema version 1:
+//
+//   - SchemaVersion: the value of SchemaVersion when the report was created
+//   - Name: the name of the Op
+//   - ID, TraceID, ParentID: see the corresponding methods on Op
+//   - RootID: the ID of the root of the Op's hierarchy within this process
+//   - Sequence: the order in which the Op ended among the delivered reports
+//     under the same root, starting at 1, or 0 for reports that aren't
+//     sequenced, like progress reports (see OrderingBuffer)
+//   - Start: when the Op began
+//   - Duration: how long the Op took, from Begin to End
+//   - Failure: the failure recorded with FailIf, or nil on success
+//   - Outcome: how the Op ended, see Op.SetOutcome
+//   - Priority: the priority of the Op, see Op.SetPriority
+//   - Context: the merged context of the Op, including globals
+//   - Environment: the environment set with SetEnvironment, if any
+//   - Severity: SeverityError for failures, SeverityWarning for successful
+//     ops with warnings (see Op.Warn) and SeverityInfo otherwise
+//   - InProgress: true for the progress reports of Op.Heartbeat, which are
+//     only delivered to reporters registered with RegisterProgressReporter
+type Report struct {
+	SchemaVersion int
+	Name          string
+	Environment   string
+	Severity      Severity
+	ID            string
+	TraceID       string
+	ParentID      string
+	RootID        string
+	Sequence      uint64
+	Start         time.Time
+	Duration      time.Duration
+	Failure       error
+	Outcome       Outcome
+	Priority      Priority
+	InProgress    bool
+	Context       map[string]interface{}
+
+	// pooled is the context map to return to the pool once the report has
+	// been delivered, if it came from there.
+	pooled map[string]interface{}
+}
+
+// Succeeded indicates whether the reported Op succeeded.
+func (r *Report) Succeeded() bool {
+	return r.Failure == nil
+}
+
+func (o *op) Snapshot() Map {
+	ctx, _ := o.snapshot()
+	return ctx
+}
+
+func (o *op) snapshot() (map[string]interface{}, error) {
+	return o.snapshotFrom(o.ctx.AsMap(nil, true))
+}
+
+// snapshotFrom completes the given map of the op's context values with the
+// values that are derived at the time of reporting.
+func (o *op) snapshotFrom(ctx map[string]interface{}) (map[string]interface{}, error) {
+	var failure error
+	_failure := o.failure.Load()
+	o.applyTags(ctx)
+	o.recordGoroutineID(ctx)
+	o.recordQueueTimes(ctx)
+	if _failure != nil {
+		failure = _failure.(error)
+		o.mergeErrorFields(ctx, failure)
+		o.applyOnFailure(ctx)
+		_, errorSet := ctx["error"]
+		if !errorSet {
+			ctx["error"] = ErrorText(failure)
+		}
+		if _, codeSet := ctx["error_code"]; !codeSet {
+			if code := ErrorCode(failure); code != "" {
+				ctx["error_code"] = code
+			}
+		}
+		ctx["error_fingerprint"] = Fingerprint(o.name, failure)
+	}
+	o.recordDependencies(ctx, failure != nil)
+	if outcome := o.getOutcome(failure); outcome != Succeeded {
+		ctx["outcome"] = outcome.String()
+	}
+	if priority := o.getPriority(); priority != PriorityNormal {
+		ctx["priority"] = priority.String()
+	}
+	delete(ctx, reporterScopesKey)
+	ctx["schema_version"] = SchemaVersion
+	return ctx, failure
+}
+
+func (o *op) report() *Report {
+	return o.reportFrom(o.snapshot())
+}
+
+func (o *op) reportFrom(ctx map[string]interface{}, failure error) *Report {
+	report := &Report{
+		SchemaVersion: SchemaVersion,
+		Name:          o.name,
+		ID:            o.id,
+		TraceID:       o.traceID,
+		ParentID:      o.parentID,
+		RootID:        o.root.id,
+		Start:         o.start,
+		Duration:      time.Since(o.start),
+		Failure:       failure,
+		Outcome:       o.getOutcome(failure),
+		Priority:      o.getPriority(),
+		Context:       ctx,
+	}
+	switch {
+	case failure != nil:
+		report.Severity = SeverityError
+	case atomic.LoadInt32(&o.warned) == 1:
+		report.Severity = SeverityWarning
+	}
+	if env := Environment(); env != "" {
+		report.Environment = env
+		ctx["environment"] = env
+	}
+	// enrich before scrubbing, since enrichers look up values like client_ip
+	enrich(report)
+	scrub(report)
+	applyPrivacy(report)
+	return report
+}
+
+// ErrorText returns the message of err without the hidden ids that
+// github.com/getlantern/errors embeds in it. Exporters should use it for the
+// text of Report.Failure.
+func ErrorText(err error) string {
+	return hidden.Clean(err.Error())
+}
@@ -0,0 +1,85 @@
+package ops_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStructuredReporter(t *testing.T) {
+	var reported []*ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = append(reported, report)
+	}, "test_structured", "child")
+
+	op := ops.Begin("test_structured")
+	child := op.Begin("child").Set("a", 1)
+	time.Sleep(5 * time.Millisecond)
+	child.FailIf(errors.New("child failed"))
+	child.End()
+	op.End()
+
+	if assert.Len(t, reported, 2) {
+		childReport, parentReport := reported[0], reported[1]
+		assert.False(t, childReport.Succeeded())
+		assert.Equal(t, ops.SchemaVersion, childReport.SchemaVersion)
+		assert.Equal(t, "child", childReport.Name)
+		assert.Equal(t, child.ID(), childReport.ID)
+		assert.Equal(t, op.ID(), childReport.ParentID)
+		assert.Equal(t, op.TraceID(), childReport.TraceID)
+		assert.True(t, childReport.Duration >= 5*time.Millisecond)
+		assert.Equal(t, "child failed", childReport.Context["error"])
+		assert.Equal(t, ops.SchemaVersion, childReport.Context["schema_version"])
+
+		assert.True(t, parentReport.Succeeded())
+		assert.Equal(t, "test_structured", parentReport.Name)
+		assert.Empty(t, parentReport.ParentID)
+		assert.False(t, parentReport.Start.After(childReport.Start))
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	calls := 0
+	op := ops.Begin("test_snapshot").Set("a", 1).SetDynamic("calls", func() interface{} {
+		calls++
+		return calls
+	})
+	defer op.End()
+
+	snapshot := op.Snapshot()
+	assert.Equal(t, "test_snapshot", snapshot["op"])
+	assert.Equal(t, 1, snapshot["a"])
+	assert.Equal(t, 1, snapshot["calls"])
+	assert.Nil(t, snapshot["error"])
+
+	// errors.New captures the current context, which evaluates dynamic values
+	op.FailIf(errors.New("not yet done"))
+	before := calls
+	snapshot = op.Snapshot()
+	assert.Equal(t, before+1, snapshot["calls"])
+	assert.Nil(t, snapshot["error_calls"], "the context captured by the error shouldn't be duplicated")
+	assert.Equal(t, "not yet done", snapshot["error"])
+}
+
+func TestRegisterReporterFor(t *testing.T) {
+	var reported []string
+	ops.RegisterReporterFor(func(failure error, ctx map[string]interface{}) {
+		reported = append(reported, ctx["op"].(string))
+	}, "interesting", "also_interesting")
+
+	ops.Begin("interesting").End()
+	ops.Begin("boring").End()
+	ops.Begin("also_interesting").End()
+	assert.Equal(t, []string{"interesting", "also_interesting"}, reported)
+}
+
+func TestErrorText(t *testing.T) {
+	err := errors.New("dial failed")
+	assert.NotEqual(t, "dial failed", err.Error(), "errors should embed a hidden id")
+	assert.Equal(t, "dial failed", ops.ErrorText(err))
+	assert.Equal(t, "wrapped: dial failed", ops.ErrorText(fmt.Errorf("wrapped: %v", err)))
+}
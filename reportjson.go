@@ -0,0 +1,205 @@
+package ops
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ReportJSONSchema is the JSON Schema describing the canonical JSON encoding of
+// Reports, as produced by Report.MarshalJSON and accepted by
+// Report.UnmarshalJSON. It's the contract for consumers of reports that aren't
+// written in Go, so changes to it follow the same rules as SchemaVersion.
+//
+// In the canonical encoding:
+//
+//   - field names are snake_case
+//   - start is an RFC 3339 timestamp in UTC with nanosecond precision
+//   - duration_ns is the duration in nanoseconds
+//   - severity is one of "info", "warning" or "error"
+//   - failed is true if the op failed, absent on success
+//   - failure is the error message of the failure, absent on success or if
+//     the message is empty
+//   - outcome is one of "succeeded", "failed", "canceled", "timed_out",
+//     "skipped" or "throttled"
+//   - priority is one of "low", "normal" or "high", absent meaning "normal"
+//   - context values of type time.Time are encoded like start, time.Duration
+//     as nanoseconds, errors as their message and anything else that can't be
+//     encoded as JSON, including NaN and infinite numbers, with fmt.Sprint
+const ReportJSONSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "https://github.com/getlantern/ops/report.schema.json",
+  "title": "ops report",
+  "type": "object",
+  "required": ["schema_version", "name", "severity", "start", "duration_ns"],
+  "properties": {
+    "schema_version": {"type": "integer", "minimum": 1},
+    "name": {"type": "string", "minLength": 1},
+    "environment": {"type": "string"},
+    "severity": {"enum": ["info", "warning", "error"]},
+    "id": {"type": "string"},
+    "trace_id": {"type": "string"},
+    "parent_id": {"type": "string"},
+    "root_id": {"type": "string"},
+    "sequence": {"type": "integer", "minimum": 0},
+    "start": {"type": "string", "format": "date-time"},
+    "duration_ns": {"type": "integer", "minimum": 0},
+    "failed": {"type": "boolean"},
+    "failure": {"type": "string"},
+    "outcome": {"enum": ["succeeded", "failed", "canceled", "timed_out", "skipped", "throttled"]},
+    "priority": {"enum": ["low", "normal", "high"]},
+    "in_progress": {"type": "boolean"},
+    "context": {"type": "object"}
+  }
+}`
+
+type jsonReport struct {
+	SchemaVersion int                    `json:"schema_version"`
+	Name          string                 `json:"name"`
+	Environment   string                 `json:"environment,omitempty"`
+	Severity      string                 `json:"severity"`
+	ID            string                 `json:"id,omitempty"`
+	TraceID       string                 `json:"trace_id,omitempty"`
+	ParentID      string                 `json:"parent_id,omitempty"`
+	RootID        string                 `json:"root_id,omitempty"`
+	Sequence      uint64                 `json:"sequence,omitempty"`
+	Start         string                 `json:"start"`
+	DurationNS    int64                  `json:"duration_ns"`
+	Failed        bool                   `json:"failed,omitempty"`
+	Failure       string                 `json:"failure,omitempty"`
+	Outcome       string                 `json:"outcome,omitempty"`
+	Priority      string                 `json:"priority,omitempty"`
+	InProgress    bool                   `json:"in_progress,omitempty"`
+	Context       map[string]interface{} `json:"context,omitempty"`
+}
+
+// ParseSeverity parses the result of Severity.String.
+func ParseSeverity(s string) (Severity, error) {
+	for _, severity := range []Severity{SeverityInfo, SeverityWarning, SeverityError} {
+		if severity.String() == s {
+			return severity, nil
+		}
+	}
+	return SeverityInfo, fmt.Errorf("unknown severity %q", s)
+}
+
+// MarshalJSON implements json.Marshaler using the canonical encoding described
+// by ReportJSONSchema.
+func (r *Report) MarshalJSON() ([]byte, error) {
+	encoded := &jsonReport{
+		SchemaVersion: r.SchemaVersion,
+		Name:          r.Name,
+		Environment:   r.Environment,
+		Severity:      r.Severity.String(),
+		ID:            r.ID,
+		TraceID:       r.TraceID,
+		ParentID:      r.ParentID,
+		RootID:        r.RootID,
+		Sequence:      r.Sequence,
+		Start:         formatJSONTime(r.Start),
+		DurationNS:    int64(r.Duration),
+		Outcome:       r.Outcome.String(),
+		InProgress:    r.InProgress,
+	}
+	if r.Priority != PriorityNormal {
+		encoded.Priority = r.Priority.String()
+	}
+	if r.Failure != nil {
+		encoded.Failed = true
+		encoded.Failure = ErrorText(r.Failure)
+	}
+	if len(r.Context) > 0 {
+		encoded.Context = make(map[string]interface{}, len(r.Context))
+		for key, value := range r.Context {
+			encoded.Context[key] = canonicalJSONValue(value)
+		}
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting the canonical encoding
+// described by ReportJSONSchema. Reports with a schema version newer than
+// SchemaVersion are rejected. The Failure of a decoded report only preserves
+// the error message, and numbers in its Context decode as float64.
+func (r *Report) UnmarshalJSON(b []byte) error {
+	decoded := &jsonReport{}
+	if err := json.Unmarshal(b, decoded); err != nil {
+		return err
+	}
+	switch {
+	case decoded.SchemaVersion < 1:
+		return errors.New("report is missing schema_version")
+	case decoded.SchemaVersion > SchemaVersion:
+		return fmt.Errorf("report has unsupported schema_version %d", decoded.SchemaVersion)
+	case decoded.Name == "":
+		return errors.New("report is missing name")
+	case decoded.DurationNS < 0:
+		return fmt.Errorf("report has negative duration_ns %d", decoded.DurationNS)
+	}
+	severity, err := ParseSeverity(decoded.Severity)
+	if err != nil {
+		return err
+	}
+	start, err := time.Parse(time.RFC3339Nano, decoded.Start)
+	if err != nil {
+		return fmt.Errorf("report has invalid start: %v", err)
+	}
+	*r = Report{
+		SchemaVersion: decoded.SchemaVersion,
+		Name:          decoded.Name,
+		Environment:   decoded.Environment,
+		Severity:      severity,
+		ID:            decoded.ID,
+		TraceID:       decoded.TraceID,
+		ParentID:      decoded.ParentID,
+		RootID:        decoded.RootID,
+		Sequence:      decoded.Sequence,
+		Start:         start,
+		Duration:      time.Duration(decoded.DurationNS),
+		InProgress:    decoded.InProgress,
+		Context:       decoded.Context,
+	}
+	if decoded.Failed || decoded.Failure != "" {
+		r.Failure = errors.New(decoded.Failure)
+	}
+	r.Outcome = outcomeOf(r.Failure)
+	if decoded.Outcome != "" {
+		if r.Outcome, err = ParseOutcome(decoded.Outcome); err != nil {
+			return err
+		}
+	}
+	if decoded.Priority != "" {
+		if r.Priority, err = ParsePriority(decoded.Priority); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatJSONTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func canonicalJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, string, bool, int, int64:
+		return v
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Sprint(v)
+		}
+		return v
+	case time.Time:
+		return formatJSONTime(v)
+	case time.Duration:
+		return int64(v)
+	case error:
+		return ErrorText(v)
+	}
+	if _, err := json.Marshal(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return value
+}
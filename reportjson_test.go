@@ -0,0 +1,99 @@
+package ops_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportJSON(t *testing.T) {
+	start := time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.FixedZone("EST", -5*3600))
+	report := &ops.Report{
+		SchemaVersion: ops.SchemaVersion,
+		Name:          "fetch",
+		Severity:      ops.SeverityError,
+		ID:            "2",
+		TraceID:       "1",
+		Start:         start,
+		Duration:      1500 * time.Millisecond,
+		Failure:       errors.New("timed out"),
+		Context: map[string]interface{}{
+			"host":    "example.com",
+			"elapsed": 2 * time.Second,
+			"at":      start,
+			"cause":   errors.New("eof"),
+			"fn":      func() {},
+			"ratio":   math.NaN(),
+			"limit":   math.Inf(1),
+		},
+	}
+	b, err := json.Marshal(report)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	raw := make(map[string]interface{})
+	if assert.NoError(t, json.Unmarshal(b, &raw)) {
+		assert.Equal(t, "fetch", raw["name"])
+		assert.Equal(t, "error", raw["severity"])
+		assert.Equal(t, "2024-03-01T17:30:00.123456789Z", raw["start"])
+		assert.EqualValues(t, 1500000000, raw["duration_ns"])
+		assert.Equal(t, true, raw["failed"])
+		assert.Equal(t, "timed out", raw["failure"])
+		ctx := raw["context"].(map[string]interface{})
+		assert.EqualValues(t, 2000000000, ctx["elapsed"])
+		assert.Equal(t, "2024-03-01T17:30:00.123456789Z", ctx["at"])
+		assert.Equal(t, "eof", ctx["cause"])
+		assert.NotEmpty(t, ctx["fn"], "unencodable values should be stringified")
+		assert.Equal(t, "NaN", ctx["ratio"])
+		assert.Equal(t, "+Inf", ctx["limit"])
+	}
+
+	decoded := &ops.Report{}
+	if assert.NoError(t, json.Unmarshal(b, decoded)) {
+		assert.Equal(t, "fetch", decoded.Name)
+		assert.Equal(t, ops.SeverityError, decoded.Severity)
+		assert.True(t, start.Equal(decoded.Start))
+		assert.Equal(t, report.Duration, decoded.Duration)
+		assert.EqualError(t, decoded.Failure, "timed out")
+		assert.Equal(t, "example.com", decoded.Context["host"])
+	}
+
+	report.Failure = errors.New("")
+	b, err = json.Marshal(report)
+	decoded = &ops.Report{}
+	if assert.NoError(t, err) && assert.NoError(t, json.Unmarshal(b, decoded)) {
+		assert.False(t, decoded.Succeeded(), "failures without a message should still decode as failures")
+	}
+}
+
+func TestReportJSONValidation(t *testing.T) {
+	for _, invalid := range []string{
+		`{"name": "a", "severity": "info", "start": "2024-03-01T00:00:00Z", "duration_ns": 0}`,
+		`{"schema_version": 99, "name": "a", "severity": "info", "start": "2024-03-01T00:00:00Z", "duration_ns": 0}`,
+		`{"schema_version": 1, "severity": "info", "start": "2024-03-01T00:00:00Z", "duration_ns": 0}`,
+		`{"schema_version": 1, "name": "a", "severity": "fatal", "start": "2024-03-01T00:00:00Z", "duration_ns": 0}`,
+		`{"schema_version": 1, "name": "a", "severity": "info", "start": "yesterday", "duration_ns": 0}`,
+		`{"schema_version": 1, "name": "a", "severity": "info", "start": "2024-03-01T00:00:00Z", "duration_ns": -1}`,
+	} {
+		assert.Error(t, json.Unmarshal([]byte(invalid), &ops.Report{}), invalid)
+	}
+
+	var schema map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(ops.ReportJSONSchema), &schema), "schema should be valid JSON")
+}
+
+func TestParseSeverity(t *testing.T) {
+	for _, severity := range []ops.Severity{ops.SeverityInfo, ops.SeverityWarning, ops.SeverityError} {
+		parsed, err := ops.ParseSeverity(severity.String())
+		assert.NoError(t, err)
+		assert.Equal(t, severity, parsed)
+	}
+	_, err := ops.ParseSeverity("unknown")
+	assert.Error(t, err)
+}
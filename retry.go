@@ -0,0 +1,87 @@
+package ops
+
+import (
+	"time"
+)
+
+// RetryPolicy configures Retry.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	// (default 3).
+	MaxAttempts int
+
+	// Backoff returns how long to wait before the given attempt (2 for the
+	// first retry). If nil, attempts are retried immediately.
+	Backoff func(attempt int) time.Duration
+
+	// Retryable decides whether a failed attempt should be retried. If nil, all
+	// errors are retried.
+	Retryable func(err error) bool
+}
+
+// ExponentialBackoff returns a RetryPolicy.Backoff that waits initial before
+// the first retry and doubles the wait for each subsequent retry, up to max.
+func ExponentialBackoff(initial, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		wait := initial
+		for i := 2; i < attempt && wait < max; i++ {
+			wait *= 2
+		}
+		if wait > max {
+			wait = max
+		}
+		return wait
+	}
+}
+
+// Retry runs fn until it succeeds or the policy says to give up. The whole
+// operation is tracked as an Op with the given name, which only fails if the
+// last attempt failed and records the number of attempts made under
+// "attempts". Each attempt is tracked as a child Op named <name>_attempt,
+// which records its attempt number under "attempt", so retried failures
+// don't inflate the failure rate of the logical operation while the outcome
+// and latency of each attempt remain visible. Attempts contain their failures
+// (see ContainFailures) whatever the FailurePropagation, since the Op fails
+// only if the last attempt does. If the Op has a deadline (see
+// Op.SetDeadline), which it inherits like any other, Retry gives up once the
+// deadline has passed or the backoff would outlast it. Retry returns the error
+// of the last attempt.
+func Retry(name string, policy RetryPolicy, fn func(attempt Op) error) error {
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	o := Begin(name)
+	var err error
+	attempt := 1
+	for ; ; attempt++ {
+		a := o.Begin(name+"_attempt").Set("attempt", attempt).SetFailurePropagation(ContainFailures)
+		err = a.EndWithError(fn(a))
+		if err == nil || attempt == maxAttempts || (policy.Retryable != nil && !policy.Retryable(err)) {
+			break
+		}
+		if !waitToRetry(o, policy, attempt+1) {
+			break
+		}
+	}
+	o.Set("attempts", attempt)
+	return o.EndWithError(err)
+}
+
+// waitToRetry waits for the backoff before the given attempt, returning false
+// without waiting if the op's deadline would pass first.
+func waitToRetry(o Op, policy RetryPolicy, attempt int) bool {
+	remaining, hasDeadline := o.RemainingBudget()
+	if hasDeadline && remaining <= 0 {
+		return false
+	}
+	if policy.Backoff == nil {
+		return true
+	}
+	wait := policy.Backoff(attempt)
+	if hasDeadline && wait >= remaining {
+		return false
+	}
+	time.Sleep(wait)
+	return true
+}
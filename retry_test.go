@@ -0,0 +1,113 @@
+package ops_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	var reported []*ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = append(reported, report)
+	}, "test_retry", "test_retry_attempt")
+
+	calls := 0
+	err := ops.Retry("test_retry", ops.RetryPolicy{MaxAttempts: 5}, func(attempt ops.Op) error {
+		calls++
+		if calls < 3 {
+			return errors.New("flaky")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, reported, 4) {
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, "test_retry_attempt", reported[i].Name)
+			assert.Equal(t, i+1, reported[i].Context["attempt"])
+			assert.Equal(t, reported[3].ID, reported[i].ParentID)
+		}
+		assert.False(t, reported[0].Succeeded())
+		assert.True(t, reported[2].Succeeded())
+		assert.Equal(t, "test_retry", reported[3].Name)
+		assert.True(t, reported[3].Succeeded())
+		assert.Equal(t, 3, reported[3].Context["attempts"])
+	}
+
+	reported = nil
+	permanent := errors.New("permanent")
+	err = ops.Retry("test_retry", ops.RetryPolicy{
+		Retryable: func(err error) bool { return err != permanent },
+	}, func(attempt ops.Op) error {
+		return permanent
+	})
+	assert.Equal(t, permanent, err)
+	if assert.Len(t, reported, 2) {
+		assert.False(t, reported[1].Succeeded())
+		assert.Equal(t, 1, reported[1].Context["attempts"])
+	}
+
+	reported = nil
+	ops.Retry("test_retry", ops.RetryPolicy{}, func(attempt ops.Op) error {
+		return errors.New("always")
+	})
+	assert.Len(t, reported, 4)
+}
+
+func TestRetryContainsAttemptFailures(t *testing.T) {
+	ops.SetFailurePropagation(ops.PropagateFailures)
+	defer ops.SetFailurePropagation(ops.ContainFailures)
+
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_retry_propagate")
+
+	calls := 0
+	err := ops.Retry("test_retry_propagate", ops.RetryPolicy{}, func(attempt ops.Op) error {
+		calls++
+		if calls == 1 {
+			return errors.New("flaky")
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	if assert.NotNil(t, reported) {
+		assert.True(t, reported.Succeeded(), "a failed attempt shouldn't fail the op once a later attempt succeeds")
+		assert.Nil(t, reported.Context["failed_child"])
+	}
+}
+
+func TestRetryDeadline(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_retry_deadline")
+
+	parent := ops.Begin("test_retry_deadline_parent").SetDeadline(time.Now().Add(30 * time.Millisecond))
+	defer parent.End()
+	start := time.Now()
+	err := ops.Retry("test_retry_deadline", ops.RetryPolicy{
+		MaxAttempts: 10,
+		Backoff:     func(attempt int) time.Duration { return 20 * time.Millisecond },
+	}, func(attempt ops.Op) error {
+		return errors.New("always")
+	})
+	assert.Equal(t, "always", ops.ErrorText(err))
+	assert.True(t, time.Since(start) < 100*time.Millisecond, "shouldn't keep retrying past the deadline")
+	if assert.NotNil(t, reported) {
+		assert.True(t, reported.Context["attempts"].(int) < 10)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ops.ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, backoff(2))
+	assert.Equal(t, 20*time.Millisecond, backoff(3))
+	assert.Equal(t, 40*time.Millisecond, backoff(4))
+	assert.Equal(t, 50*time.Millisecond, backoff(5))
+	assert.Equal(t, 50*time.Millisecond, backoff(10))
+}
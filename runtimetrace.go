@@ -0,0 +1,57 @@
+package ops
+
+import (
+	stdcontext "context"
+	"runtime/trace"
+	"sync/atomic"
+)
+
+var runtimeTracing int32
+
+// EnableRuntimeTrace controls whether ops are recorded with runtime/trace while
+// an execution trace is being collected. When enabled, every root op becomes a
+// trace task and every op begun under it becomes a region within that task, so
+// that 'go tool trace' shows application level operations alongside scheduler
+// events. Regions should be ended on the goroutine that began them.
+func EnableRuntimeTrace(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&runtimeTracing, value)
+}
+
+type runtimeTrace struct {
+	ctx    stdcontext.Context
+	task   *trace.Task
+	region *trace.Region
+}
+
+func (o *op) startRuntimeTrace(parent *op) {
+	if atomic.LoadInt32(&runtimeTracing) == 0 || !trace.IsEnabled() {
+		return
+	}
+	if parent == nil || parent.rtrace == nil {
+		ctx, task := trace.NewTask(stdcontext.Background(), o.name)
+		o.rtrace = &runtimeTrace{ctx: ctx, task: task}
+		return
+	}
+	o.rtrace = &runtimeTrace{
+		ctx:    parent.rtrace.ctx,
+		region: trace.StartRegion(parent.rtrace.ctx, o.name),
+	}
+}
+
+func (o *op) endRuntimeTrace() {
+	if o.rtrace == nil {
+		return
+	}
+	if o.failure.Load() != nil {
+		trace.Log(o.rtrace.ctx, "failure", ErrorText(o.failure.Load().(error)))
+	}
+	if o.rtrace.region != nil {
+		o.rtrace.region.End()
+	} else {
+		o.rtrace.task.End()
+	}
+}
@@ -0,0 +1,30 @@
+package ops_test
+
+import (
+	"bytes"
+	"runtime/trace"
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuntimeTrace(t *testing.T) {
+	ops.EnableRuntimeTrace(true)
+	defer ops.EnableRuntimeTrace(false)
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, trace.Start(&buf)) {
+		return
+	}
+	op := ops.Begin("traced_root")
+	child := op.Begin("traced_child")
+	child.FailIf(errors.New("traced failure"))
+	child.End()
+	op.End()
+	trace.Stop()
+
+	assert.Contains(t, buf.String(), "traced_root")
+	assert.Contains(t, buf.String(), "traced_child")
+}
@@ -0,0 +1,137 @@
+package ops
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sampler decides whether a report gets delivered to reporters.
+type Sampler func(report *Report) bool
+
+var currentSampler atomic.Value
+
+// SetSampler sets the Sampler used to decide which reports are delivered to
+// reporters. A nil Sampler (the default) delivers all reports.
+func SetSampler(sampler Sampler) {
+	currentSampler.Store(sampler)
+}
+
+func sample(report *Report) bool {
+	sampler, _ := currentSampler.Load().(Sampler)
+	return sampler == nil || sampler(report)
+}
+
+// OutcomeSampler returns a Sampler that keeps the given fraction (0 to 1) of
+// successful and failed reports respectively. If maxFailuresPerSecond is
+// greater than 0, no more than that many failures are kept per second for each
+// op name. Kept reports with a rate below 1 get the key "sample_rate" so that
+// consumers can scale counts accordingly.
+func OutcomeSampler(successRate float64, failureRate float64, maxFailuresPerSecond int) Sampler {
+	s := &outcomeSampler{
+		successRate:          successRate,
+		failureRate:          failureRate,
+		maxFailuresPerSecond: maxFailuresPerSecond,
+		failureCounts:        make(map[string]*secondCount),
+	}
+	return s.sample
+}
+
+type outcomeSampler struct {
+	successRate          float64
+	failureRate          float64
+	maxFailuresPerSecond int
+	failureCounts        map[string]*secondCount
+	mx                   sync.Mutex
+}
+
+type secondCount struct {
+	second int64
+	count  int
+}
+
+func (s *outcomeSampler) sample(report *Report) bool {
+	rate := s.successRate
+	if !report.Succeeded() {
+		rate = s.failureRate
+	}
+	if rate <= 0 || (rate < 1 && rand.Float64() >= rate) {
+		return false
+	}
+	if !report.Succeeded() && !s.allowFailure(report.Name) {
+		return false
+	}
+	if rate < 1 {
+		report.Context["sample_rate"] = rate
+	}
+	return true
+}
+
+func (s *outcomeSampler) allowFailure(name string) bool {
+	if s.maxFailuresPerSecond <= 0 {
+		return true
+	}
+	second := time.Now().Unix()
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	count := s.failureCounts[name]
+	if count == nil {
+		count = &secondCount{}
+		s.failureCounts[name] = count
+	}
+	if count.second != second {
+		count.second = second
+		count.count = 0
+	}
+	if count.count >= s.maxFailuresPerSecond {
+		return false
+	}
+	count.count++
+	return true
+}
+
+// minSlowestObservations is how many ops of a given name SlowestSampler needs
+// to see before it trusts its histogram.
+const minSlowestObservations = 100
+
+// SlowestSampler returns a Sampler that always keeps reports whose duration is
+// in the slowest fraction (e.g. 0.05 for the slowest 5%) of recent reports for
+// the same op name, as learned from a rolling histogram. All other reports are
+// left to the otherwise Sampler (and dropped if it's nil). Until enough ops of
+// a given name have been seen, all reports are left to otherwise.
+func SlowestSampler(fraction float64, otherwise Sampler) Sampler {
+	s := &slowestSampler{
+		fraction:   fraction,
+		otherwise:  otherwise,
+		histograms: make(map[string]*histogram),
+	}
+	return s.sample
+}
+
+type slowestSampler struct {
+	fraction   float64
+	otherwise  Sampler
+	histograms map[string]*histogram
+	mx         sync.Mutex
+}
+
+func (s *slowestSampler) sample(report *Report) bool {
+	if report.InProgress {
+		return s.otherwise != nil && s.otherwise(report)
+	}
+	s.mx.Lock()
+	h := s.histograms[report.Name]
+	if h == nil {
+		h = newHistogram(10000)
+		s.histograms[report.Name] = h
+	}
+	slow := h.total >= minSlowestObservations && report.Duration >= h.quantile(1-s.fraction)
+	h.observe(report.Duration)
+	s.mx.Unlock()
+
+	if slow {
+		return true
+	}
+	return s.otherwise != nil && s.otherwise(report)
+}
@@ -0,0 +1,69 @@
+package ops_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutcomeSampler(t *testing.T) {
+	sampler := ops.OutcomeSampler(0, 1, 2)
+	success := func() *ops.Report {
+		return &ops.Report{Name: "sampled", Context: make(map[string]interface{})}
+	}
+	failure := func(name string) *ops.Report {
+		return &ops.Report{Name: name, Failure: errors.New("fail"), Context: make(map[string]interface{})}
+	}
+
+	assert.False(t, sampler(success()))
+	assert.True(t, sampler(failure("sampled")))
+	assert.True(t, sampler(failure("sampled")))
+	assert.False(t, sampler(failure("sampled")), "failures should be capped per second")
+	assert.True(t, sampler(failure("other")), "cap should apply per op name")
+
+	kept := 0
+	sampler = ops.OutcomeSampler(0.5, 1, 0)
+	for i := 0; i < 1000; i++ {
+		report := success()
+		if sampler(report) {
+			kept++
+			assert.Equal(t, 0.5, report.Context["sample_rate"])
+		}
+	}
+	assert.InDelta(t, 500, kept, 100)
+}
+
+func TestSetSampler(t *testing.T) {
+	defer ops.SetSampler(nil)
+
+	var reported []string
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = append(reported, report.Name)
+	}, "sampled_success", "sampled_failure")
+	ops.SetSampler(ops.OutcomeSampler(0, 1, 0))
+	ops.Begin("sampled_success").End()
+	op := ops.Begin("sampled_failure")
+	op.FailIf(errors.New("fail"))
+	op.End()
+	assert.Equal(t, []string{"sampled_failure"}, reported)
+}
+
+func TestSlowestSampler(t *testing.T) {
+	sampler := ops.SlowestSampler(0.05, nil)
+	report := func(d time.Duration) *ops.Report {
+		return &ops.Report{Name: "slowest", Duration: d, Context: make(map[string]interface{})}
+	}
+
+	for i := 0; i < 200; i++ {
+		sampler(report(time.Duration(i%100) * time.Millisecond))
+	}
+	assert.True(t, sampler(report(time.Second)))
+	assert.True(t, sampler(report(99*time.Millisecond)))
+	assert.False(t, sampler(report(10*time.Millisecond)))
+
+	sampler = ops.SlowestSampler(0.05, ops.OutcomeSampler(1, 1, 0))
+	assert.True(t, sampler(report(time.Millisecond)), "should fall back to otherwise sampler")
+}
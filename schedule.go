@@ -0,0 +1,97 @@
+package ops
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Job is a periodic job started with Schedule.
+type Job struct {
+	name     string
+	interval time.Duration
+	jitter   time.Duration
+	fn       func(Op) error
+	running  bool
+	missed   int
+	runs     int
+	mx       sync.Mutex
+	wg       sync.WaitGroup
+	stop     chan interface{}
+	stopOnce sync.Once
+}
+
+// Schedule runs fn every interval, each time in a new Op with the given name.
+// If a run is still in progress when the next one is due, the next one is
+// skipped and counted; the next run that does happen records the number of
+// skipped runs under missed_runs. Each run's op also records its sequence
+// number under run. Errors returned by fn fail the run's Op.
+func Schedule(name string, interval time.Duration, fn func(Op) error) *Job {
+	return ScheduleWithJitter(name, interval, 0, fn)
+}
+
+// ScheduleWithJitter is like Schedule but delays each run by a random
+// duration of up to jitter, to avoid many processes running jobs in lockstep.
+func ScheduleWithJitter(name string, interval time.Duration, jitter time.Duration, fn func(Op) error) *Job {
+	job := &Job{
+		name:     name,
+		interval: interval,
+		jitter:   jitter,
+		fn:       fn,
+		stop:     make(chan interface{}),
+	}
+	go job.schedule()
+	return job
+}
+
+func (job *Job) schedule() {
+	next := time.Now()
+	for {
+		next = next.Add(job.interval)
+		delay := time.Until(next)
+		if job.jitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(job.jitter)))
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+			job.trigger()
+		case <-job.stop:
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (job *Job) trigger() {
+	job.mx.Lock()
+	if job.running {
+		job.missed++
+		job.mx.Unlock()
+		return
+	}
+	job.running = true
+	job.runs++
+	run, missed := job.runs, job.missed
+	job.missed = 0
+	job.wg.Add(1)
+	job.mx.Unlock()
+
+	go func() {
+		defer job.wg.Done()
+		o := Begin(job.name).Set("run", run).Set("missed_runs", missed)
+		o.FailIf(job.fn(o))
+		o.End()
+		job.mx.Lock()
+		job.running = false
+		job.mx.Unlock()
+	}()
+}
+
+// Stop stops scheduling runs and waits for any run in progress to finish.
+func (job *Job) Stop() {
+	job.stopOnce.Do(func() {
+		close(job.stop)
+	})
+	job.wg.Wait()
+}
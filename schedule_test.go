@@ -0,0 +1,43 @@
+package ops_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedule(t *testing.T) {
+	var mx sync.Mutex
+	var reported []*ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		mx.Lock()
+		reported = append(reported, report)
+		mx.Unlock()
+	}, "scheduled")
+
+	job := ops.Schedule("scheduled", 10*time.Millisecond, func(op ops.Op) error {
+		// The first run overlaps with the next two
+		if op.Snapshot()["run"] == 1 {
+			time.Sleep(25 * time.Millisecond)
+			return errors.New("slow run")
+		}
+		return nil
+	})
+	time.Sleep(55 * time.Millisecond)
+	job.Stop()
+
+	mx.Lock()
+	defer mx.Unlock()
+	if assert.True(t, len(reported) >= 2) {
+		assert.False(t, reported[0].Succeeded())
+		assert.Equal(t, 1, reported[0].Context["run"])
+		assert.Equal(t, 0, reported[0].Context["missed_runs"])
+		assert.True(t, reported[1].Succeeded())
+		assert.Equal(t, 2, reported[1].Context["run"])
+		assert.Equal(t, 2, reported[1].Context["missed_runs"])
+	}
+}
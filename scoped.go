@@ -0,0 +1,87 @@
+package ops
+
+import (
+	"sync/atomic"
+)
+
+// scopedReporterCount counts all scoped reporters ever registered, so that ops
+// can skip looking for them when there are none.
+var scopedReporterCount int32
+
+// activeReporterScopes counts the reporters added with WithReporter whose op
+// hasn't ended yet, so that ops can skip looking for them when there are none.
+var activeReporterScopes int32
+
+// reporterScopesKey is the context key holding the reporters added with
+// WithReporter, which is left out of reports.
+const reporterScopesKey = "_reporter_scopes"
+
+// reporterScope is a reporter added with WithReporter.
+type reporterScope struct {
+	reporter StructuredReporter
+	ended    int32
+}
+
+func (o *op) RegisterReporter(reporter Reporter) Op {
+	return o.RegisterStructuredReporter(func(report *Report) {
+		reporter(report.Failure, report.Context)
+	})
+}
+
+func (o *op) RegisterStructuredReporter(reporter StructuredReporter) Op {
+	atomic.AddInt32(&scopedReporterCount, 1)
+	o.scopedMx.Lock()
+	o.scoped = append(o.scoped, reporter)
+	o.scopedMx.Unlock()
+	return o
+}
+
+func (o *op) WithReporter(reporter StructuredReporter) Op {
+	atomic.AddInt32(&activeReporterScopes, 1)
+	scope := &reporterScope{reporter: reporter}
+	inherited, _ := o.lookup(reporterScopesKey).([]*reporterScope)
+	scopes := make([]*reporterScope, 0, len(inherited)+1)
+	scopes = append(append(scopes, inherited...), scope)
+	o.putLookup(reporterScopesKey, scopes)
+	o.scopedMx.Lock()
+	o.ownScopes = append(o.ownScopes, scope)
+	o.scopedMx.Unlock()
+	return o
+}
+
+// endReporterScopes removes the reporters added to this op with WithReporter
+// once it has been reported.
+func (o *op) endReporterScopes() {
+	o.scopedMx.Lock()
+	scopes := o.ownScopes
+	o.ownScopes = nil
+	o.scopedMx.Unlock()
+	for _, scope := range scopes {
+		if atomic.CompareAndSwapInt32(&scope.ended, 0, 1) {
+			atomic.AddInt32(&activeReporterScopes, -1)
+		}
+	}
+}
+
+// reporters returns the global reporters interested in this op plus any
+// reporters scoped to it or its ancestors and those added with WithReporter to
+// ops whose context it inherits that haven't ended yet.
+func (o *op) reporters() []StructuredReporter {
+	result := currentReporters(o.name)
+	if atomic.LoadInt32(&scopedReporterCount) > 0 {
+		for current := o; current != nil; current = current.parent {
+			current.scopedMx.RLock()
+			result = append(result, current.scoped...)
+			current.scopedMx.RUnlock()
+		}
+	}
+	if atomic.LoadInt32(&activeReporterScopes) > 0 {
+		scopes, _ := o.lookup(reporterScopesKey).([]*reporterScope)
+		for _, scope := range scopes {
+			if atomic.LoadInt32(&scope.ended) == 0 {
+				result = append(result, scope.reporter)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,63 @@
+package ops_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScopedReporter(t *testing.T) {
+	var scoped []string
+	root := ops.Begin("scoped_root").RegisterReporter(func(failure error, ctx map[string]interface{}) {
+		scoped = append(scoped, ctx["op"].(string))
+	})
+	child := root.Begin("scoped_child")
+	child.Begin("scoped_grandchild").End()
+	child.End()
+	ops.Begin("unrelated").End()
+	root.End()
+
+	assert.Equal(t, []string{"scoped_grandchild", "scoped_child", "scoped_root"}, scoped)
+}
+
+func TestWithReporter(t *testing.T) {
+	t.Run("getlantern", testWithReporter(ops.GetlanternContextBackend))
+	t.Run("native", testWithReporter(ops.NativeContextBackend))
+}
+
+func testWithReporter(backend ops.ContextBackend) func(t *testing.T) {
+	return func(t *testing.T) {
+		ops.SetContextBackend(backend)
+		defer ops.SetContextBackend(ops.GetlanternContextBackend)
+		var mx sync.Mutex
+		var captured []string
+		capture := func(report *ops.Report) {
+			mx.Lock()
+			captured = append(captured, report.Name)
+			mx.Unlock()
+			assert.NotContains(t, report.Context, "_reporter_scopes")
+		}
+		var outer []string
+		request := ops.Begin("request").WithReporter(capture)
+		request.Begin("request_child").WithReporter(func(report *ops.Report) {
+			outer = append(outer, report.Name)
+		}).End()
+		ops.Begin("request_ambient").End()
+		var wg sync.WaitGroup
+		wg.Add(1)
+		request.Go(func() {
+			ops.Begin("request_goroutine").End()
+			wg.Done()
+		})
+		wg.Wait()
+		late := request.Begin("request_late")
+		request.End()
+		late.End()
+		ops.Begin("after_request").End()
+
+		assert.Equal(t, []string{"request_child", "request_ambient", "request_goroutine", "request"}, captured)
+		assert.Equal(t, []string{"request_child"}, outer, "reporter should only receive reports for its op's extent")
+	}
+}
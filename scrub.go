@@ -0,0 +1,85 @@
+package ops
+
+import (
+	"regexp"
+	"sync/atomic"
+)
+
+// Scrubber removes sensitive data, like user URLs or email addresses, from an
+// error message.
+type Scrubber func(msg string) string
+
+var (
+	scrubEmailPattern = regexp.MustCompile(`[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}`)
+	scrubURLPattern   = regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.\-]*://[^\s"'<>]*[^\s"'<>.,:;)]`)
+
+	currentScrubber atomic.Value
+)
+
+// ScrubIPs replaces IPv4 and IPv6 addresses (with optional ports) with <ip>.
+func ScrubIPs(msg string) string {
+	msg = ipv4Pattern.ReplaceAllString(msg, "<ip>")
+	return ipv6Pattern.ReplaceAllString(msg, "<ip>")
+}
+
+// ScrubEmails replaces email addresses with <email>.
+func ScrubEmails(msg string) string {
+	return scrubEmailPattern.ReplaceAllString(msg, "<email>")
+}
+
+// ScrubURLs replaces URLs with <url>.
+func ScrubURLs(msg string) string {
+	return scrubURLPattern.ReplaceAllString(msg, "<url>")
+}
+
+// Scrubbers combines the given scrubbers, applying them in order.
+func Scrubbers(scrubbers ...Scrubber) Scrubber {
+	return func(msg string) string {
+		for _, scrubber := range scrubbers {
+			msg = scrubber(msg)
+		}
+		return msg
+	}
+}
+
+// DefaultScrubber scrubs URLs, then email addresses, then IP addresses.
+var DefaultScrubber = Scrubbers(ScrubURLs, ScrubEmails, ScrubIPs)
+
+// SetScrubber sets the Scrubber applied to reports before they're delivered:
+// to every string value in their context, which covers the "error" key, other
+// errors recorded by the op (like "warning", "read_error" and "write_error")
+// and context merged in from errors, and to the message of Report.Failure,
+// which still unwraps to the original error. Pass nil to disable scrubbing,
+// which is the default. Error fingerprints are computed from the unscrubbed
+// message.
+func SetScrubber(scrubber Scrubber) {
+	currentScrubber.Store(scrubber)
+}
+
+func scrub(report *Report) {
+	scrubber, _ := currentScrubber.Load().(Scrubber)
+	if scrubber == nil {
+		return
+	}
+	for key, value := range report.Context {
+		if msg, ok := value.(string); ok {
+			report.Context[key] = scrubber(msg)
+		}
+	}
+	if report.Failure != nil {
+		report.Failure = &scrubbedError{msg: scrubber(ErrorText(report.Failure)), err: report.Failure}
+	}
+}
+
+type scrubbedError struct {
+	msg string
+	err error
+}
+
+func (e *scrubbedError) Error() string {
+	return e.msg
+}
+
+func (e *scrubbedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,87 @@
+package ops_test
+
+import (
+	stderrors "errors"
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrubbers(t *testing.T) {
+	assert.Equal(t, "dial <ip> failed", ops.ScrubIPs("dial 10.1.2.3:443 failed"))
+	assert.Equal(t, "dial <ip> failed", ops.ScrubIPs("dial [2001:db8::1]:443 failed"))
+	assert.Equal(t, "no account for <email>", ops.ScrubEmails("no account for jane.doe+x@example.com"))
+	assert.Equal(t, "GET <url>: 404", ops.ScrubURLs("GET https://example.com/users/5?token=x: 404"))
+	assert.Equal(t, "fetch <url> for <email> via <ip>",
+		ops.DefaultScrubber("fetch http://1.2.3.4/a for a@b.io via 5.6.7.8"))
+}
+
+func TestSetScrubber(t *testing.T) {
+	ops.SetScrubber(ops.DefaultScrubber)
+	defer ops.SetScrubber(nil)
+
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_scrub")
+
+	original := errors.New("user bob@example.com not found")
+	op := ops.Begin("test_scrub")
+	op.FailIf(original)
+	op.End()
+
+	if assert.NotNil(t, reported) {
+		assert.Equal(t, "user <email> not found", reported.Context["error"])
+		assert.Equal(t, "user <email> not found", reported.Failure.Error())
+		assert.True(t, stderrors.Is(reported.Failure, original))
+		assert.Equal(t, ops.Fingerprint("test_scrub", original), reported.Context["error_fingerprint"])
+	}
+}
+
+func TestScrubOtherErrors(t *testing.T) {
+	ops.SetScrubber(ops.DefaultScrubber)
+	defer ops.SetScrubber(nil)
+
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_scrub_other")
+
+	op := ops.Begin("test_scrub_other")
+	op.Warn(errors.New("retrying https://example.com/users/5"))
+	op.Set("read_error", "read from 10.1.2.3:443 failed")
+	op.FailIf(errors.New("failed").With("account", "bob@example.com"))
+	op.End()
+
+	if assert.NotNil(t, reported) {
+		assert.Equal(t, "retrying <url>", reported.Context["warning"])
+		assert.Equal(t, "read from <ip> failed", reported.Context["read_error"])
+		assert.Equal(t, "<email>", reported.Context["account"])
+		assert.Equal(t, "test_scrub_other", reported.Context["op"])
+	}
+}
+
+func TestScrubAfterEnrich(t *testing.T) {
+	ops.SetScrubber(ops.DefaultScrubber)
+	defer ops.SetScrubber(nil)
+
+	geoip := ops.GeoIPEnricher(testGeoIP{"5.160.0.1": {Country: "IR"}})
+	ops.RegisterEnricher(ops.EnricherFunc(func(ctx map[string]interface{}, failure error) {
+		if ctx["op"] == "test_scrub_geoip" {
+			geoip.Enrich(ctx, failure)
+		}
+	}))
+
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_scrub_geoip")
+
+	ops.Begin("test_scrub_geoip").Set("client_ip", "5.160.0.1:51234").End()
+	if assert.NotNil(t, reported) {
+		assert.Equal(t, "IR", reported.Context["client_country"], "enrichers should see unscrubbed values")
+		assert.Equal(t, "<ip>", reported.Context["client_ip"])
+	}
+}
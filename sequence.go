@@ -0,0 +1,174 @@
+package ops
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// nextSequence returns the next sequence number for reports of ops under this
+// root.
+func (o *op) nextSequence() uint64 {
+	return atomic.AddUint64(&o.root.sequence, 1)
+}
+
+// OrderingBuffer is a StructuredReporter that delivers the reports of each
+// root op to downstream reporters in the order the ops ended (see
+// Report.Sequence), even if concurrent child ops reach it out of order.
+// Reports are held until all reports with lower sequence numbers have been
+// delivered or, since some reports never arrive (for example because they
+// were sampled out), until they've waited for the configured window. Reports
+// without a sequence number are delivered immediately.
+type OrderingBuffer struct {
+	window     time.Duration
+	downstream []StructuredReporter
+	roots      map[string]*orderedRoot
+	mx         sync.Mutex
+	stop       chan interface{}
+	stopOnce   sync.Once
+}
+
+type orderedRoot struct {
+	next     uint64
+	pending  map[uint64]*pendingReport
+	lastSeen time.Time
+}
+
+type pendingReport struct {
+	report   *Report
+	received time.Time
+}
+
+// NewOrderingBuffer creates an OrderingBuffer that holds out of order reports
+// for up to window before delivering them to the given downstream reporters.
+// Register it with RegisterStructuredReporter(buffer.Report).
+func NewOrderingBuffer(window time.Duration, downstream ...StructuredReporter) *OrderingBuffer {
+	b := &OrderingBuffer{
+		window:     window,
+		downstream: downstream,
+		roots:      make(map[string]*orderedRoot),
+		stop:       make(chan interface{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *OrderingBuffer) run() {
+	ticker := time.NewTicker(b.window / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.expire(time.Now())
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Report buffers the given report, delivering it and any reports it was
+// holding up once they're in order. Downstream reporters are called while the
+// buffer is locked, so they should return quickly.
+func (b *OrderingBuffer) Report(report *Report) {
+	if report.Sequence == 0 || report.RootID == "" {
+		b.deliver(report)
+		return
+	}
+	now := time.Now()
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	root := b.roots[report.RootID]
+	if root == nil {
+		root = &orderedRoot{next: 1, pending: make(map[uint64]*pendingReport)}
+		b.roots[report.RootID] = root
+	}
+	root.lastSeen = now
+	if report.Sequence < root.next {
+		// We already gave up waiting for this one
+		b.deliver(report)
+		return
+	}
+	root.pending[report.Sequence] = &pendingReport{report.Retain(), now}
+	b.drain(root)
+}
+
+// drain delivers the pending reports of root that are next in order.
+func (b *OrderingBuffer) drain(root *orderedRoot) {
+	for {
+		pending, found := root.pending[root.next]
+		if !found {
+			return
+		}
+		delete(root.pending, root.next)
+		root.next++
+		b.deliver(pending.report)
+	}
+}
+
+// expire stops waiting for missing reports that have held up other reports
+// for longer than the window, and forgets about roots that have been idle for
+// a while.
+func (b *OrderingBuffer) expire(now time.Time) {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	for rootID, root := range b.roots {
+		for _, seq := range root.sortedPending() {
+			pending, found := root.pending[seq]
+			if !found {
+				// already delivered while draining
+				continue
+			}
+			if now.Sub(pending.received) < b.window {
+				break
+			}
+			root.next = seq
+			b.drain(root)
+		}
+		if len(root.pending) == 0 && now.Sub(root.lastSeen) > 10*b.window {
+			delete(b.roots, rootID)
+		}
+	}
+}
+
+func (root *orderedRoot) sortedPending() []uint64 {
+	seqs := make([]uint64, 0, len(root.pending))
+	for seq := range root.pending {
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i] < seqs[j]
+	})
+	return seqs
+}
+
+func (b *OrderingBuffer) deliver(report *Report) {
+	for _, reporter := range b.downstream {
+		reporter(report)
+	}
+}
+
+// Flush immediately delivers all held reports in order, without waiting for
+// missing ones.
+func (b *OrderingBuffer) Flush() {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	for _, root := range b.roots {
+		for _, seq := range root.sortedPending() {
+			if _, found := root.pending[seq]; !found {
+				// already delivered while draining
+				continue
+			}
+			root.next = seq
+			b.drain(root)
+		}
+	}
+}
+
+// Stop stops expiring held reports, flushing any that are still held.
+func (b *OrderingBuffer) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.stop)
+		b.Flush()
+	})
+}
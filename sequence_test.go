@@ -0,0 +1,70 @@
+package ops_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequence(t *testing.T) {
+	var reported []*ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		if report.RootID != "" {
+			reported = append(reported, report)
+		}
+	}, "sequence_root", "sequence_a", "sequence_b")
+
+	root := ops.Begin("sequence_root")
+	a := root.Begin("sequence_a")
+	b := root.Begin("sequence_b")
+	b.End()
+	a.End()
+	root.End()
+
+	var sequences []uint64
+	for _, report := range reported {
+		if report.RootID == root.ID() {
+			sequences = append(sequences, report.Sequence)
+		}
+	}
+	assert.Equal(t, []uint64{1, 2, 3}, sequences)
+}
+
+func TestOrderingBuffer(t *testing.T) {
+	var mx sync.Mutex
+	var delivered []string
+	b := ops.NewOrderingBuffer(50*time.Millisecond, func(report *ops.Report) {
+		mx.Lock()
+		delivered = append(delivered, report.Name)
+		mx.Unlock()
+	})
+	defer b.Stop()
+
+	report := func(name string, seq uint64) *ops.Report {
+		return &ops.Report{Name: name, RootID: "root", Sequence: seq}
+	}
+	b.Report(report("third", 3))
+	b.Report(report("second", 2))
+	b.Report(&ops.Report{Name: "unsequenced"})
+	assert.Equal(t, []string{"unsequenced"}, delivered, "should hold reports until they're in order")
+	b.Report(report("first", 1))
+	assert.Equal(t, []string{"unsequenced", "first", "second", "third"}, delivered)
+
+	delivered = nil
+	b.Report(report("sixth", 6))
+	b.Report(report("fifth", 5))
+	time.Sleep(200 * time.Millisecond)
+	mx.Lock()
+	assert.Equal(t, []string{"fifth", "sixth"}, delivered, "should stop waiting for missing reports after the window")
+	mx.Unlock()
+	b.Report(report("fourth", 4))
+	assert.Equal(t, []string{"fifth", "sixth", "fourth"}, delivered, "late reports should be delivered immediately")
+
+	delivered = nil
+	b.Report(report("eighth", 8))
+	b.Flush()
+	assert.Equal(t, []string{"eighth"}, delivered)
+}
@@ -0,0 +1,57 @@
+package ops
+
+import (
+	"sync/atomic"
+)
+
+// Severity classifies reports.
+type Severity int
+
+const (
+	// SeverityInfo is the severity of successful ops.
+	SeverityInfo Severity = iota
+	// SeverityWarning is the severity of successful ops that had warnings.
+	SeverityWarning
+	// SeverityError is the severity of failed ops.
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return "unknown"
+}
+
+func (o *op) Warn(err error) error {
+	if err != nil {
+		atomic.StoreInt32(&o.warned, 1)
+		o.ctx.Put("warning", ErrorText(err))
+	}
+	return err
+}
+
+// Routes maps severities to the reporters that should receive reports of that
+// severity.
+type Routes map[Severity][]StructuredReporter
+
+// Route returns a StructuredReporter that delivers each report to the
+// reporters routed for its severity, for example:
+//
+//	ops.RegisterStructuredReporter(ops.Route(ops.Routes{
+//		ops.SeverityInfo:    {statsd},
+//		ops.SeverityWarning: {logs},
+//		ops.SeverityError:   {sentry, statsd},
+//	}))
+func Route(routes Routes) StructuredReporter {
+	return func(report *Report) {
+		for _, reporter := range routes[report.Severity] {
+			reporter(report)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package ops_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoute(t *testing.T) {
+	var metrics, alerts, logs []string
+	collect := func(into *[]string) ops.StructuredReporter {
+		return func(report *ops.Report) {
+			*into = append(*into, report.Name)
+		}
+	}
+	ops.RegisterStructuredReporterFor(ops.Route(ops.Routes{
+		ops.SeverityInfo:    {collect(&metrics)},
+		ops.SeverityWarning: {collect(&logs)},
+		ops.SeverityError:   {collect(&alerts), collect(&metrics)},
+	}), "route_success", "route_warning", "route_failure")
+
+	ops.Begin("route_success").End()
+	op := ops.Begin("route_warning")
+	op.Warn(errors.New("slow upstream"))
+	op.End()
+	op = ops.Begin("route_failure")
+	op.Warn(errors.New("slow upstream"))
+	op.FailIf(errors.New("failed"))
+	op.End()
+
+	assert.Equal(t, []string{"route_success", "route_failure"}, metrics)
+	assert.Equal(t, []string{"route_warning"}, logs)
+	assert.Equal(t, []string{"route_failure"}, alerts)
+	assert.Equal(t, "warning", ops.SeverityWarning.String())
+}
@@ -0,0 +1,61 @@
+package ops
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// timingHeader carries the sender's wall clock time and the time elapsed since
+// the sending Op began (measured with the sender's monotonic clock), in
+// nanoseconds, separated by a semicolon.
+const timingHeader = "X-Ops-Timing"
+
+var clockSkewTolerance int64 = int64(time.Second)
+
+// SetClockSkewTolerance sets how far a remote clock may be ahead of or behind
+// the local one before ops continued with BeginRemote are flagged as
+// clock_skewed. The default is 1 second.
+func SetClockSkewTolerance(tolerance time.Duration) {
+	atomic.StoreInt64(&clockSkewTolerance, int64(tolerance))
+}
+
+func injectTiming(o Op, carrier Carrier) {
+	_o, ok := o.(*op)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	carrier.Set(timingHeader, fmt.Sprintf("%d;%d", now.UnixNano(), now.Sub(_o.start)))
+}
+
+// extractTiming records how this op relates in time to its remote parent.
+// remote_transit is the time between the parent sending the request and this
+// op beginning, according to the two machines' wall clocks. Because those
+// clocks can disagree, negative transit times are clamped to 0. Transit times
+// beyond the configured tolerance in either direction, which means that the
+// remote clock is ahead or that it's behind (or that the request really took
+// that long, which can't be told apart), are attributed to skew: the op is
+// flagged with clock_skewed=true and the transit counts as 0. parent_offset is
+// the time at which this op began relative to the start of its remote parent,
+// computed from the parent's monotonic elapsed time plus the clamped transit,
+// so it never goes negative and isn't inflated by a remote clock that's behind.
+func (o *op) extractTiming(carrier Carrier) {
+	var sentAt, elapsed int64
+	if _, err := fmt.Sscanf(carrier.Get(timingHeader), "%d;%d", &sentAt, &elapsed); err != nil {
+		return
+	}
+	transit := o.start.Sub(time.Unix(0, sentAt))
+	tolerance := time.Duration(atomic.LoadInt64(&clockSkewTolerance))
+	if transit < -tolerance || transit > tolerance {
+		o.ctx.Put("clock_skewed", true)
+		transit = 0
+	} else if transit < 0 {
+		transit = 0
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	o.ctx.Put("remote_transit", transit)
+	o.ctx.Put("parent_offset", time.Duration(elapsed)+transit)
+}
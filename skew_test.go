@@ -0,0 +1,57 @@
+package ops_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockSkew(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "server", "client")
+
+	remoteRequest := func(sentAt time.Time, elapsed time.Duration) {
+		h := make(http.Header)
+		h.Set("X-B3-TraceId", "80f198ee56343ba864fe8b2a57d3eff7")
+		h.Set("X-B3-SpanId", "e457b5a2e4d86bd1")
+		h.Set("X-Ops-Timing", fmt.Sprintf("%d;%d", sentAt.UnixNano(), elapsed))
+		ops.BeginRemote("server", h).End()
+	}
+
+	remoteRequest(time.Now().Add(-10*time.Millisecond), 5*time.Millisecond)
+	assert.Nil(t, reported.Context["clock_skewed"])
+	assert.True(t, reported.Context["remote_transit"].(time.Duration) >= 10*time.Millisecond)
+	assert.True(t, reported.Context["parent_offset"].(time.Duration) >= 15*time.Millisecond)
+
+	// Remote clock slightly ahead, within tolerance
+	remoteRequest(time.Now().Add(100*time.Millisecond), 5*time.Millisecond)
+	assert.Nil(t, reported.Context["clock_skewed"])
+	assert.Equal(t, time.Duration(0), reported.Context["remote_transit"])
+	assert.Equal(t, 5*time.Millisecond, reported.Context["parent_offset"])
+
+	// Remote clock way ahead
+	remoteRequest(time.Now().Add(time.Minute), 5*time.Millisecond)
+	assert.Equal(t, true, reported.Context["clock_skewed"])
+	assert.Equal(t, time.Duration(0), reported.Context["remote_transit"])
+	assert.Equal(t, 5*time.Millisecond, reported.Context["parent_offset"])
+
+	// Remote clock way behind
+	remoteRequest(time.Now().Add(-time.Minute), 5*time.Millisecond)
+	assert.Equal(t, true, reported.Context["clock_skewed"])
+	assert.Equal(t, time.Duration(0), reported.Context["remote_transit"])
+	assert.Equal(t, 5*time.Millisecond, reported.Context["parent_offset"], "offset shouldn't include the skew")
+
+	// Round trip through Inject
+	op := ops.Begin("client")
+	h := make(http.Header)
+	ops.Inject(op, h)
+	ops.BeginRemote("server", h).End()
+	assert.NotNil(t, reported.Context["parent_offset"])
+	op.End()
+}
@@ -0,0 +1,162 @@
+package ops
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// stackTops holds the innermost op begun with the getlantern backend on each
+// goroutine, by goroutine id. It mirrors the context stack, so that exit can
+// check the stack by identity rather than by building the current context's
+// map, which would evaluate all of its dynamic values. Like the context stack
+// itself, it keeps referencing ops that are never ended.
+var stackTops sync.Map
+
+// pushStack makes this op the innermost one on its goroutine.
+func (o *op) pushStack() {
+	if below, ok := stackTops.Load(o.gid); ok {
+		o.below = below.(*op)
+	}
+	stackTops.Store(o.gid, o)
+	o.stacked = true
+}
+
+// popStack makes the op that was innermost before this one innermost again.
+func (o *op) popStack() {
+	if o.below == nil {
+		stackTops.Delete(o.gid)
+	} else {
+		stackTops.Store(o.gid, o.below)
+	}
+}
+
+// innermost returns the innermost op begun with the getlantern backend on the
+// current goroutine, or nil if there is none.
+func innermost() *op {
+	if _, native := cm.(*nativeManager); native {
+		return nil
+	}
+	top, _ := stackTops.Load(curGoroutineID())
+	o, _ := top.(*op)
+	return o
+}
+
+// seedStack wraps fn, which runs on a new goroutine carrying this op's context,
+// so that ops begun by it see this op as the innermost one below them and
+// inherit its lookups. The native backend keeps the parent of the goroutine's
+// context itself, and a nil op leaves fn as is.
+func (o *op) seedStack(fn func()) func() {
+	if o == nil {
+		return fn
+	}
+	if _, native := o.ctx.(*nativeContext); native {
+		return fn
+	}
+	return func() {
+		gid := curGoroutineID()
+		stackTops.Store(gid, o)
+		defer stackTops.Delete(gid)
+		fn()
+	}
+}
+
+// exit pops the op's context from the context stack of the goroutine that
+// began it, making sure not to corrupt the stack when End is called in the
+// wrong place.
+//
+// Both backends pop contexts from the stack of the goroutine that entered
+// them, so ending an op on a different goroutine than Begin is harmless and
+// exit never needs to look up the current goroutine. If ops begun inside this
+// one were never ended, popping this op's context drops theirs too, which
+// restores the stack to what it was before Begin. If the op's context is no
+// longer on the stack at all, the stack is left alone. In both of these cases,
+// a diagnostic report of kind "context_stack_mismatch" is emitted identifying
+// the caller of End.
+func (o *op) exit() {
+	var missing bool
+	var top interface{}
+	if native, ok := cm.(*nativeManager); ok {
+		missing, top = o.checkNativeStack(native)
+	} else {
+		missing, top = o.checkStack()
+	}
+	switch {
+	case missing:
+		// Stack has already been popped past this op, leave it alone
+		o.reportStackMismatch("missing", nil)
+		return
+	case top != nil:
+		o.reportStackMismatch("unended_children", top)
+	}
+	if o.stacked {
+		o.popStack()
+	}
+	o.ctx.Exit()
+}
+
+// checkStack checks the context stack of the goroutine that began this op,
+// returning whether this op's context is no longer on it and, if it isn't on
+// top, the name of the op whose context is.
+func (o *op) checkStack() (missing bool, top interface{}) {
+	if !o.stacked {
+		// Begun with the native backend
+		return false, nil
+	}
+	innermost, _ := stackTops.Load(o.gid)
+	first, _ := innermost.(*op)
+	for current := first; current != nil; current = current.below {
+		if current == o {
+			if first != o {
+				return false, first.name
+			}
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// checkNativeStack is like checkStack for the native backend, which can look
+// at the stack directly.
+func (o *op) checkNativeStack(native *nativeManager) (missing bool, top interface{}) {
+	c := native.current(o.gid)
+	if c == nil {
+		return true, nil
+	}
+	if c != o.ctx {
+		name, _ := c.get("op")
+		return false, name
+	}
+	return false, nil
+}
+
+func (o *op) reportStackMismatch(problem string, found interface{}) {
+	ctx := map[string]interface{}{
+		"stack_problem":  problem,
+		"expected_op":    o.name,
+		"expected_op_id": o.id,
+	}
+	if found != nil {
+		ctx["found_op"] = found
+	}
+	// Skip reportStackMismatch, exit and End
+	if _, file, line, ok := runtime.Caller(3); ok {
+		ctx["caller"] = fmt.Sprintf("%v:%d", file, line)
+	}
+	reportDiagnostic("context_stack_mismatch", ctx)
+}
+
+// curGoroutineID returns the id of the current goroutine, parsed from the
+// header of its stack trace ("goroutine 18 [running]: ...").
+func curGoroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i >= 0 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
@@ -0,0 +1,63 @@
+package ops_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextStackMismatch(t *testing.T) {
+	var mx sync.Mutex
+	var diagnostics []map[string]interface{}
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		if report.Context["diagnostic"] == "context_stack_mismatch" {
+			mx.Lock()
+			diagnostics = append(diagnostics, report.Context)
+			mx.Unlock()
+		}
+	}, ops.DiagnosticOpName)
+
+	// Ending on another goroutine pops the stack of the goroutine that began
+	// the op, which is harmless
+	outer := ops.Begin("stack_outer")
+	moved := ops.Begin("stack_moved")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		moved.End()
+		wg.Done()
+	}()
+	wg.Wait()
+	assert.Equal(t, "stack_outer", ops.AsMap(nil, false)["op"])
+
+	// Ending with an unended child pops back to before the op
+	outer2 := outer.Begin("stack_middle")
+	outer2.Begin("stack_inner")
+	outer2.End()
+	assert.Equal(t, "stack_outer", ops.AsMap(nil, false)["op"])
+	outer.End()
+	assert.Nil(t, ops.AsMap(nil, false)["op"])
+
+	mx.Lock()
+	defer mx.Unlock()
+	if assert.Len(t, diagnostics, 1) {
+		assert.Equal(t, "unended_children", diagnostics[0]["stack_problem"])
+		assert.Equal(t, "stack_middle", diagnostics[0]["expected_op"])
+		assert.Equal(t, "stack_inner", diagnostics[0]["found_op"])
+		assert.True(t, strings.Contains(diagnostics[0]["caller"].(string), "stack_test.go"))
+	}
+}
+
+func TestExitDoesntEvaluateDynamicValues(t *testing.T) {
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {}, "stack_dynamic")
+	evaluations := 0
+	op := ops.Begin("stack_dynamic").SetDynamic("evaluated", func() interface{} {
+		evaluations++
+		return evaluations
+	})
+	op.End()
+	assert.Equal(t, 1, evaluations, "only the report should evaluate dynamic values")
+}
@@ -0,0 +1,86 @@
+package ops
+
+import (
+	stdcontext "context"
+	"net/http"
+	"sync/atomic"
+)
+
+var propagateByContext int32
+
+type opKey struct{}
+
+// SetContextPropagation chooses how BeginContext attaches new Ops to the Op
+// found in a context.Context.
+//
+// By default (false), the new Op is begun with Op.Begin, which relies on the
+// goroutine context stack and is only correct on the goroutine that began the
+// parent or goroutines started with Go. When enabled, the parent's context is
+// copied onto the current goroutine instead, so BeginContext is safe to call
+// from anywhere the context.Context travels, like pre-existing worker pools.
+// The copy is a snapshot, so dynamic values are evaluated at the time of
+// calling BeginContext.
+func SetContextPropagation(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&propagateByContext, value)
+}
+
+// NewContext returns a copy of ctx that carries the given Op.
+func NewContext(ctx stdcontext.Context, o Op) stdcontext.Context {
+	return stdcontext.WithValue(ctx, opKey{}, o)
+}
+
+// FromContext returns the Op carried by ctx, if any.
+func FromContext(ctx stdcontext.Context) (Op, bool) {
+	o, ok := ctx.Value(opKey{}).(Op)
+	return o, ok
+}
+
+// BeginContext begins a new Op under the Op carried by ctx, or a new top-level
+// Op if ctx doesn't carry one, and returns it along with a copy of ctx that
+// carries the new Op. If ctx has a deadline, it becomes the new Op's deadline
+// unless the Op inherits an earlier one. See SetContextPropagation.
+func BeginContext(ctx stdcontext.Context, name string) (Op, stdcontext.Context) {
+	var o Op
+	parent, ok := FromContext(ctx)
+	switch {
+	case !ok:
+		o = Begin(name)
+	case atomic.LoadInt32(&propagateByContext) == 1:
+		if p, isOp := parent.(*op); isOp && p.withinBudget() {
+			o = beginCopied(p, name)
+		} else {
+			o = parent.Begin(name)
+		}
+	default:
+		o = parent.Begin(name)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		o.SetDeadline(deadline)
+	}
+	return o, NewContext(ctx, o)
+}
+
+func beginCopied(parent *op, name string) *op {
+	values := parent.ctx.AsMap(nil, false)
+	ctx := cm.Enter()
+	for key, value := range values {
+		ctx.Put(key, value)
+	}
+	return newOp(ctx, name, parent)
+}
+
+// Handler wraps the given http.Handler so that each request is processed in an
+// Op with the given name, continuing any trace propagated in the request
+// headers (see BeginRemote). The Op is carried in the request's context, so
+// handlers can begin child Ops with BeginContext(req.Context(), name).
+func Handler(name string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		o := BeginRemote(name, req.Header)
+		defer o.End()
+		next.ServeHTTP(resp, req.WithContext(NewContext(req.Context(), o)))
+	})
+}
@@ -0,0 +1,72 @@
+package ops_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextPropagation(t *testing.T) {
+	ops.SetContextPropagation(true)
+	defer ops.SetContextPropagation(false)
+
+	var mx sync.Mutex
+	reported := make(map[string]*ops.Report)
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		mx.Lock()
+		reported[report.Name] = report
+		mx.Unlock()
+	}, "ctx_handler", "ctx_work")
+
+	// A worker pool that exists independently of any request
+	work := make(chan func())
+	defer close(work)
+	go func() {
+		for fn := range work {
+			fn()
+			assert.Empty(t, ops.Current())
+		}
+	}()
+
+	handler := ops.Handler("ctx_handler", http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		op, _ := ops.FromContext(req.Context())
+		op.Set("user", "alice")
+		done := make(chan bool)
+		work <- func() {
+			child, _ := ops.BeginContext(req.Context(), "ctx_work")
+			child.End()
+			done <- true
+		}
+		<-done
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-B3-TraceId", "trace")
+	req.Header.Set("X-B3-SpanId", "span")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	mx.Lock()
+	defer mx.Unlock()
+	server, child := reported["ctx_handler"], reported["ctx_work"]
+	if assert.NotNil(t, server) && assert.NotNil(t, child) {
+		assert.Equal(t, "trace", server.TraceID)
+		assert.Equal(t, "span", server.ParentID)
+		assert.Equal(t, "trace", child.TraceID)
+		assert.Equal(t, server.ID, child.ParentID)
+		assert.Equal(t, "alice", child.Context["user"])
+		assert.Equal(t, "ctx_handler", child.Context["root_op"])
+		assert.Equal(t, "ctx_work", child.Context["op"])
+	}
+}
+
+func TestBeginContextWithoutOp(t *testing.T) {
+	op, ctx := ops.BeginContext(httptest.NewRequest("GET", "/", nil).Context(), "ctx_root")
+	fromCtx, ok := ops.FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, op.ID(), fromCtx.ID())
+	assert.Equal(t, "", op.ParentID())
+	op.End()
+}
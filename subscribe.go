@@ -0,0 +1,119 @@
+package ops
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// subscriptionBuffer is how many reports a subscription buffers before
+// dropping reports.
+const subscriptionBuffer = 1000
+
+type subscription struct {
+	filter func(*Report) bool
+	ch     chan *Report
+	closed bool
+	mx     sync.Mutex
+}
+
+var (
+	subscriptions      = make(map[*subscription]bool)
+	subscriptionsMutex sync.RWMutex
+	subscribeOnce      sync.Once
+)
+
+// Subscribe returns a channel that receives the reports of all Ops for which
+// filter returns true (all Ops if filter is nil), and a function that cancels
+// the subscription and closes the channel. Reports are dropped rather than
+// blocking the reporting goroutine if the subscriber falls behind by more than
+// 1000 reports.
+func Subscribe(filter func(*Report) bool) (<-chan *Report, func()) {
+	subscribeOnce.Do(func() {
+		RegisterStructuredReporter(publish)
+	})
+	sub := &subscription{filter: filter, ch: make(chan *Report, subscriptionBuffer)}
+	subscriptionsMutex.Lock()
+	subscriptions[sub] = true
+	subscriptionsMutex.Unlock()
+
+	cancel := func() {
+		subscriptionsMutex.Lock()
+		delete(subscriptions, sub)
+		subscriptionsMutex.Unlock()
+		sub.mx.Lock()
+		if !sub.closed {
+			sub.closed = true
+			close(sub.ch)
+		}
+		sub.mx.Unlock()
+	}
+	return sub.ch, cancel
+}
+
+func publish(report *Report) {
+	subscriptionsMutex.RLock()
+	defer subscriptionsMutex.RUnlock()
+	var retained *Report
+	for sub := range subscriptions {
+		if sub.filter != nil && !sub.filter(report) {
+			continue
+		}
+		if retained == nil {
+			retained = report.Retain()
+		}
+		sub.mx.Lock()
+		if !sub.closed {
+			select {
+			case sub.ch <- retained:
+			default:
+				// Subscriber is falling behind
+			}
+		}
+		sub.mx.Unlock()
+	}
+}
+
+// StreamHandler returns an http.Handler that streams reports to the client as
+// they're delivered, one report per line in the canonical JSON encoding (see
+// ReportJSONSchema), until the client disconnects. The query parameter name
+// (which may be repeated) limits the stream to ops with those names, and
+// failures=true to failed ops. Serve it on a unix socket or loopback address
+// for tools like cmd/opsctl, since reports may contain sensitive data.
+func StreamHandler() http.Handler {
+	return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		names := make(map[string]bool)
+		for _, name := range req.URL.Query()["name"] {
+			names[name] = true
+		}
+		onlyFailures := req.URL.Query().Get("failures") == "true"
+		reports, cancel := Subscribe(func(report *Report) bool {
+			if len(names) > 0 && !names[report.Name] {
+				return false
+			}
+			return !onlyFailures || !report.Succeeded()
+		})
+		defer cancel()
+
+		resp.Header().Set("Content-Type", "application/x-ndjson")
+		resp.WriteHeader(http.StatusOK)
+		flusher, _ := resp.(http.Flusher)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		enc := json.NewEncoder(resp)
+		for {
+			select {
+			case report := <-reports:
+				if err := enc.Encode(report); err != nil {
+					return
+				}
+				if flusher != nil {
+					flusher.Flush()
+				}
+			case <-req.Context().Done():
+				return
+			}
+		}
+	})
+}
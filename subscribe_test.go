@@ -0,0 +1,73 @@
+package ops_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	failures, cancel := ops.Subscribe(func(report *ops.Report) bool {
+		return report.Name == "test_subscribe" && !report.Succeeded()
+	})
+	all, cancelAll := ops.Subscribe(nil)
+	defer cancelAll()
+
+	ops.Begin("test_subscribe").End()
+	op := ops.Begin("test_subscribe")
+	op.FailIf(errors.New("failed"))
+	op.End()
+
+	report := <-failures
+	assert.Equal(t, "test_subscribe", report.Name)
+	assert.False(t, report.Succeeded())
+	// Other ops may be running in the background, so skip their reports
+	var fromAll []*ops.Report
+	for report := range all {
+		if report.Name == "test_subscribe" {
+			fromAll = append(fromAll, report)
+			if len(fromAll) == 2 {
+				break
+			}
+		}
+	}
+	assert.True(t, fromAll[0].Succeeded())
+	assert.False(t, fromAll[1].Succeeded())
+
+	cancel()
+	cancel()
+	ops.Begin("test_subscribe").End()
+	_, open := <-failures
+	assert.False(t, open)
+}
+
+func TestStreamHandler(t *testing.T) {
+	server := httptest.NewServer(ops.StreamHandler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?name=test_stream&failures=true")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+	ops.Begin("test_stream").End()
+	ops.Begin("test_stream_other").EndWithError(errors.New("other failed"))
+	ops.Begin("test_stream").EndWithError(errors.New("failed"))
+
+	scanner := bufio.NewScanner(resp.Body)
+	if assert.True(t, scanner.Scan()) {
+		report := &ops.Report{}
+		if assert.NoError(t, json.Unmarshal(scanner.Bytes(), report)) {
+			assert.Equal(t, "test_stream", report.Name)
+			assert.EqualError(t, report.Failure, "failed")
+		}
+	}
+}
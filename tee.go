@@ -0,0 +1,39 @@
+package ops
+
+import (
+	"encoding/json"
+	"io"
+	"math/rand"
+	"sync"
+)
+
+// Tee returns a StructuredReporter that duplicates some of the reports it
+// receives to sink, typically for debugging: all reports matching filter (if
+// not nil) and a random fraction (0 to 1) of the others. Register it alongside
+// the primary reporters, which are unaffected, and use something like
+// WriterSink as the sink. Only reports that are delivered at all (see
+// SetSampler) reach the sink.
+func Tee(sink StructuredReporter, fraction float64, filter func(report *Report) bool) StructuredReporter {
+	return func(report *Report) {
+		if (filter != nil && filter(report)) || (fraction > 0 && rand.Float64() < fraction) {
+			sink(report)
+		}
+	}
+}
+
+// WriterSink returns a StructuredReporter that writes reports to w, for
+// example a local file, one report per line in the canonical JSON encoding
+// (see ReportJSONSchema). Reports that can't be encoded or written are
+// dropped.
+func WriterSink(w io.Writer) StructuredReporter {
+	var mx sync.Mutex
+	return func(report *Report) {
+		encoded, err := json.Marshal(report)
+		if err != nil {
+			return
+		}
+		mx.Lock()
+		w.Write(append(encoded, '\n'))
+		mx.Unlock()
+	}
+}
@@ -0,0 +1,52 @@
+package ops_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/getlantern/errors"
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTee(t *testing.T) {
+	var sink bytes.Buffer
+	ops.RegisterStructuredReporterFor(ops.Tee(ops.WriterSink(&sink), 0, func(report *ops.Report) bool {
+		return !report.Succeeded()
+	}), "test_tee")
+	var primary int
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		primary++
+	}, "test_tee")
+
+	ops.Begin("test_tee").End()
+	ops.Begin("test_tee").EndWithError(errors.New("failed"))
+	assert.Equal(t, 2, primary, "primary reporters should get all reports")
+
+	var teed []*ops.Report
+	scanner := bufio.NewScanner(&sink)
+	for scanner.Scan() {
+		report := &ops.Report{}
+		if assert.NoError(t, json.Unmarshal(scanner.Bytes(), report)) {
+			teed = append(teed, report)
+		}
+	}
+	if assert.Len(t, teed, 1) {
+		assert.EqualError(t, teed[0].Failure, "failed")
+	}
+}
+
+func TestTeeFraction(t *testing.T) {
+	var all, none int
+	teeAll := ops.Tee(func(report *ops.Report) { all++ }, 1, nil)
+	teeNone := ops.Tee(func(report *ops.Report) { none++ }, 0, nil)
+	for i := 0; i < 100; i++ {
+		report := &ops.Report{Name: "test_tee_fraction"}
+		teeAll(report)
+		teeNone(report)
+	}
+	assert.Equal(t, 100, all)
+	assert.Equal(t, 0, none)
+}
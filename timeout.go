@@ -0,0 +1,88 @@
+package ops
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SlowReporterStats counts the incidents of a reporter wrapped with
+// ReporterTimeout.
+type SlowReporterStats struct {
+	// Abandoned is the number of calls that didn't return within the timeout.
+	Abandoned int64
+	// Skipped is the number of reports that weren't given to the reporter
+	// because an abandoned call was still running.
+	Skipped int64
+}
+
+var (
+	slowReporters   = make(map[string]*timeoutReporter)
+	slowReportersMx sync.Mutex
+)
+
+type timeoutReporter struct {
+	name      string
+	reporter  StructuredReporter
+	timeout   time.Duration
+	busy      int32 // the number of abandoned calls still running
+	abandoned int64
+	skipped   int64
+}
+
+// ReporterTimeout returns a StructuredReporter that gives each report to
+// reporter but waits at most timeout for it to return, so that a slow
+// reporter (like one blocking on a network write) doesn't hold up the other
+// reporters and the code ending the op. A call that takes longer is abandoned,
+// left to finish in the background, and while it's running further reports
+// are skipped rather than piling up behind it, except for high-priority ones
+// (see PriorityHigh). Incidents are counted under
+// the given name, see SlowReporters. The reporter is given reports that are
+// safe to retain (see Report.Retain).
+func ReporterTimeout(name string, reporter StructuredReporter, timeout time.Duration) StructuredReporter {
+	r := &timeoutReporter{name: name, reporter: reporter, timeout: timeout}
+	slowReportersMx.Lock()
+	slowReporters[name] = r
+	slowReportersMx.Unlock()
+	return r.report
+}
+
+func (r *timeoutReporter) report(report *Report) {
+	if atomic.LoadInt32(&r.busy) > 0 && report.Priority != PriorityHigh {
+		atomic.AddInt64(&r.skipped, 1)
+		return
+	}
+	report = report.Retain()
+	done := make(chan interface{})
+	go func() {
+		defer close(done)
+		r.reporter(report)
+	}()
+	timer := time.NewTimer(r.timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		atomic.AddInt64(&r.abandoned, 1)
+		atomic.AddInt32(&r.busy, 1)
+		go func() {
+			<-done
+			atomic.AddInt32(&r.busy, -1)
+		}()
+	}
+}
+
+// SlowReporters returns the incidents of all reporters wrapped with
+// ReporterTimeout, keyed by their names.
+func SlowReporters() map[string]SlowReporterStats {
+	slowReportersMx.Lock()
+	defer slowReportersMx.Unlock()
+	result := make(map[string]SlowReporterStats, len(slowReporters))
+	for name, r := range slowReporters {
+		result[name] = SlowReporterStats{
+			Abandoned: atomic.LoadInt64(&r.abandoned),
+			Skipped:   atomic.LoadInt64(&r.skipped),
+		}
+	}
+	return result
+}
@@ -0,0 +1,77 @@
+package ops_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReporterTimeout(t *testing.T) {
+	unblock := make(chan interface{})
+	var slowCalls int32
+	ops.RegisterStructuredReporterFor(ops.ReporterTimeout("test_slow", func(report *ops.Report) {
+		if atomic.AddInt32(&slowCalls, 1) == 1 {
+			<-unblock
+		}
+	}, 20*time.Millisecond), "test_timeout")
+	var fastCalls int32
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		atomic.AddInt32(&fastCalls, 1)
+	}, "test_timeout")
+
+	start := time.Now()
+	ops.Begin("test_timeout").End()
+	assert.True(t, time.Since(start) < time.Second, "End shouldn't wait for the slow reporter")
+	ops.Begin("test_timeout").End()
+	assert.EqualValues(t, 2, atomic.LoadInt32(&fastCalls))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&slowCalls), "second report should have been skipped")
+	assert.Equal(t, ops.SlowReporterStats{Abandoned: 1, Skipped: 1}, ops.SlowReporters()["test_slow"])
+
+	// Once the abandoned call returns, reports are delivered again
+	close(unblock)
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&slowCalls) < 2 && time.Now().Before(deadline) {
+		ops.Begin("test_timeout").End()
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.EqualValues(t, 2, atomic.LoadInt32(&slowCalls))
+	assert.EqualValues(t, 1, ops.SlowReporters()["test_slow"].Abandoned)
+}
+
+func TestReporterTimeoutHighPriority(t *testing.T) {
+	var calls int32
+	blocks := []chan interface{}{make(chan interface{}), make(chan interface{})}
+	returned := make(chan interface{}, 2)
+	ops.RegisterStructuredReporterFor(ops.ReporterTimeout("test_slow_priority", func(report *ops.Report) {
+		if call := atomic.AddInt32(&calls, 1); call <= 2 {
+			<-blocks[call-1]
+			returned <- nil
+		}
+	}, 10*time.Millisecond), "test_timeout_priority")
+
+	ops.Begin("test_timeout_priority").End()
+	ops.Begin("test_timeout_priority").SetPriority(ops.PriorityHigh).End()
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls), "high-priority reports shouldn't be skipped")
+
+	// The high-priority call is still running once the first one returns
+	close(blocks[0])
+	<-returned
+	time.Sleep(10 * time.Millisecond)
+	ops.Begin("test_timeout_priority").End()
+	assert.EqualValues(t, 2, atomic.LoadInt32(&calls), "reports should be skipped until every abandoned call returns")
+
+	close(blocks[1])
+	<-returned
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&calls) < 3 && time.Now().Before(deadline) {
+		ops.Begin("test_timeout_priority").End()
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.EqualValues(t, 3, atomic.LoadInt32(&calls))
+	stats := ops.SlowReporters()["test_slow_priority"]
+	assert.EqualValues(t, 2, stats.Abandoned)
+	assert.True(t, stats.Skipped >= 1)
+}
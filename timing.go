@@ -0,0 +1,126 @@
+package ops
+
+import (
+	stdcontext "context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Phases of a request measured by ResourceTiming. Each phase is recorded on
+// the op under its name plus "_duration", for example "dns_duration", so that
+// all components report comparable timing breakdowns for proxied and tunneled
+// requests.
+const (
+	// PhaseDNS is resolving the host name.
+	PhaseDNS = "dns"
+	// PhaseConnect is establishing the connection.
+	PhaseConnect = "connect"
+	// PhaseTLS is the TLS handshake.
+	PhaseTLS = "tls"
+	// PhaseFirstByte is the time from the start of the ResourceTiming until
+	// the first byte of the response, rather than a phase of its own, like
+	// time to first byte in browsers.
+	PhaseFirstByte = "first_byte"
+	// PhaseTotal is the time from the start of the ResourceTiming until End.
+	PhaseTotal = "total"
+)
+
+// ResourceTiming measures the phases of a request, like the resource timing
+// of browsers, recording each phase's duration on an op as it completes.
+// Phases can be marked manually with Start and Done, or for net/http requests
+// with ClientTrace. It's safe for concurrent use.
+type ResourceTiming struct {
+	op      Op
+	start   time.Time
+	started map[string]time.Time
+	done    map[string]bool
+	mx      sync.Mutex
+}
+
+// StartResourceTiming starts measuring the phases of a request made by the
+// given op.
+func StartResourceTiming(op Op) *ResourceTiming {
+	return &ResourceTiming{
+		op:      op,
+		start:   time.Now(),
+		started: make(map[string]time.Time),
+		done:    make(map[string]bool),
+	}
+}
+
+// Start marks the start of the given phase. Only the first start of each phase
+// counts.
+func (t *ResourceTiming) Start(phase string) {
+	t.mx.Lock()
+	if _, found := t.started[phase]; !found {
+		t.started[phase] = time.Now()
+	}
+	t.mx.Unlock()
+}
+
+// Done marks the end of the given phase, recording its duration. Only the
+// first end of each phase counts, and phases that weren't started are timed
+// from the start of the ResourceTiming.
+func (t *ResourceTiming) Done(phase string) {
+	now := time.Now()
+	t.mx.Lock()
+	defer t.mx.Unlock()
+	if t.done[phase] {
+		return
+	}
+	t.done[phase] = true
+	start, found := t.started[phase]
+	if !found {
+		start = t.start
+	}
+	t.op.Set(phase+"_duration", now.Sub(start))
+}
+
+// FirstByte marks the arrival of the first byte of the response.
+func (t *ResourceTiming) FirstByte() {
+	t.Done(PhaseFirstByte)
+}
+
+// End records the total duration.
+func (t *ResourceTiming) End() {
+	t.Done(PhaseTotal)
+}
+
+// ClientTrace returns an httptrace.ClientTrace that marks the phases of a
+// net/http request. Connections that are reused skip the dns, connect and tls
+// phases and set "connection_reused".
+func (t *ResourceTiming) ClientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.Start(PhaseDNS) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.Done(PhaseDNS) },
+		ConnectStart: func(network, addr string) {
+			t.Start(PhaseConnect)
+		},
+		ConnectDone: func(network, addr string, err error) {
+			// With multiple addresses, dialing may fall back to others
+			if err == nil {
+				t.Done(PhaseConnect)
+			}
+		},
+		TLSHandshakeStart: func() { t.Start(PhaseTLS) },
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err == nil {
+				t.Done(PhaseTLS)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				t.op.Set("connection_reused", true)
+			}
+		},
+		GotFirstResponseByte: t.FirstByte,
+	}
+}
+
+// WithClientTrace returns ctx with ClientTrace attached, for use with
+// http.Request.WithContext.
+func (t *ResourceTiming) WithClientTrace(ctx stdcontext.Context) stdcontext.Context {
+	return httptrace.WithClientTrace(ctx, t.ClientTrace())
+}
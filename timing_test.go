@@ -0,0 +1,64 @@
+package ops_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResourceTimingManual(t *testing.T) {
+	op := ops.Begin("timing_manual")
+	defer op.End()
+	timing := ops.StartResourceTiming(op)
+	timing.Start(ops.PhaseConnect)
+	time.Sleep(10 * time.Millisecond)
+	timing.Done(ops.PhaseConnect)
+	timing.Done(ops.PhaseConnect)
+	timing.FirstByte()
+	timing.End()
+
+	ctx := op.Snapshot()
+	connect := ctx["connect_duration"].(time.Duration)
+	assert.True(t, connect >= 10*time.Millisecond, "connect %v", connect)
+	assert.True(t, ctx["first_byte_duration"].(time.Duration) >= connect)
+	assert.True(t, ctx["total_duration"].(time.Duration) >= ctx["first_byte_duration"].(time.Duration))
+	assert.NotContains(t, ctx, "dns_duration")
+}
+
+func TestResourceTimingHTTP(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	client := server.Client()
+
+	get := func(name string) ops.Map {
+		op := ops.Begin(name)
+		defer op.End()
+		timing := ops.StartResourceTiming(op)
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req.WithContext(timing.WithClientTrace(req.Context())))
+		if assert.NoError(t, err) {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		timing.End()
+		return op.Snapshot()
+	}
+
+	ctx := get("timing_http")
+	for _, key := range []string{"connect_duration", "tls_duration", "first_byte_duration", "total_duration"} {
+		assert.IsType(t, time.Duration(0), ctx[key], key)
+	}
+	assert.NotContains(t, ctx, "connection_reused")
+
+	ctx = get("timing_http_reused")
+	assert.Equal(t, true, ctx["connection_reused"])
+	assert.NotContains(t, ctx, "tls_duration")
+	assert.Contains(t, ctx, "first_byte_duration")
+}
@@ -0,0 +1,176 @@
+package ops
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Kind is the type of a Value.
+type Kind int
+
+const (
+	// KindOther is any value that isn't one of the other kinds. Exporters
+	// typically format it as a string.
+	KindOther Kind = iota
+	KindString
+	KindInt64
+	KindFloat64
+	KindBool
+	KindTime
+	KindDuration
+)
+
+var kindNames = []string{"other", "string", "int64", "float64", "bool", "time", "duration"}
+
+func (k Kind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+	return kindNames[k]
+}
+
+// Value is a context value normalized to one of a small number of kinds, so
+// that exporters can map values to the appropriate backend types without
+// switching on every Go type. All signed and unsigned integers become
+// KindInt64 (unsigned integers that overflow int64 become KindFloat64) and
+// float32 becomes KindFloat64. time.Duration is kept distinct from integers.
+type Value struct {
+	kind Kind
+	num  int64
+	flt  float64
+	str  string
+	tm   time.Time
+	any  interface{}
+}
+
+// ValueOf normalizes the given value.
+func ValueOf(v interface{}) Value {
+	switch t := v.(type) {
+	case string:
+		return Value{kind: KindString, str: t}
+	case bool:
+		if t {
+			return Value{kind: KindBool, num: 1}
+		}
+		return Value{kind: KindBool}
+	case time.Duration:
+		return Value{kind: KindDuration, num: int64(t)}
+	case time.Time:
+		return Value{kind: KindTime, tm: t}
+	case int:
+		return Value{kind: KindInt64, num: int64(t)}
+	case int8:
+		return Value{kind: KindInt64, num: int64(t)}
+	case int16:
+		return Value{kind: KindInt64, num: int64(t)}
+	case int32:
+		return Value{kind: KindInt64, num: int64(t)}
+	case int64:
+		return Value{kind: KindInt64, num: t}
+	case uint:
+		return unsignedValue(uint64(t))
+	case uint8:
+		return Value{kind: KindInt64, num: int64(t)}
+	case uint16:
+		return Value{kind: KindInt64, num: int64(t)}
+	case uint32:
+		return Value{kind: KindInt64, num: int64(t)}
+	case uint64:
+		return unsignedValue(t)
+	case float32:
+		return Value{kind: KindFloat64, flt: float64(t)}
+	case float64:
+		return Value{kind: KindFloat64, flt: t}
+	default:
+		return Value{kind: KindOther, any: v}
+	}
+}
+
+func unsignedValue(u uint64) Value {
+	if u > math.MaxInt64 {
+		return Value{kind: KindFloat64, flt: float64(u)}
+	}
+	return Value{kind: KindInt64, num: int64(u)}
+}
+
+// Kind returns the kind of the value.
+func (v Value) Kind() Kind { return v.kind }
+
+// Int64 returns the value of a KindInt64 or KindDuration Value, or 0.
+func (v Value) Int64() int64 {
+	if v.kind == KindInt64 || v.kind == KindDuration {
+		return v.num
+	}
+	return 0
+}
+
+// Float64 returns the value of a numeric Value as a float64, or 0.
+func (v Value) Float64() float64 {
+	switch v.kind {
+	case KindFloat64:
+		return v.flt
+	case KindInt64, KindDuration:
+		return float64(v.num)
+	}
+	return 0
+}
+
+// Bool returns the value of a KindBool Value, or false.
+func (v Value) Bool() bool { return v.kind == KindBool && v.num == 1 }
+
+// Time returns the value of a KindTime Value, or the zero time.
+func (v Value) Time() time.Time { return v.tm }
+
+// Duration returns the value of a KindDuration Value, or 0.
+func (v Value) Duration() time.Duration {
+	if v.kind == KindDuration {
+		return time.Duration(v.num)
+	}
+	return 0
+}
+
+// String returns the value formatted as a string. Times are formatted as
+// RFC 3339 with nanoseconds.
+func (v Value) String() string {
+	switch v.kind {
+	case KindString:
+		return v.str
+	case KindTime:
+		return v.tm.Format(time.RFC3339Nano)
+	case KindOther:
+		return fmt.Sprint(v.any)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// Interface returns the normalized value as an interface{}: a string, int64,
+// float64, bool, time.Time, time.Duration or, for KindOther, the original
+// value.
+func (v Value) Interface() interface{} {
+	switch v.kind {
+	case KindString:
+		return v.str
+	case KindInt64:
+		return v.num
+	case KindFloat64:
+		return v.flt
+	case KindBool:
+		return v.Bool()
+	case KindTime:
+		return v.tm
+	case KindDuration:
+		return time.Duration(v.num)
+	}
+	return v.any
+}
+
+// TypedContext returns the report's context with all values normalized by
+// ValueOf.
+func (r *Report) TypedContext() map[string]Value {
+	result := make(map[string]Value, len(r.Context))
+	for key, value := range r.Context {
+		result[key] = ValueOf(value)
+	}
+	return result
+}
@@ -0,0 +1,58 @@
+package ops_test
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueOf(t *testing.T) {
+	now := time.Now()
+	type custom struct{ a int }
+	for _, test := range []struct {
+		in   interface{}
+		kind ops.Kind
+		out  interface{}
+	}{
+		{"s", ops.KindString, "s"},
+		{5, ops.KindInt64, int64(5)},
+		{int8(-5), ops.KindInt64, int64(-5)},
+		{uint32(5), ops.KindInt64, int64(5)},
+		{uint64(math.MaxUint64), ops.KindFloat64, float64(math.MaxUint64)},
+		{float32(1.5), ops.KindFloat64, 1.5},
+		{true, ops.KindBool, true},
+		{false, ops.KindBool, false},
+		{now, ops.KindTime, now},
+		{time.Second, ops.KindDuration, time.Second},
+		{custom{1}, ops.KindOther, custom{1}},
+	} {
+		v := ops.ValueOf(test.in)
+		assert.Equal(t, test.kind, v.Kind(), "%v", test.in)
+		assert.Equal(t, test.out, v.Interface(), "%v", test.in)
+	}
+
+	assert.Equal(t, int64(1000000000), ops.ValueOf(time.Second).Int64())
+	assert.Equal(t, 5.0, ops.ValueOf(5).Float64())
+	assert.Equal(t, "5", ops.ValueOf(uint(5)).String())
+	assert.Equal(t, "1s", ops.ValueOf(time.Second).String())
+	assert.Equal(t, int64(0), ops.ValueOf("5").Int64())
+	assert.Equal(t, "duration", ops.KindDuration.String())
+}
+
+func TestTypedContext(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "test_typed")
+	ops.Begin("test_typed").Set("bytes", uint16(10)).Set("elapsed", time.Millisecond).End()
+
+	typed := reported.TypedContext()
+	assert.Equal(t, ops.KindInt64, typed["bytes"].Kind())
+	assert.Equal(t, int64(10), typed["bytes"].Int64())
+	assert.Equal(t, ops.KindDuration, typed["elapsed"].Kind())
+	assert.Equal(t, ops.KindString, typed["op"].Kind())
+	assert.Equal(t, ops.KindInt64, typed["schema_version"].Kind())
+}
@@ -0,0 +1,40 @@
+package ops
+
+import (
+	"sync/atomic"
+)
+
+var recordingGoroutineIDs int32
+
+// SetRecordGoroutineIDs chooses whether reports include the id of the
+// goroutine whose context stack the op is on, normally the one that began it,
+// under the key "goroutine_id" (default false).
+// Together with worker ids (see EnterWorker), this helps diagnose concurrency
+// problems like one goroutine handling overlapping ops or head-of-line
+// blocking. Goroutine ids are only meaningful within a process and get reused
+// over time.
+func SetRecordGoroutineIDs(enabled bool) {
+	var value int32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreInt32(&recordingGoroutineIDs, value)
+}
+
+// EnterWorker marks the current goroutine as the worker with the given id,
+// typically at the top of a worker pool's goroutine, so that all ops begun on
+// it record the id under the key "worker_id". Call the returned function when
+// the goroutine stops working, typically with defer:
+//
+//	defer ops.EnterWorker(fmt.Sprintf("fetcher-%d", i))()
+func EnterWorker(id string) func() {
+	ctx := cm.Enter()
+	ctx.Put("worker_id", id)
+	return ctx.Exit
+}
+
+func (o *op) recordGoroutineID(ctx map[string]interface{}) {
+	if atomic.LoadInt32(&recordingGoroutineIDs) == 1 {
+		ctx["goroutine_id"] = o.gid
+	}
+}
@@ -0,0 +1,31 @@
+package ops_test
+
+import (
+	"testing"
+
+	"github.com/getlantern/ops"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkerAndGoroutineIDs(t *testing.T) {
+	var reported *ops.Report
+	ops.RegisterStructuredReporterFor(func(report *ops.Report) {
+		reported = report
+	}, "worker_task")
+
+	done := make(chan interface{})
+	go func() {
+		defer close(done)
+		defer ops.EnterWorker("worker-1")()
+		ops.Begin("worker_task").End()
+	}()
+	<-done
+	assert.Equal(t, "worker-1", reported.Context["worker_id"])
+	assert.Nil(t, reported.Context["goroutine_id"], "goroutine ids should be off by default")
+
+	ops.SetRecordGoroutineIDs(true)
+	defer ops.SetRecordGoroutineIDs(false)
+	ops.Begin("worker_task").End()
+	assert.NotZero(t, reported.Context["goroutine_id"])
+	assert.Nil(t, reported.Context["worker_id"])
+}